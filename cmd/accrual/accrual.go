@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/paxren/go-musthave-diploma-tpl/internal/accrual"
+	"github.com/paxren/go-musthave-diploma-tpl/internal/config"
+	"github.com/paxren/go-musthave-diploma-tpl/internal/logger"
+)
+
+var (
+	accrualConfig = config.NewAccrualConfig()
+)
+
+func init() {
+	accrualConfig.Init()
+}
+
+// fatalError логирует критическую ошибку и завершает приложение с кодом 1
+func fatalError(logger *slog.Logger, message string, err error) {
+	logger.Error(message, "error", err)
+	fmt.Fprintf(os.Stderr, "FATAL: %s: %v\n", message, err)
+	os.Exit(1)
+}
+
+func main() {
+	rootCtx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	finish := make([]func() error, 0, 1)
+
+	accrualConfig.Parse()
+
+	fmt.Println()
+	fmt.Println(accrualConfig)
+
+	appLogger := logger.New()
+	logger.SetDefault(appLogger)
+
+	// Без адреса базы данных данные хранятся в памяти, этого достаточно для локальной разработки
+	var storage accrual.Storage
+	if accrualConfig.DatabaseURI != "" {
+		postgresStorage, err := accrual.NewPostgresStorage(accrualConfig.DatabaseURI)
+		if err != nil {
+			fatalError(appLogger, "PostgreSQL не инициализирована", err)
+		}
+		finish = append(finish, postgresStorage.Close)
+		storage = postgresStorage
+	} else {
+		appLogger.Warn("DATABASE_URI не задан, данные хранятся в памяти")
+		storage = accrual.NewMemStorage()
+	}
+
+	processor := accrual.NewProcessor(storage)
+	processor.SetLogger(appLogger)
+	processor.SetInterval(accrualConfig.ProcessInterval)
+	processor.Start(rootCtx)
+	defer processor.Stop()
+
+	api := accrual.NewServer(storage)
+	api.SetLogger(appLogger)
+	api.SetRateLimit(accrualConfig.RateLimit)
+
+	server := &http.Server{
+		Addr:    accrualConfig.RunAddress.String(),
+		Handler: api.Routes(),
+	}
+
+	go func() {
+		err := server.ListenAndServe()
+		if err != nil && err != http.ErrServerClosed {
+			fatalError(appLogger, "Ошибка при запуске сервера", err)
+		}
+	}()
+
+	appLogger.Info("Запуск системы расчета начислений", "address", accrualConfig.RunAddress.String())
+
+	<-rootCtx.Done()
+	appLogger.Info("Получен сигнал завершения, остановка сервера")
+	stop()
+
+	if err := server.Shutdown(context.Background()); err != nil {
+		appLogger.Error("Ошибка при остановке сервера", "error", err)
+	}
+
+	for _, f := range finish {
+		if err := f(); err != nil {
+			appLogger.Error("Ошибка при выполнении финализатора", "error", err)
+		}
+	}
+
+	appLogger.Info("Сервер успешно остановлен")
+}
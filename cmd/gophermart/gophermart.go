@@ -33,6 +33,81 @@ func fatalError(logger *slog.Logger, message string, err error) {
 	os.Exit(1)
 }
 
+// newJWTService создает JWT сервис по конфигурации: с асимметричными ключами, если задан
+// файл закрытого ключа, иначе с секретным ключом
+func newJWTService(cfg *config.ServerConfig) (*auth.JWTService, error) {
+	if cfg.JWTPrivateKeyFile == "" {
+		return auth.NewJWTService(cfg.JWTSecret), nil
+	}
+
+	signingKey, err := auth.LoadSigningKeyFile(cfg.JWTPrivateKeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	verificationKeys := make([]*auth.SigningKey, 0, len(cfg.JWTPublicKeyFiles))
+	for _, path := range cfg.JWTPublicKeyFiles {
+		key, err := auth.LoadVerificationKeyFile(path)
+		if err != nil {
+			return nil, err
+		}
+		verificationKeys = append(verificationKeys, key)
+	}
+
+	return auth.NewJWTServiceWithKeys(signingKey, verificationKeys...)
+}
+
+// storages хранилища данных, выбранные конфигурацией
+type storages struct {
+	users       repository.UsersBase
+	orders      repository.OrderBase
+	idempotency repository.IdempotencyBase
+	sessions    repository.SessionBase
+	// close закрывает соединение с базой, nil - закрывать нечего
+	close func() error
+}
+
+// newStorages создает хранилища по конфигурации: PostgreSQL, файл SQLite или память.
+// Данные в памяти теряются при остановке сервера
+func newStorages(cfg *config.ServerConfig) (*storages, error) {
+	switch cfg.StorageBackend {
+	case config.StorageBackendSQLite:
+		sqliteCon, err := repository.MakeSQLiteStorage(cfg.DatabaseURI)
+		if err != nil {
+			return nil, fmt.Errorf("SQLite не инициализирована: %w", err)
+		}
+		return &storages{
+			users:       repository.MakeUserSQLiteStorage(sqliteCon),
+			orders:      repository.MakeOrderSQLiteStorage(sqliteCon),
+			idempotency: repository.MakeIdempotencySQLiteStorage(sqliteCon),
+			sessions:    repository.MakeSessionSQLiteStorage(sqliteCon),
+			close:       sqliteCon.Close,
+		}, nil
+	case config.StorageBackendMemory:
+		users := repository.MakeUserMemStorage()
+		sessions := repository.MakeSessionMemStorage()
+		users.SetSessions(sessions)
+		return &storages{
+			users:       users,
+			orders:      repository.MakeOrderMemStorage(),
+			idempotency: repository.MakeIdempotencyMemStorage(),
+			sessions:    sessions,
+		}, nil
+	default:
+		postgresCon, err := repository.MakePostgresStorage(cfg.DatabaseURI)
+		if err != nil {
+			return nil, fmt.Errorf("PostgreSQL не инициализирована: %w", err)
+		}
+		return &storages{
+			users:       repository.MakeUserPostgresStorage(postgresCon),
+			orders:      repository.MakeOrderPostgresStorage(postgresCon),
+			idempotency: repository.MakeIdempotencyPostgresStorage(postgresCon),
+			sessions:    repository.MakeSessionPostgresStorage(postgresCon),
+			close:       postgresCon.Close,
+		}, nil
+	}
+}
+
 func main() {
 	//обработка сигтерм, по статье https://habr.com/ru/articles/908344/
 	rootCtx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
@@ -48,20 +123,42 @@ func main() {
 	appLogger := logger.New()
 	logger.SetDefault(appLogger)
 
-	postgresCon, err := repository.MakePostgresStorage(serverConfig.DatabaseURI)
+	if err := serverConfig.Validate(); err != nil {
+		fatalError(appLogger, "Некорректная конфигурация", err)
+	}
+	if serverConfig.DevMode {
+		appLogger.Warn("Включен режим разработки, проверка стойкости секрета JWT отключена")
+	}
+
+	stores, err := newStorages(serverConfig)
 	if err != nil {
-		fatalError(appLogger, "PostgreSQL не инициализирована", err)
+		fatalError(appLogger, "Хранилище не инициализировано", err)
+	}
+	if stores.close != nil {
+		finish = append(finish, stores.close)
+	}
+	if serverConfig.StorageBackend == config.StorageBackendMemory {
+		appLogger.Warn("Данные хранятся в памяти и будут потеряны при остановке сервера")
 	}
-	finish = append(finish, postgresCon.Close)
 
-	usersStorage := repository.MakeUserPostgresStorage(postgresCon)
-	ordersStorage := repository.MakeOrderPostgresStorage(postgresCon)
+	usersStorage := stores.users
+	ordersStorage := stores.orders
+	idempotencyStorage := stores.idempotency
+	sessionStorage := stores.sessions
 
-	// Создаем JWT сервис с секретным ключом из конфигурации
-	jwtService := auth.NewJWTService(serverConfig.JWTSecret)
+	jwtService, err := newJWTService(serverConfig)
+	if err != nil {
+		fatalError(appLogger, "Ошибка при загрузке ключей JWT", err)
+	}
 
-	authMidl := handler.MakeAuthorizer(usersStorage, jwtService)
-	handlerv := handler.NewHandler(usersStorage, ordersStorage, jwtService)
+	userCache := handler.NewUserCache(handler.DefaultUserCacheTTL)
+	authMidl := handler.MakeAuthorizer(sessionStorage, jwtService, userCache)
+	handlerv := handler.NewHandler(usersStorage, ordersStorage, idempotencyStorage, sessionStorage, jwtService)
+	handlerv.SetUserCache(userCache)
+	handlerv.SetPasswordPolicy(auth.PasswordPolicy{
+		MinLength:  serverConfig.PasswordMinLength,
+		MinClasses: serverConfig.PasswordMinClasses,
+	})
 	r := chi.NewRouter()
 
 	// Создаем клиент для взаимодействия с accrual системой
@@ -71,19 +168,35 @@ func main() {
 	// Создаем сервис опроса статусов заказов
 	pollingService := services.NewAccrualPollingService(accrualClient, ordersStorage)
 	pollingService.SetLogger(appLogger)
+	pollingService.SetWorkers(serverConfig.AccrualPollWorkers)
+	pollingService.SetGiveUpAttempts(serverConfig.AccrualGiveUp)
+	pollingService.SetTickTimeout(serverConfig.AccrualPollTimeout)
 
 	// Запускаем сервис опроса
-	pollingService.Start()
+	pollingService.Start(rootCtx)
 	defer pollingService.Stop()
 
+	r.Get(`/.well-known/jwks.json`, handlerv.JWKS)
 	r.Post(`/api/user/register`, handlerv.RegisterUser)
 	r.Post(`/api/user/login`, handlerv.LoginUser)
+	r.Post(`/api/user/token/refresh`, handlerv.RefreshToken)
+	r.Post(`/api/user/logout`, authMidl.AuthMiddleware(handlerv.Logout))
+	r.Put(`/api/user/password`, authMidl.AuthMiddleware(handlerv.ChangePassword))
 	r.Post(`/api/user/orders`, authMidl.AuthMiddleware(handlerv.AddOrder))
 	r.Get(`/api/user/orders`, authMidl.AuthMiddleware(handlerv.GetOrders))
 	r.Get(`/api/user/balance`, authMidl.AuthMiddleware(handlerv.GetBalance))
-	r.Post(`/api/user/balance/withdraw`, authMidl.AuthMiddleware(handlerv.WithdrawBalance))
+	r.Post(`/api/user/balance/withdraw`, authMidl.AuthMiddleware(handlerv.Idempotent(handlerv.WithdrawBalance)))
 	r.Get(`/api/user/withdrawals`, authMidl.AuthMiddleware(handlerv.GetWithdrawals))
 
+	// Прием уведомлений accrual системы включается секретом подписи, опрос при этом продолжает работать
+	if serverConfig.AccrualCallbackSecret != "" {
+		accrualUpdater := services.NewAccrualUpdater(ordersStorage)
+		accrualUpdater.SetLogger(appLogger)
+		accrualCallback := handler.NewAccrualCallback(ordersStorage, accrualUpdater, serverConfig.AccrualCallbackSecret)
+		r.Post(`/internal/accrual/callback`, accrualCallback.Callback)
+		appLogger.Info("Включен прием уведомлений accrual системы", "path", "/internal/accrual/callback")
+	}
+
 	server := &http.Server{
 		Addr:    serverConfig.RunAddress.String(),
 		Handler: r,
@@ -0,0 +1,129 @@
+package accrual
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/paxren/go-musthave-diploma-tpl/internal/money"
+)
+
+// Типы вознаграждения механики
+const (
+	RewardTypePercent = "%"  // процент от стоимости товара
+	RewardTypePoints  = "pt" // точное количество баллов
+)
+
+// Статусы расчета начисления за заказ
+const (
+	StatusRegistered = "REGISTERED"
+	StatusInvalid    = "INVALID"
+	StatusProcessing = "PROCESSING"
+	StatusProcessed  = "PROCESSED"
+)
+
+var (
+	ErrMatchExists   = errors.New("ключ поиска уже зарегистрирован")
+	ErrOrderExists   = errors.New("заказ уже принят в обработку")
+	ErrOrderNotFound = errors.New("заказ не зарегистрирован")
+	ErrInvalidInput  = errors.New("неверный формат запроса")
+)
+
+// maxDecimalExponent ограничивает экспоненту в ценах и вознаграждениях,
+// чтобы разбор числа вроде 1e1000000000 не занимал память
+const maxDecimalExponent = 30
+
+var (
+	decimalPattern = regexp.MustCompile(`^-?(?:0|[1-9][0-9]*)(?:\.[0-9]+)?(?:[eE]([+-]?[0-9]+))?$`)
+	orderPattern   = regexp.MustCompile(`^[0-9]+$`)
+)
+
+// Mechanic механика вознаграждения за товары, в наименовании которых встречается Match
+type Mechanic struct {
+	Match      string      `json:"match"`
+	Reward     json.Number `json:"reward"`
+	RewardType string      `json:"reward_type"`
+}
+
+// Validate проверяет механику, полученную от менеджера
+func (m Mechanic) Validate() error {
+	if m.Match == "" {
+		return fmt.Errorf("%w: пустой ключ поиска", ErrInvalidInput)
+	}
+	if m.RewardType != RewardTypePercent && m.RewardType != RewardTypePoints {
+		return fmt.Errorf("%w: неизвестный тип вознаграждения %q", ErrInvalidInput, m.RewardType)
+	}
+	if _, err := parseDecimal(m.Reward); err != nil {
+		return fmt.Errorf("%w: reward: %v", ErrInvalidInput, err)
+	}
+	return nil
+}
+
+// Good товар в составе заказа. Цена хранится в том виде, в каком пришла, и при расчете
+// разбирается без потери точности
+type Good struct {
+	Description string      `json:"description"`
+	Price       json.Number `json:"price"`
+}
+
+// Order заказ, зарегистрированный для расчета начисления
+type Order struct {
+	Number    string
+	Status    string
+	Accrual   *money.Amount // nil - начисления нет или расчет не окончен
+	Goods     []Good
+	CreatedAt time.Time
+}
+
+// OrderRequest тело запроса регистрации заказа
+type OrderRequest struct {
+	Order string `json:"order"`
+	Goods []Good `json:"goods"`
+}
+
+// Validate проверяет заказ, полученный от магазина
+func (r OrderRequest) Validate() error {
+	if !orderPattern.MatchString(r.Order) {
+		return fmt.Errorf("%w: номер заказа должен состоять из цифр", ErrInvalidInput)
+	}
+	for i, good := range r.Goods {
+		if _, err := parseDecimal(good.Price); err != nil {
+			return fmt.Errorf("%w: goods[%d].price: %v", ErrInvalidInput, i, err)
+		}
+	}
+	return nil
+}
+
+// OrderResponse ответ на запрос информации о расчете начисления
+type OrderResponse struct {
+	Order   string        `json:"order"`
+	Status  string        `json:"status"`
+	Accrual *money.Amount `json:"accrual,omitempty"`
+}
+
+// parseDecimal точно разбирает неотрицательное десятичное число
+func parseDecimal(n json.Number) (*big.Rat, error) {
+	m := decimalPattern.FindStringSubmatch(string(n))
+	if m == nil {
+		return nil, fmt.Errorf("%q не является числом", n)
+	}
+	if m[1] != "" {
+		exp, err := strconv.Atoi(m[1])
+		if err != nil || exp > maxDecimalExponent || exp < -maxDecimalExponent {
+			return nil, fmt.Errorf("слишком большая экспонента в %q", n)
+		}
+	}
+
+	r, ok := new(big.Rat).SetString(string(n))
+	if !ok {
+		return nil, fmt.Errorf("%q не является числом", n)
+	}
+	if r.Sign() < 0 {
+		return nil, fmt.Errorf("отрицательное значение %q", n)
+	}
+	return r, nil
+}
@@ -0,0 +1,203 @@
+package accrual
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/paxren/go-musthave-diploma-tpl/internal/money"
+	"github.com/paxren/go-musthave-diploma-tpl/internal/repository"
+)
+
+// migrationsSource расположение файлов миграций системы расчета начислений
+var migrationsSource = "file://./migrations/accrual"
+
+// PostgresStorage хранилище в PostgreSQL
+type PostgresStorage struct {
+	db *sql.DB
+}
+
+// NewPostgresStorage подключается к PostgreSQL и применяет миграции accrual
+func NewPostgresStorage(con string) (*PostgresStorage, error) {
+	db, err := repository.OpenPostgres(con, migrationsSource, "schema_migrations_accrual")
+	if err != nil {
+		return nil, err
+	}
+	return &PostgresStorage{db: db}, nil
+}
+
+// Close закрывает соединение с базой
+func (st *PostgresStorage) Close() error {
+	return st.db.Close()
+}
+
+func (st *PostgresStorage) AddMechanic(ctx context.Context, mechanic Mechanic) error {
+	query := `
+		INSERT INTO accrual_mechanics (match, reward, reward_type)
+		VALUES ($1, $2::text::numeric, $3)
+		ON CONFLICT (match) DO NOTHING
+	`
+	result, err := st.db.ExecContext(ctx, query, mechanic.Match, mechanic.Reward.String(), mechanic.RewardType)
+	if err != nil {
+		return fmt.Errorf("ошибка при добавлении механики: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("ошибка при получении количества добавленных строк: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrMatchExists
+	}
+	return nil
+}
+
+func (st *PostgresStorage) Mechanics(ctx context.Context) ([]Mechanic, error) {
+	rows, err := st.db.QueryContext(ctx, "SELECT match, reward::text, reward_type FROM accrual_mechanics")
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении механик: %w", err)
+	}
+	defer rows.Close()
+
+	var mechanics []Mechanic
+	for rows.Next() {
+		var mechanic Mechanic
+		var reward string
+		if err := rows.Scan(&mechanic.Match, &reward, &mechanic.RewardType); err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании механики: %w", err)
+		}
+		mechanic.Reward = json.Number(reward)
+		mechanics = append(mechanics, mechanic)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при итерации по механикам: %w", err)
+	}
+	return mechanics, nil
+}
+
+func (st *PostgresStorage) RegisterOrder(ctx context.Context, number string, goods []Good) error {
+	if goods == nil {
+		goods = []Good{}
+	}
+	goodsJSON, err := json.Marshal(goods)
+	if err != nil {
+		return fmt.Errorf("ошибка при сериализации товаров: %w", err)
+	}
+
+	query := `
+		INSERT INTO accrual_orders (number, status, goods)
+		VALUES ($1, $2, $3::text::jsonb)
+		ON CONFLICT (number) DO NOTHING
+	`
+	result, err := st.db.ExecContext(ctx, query, number, StatusRegistered, string(goodsJSON))
+	if err != nil {
+		return fmt.Errorf("ошибка при регистрации заказа: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("ошибка при получении количества добавленных строк: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrOrderExists
+	}
+	return nil
+}
+
+func (st *PostgresStorage) GetOrder(ctx context.Context, number string) (*Order, error) {
+	query := `
+		SELECT number, status, accrual, goods::text, created_at
+		FROM accrual_orders
+		WHERE number = $1
+	`
+	order, err := scanOrder(st.db.QueryRowContext(ctx, query, number))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrOrderNotFound
+		}
+		return nil, fmt.Errorf("ошибка при получении заказа: %w", err)
+	}
+	return order, nil
+}
+
+func (st *PostgresStorage) OrdersWithStatus(ctx context.Context, status string, limit int) ([]Order, error) {
+	query := `
+		SELECT number, status, accrual, goods::text, created_at
+		FROM accrual_orders
+		WHERE status = $1
+		ORDER BY created_at ASC
+		LIMIT $2
+	`
+	rows, err := st.db.QueryContext(ctx, query, status, limit)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении заказов: %w", err)
+	}
+	defer rows.Close()
+
+	var orders []Order
+	for rows.Next() {
+		order, err := scanOrder(rows)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании заказа: %w", err)
+		}
+		orders = append(orders, *order)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при итерации по заказам: %w", err)
+	}
+	return orders, nil
+}
+
+func (st *PostgresStorage) UpdateOrder(ctx context.Context, number, status string, accrual *money.Amount) error {
+	var value interface{}
+	if accrual != nil {
+		value = *accrual
+	}
+
+	query := `
+		UPDATE accrual_orders
+		SET status = $1, accrual = $2, updated_at = CURRENT_TIMESTAMP
+		WHERE number = $3
+	`
+	result, err := st.db.ExecContext(ctx, query, status, value, number)
+	if err != nil {
+		return fmt.Errorf("ошибка при обновлении заказа: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("ошибка при получении количества обновленных строк: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrOrderNotFound
+	}
+	return nil
+}
+
+// rowScanner общий интерфейс sql.Row и sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanOrder читает заказ из строки результата
+func scanOrder(row rowScanner) (*Order, error) {
+	var order Order
+	var accrual sql.NullInt64
+	var goods string
+
+	if err := row.Scan(&order.Number, &order.Status, &accrual, &goods, &order.CreatedAt); err != nil {
+		return nil, err
+	}
+	if accrual.Valid {
+		value := money.FromKopecks(uint64(accrual.Int64))
+		order.Accrual = &value
+	}
+	if err := json.Unmarshal([]byte(goods), &order.Goods); err != nil {
+		return nil, fmt.Errorf("ошибка при разборе товаров заказа: %w", err)
+	}
+	return &order, nil
+}
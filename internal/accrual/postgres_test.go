@@ -0,0 +1,60 @@
+package accrual
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPostgresStorage(t *testing.T) {
+	uri := os.Getenv("TEST_DATABASE_URI")
+	if uri == "" {
+		t.Skip("TEST_DATABASE_URI не задан, тест с PostgreSQL пропущен")
+	}
+
+	migrationsSource = "file://../../migrations/accrual"
+	storage, err := NewPostgresStorage(uri)
+	require.NoError(t, err)
+	t.Cleanup(func() { storage.Close() })
+
+	ctx := context.Background()
+	suffix := time.Now().UnixNano()
+	match := fmt.Sprintf("test-%d", suffix)
+	number := fmt.Sprintf("%d", suffix)
+	t.Cleanup(func() {
+		storage.db.Exec("DELETE FROM accrual_mechanics WHERE match = $1", match)
+		storage.db.Exec("DELETE FROM accrual_orders WHERE number = $1", number)
+	})
+
+	mechanic := Mechanic{Match: match, Reward: "7.25", RewardType: RewardTypePercent}
+	require.NoError(t, storage.AddMechanic(ctx, mechanic))
+	assert.ErrorIs(t, storage.AddMechanic(ctx, mechanic), ErrMatchExists)
+
+	mechanics, err := storage.Mechanics(ctx)
+	require.NoError(t, err)
+	assert.Contains(t, mechanics, mechanic)
+
+	goods := []Good{{Description: "Товар " + match, Price: "14599.50"}}
+	require.NoError(t, storage.RegisterOrder(ctx, number, goods))
+	assert.ErrorIs(t, storage.RegisterOrder(ctx, number, nil), ErrOrderExists)
+
+	order, err := storage.GetOrder(ctx, number)
+	require.NoError(t, err)
+	assert.Equal(t, StatusRegistered, order.Status)
+	assert.Nil(t, order.Accrual)
+	assert.Equal(t, goods, order.Goods)
+
+	accrual := amount(105846)
+	require.NoError(t, storage.UpdateOrder(ctx, number, StatusProcessed, accrual))
+	order, err = storage.GetOrder(ctx, number)
+	require.NoError(t, err)
+	assert.Equal(t, accrual, order.Accrual)
+
+	_, err = storage.GetOrder(ctx, "0")
+	assert.ErrorIs(t, err, ErrOrderNotFound)
+}
@@ -0,0 +1,142 @@
+package accrual
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/paxren/go-musthave-diploma-tpl/internal/models"
+)
+
+const (
+	// DefaultProcessInterval интервал между шагами обработки заказов
+	DefaultProcessInterval = time.Second
+	// processBatchSize количество заказов, обрабатываемых за один шаг
+	processBatchSize = 100
+)
+
+// Processor рассчитывает начисления за зарегистрированные заказы.
+// За каждый шаг заказ продвигается на один статус: REGISTERED -> PROCESSING,
+// затем PROCESSING -> PROCESSED или INVALID, поэтому клиент успевает увидеть
+// все промежуточные статусы
+type Processor struct {
+	storage  Storage
+	logger   *slog.Logger
+	interval time.Duration
+	ticker   *time.Ticker
+	done     chan bool
+}
+
+// NewProcessor создает обработчик заказов с интервалом DefaultProcessInterval
+func NewProcessor(storage Storage) *Processor {
+	return &Processor{
+		storage:  storage,
+		logger:   slog.New(slog.NewJSONHandler(io.Discard, nil)),
+		interval: DefaultProcessInterval,
+		done:     make(chan bool),
+	}
+}
+
+// SetInterval устанавливает интервал между шагами обработки
+func (p *Processor) SetInterval(interval time.Duration) {
+	if interval > 0 {
+		p.interval = interval
+	}
+}
+
+// SetLogger устанавливает логгер
+func (p *Processor) SetLogger(logger *slog.Logger) {
+	p.logger = logger
+}
+
+// Start запускает обработку заказов в отдельной горутине
+func (p *Processor) Start(ctx context.Context) {
+	p.logger.Info("Запуск обработки заказов", "interval", p.interval)
+	p.ticker = time.NewTicker(p.interval)
+
+	go func() {
+		for {
+			select {
+			case <-p.ticker.C:
+				p.step(ctx)
+			case <-ctx.Done():
+				p.logger.Info("Остановка обработки заказов по отмене контекста")
+				return
+			case <-p.done:
+				p.logger.Info("Остановка обработки заказов")
+				return
+			}
+		}
+	}()
+}
+
+// Stop останавливает обработку заказов
+func (p *Processor) Stop() {
+	if p.ticker != nil {
+		p.ticker.Stop()
+	}
+
+	select {
+	case p.done <- true:
+	default:
+	}
+}
+
+// step выполняет один шаг обработки. Сначала завершаются заказы, взятые в расчет
+// на прошлом шаге, затем в расчет берутся новые
+func (p *Processor) step(ctx context.Context) {
+	processing, err := p.storage.OrdersWithStatus(ctx, StatusProcessing, processBatchSize)
+	if err != nil {
+		p.logger.Error("Ошибка при получении заказов в расчете", "error", err)
+		return
+	}
+
+	mechanics, err := p.storage.Mechanics(ctx)
+	if err != nil {
+		p.logger.Error("Ошибка при получении механик вознаграждения", "error", err)
+		return
+	}
+
+	for _, order := range processing {
+		p.finish(ctx, order, mechanics)
+	}
+
+	registered, err := p.storage.OrdersWithStatus(ctx, StatusRegistered, processBatchSize)
+	if err != nil {
+		p.logger.Error("Ошибка при получении зарегистрированных заказов", "error", err)
+		return
+	}
+
+	for _, order := range registered {
+		if err := p.storage.UpdateOrder(ctx, order.Number, StatusProcessing, nil); err != nil {
+			p.logger.Error("Ошибка при взятии заказа в расчет", "error", err, "order", order.Number)
+		}
+	}
+}
+
+// finish рассчитывает начисление и переводит заказ в конечный статус.
+// Заказ с номером, не проходящим проверку по алгоритму Луна, к расчету не принимается
+func (p *Processor) finish(ctx context.Context, order Order, mechanics []Mechanic) {
+	if !models.LunaCheck(order.Number) {
+		if err := p.storage.UpdateOrder(ctx, order.Number, StatusInvalid, nil); err != nil {
+			p.logger.Error("Ошибка при отклонении заказа", "error", err, "order", order.Number)
+		}
+		return
+	}
+
+	accrual, err := Calculate(order.Goods, mechanics)
+	if err != nil {
+		p.logger.Error("Ошибка при расчете начисления", "error", err, "order", order.Number)
+		if err := p.storage.UpdateOrder(ctx, order.Number, StatusInvalid, nil); err != nil {
+			p.logger.Error("Ошибка при отклонении заказа", "error", err, "order", order.Number)
+		}
+		return
+	}
+
+	if err := p.storage.UpdateOrder(ctx, order.Number, StatusProcessed, accrual); err != nil {
+		p.logger.Error("Ошибка при сохранении начисления", "error", err, "order", order.Number)
+		return
+	}
+	p.logger.Info("Начисление за заказ рассчитано", "order", order.Number, "accrual", accrual)
+}
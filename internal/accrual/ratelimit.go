@@ -0,0 +1,49 @@
+package accrual
+
+import (
+	"sync"
+	"time"
+)
+
+// rateLimitWindow окно, в котором считаются запросы
+const rateLimitWindow = time.Minute
+
+// rateLimiter ограничивает количество запросов в минуту фиксированным окном:
+// счетчик сбрасывается в начале каждой минуты от первого запроса окна
+type rateLimiter struct {
+	mutex       sync.Mutex
+	limit       int // 0 - без ограничения
+	windowStart time.Time
+	count       int
+	now         func() time.Time
+}
+
+func newRateLimiter(limit int) *rateLimiter {
+	return &rateLimiter{
+		limit: limit,
+		now:   time.Now,
+	}
+}
+
+// Allow учитывает запрос. Если лимит окна исчерпан, возвращает false
+// и время до начала следующего окна
+func (l *rateLimiter) Allow() (bool, time.Duration) {
+	if l.limit <= 0 {
+		return true, 0
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := l.now()
+	if now.Sub(l.windowStart) >= rateLimitWindow {
+		l.windowStart = now
+		l.count = 0
+	}
+
+	if l.count >= l.limit {
+		return false, l.windowStart.Add(rateLimitWindow).Sub(now)
+	}
+	l.count++
+	return true, 0
+}
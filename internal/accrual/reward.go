@@ -0,0 +1,57 @@
+package accrual
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/paxren/go-musthave-diploma-tpl/internal/money"
+)
+
+// Calculate рассчитывает начисление за товары заказа. Для каждого товара применяются все
+// механики, ключ поиска которых встречается в наименовании товара, начисления суммируются.
+// Расчет ведется точно, итог округляется вниз до копейки.
+// Если ни одна механика не подошла, возвращает nil: начисления за заказ нет
+func Calculate(goods []Good, mechanics []Mechanic) (*money.Amount, error) {
+	total := new(big.Rat)
+	matched := false
+
+	for _, good := range goods {
+		price, err := parseDecimal(good.Price)
+		if err != nil {
+			return nil, fmt.Errorf("цена товара %q: %w", good.Description, err)
+		}
+
+		for _, mechanic := range mechanics {
+			if !strings.Contains(good.Description, mechanic.Match) {
+				continue
+			}
+
+			reward, err := parseDecimal(mechanic.Reward)
+			if err != nil {
+				return nil, fmt.Errorf("вознаграждение механики %q: %w", mechanic.Match, err)
+			}
+
+			matched = true
+			switch mechanic.RewardType {
+			case RewardTypePercent:
+				total.Add(total, new(big.Rat).Mul(price, reward.Quo(reward, big.NewRat(100, 1))))
+			case RewardTypePoints:
+				total.Add(total, reward)
+			}
+		}
+	}
+
+	if !matched {
+		return nil, nil
+	}
+
+	// Переводим в копейки и отбрасываем доли копейки
+	kopecks := new(big.Int).Quo(new(big.Int).Mul(total.Num(), big.NewInt(100)), total.Denom())
+	if !kopecks.IsUint64() || money.Amount(kopecks.Uint64()) > money.MaxAmount {
+		return nil, fmt.Errorf("%w: начисление %s", money.ErrOverflow, total.FloatString(2))
+	}
+
+	accrual := money.FromKopecks(kopecks.Uint64())
+	return &accrual, nil
+}
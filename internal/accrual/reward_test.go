@@ -0,0 +1,87 @@
+package accrual
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/paxren/go-musthave-diploma-tpl/internal/money"
+)
+
+func TestCalculate(t *testing.T) {
+	mechanics := []Mechanic{
+		{Match: "Bork", Reward: "10", RewardType: RewardTypePercent},
+		{Match: "Чайник", Reward: "15.5", RewardType: RewardTypePoints},
+		{Match: "LG", Reward: "7.5", RewardType: RewardTypePercent},
+	}
+
+	tests := []struct {
+		name     string
+		goods    []Good
+		expected *money.Amount
+	}{
+		{
+			name:     "Процент от цены",
+			goods:    []Good{{Description: "Утюг Bork", Price: "7000"}},
+			expected: amount(70000),
+		},
+		{
+			name:     "Сумма совпадений нескольких механик",
+			goods:    []Good{{Description: "Чайник Bork", Price: "7000"}},
+			expected: amount(71550),
+		},
+		{
+			name: "Сумма по товарам",
+			goods: []Good{
+				{Description: "Утюг Bork", Price: "7000"},
+				{Description: "Телевизор LG", Price: "14599.50"},
+			},
+			// 700 + 1094.9625, доли копейки отбрасываются
+			expected: amount(179496),
+		},
+		{
+			name:     "Точная дробная цена без ошибок округления",
+			goods:    []Good{{Description: "Утюг Bork", Price: "729.98"}},
+			expected: amount(7299),
+		},
+		{
+			name:     "Нет совпадений",
+			goods:    []Good{{Description: "Холодильник Samsung", Price: "50000"}},
+			expected: nil,
+		},
+		{
+			name:     "Пустой заказ",
+			expected: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			accrual, err := Calculate(tt.goods, mechanics)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, accrual)
+		})
+	}
+}
+
+func TestMechanicValidate(t *testing.T) {
+	assert.NoError(t, Mechanic{Match: "Bork", Reward: "10", RewardType: RewardTypePercent}.Validate())
+	assert.NoError(t, Mechanic{Match: "Bork", Reward: "0.5", RewardType: RewardTypePoints}.Validate())
+
+	for _, mechanic := range []Mechanic{
+		{Match: "", Reward: "10", RewardType: RewardTypePercent},
+		{Match: "Bork", Reward: "10", RewardType: "руб"},
+		{Match: "Bork", Reward: "-10", RewardType: RewardTypePoints},
+		{Match: "Bork", Reward: json.Number("1e100000"), RewardType: RewardTypePoints},
+		{Match: "Bork", RewardType: RewardTypePoints},
+	} {
+		assert.ErrorIs(t, mechanic.Validate(), ErrInvalidInput, mechanic)
+	}
+}
+
+func amount(kopecks uint64) *money.Amount {
+	a := money.FromKopecks(kopecks)
+	return &a
+}
@@ -0,0 +1,148 @@
+package accrual
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// maxRequestBody максимальный размер тела запроса
+const maxRequestBody = 1 << 20
+
+// Server HTTP API системы расчета начислений
+type Server struct {
+	storage Storage
+	limiter *rateLimiter
+	logger  *slog.Logger
+}
+
+// NewServer создает API поверх хранилища без ограничения частоты запросов
+func NewServer(storage Storage) *Server {
+	return &Server{
+		storage: storage,
+		limiter: newRateLimiter(0),
+		logger:  slog.New(slog.NewJSONHandler(io.Discard, nil)),
+	}
+}
+
+// SetRateLimit ограничивает количество запросов информации о заказах в минуту, 0 - без ограничения
+func (s *Server) SetRateLimit(requestsPerMinute int) {
+	s.limiter = newRateLimiter(requestsPerMinute)
+}
+
+// SetLogger устанавливает логгер
+func (s *Server) SetLogger(logger *slog.Logger) {
+	s.logger = logger
+}
+
+// Routes возвращает маршрутизатор API
+func (s *Server) Routes() http.Handler {
+	r := chi.NewRouter()
+	r.Post(`/api/goods`, s.RegisterMechanic)
+	r.Post(`/api/orders`, s.RegisterOrder)
+	r.Get(`/api/orders/{number}`, s.GetOrder)
+	return r
+}
+
+// RegisterMechanic обрабатывает регистрацию механики вознаграждения
+func (s *Server) RegisterMechanic(res http.ResponseWriter, req *http.Request) {
+	var mechanic Mechanic
+	if err := decodeJSON(req, &mechanic); err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := mechanic.Validate(); err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := s.storage.AddMechanic(req.Context(), mechanic); err != nil {
+		s.writeError(res, err)
+		return
+	}
+
+	res.WriteHeader(http.StatusOK)
+}
+
+// RegisterOrder обрабатывает регистрацию заказа для расчета начисления
+func (s *Server) RegisterOrder(res http.ResponseWriter, req *http.Request) {
+	var order OrderRequest
+	if err := decodeJSON(req, &order); err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := order.Validate(); err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := s.storage.RegisterOrder(req.Context(), order.Order, order.Goods); err != nil {
+		s.writeError(res, err)
+		return
+	}
+
+	res.WriteHeader(http.StatusAccepted)
+}
+
+// GetOrder обрабатывает запрос информации о расчете начисления за заказ
+func (s *Server) GetOrder(res http.ResponseWriter, req *http.Request) {
+	if ok, retryAfter := s.limiter.Allow(); !ok {
+		res.Header().Set("Content-Type", "text/plain")
+		res.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		res.WriteHeader(http.StatusTooManyRequests)
+		fmt.Fprintf(res, "No more than %d requests per minute allowed", s.limiter.limit)
+		return
+	}
+
+	order, err := s.storage.GetOrder(req.Context(), chi.URLParam(req, "number"))
+	if err != nil {
+		if errors.Is(err, ErrOrderNotFound) {
+			res.WriteHeader(http.StatusNoContent)
+			return
+		}
+		s.writeError(res, err)
+		return
+	}
+
+	body, err := json.Marshal(OrderResponse{
+		Order:   order.Number,
+		Status:  order.Status,
+		Accrual: order.Accrual,
+	})
+	if err != nil {
+		s.writeError(res, err)
+		return
+	}
+
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(http.StatusOK)
+	res.Write(body)
+}
+
+// writeError отвечает на ошибку хранилища
+func (s *Server) writeError(res http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrMatchExists), errors.Is(err, ErrOrderExists):
+		http.Error(res, err.Error(), http.StatusConflict)
+	default:
+		s.logger.Error("Ошибка при обработке запроса", "error", err)
+		http.Error(res, "внутренняя ошибка сервера", http.StatusInternalServerError)
+	}
+}
+
+// decodeJSON разбирает тело запроса в формате JSON
+func decodeJSON(req *http.Request, v any) error {
+	decoder := json.NewDecoder(io.LimitReader(req.Body, maxRequestBody))
+	decoder.UseNumber()
+	if err := decoder.Decode(v); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidInput, err)
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package accrual
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func send(t *testing.T, handler http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+	return res
+}
+
+func TestServer_OrderLifecycle(t *testing.T) {
+	storage := NewMemStorage()
+	server := NewServer(storage)
+	processor := NewProcessor(storage)
+	api := server.Routes()
+	ctx := context.Background()
+
+	// Регистрация механик
+	assert.Equal(t, http.StatusOK, send(t, api, http.MethodPost, "/api/goods", `{"match":"Bork","reward":10,"reward_type":"%"}`).Code)
+	assert.Equal(t, http.StatusConflict, send(t, api, http.MethodPost, "/api/goods", `{"match":"Bork","reward":5,"reward_type":"pt"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, send(t, api, http.MethodPost, "/api/goods", `{"match":"","reward":5,"reward_type":"pt"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, send(t, api, http.MethodPost, "/api/goods", `{"match":"LG"`).Code)
+
+	// Регистрация заказов
+	assert.Equal(t, http.StatusAccepted, send(t, api, http.MethodPost, "/api/orders", `{"order":"79927398713","goods":[{"description":"Чайник Bork","price":7000.50}]}`).Code)
+	assert.Equal(t, http.StatusAccepted, send(t, api, http.MethodPost, "/api/orders", `{"order":"12345678903","goods":[{"description":"Холодильник","price":50000}]}`).Code)
+	assert.Equal(t, http.StatusAccepted, send(t, api, http.MethodPost, "/api/orders", `{"order":"12345678900","goods":[{"description":"Утюг Bork","price":1000}]}`).Code)
+	assert.Equal(t, http.StatusConflict, send(t, api, http.MethodPost, "/api/orders", `{"order":"79927398713","goods":[]}`).Code)
+	assert.Equal(t, http.StatusBadRequest, send(t, api, http.MethodPost, "/api/orders", `{"order":"79927x","goods":[]}`).Code)
+	assert.Equal(t, http.StatusBadRequest, send(t, api, http.MethodPost, "/api/orders", `{"order":"4561261212345467","goods":[{"description":"Bork","price":"дорого"}]}`).Code)
+
+	getOrder := func(number string) OrderResponse {
+		res := send(t, api, http.MethodGet, "/api/orders/"+number, "")
+		require.Equal(t, http.StatusOK, res.Code)
+		assert.Equal(t, "application/json", res.Header().Get("Content-Type"))
+
+		var order OrderResponse
+		require.NoError(t, json.Unmarshal(res.Body.Bytes(), &order))
+		return order
+	}
+
+	assert.Equal(t, StatusRegistered, getOrder("79927398713").Status)
+	assert.Equal(t, http.StatusNoContent, send(t, api, http.MethodGet, "/api/orders/4561261212345467", "").Code)
+
+	// Каждый шаг продвигает заказ на один статус
+	processor.step(ctx)
+	assert.Equal(t, StatusProcessing, getOrder("79927398713").Status)
+
+	processor.step(ctx)
+	processed := getOrder("79927398713")
+	assert.Equal(t, StatusProcessed, processed.Status)
+	require.NotNil(t, processed.Accrual)
+	assert.EqualValues(t, 70005, processed.Accrual.Kopecks())
+
+	// Заказ без совпадений обработан без начисления, поле accrual отсутствует
+	res := send(t, api, http.MethodGet, "/api/orders/12345678903", "")
+	assert.JSONEq(t, `{"order":"12345678903","status":"PROCESSED"}`, res.Body.String())
+
+	// Номер, не проходящий проверку Луна, к расчету не принимается
+	assert.Equal(t, StatusInvalid, getOrder("12345678900").Status)
+}
+
+func TestServer_RateLimit(t *testing.T) {
+	server := NewServer(NewMemStorage())
+	server.SetRateLimit(2)
+	now := time.Now()
+	server.limiter.now = func() time.Time { return now }
+	api := server.Routes()
+
+	assert.Equal(t, http.StatusNoContent, send(t, api, http.MethodGet, "/api/orders/79927398713", "").Code)
+	now = now.Add(15 * time.Second)
+	assert.Equal(t, http.StatusNoContent, send(t, api, http.MethodGet, "/api/orders/79927398713", "").Code)
+
+	res := send(t, api, http.MethodGet, "/api/orders/79927398713", "")
+	assert.Equal(t, http.StatusTooManyRequests, res.Code)
+	assert.Equal(t, "text/plain", res.Header().Get("Content-Type"))
+	assert.Equal(t, "45", res.Header().Get("Retry-After"))
+	assert.Equal(t, "No more than 2 requests per minute allowed", res.Body.String())
+
+	// Регистрация не ограничивается
+	assert.Equal(t, http.StatusAccepted, send(t, api, http.MethodPost, "/api/orders", `{"order":"79927398713","goods":[]}`).Code)
+
+	// В следующем окне запросы снова разрешены
+	now = now.Add(45 * time.Second)
+	assert.Equal(t, http.StatusOK, send(t, api, http.MethodGet, "/api/orders/79927398713", "").Code)
+}
@@ -0,0 +1,124 @@
+package accrual
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/paxren/go-musthave-diploma-tpl/internal/money"
+)
+
+// Storage хранилище механик вознаграждения и заказов системы расчета начислений
+type Storage interface {
+	// AddMechanic регистрирует механику, ErrMatchExists - ключ поиска уже занят
+	AddMechanic(ctx context.Context, mechanic Mechanic) error
+	// Mechanics возвращает все зарегистрированные механики
+	Mechanics(ctx context.Context) ([]Mechanic, error)
+	// RegisterOrder регистрирует заказ в статусе REGISTERED, ErrOrderExists - заказ уже принят
+	RegisterOrder(ctx context.Context, number string, goods []Good) error
+	// GetOrder возвращает заказ, ErrOrderNotFound - заказ не зарегистрирован
+	GetOrder(ctx context.Context, number string) (*Order, error)
+	// OrdersWithStatus возвращает до limit самых ранних заказов в статусе status
+	OrdersWithStatus(ctx context.Context, status string, limit int) ([]Order, error)
+	// UpdateOrder меняет статус заказа и начисление по нему
+	UpdateOrder(ctx context.Context, number, status string, accrual *money.Amount) error
+}
+
+// MemStorage хранилище в памяти, данные теряются при перезапуске
+type MemStorage struct {
+	mutex     sync.RWMutex
+	mechanics map[string]Mechanic
+	orders    map[string]Order
+}
+
+// NewMemStorage создает пустое хранилище в памяти
+func NewMemStorage() *MemStorage {
+	return &MemStorage{
+		mechanics: make(map[string]Mechanic),
+		orders:    make(map[string]Order),
+	}
+}
+
+func (st *MemStorage) AddMechanic(_ context.Context, mechanic Mechanic) error {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+
+	if _, ok := st.mechanics[mechanic.Match]; ok {
+		return ErrMatchExists
+	}
+	st.mechanics[mechanic.Match] = mechanic
+	return nil
+}
+
+func (st *MemStorage) Mechanics(_ context.Context) ([]Mechanic, error) {
+	st.mutex.RLock()
+	defer st.mutex.RUnlock()
+
+	mechanics := make([]Mechanic, 0, len(st.mechanics))
+	for _, mechanic := range st.mechanics {
+		mechanics = append(mechanics, mechanic)
+	}
+	return mechanics, nil
+}
+
+func (st *MemStorage) RegisterOrder(_ context.Context, number string, goods []Good) error {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+
+	if _, ok := st.orders[number]; ok {
+		return ErrOrderExists
+	}
+	st.orders[number] = Order{
+		Number:    number,
+		Status:    StatusRegistered,
+		Goods:     append([]Good(nil), goods...),
+		CreatedAt: time.Now(),
+	}
+	return nil
+}
+
+func (st *MemStorage) GetOrder(_ context.Context, number string) (*Order, error) {
+	st.mutex.RLock()
+	defer st.mutex.RUnlock()
+
+	order, ok := st.orders[number]
+	if !ok {
+		return nil, ErrOrderNotFound
+	}
+	return &order, nil
+}
+
+func (st *MemStorage) OrdersWithStatus(_ context.Context, status string, limit int) ([]Order, error) {
+	st.mutex.RLock()
+	defer st.mutex.RUnlock()
+
+	var orders []Order
+	for _, order := range st.orders {
+		if order.Status == status {
+			orders = append(orders, order)
+		}
+	}
+
+	sort.Slice(orders, func(i, j int) bool {
+		return orders[i].CreatedAt.Before(orders[j].CreatedAt)
+	})
+	if limit > 0 && len(orders) > limit {
+		orders = orders[:limit]
+	}
+	return orders, nil
+}
+
+func (st *MemStorage) UpdateOrder(_ context.Context, number, status string, accrual *money.Amount) error {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+
+	order, ok := st.orders[number]
+	if !ok {
+		return ErrOrderNotFound
+	}
+	order.Status = status
+	order.Accrual = accrual
+	st.orders[number] = order
+	return nil
+}
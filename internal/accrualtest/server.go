@@ -0,0 +1,280 @@
+// Package accrualtest содержит поддельную accrual систему для детерминированных
+// интеграционных тестов клиента и сервиса опроса. Ответы на запросы о каждом заказе
+// задаются сценарием: последовательностью шагов, каждый из которых описывает один ответ
+package accrualtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Step один ответ поддельной accrual системы на запрос информации о заказе
+type Step struct {
+	// Code код ответа, 0 - 200 с информацией о заказе
+	Code int
+	// Status статус заказа в ответе 200
+	Status string
+	// Accrual сумма начисления в виде JSON числа, пустая - поле accrual не передается
+	Accrual string
+	// RetryAfter значение заголовка Retry-After, пустое - заголовок не передается
+	RetryAfter string
+	// Body тело ответа, заменяет сформированное по остальным полям
+	Body string
+	// Delay задержка перед ответом
+	Delay time.Duration
+	// Reset разрывает соединение вместо ответа
+	Reset bool
+}
+
+// Registered ответ со статусом REGISTERED
+func Registered() Step {
+	return Step{Status: "REGISTERED"}
+}
+
+// Processing ответ со статусом PROCESSING
+func Processing() Step {
+	return Step{Status: "PROCESSING"}
+}
+
+// Invalid ответ со статусом INVALID
+func Invalid() Step {
+	return Step{Status: "INVALID"}
+}
+
+// Processed ответ со статусом PROCESSED и начислением accrual, например "729.98"
+func Processed(accrual string) Step {
+	return Step{Status: "PROCESSED", Accrual: accrual}
+}
+
+// NotRegistered ответ 204: заказ не зарегистрирован в системе расчета
+func NotRegistered() Step {
+	return Step{Code: http.StatusNoContent}
+}
+
+// TooManyRequests ответ 429 с заголовком Retry-After в секундах и телом
+// "No more than N requests per minute allowed", как у настоящей accrual системы
+func TooManyRequests(retryAfter, requestsPerMinute int) Step {
+	return Step{
+		Code:       http.StatusTooManyRequests,
+		RetryAfter: strconv.Itoa(retryAfter),
+		Body:       fmt.Sprintf("No more than %d requests per minute allowed", requestsPerMinute),
+	}
+}
+
+// ServerError ответ 500
+func ServerError() Step {
+	return Step{Code: http.StatusInternalServerError, Body: "internal server error"}
+}
+
+// Malformed ответ 200 с телом, которое не разбирается как JSON
+func Malformed() Step {
+	return Step{Body: `{"order": "`}
+}
+
+// ConnectionReset разрыв соединения без ответа
+func ConnectionReset() Step {
+	return Step{Reset: true}
+}
+
+// After возвращает копию шага с задержкой ответа d
+func (s Step) After(d time.Duration) Step {
+	s.Delay = d
+	return s
+}
+
+// Request запрос, полученный поддельной accrual системой
+type Request struct {
+	Method string
+	Path   string
+	// Order номер заказа из пути запроса, пустой для прочих запросов
+	Order string
+	// Step порядковый номер шага сценария заказа, которым был дан ответ
+	Step int
+	At   time.Time
+}
+
+// Server поддельная accrual система поверх httptest.Server.
+// Заказы без сценария отвечают 204, по исчерпании сценария повторяется его последний шаг
+type Server struct {
+	*httptest.Server
+
+	mutex    sync.Mutex
+	scripts  map[string][]Step
+	served   map[string]int
+	requests []Request
+}
+
+// NewServer запускает поддельную accrual систему. Сервер нужно закрыть вызовом Close
+func NewServer() *Server {
+	s := &Server{
+		scripts: make(map[string][]Step),
+		served:  make(map[string]int),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/orders/{number}", s.getOrder)
+	mux.HandleFunc("/", s.notFound)
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// Script задает сценарий ответов на запросы о заказе number и сбрасывает его позицию
+func (s *Server) Script(number string, steps ...Step) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.scripts[number] = steps
+	s.served[number] = 0
+}
+
+// Requests возвращает копию списка полученных запросов в порядке поступления
+func (s *Server) Requests() []Request {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	requests := make([]Request, len(s.requests))
+	copy(requests, s.requests)
+	return requests
+}
+
+// RequestsFor возвращает запросы о заказе number в порядке поступления
+func (s *Server) RequestsFor(number string) []Request {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var requests []Request
+	for _, request := range s.requests {
+		if request.Order == number {
+			requests = append(requests, request)
+		}
+	}
+	return requests
+}
+
+// next записывает запрос и выбирает очередной шаг сценария заказа
+func (s *Server) next(req *http.Request, number string) (Step, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	index := s.served[number]
+	s.served[number] = index + 1
+	s.requests = append(s.requests, Request{
+		Method: req.Method,
+		Path:   req.URL.Path,
+		Order:  number,
+		Step:   index,
+		At:     time.Now(),
+	})
+
+	steps := s.scripts[number]
+	if len(steps) == 0 {
+		return Step{}, false
+	}
+	if index >= len(steps) {
+		index = len(steps) - 1
+	}
+	return steps[index], true
+}
+
+func (s *Server) getOrder(res http.ResponseWriter, req *http.Request) {
+	number := req.PathValue("number")
+	step, ok := s.next(req, number)
+	if !ok {
+		res.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if step.Delay > 0 {
+		timer := time.NewTimer(step.Delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			return
+		}
+	}
+
+	if step.Reset {
+		resetConnection(res)
+		return
+	}
+
+	if step.RetryAfter != "" {
+		res.Header().Set("Retry-After", step.RetryAfter)
+	}
+
+	code := step.Code
+	if code == 0 {
+		code = http.StatusOK
+	}
+
+	body := step.Body
+	if body == "" && code == http.StatusOK {
+		body = orderBody(number, step)
+	}
+
+	if code == http.StatusOK {
+		res.Header().Set("Content-Type", "application/json")
+	} else if body != "" {
+		res.Header().Set("Content-Type", "text/plain")
+	}
+	res.WriteHeader(code)
+	if body != "" && code != http.StatusNoContent {
+		fmt.Fprint(res, body)
+	}
+}
+
+func (s *Server) notFound(res http.ResponseWriter, req *http.Request) {
+	s.mutex.Lock()
+	s.requests = append(s.requests, Request{
+		Method: req.Method,
+		Path:   req.URL.Path,
+		At:     time.Now(),
+	})
+	s.mutex.Unlock()
+
+	http.NotFound(res, req)
+}
+
+// orderBody формирует тело ответа 200 в формате accrual системы
+func orderBody(number string, step Step) string {
+	response := struct {
+		Order   string      `json:"order"`
+		Status  string      `json:"status"`
+		Accrual json.Number `json:"accrual,omitempty"`
+	}{
+		Order:   number,
+		Status:  step.Status,
+		Accrual: json.Number(step.Accrual),
+	}
+
+	body, err := json.Marshal(response)
+	if err != nil {
+		panic(fmt.Sprintf("accrualtest: некорректная сумма начисления %q: %v", step.Accrual, err))
+	}
+	return string(body)
+}
+
+// resetConnection закрывает соединение, не отправив ответ. Для TCP соединения
+// сбрасывается задержка закрытия, и клиент получает RST вместо корректного FIN
+func resetConnection(res http.ResponseWriter) {
+	hijacker, ok := res.(http.Hijacker)
+	if !ok {
+		panic("accrualtest: соединение не поддерживает перехват")
+	}
+
+	conn, _, err := hijacker.Hijack()
+	if err != nil {
+		panic(fmt.Sprintf("accrualtest: ошибка при перехвате соединения: %v", err))
+	}
+	if tcpConn, ok := conn.(*net.TCPConn); ok {
+		tcpConn.SetLinger(0)
+	}
+	conn.Close()
+}
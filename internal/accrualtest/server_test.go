@@ -0,0 +1,124 @@
+package accrualtest
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func get(t *testing.T, ctx context.Context, url string) (*http.Response, string, error) {
+	t.Helper()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	require.NoError(t, err)
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	return res, string(body), nil
+}
+
+func TestServer_Script(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+
+	server.Script("12345678903",
+		Registered(),
+		TooManyRequests(7, 60),
+		ServerError(),
+		Malformed(),
+		Processed("729.98"),
+	)
+
+	tests := []struct {
+		code        int
+		body        string
+		retryAfter  string
+		contentType string
+	}{
+		{http.StatusOK, `{"order":"12345678903","status":"REGISTERED"}`, "", "application/json"},
+		{http.StatusTooManyRequests, "No more than 60 requests per minute allowed", "7", "text/plain"},
+		{http.StatusInternalServerError, "internal server error", "", "text/plain"},
+		{http.StatusOK, `{"order": "`, "", "application/json"},
+		{http.StatusOK, `{"order":"12345678903","status":"PROCESSED","accrual":729.98}`, "", "application/json"},
+		// По исчерпании сценария повторяется последний шаг
+		{http.StatusOK, `{"order":"12345678903","status":"PROCESSED","accrual":729.98}`, "", "application/json"},
+	}
+
+	for i, tt := range tests {
+		res, body, err := get(t, context.Background(), server.URL+"/api/orders/12345678903")
+		require.NoError(t, err, "шаг %d", i)
+		assert.Equal(t, tt.code, res.StatusCode, "шаг %d", i)
+		assert.Equal(t, tt.body, body, "шаг %d", i)
+		assert.Equal(t, tt.retryAfter, res.Header.Get("Retry-After"), "шаг %d", i)
+		assert.Equal(t, tt.contentType, res.Header.Get("Content-Type"), "шаг %d", i)
+	}
+
+	requests := server.RequestsFor("12345678903")
+	require.Len(t, requests, len(tests))
+	for i, request := range requests {
+		assert.Equal(t, http.MethodGet, request.Method)
+		assert.Equal(t, "/api/orders/12345678903", request.Path)
+		assert.Equal(t, i, request.Step)
+	}
+}
+
+func TestServer_UnscriptedOrder(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+
+	res, body, err := get(t, context.Background(), server.URL+"/api/orders/79927398713")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, res.StatusCode)
+	assert.Empty(t, body)
+
+	res, _, err = get(t, context.Background(), server.URL+"/api/goods")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+
+	requests := server.Requests()
+	require.Len(t, requests, 2)
+	assert.Equal(t, "79927398713", requests[0].Order)
+	assert.Equal(t, "/api/goods", requests[1].Path)
+	assert.Empty(t, requests[1].Order)
+}
+
+func TestServer_ConnectionReset(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+
+	server.Script("79927398713", ConnectionReset(), Processing())
+
+	_, _, err := get(t, context.Background(), server.URL+"/api/orders/79927398713")
+	require.Error(t, err)
+
+	res, _, err := get(t, context.Background(), server.URL+"/api/orders/79927398713")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+}
+
+func TestServer_Delay(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+
+	server.Script("79927398713", Invalid().After(time.Minute))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, _, err := get(t, ctx, server.URL+"/api/orders/79927398713")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 10*time.Second)
+	assert.Len(t, server.Requests(), 1)
+}
@@ -7,37 +7,96 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
-// Claims представляет структуру утверждений в JWT токене
+// Время жизни токенов по умолчанию
+const (
+	DefaultAccessTokenTTL  = 15 * time.Minute
+	DefaultRefreshTokenTTL = 30 * 24 * time.Hour
+)
+
+// Claims представляет структуру утверждений в JWT токене.
+// Идентификатор токена (jti) хранится в RegisteredClaims.ID
 type Claims struct {
-	UserID uint64 `json:"user_id"`
-	Login  string `json:"login"`
+	UserID    uint64 `json:"user_id"`
+	Login     string `json:"login"`
+	SessionID string `json:"sid,omitempty"`
 	jwt.RegisteredClaims
 }
 
-// JWTService представляет сервис для работы с JWT токенами
+// JWTService представляет сервис для работы с JWT токенами.
+// Токены подписываются либо общим секретом (HS256), либо асимметричным ключом
+// (RS256 или EdDSA) с идентификатором kid в заголовке
 type JWTService struct {
-	secretKey string
+	secretKey        string
+	signingKey       *SigningKey
+	verificationKeys map[string]*SigningKey
+	accessTTL        time.Duration
 }
 
-// NewJWTService создает новый экземпляр JWTService
+// NewJWTService создает новый экземпляр JWTService, подписывающий токены общим секретом
 func NewJWTService(secretKey string) *JWTService {
 	return &JWTService{
 		secretKey: secretKey,
+		accessTTL: DefaultAccessTokenTTL,
+	}
+}
+
+// NewJWTServiceWithKeys создает JWTService, подписывающий токены асимметричным ключом.
+// Токены принимаются с подписью ключа signingKey и любого из verificationKeys,
+// что позволяет менять ключ подписи, не разлогинивая пользователей.
+// Токены с подписью HS256 такой сервис не принимает
+func NewJWTServiceWithKeys(signingKey *SigningKey, verificationKeys ...*SigningKey) (*JWTService, error) {
+	if signingKey == nil || signingKey.Private == nil {
+		return nil, errors.New("не задан закрытый ключ подписи")
 	}
+
+	s := &JWTService{
+		signingKey:       signingKey,
+		verificationKeys: map[string]*SigningKey{signingKey.ID: signingKey},
+		accessTTL:        DefaultAccessTokenTTL,
+	}
+	for _, key := range verificationKeys {
+		s.verificationKeys[key.ID] = key
+	}
+
+	return s, nil
 }
 
-// GenerateToken генерирует JWT токен для пользователя
-func (s *JWTService) GenerateToken(userID uint64, login string) (string, error) {
+// SetAccessTTL устанавливает время жизни access токена
+func (s *JWTService) SetAccessTTL(ttl time.Duration) {
+	s.accessTTL = ttl
+}
+
+// GenerateToken генерирует короткоживущий access токен для сессии пользователя
+func (s *JWTService) GenerateToken(userID uint64, login, sessionID string) (string, error) {
+	jti, err := randomToken(16)
+	if err != nil {
+		return "", err
+	}
+
+	ttl := s.accessTTL
+	if ttl <= 0 {
+		ttl = DefaultAccessTokenTTL
+	}
+
 	// Создаем утверждения с данными пользователя и временем истечения токена
 	claims := &Claims{
-		UserID: userID,
-		Login:  login,
+		UserID:    userID,
+		Login:     login,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)), // Токен действителен 24 часа
+			ID:        jti,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
 
+	if s.signingKey != nil {
+		// Подписываем токен асимметричным ключом и указываем его идентификатор
+		token := jwt.NewWithClaims(s.signingKey.Method, claims)
+		token.Header["kid"] = s.signingKey.ID
+		return token.SignedString(s.signingKey.Private)
+	}
+
 	// Создаем токен с методом подписи HS256 и утверждениями
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
@@ -50,16 +109,48 @@ func (s *JWTService) GenerateToken(userID uint64, login string) (string, error)
 	return tokenString, nil
 }
 
-// ValidateToken валидирует JWT токен и возвращает утверждения
-func (s *JWTService) ValidateToken(tokenString string) (*Claims, error) {
-	// Парсим токен с проверкой подписи
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
+// keyFunc выбирает ключ для проверки подписи токена
+func (s *JWTService) keyFunc(token *jwt.Token) (interface{}, error) {
+	if s.signingKey == nil {
 		// Проверяем, что метод подписи - HS256
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, errors.New("неверный метод подписи")
 		}
 		return []byte(s.secretKey), nil
-	})
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	key, ok := s.verificationKeys[kid]
+	if !ok {
+		return nil, errors.New("неизвестный ключ подписи")
+	}
+	// Метод подписи должен совпадать с типом ключа
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, errors.New("неверный метод подписи")
+	}
+	return key.Public, nil
+}
+
+// JWKS возвращает открытые ключи проверки подписи токенов.
+// Для сервиса с общим секретом набор пуст
+func (s *JWTService) JWKS() JWKSet {
+	set := JWKSet{Keys: make([]JWK, 0, len(s.verificationKeys))}
+	if s.signingKey != nil {
+		set.Keys = append(set.Keys, s.signingKey.JWK())
+	}
+	for id, key := range s.verificationKeys {
+		if s.signingKey != nil && id == s.signingKey.ID {
+			continue
+		}
+		set.Keys = append(set.Keys, key.JWK())
+	}
+	return set
+}
+
+// ValidateToken валидирует JWT токен и возвращает утверждения
+func (s *JWTService) ValidateToken(tokenString string) (*Claims, error) {
+	// Парсим токен с проверкой подписи
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, s.keyFunc)
 
 	if err != nil {
 		return nil, err
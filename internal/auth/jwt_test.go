@@ -16,7 +16,7 @@ func TestJWTService_GenerateToken(t *testing.T) {
 	userID := uint64(123)
 	login := "testuser"
 
-	token, err := jwtService.GenerateToken(userID, login)
+	token, err := jwtService.GenerateToken(userID, login, "session-1")
 
 	require.NoError(t, err)
 	assert.NotEmpty(t, token)
@@ -33,6 +33,38 @@ func TestJWTService_GenerateToken(t *testing.T) {
 	require.True(t, ok)
 	assert.Equal(t, userID, claims.UserID)
 	assert.Equal(t, login, claims.Login)
+	assert.Equal(t, "session-1", claims.SessionID)
+	assert.NotEmpty(t, claims.ID)
+}
+
+func TestJWTService_GenerateToken_UniqueJTI(t *testing.T) {
+	jwtService := NewJWTService("test-secret-key")
+
+	token1, err := jwtService.GenerateToken(123, "testuser", "session-1")
+	require.NoError(t, err)
+	token2, err := jwtService.GenerateToken(123, "testuser", "session-1")
+	require.NoError(t, err)
+
+	claims1, err := jwtService.ValidateToken(token1)
+	require.NoError(t, err)
+	claims2, err := jwtService.ValidateToken(token2)
+	require.NoError(t, err)
+
+	assert.NotEqual(t, claims1.ID, claims2.ID)
+	assert.WithinDuration(t, time.Now().Add(DefaultAccessTokenTTL), claims1.ExpiresAt.Time, time.Minute)
+}
+
+func TestGenerateRefreshToken(t *testing.T) {
+	token, hash, err := GenerateRefreshToken()
+	require.NoError(t, err)
+
+	assert.NotEmpty(t, token)
+	assert.NotEqual(t, token, hash)
+	assert.Equal(t, hash, HashRefreshToken(token))
+
+	other, _, err := GenerateRefreshToken()
+	require.NoError(t, err)
+	assert.NotEqual(t, token, other)
 }
 
 func TestJWTService_ValidateToken(t *testing.T) {
@@ -43,7 +75,7 @@ func TestJWTService_ValidateToken(t *testing.T) {
 	login := "testuser"
 
 	// Генерируем токен
-	token, err := jwtService.GenerateToken(userID, login)
+	token, err := jwtService.GenerateToken(userID, login, "session-1")
 	require.NoError(t, err)
 
 	// Валидируем токен
@@ -76,7 +108,7 @@ func TestJWTService_ValidateToken_WrongSecret(t *testing.T) {
 	login := "testuser"
 
 	// Генерируем токен с одним секретом
-	token, err := jwtService1.GenerateToken(userID, login)
+	token, err := jwtService1.GenerateToken(userID, login, "session-1")
 	require.NoError(t, err)
 
 	// Пытаемся валидировать с другим секретом
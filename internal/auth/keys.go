@@ -0,0 +1,224 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// minRSAKeyBits минимальный размер RSA ключа, которым разрешено подписывать токены
+const minRSAKeyBits = 2048
+
+// ErrUnsupportedKey возвращается для ключей, которыми нельзя подписывать токены
+var ErrUnsupportedKey = errors.New("неподдерживаемый тип ключа, нужен RSA или Ed25519")
+
+// SigningKey представляет ключ подписи токенов.
+// Для ключей проверки подписи Private не заполнен
+type SigningKey struct {
+	ID      string
+	Method  jwt.SigningMethod
+	Private crypto.Signer
+	Public  crypto.PublicKey
+}
+
+// NewSigningKey создает ключ из закрытого RSA или Ed25519 ключа.
+// Идентификатор ключа (kid) вычисляется как отпечаток открытого ключа по RFC 7638
+func NewSigningKey(private crypto.Signer) (*SigningKey, error) {
+	key, err := NewVerificationKey(private.Public())
+	if err != nil {
+		return nil, err
+	}
+	key.Private = private
+	return key, nil
+}
+
+// NewVerificationKey создает ключ проверки подписи из открытого RSA или Ed25519 ключа
+func NewVerificationKey(public crypto.PublicKey) (*SigningKey, error) {
+	key := &SigningKey{Public: public}
+
+	switch pub := public.(type) {
+	case *rsa.PublicKey:
+		if pub.N.BitLen() < minRSAKeyBits {
+			return nil, fmt.Errorf("размер RSA ключа %d бит меньше допустимых %d", pub.N.BitLen(), minRSAKeyBits)
+		}
+		key.Method = jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		key.Method = jwt.SigningMethodEdDSA
+	default:
+		return nil, ErrUnsupportedKey
+	}
+
+	thumbprint, err := key.JWK().thumbprint()
+	if err != nil {
+		return nil, err
+	}
+	key.ID = thumbprint
+
+	return key, nil
+}
+
+// LoadSigningKeyFile загружает закрытый ключ подписи из PEM файла (PKCS#8 или PKCS#1)
+func LoadSigningKeyFile(path string) (*SigningKey, error) {
+	block, err := readPEMFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	private, err := parsePrivateKey(block)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при разборе закрытого ключа %s: %w", path, err)
+	}
+
+	key, err := NewSigningKey(private)
+	if err != nil {
+		return nil, fmt.Errorf("ключ %s: %w", path, err)
+	}
+	return key, nil
+}
+
+// LoadVerificationKeyFile загружает ключ проверки подписи из PEM файла.
+// Файл может содержать как открытый, так и закрытый ключ, из закрытого берется только открытая часть
+func LoadVerificationKeyFile(path string) (*SigningKey, error) {
+	block, err := readPEMFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var public crypto.PublicKey
+	switch block.Type {
+	case "PUBLIC KEY":
+		public, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		public, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		var private crypto.Signer
+		private, err = parsePrivateKey(block)
+		if err == nil {
+			public = private.Public()
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при разборе ключа %s: %w", path, err)
+	}
+
+	key, err := NewVerificationKey(public)
+	if err != nil {
+		return nil, fmt.Errorf("ключ %s: %w", path, err)
+	}
+	return key, nil
+}
+
+func readPEMFile(path string) (*pem.Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при чтении ключа: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("файл %s не содержит PEM блока", path)
+	}
+	return block, nil
+}
+
+func parsePrivateKey(block *pem.Block) (crypto.Signer, error) {
+	if block.Type == "RSA PRIVATE KEY" {
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	}
+
+	private, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, ok := private.(crypto.Signer)
+	if !ok {
+		return nil, ErrUnsupportedKey
+	}
+	return signer, nil
+}
+
+// JWK представляет открытый ключ в формате JSON Web Key (RFC 7517)
+type JWK struct {
+	KeyType string `json:"kty"`
+	KeyID   string `json:"kid,omitempty"`
+	Use     string `json:"use,omitempty"`
+	Alg     string `json:"alg,omitempty"`
+
+	// Параметры RSA ключа
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+
+	// Параметры Ed25519 ключа
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+}
+
+// JWKSet представляет набор открытых ключей, публикуемый на /.well-known/jwks.json
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWK возвращает открытую часть ключа в формате JSON Web Key
+func (k *SigningKey) JWK() JWK {
+	jwk := JWK{
+		KeyID: k.ID,
+		Use:   "sig",
+	}
+	if k.Method != nil {
+		jwk.Alg = k.Method.Alg()
+	}
+
+	switch pub := k.Public.(type) {
+	case *rsa.PublicKey:
+		jwk.KeyType = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.KeyType = "OKP"
+		jwk.Curve = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+	}
+
+	return jwk
+}
+
+// thumbprint вычисляет отпечаток ключа по RFC 7638: SHA-256 от обязательных полей
+// в лексикографическом порядке
+func (j JWK) thumbprint() (string, error) {
+	var members any
+	switch j.KeyType {
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{j.E, j.KeyType, j.N}
+	case "OKP":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{j.Curve, j.KeyType, j.X}
+	default:
+		return "", ErrUnsupportedKey
+	}
+
+	data, err := json.Marshal(members)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
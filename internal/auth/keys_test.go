@@ -0,0 +1,130 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newEd25519Key(t *testing.T) *SigningKey {
+	t.Helper()
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	key, err := NewSigningKey(private)
+	require.NoError(t, err)
+	return key
+}
+
+func TestJWTService_RS256(t *testing.T) {
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	key, err := NewSigningKey(private)
+	require.NoError(t, err)
+
+	jwtService, err := NewJWTServiceWithKeys(key)
+	require.NoError(t, err)
+
+	token, err := jwtService.GenerateToken(123, "testuser", "session-1")
+	require.NoError(t, err)
+
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, &Claims{})
+	require.NoError(t, err)
+	assert.Equal(t, "RS256", parsed.Method.Alg())
+	assert.Equal(t, key.ID, parsed.Header["kid"])
+
+	claims, err := jwtService.ValidateToken(token)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(123), claims.UserID)
+}
+
+func TestJWTService_KeyRotation(t *testing.T) {
+	oldKey := newEd25519Key(t)
+	newKey := newEd25519Key(t)
+
+	oldService, err := NewJWTServiceWithKeys(oldKey)
+	require.NoError(t, err)
+	oldToken, err := oldService.GenerateToken(123, "testuser", "session-1")
+	require.NoError(t, err)
+
+	// После ротации токены старого ключа продолжают приниматься
+	verificationKey, err := NewVerificationKey(oldKey.Public)
+	require.NoError(t, err)
+	rotated, err := NewJWTServiceWithKeys(newKey, verificationKey)
+	require.NoError(t, err)
+
+	_, err = rotated.ValidateToken(oldToken)
+	assert.NoError(t, err)
+
+	newToken, err := rotated.GenerateToken(123, "testuser", "session-1")
+	require.NoError(t, err)
+	_, err = rotated.ValidateToken(newToken)
+	assert.NoError(t, err)
+
+	// Когда старый ключ убран из набора, его токены отклоняются
+	withoutOld, err := NewJWTServiceWithKeys(newKey)
+	require.NoError(t, err)
+	_, err = withoutOld.ValidateToken(oldToken)
+	assert.Error(t, err)
+
+	// Токены с общим секретом сервис с асимметричными ключами не принимает
+	hsToken, err := NewJWTService("test-secret-key").GenerateToken(123, "testuser", "session-1")
+	require.NoError(t, err)
+	_, err = rotated.ValidateToken(hsToken)
+	assert.Error(t, err)
+
+	jwks := rotated.JWKS()
+	require.Len(t, jwks.Keys, 2)
+	assert.Equal(t, newKey.ID, jwks.Keys[0].KeyID)
+	assert.Equal(t, "OKP", jwks.Keys[0].KeyType)
+	assert.Equal(t, "EdDSA", jwks.Keys[0].Alg)
+	assert.Equal(t, oldKey.ID, jwks.Keys[1].KeyID)
+}
+
+func TestNewSigningKey_RejectsShortRSA(t *testing.T) {
+	private, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+	_, err = NewSigningKey(private)
+	assert.Error(t, err)
+}
+
+func TestLoadKeyFiles(t *testing.T) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+
+	privateDER, err := x509.MarshalPKCS8PrivateKey(private)
+	require.NoError(t, err)
+	privatePath := filepath.Join(dir, "private.pem")
+	require.NoError(t, os.WriteFile(privatePath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER}), 0o600))
+
+	publicDER, err := x509.MarshalPKIXPublicKey(private.Public())
+	require.NoError(t, err)
+	publicPath := filepath.Join(dir, "public.pem")
+	require.NoError(t, os.WriteFile(publicPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}), 0o644))
+
+	signingKey, err := LoadSigningKeyFile(privatePath)
+	require.NoError(t, err)
+	assert.NotNil(t, signingKey.Private)
+
+	verificationKey, err := LoadVerificationKeyFile(publicPath)
+	require.NoError(t, err)
+	assert.Nil(t, verificationKey.Private)
+	assert.Equal(t, signingKey.ID, verificationKey.ID)
+
+	// Открытый ключ не годится для подписи
+	_, err = LoadSigningKeyFile(publicPath)
+	assert.Error(t, err)
+
+	_, err = LoadSigningKeyFile(filepath.Join(dir, "missing.pem"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxPasswordBytes максимальная длина пароля в байтах: bcrypt не принимает пароли длиннее
+const MaxPasswordBytes = 72
+
+// Требования к паролю по умолчанию
+const (
+	DefaultPasswordMinLength  = 8
+	DefaultPasswordMinClasses = 2
+)
+
+var ErrWeakPassword = errors.New("пароль не соответствует требованиям")
+
+// PasswordPolicy требования к стойкости пароля
+type PasswordPolicy struct {
+	// MinLength минимальная длина пароля в символах
+	MinLength int
+	// MinClasses сколько разных классов символов должно быть в пароле:
+	// строчные буквы, заглавные буквы, цифры, остальные символы
+	MinClasses int
+}
+
+// DefaultPasswordPolicy возвращает требования к паролю по умолчанию
+func DefaultPasswordPolicy() PasswordPolicy {
+	return PasswordPolicy{
+		MinLength:  DefaultPasswordMinLength,
+		MinClasses: DefaultPasswordMinClasses,
+	}
+}
+
+// Validate проверяет пароль пользователя с логином login
+func (p PasswordPolicy) Validate(login, password string) error {
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		return fmt.Errorf("%w: длина меньше %d символов", ErrWeakPassword, p.MinLength)
+	}
+	if len(password) > MaxPasswordBytes {
+		return fmt.Errorf("%w: длина больше %d байт", ErrWeakPassword, MaxPasswordBytes)
+	}
+
+	if classes := passwordClasses(password); classes < p.MinClasses {
+		return fmt.Errorf("%w: нужно не меньше %d из классов символов: строчные, заглавные, цифры, прочие",
+			ErrWeakPassword, p.MinClasses)
+	}
+
+	login = strings.ToLower(strings.TrimSpace(login))
+	if login != "" && strings.Contains(strings.ToLower(password), login) {
+		return fmt.Errorf("%w: пароль содержит логин", ErrWeakPassword)
+	}
+
+	return nil
+}
+
+// passwordClasses считает, сколько классов символов встречается в пароле
+func passwordClasses(password string) int {
+	var lower, upper, digit, other bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			other = true
+		}
+	}
+
+	classes := 0
+	for _, present := range []bool{lower, upper, digit, other} {
+		if present {
+			classes++
+		}
+	}
+	return classes
+}
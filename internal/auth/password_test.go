@@ -0,0 +1,42 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPasswordPolicy_Validate(t *testing.T) {
+	policy := DefaultPasswordPolicy()
+
+	tests := []struct {
+		name     string
+		login    string
+		password string
+		valid    bool
+	}{
+		{name: "Стойкий пароль", login: "ivan", password: "correct-horse-7", valid: true},
+		{name: "Пароль из разных классов", login: "ivan", password: "Пароль2024", valid: true},
+		{name: "Один символ", login: "a", password: "1", valid: false},
+		{name: "Короткий пароль", login: "ivan", password: "Ab1!", valid: false},
+		{name: "Один класс символов", login: "ivan", password: "abcdefghijk", valid: false},
+		{name: "Пароль содержит логин", login: "Ivan", password: "my-ivan-2024", valid: false},
+		{name: "Длиннее ограничения bcrypt", login: "ivan", password: strings.Repeat("Ab1", 25), valid: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := policy.Validate(tt.login, tt.password)
+			if tt.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, ErrWeakPassword)
+			}
+		})
+	}
+
+	// Требования настраиваются
+	relaxed := PasswordPolicy{MinLength: 4, MinClasses: 1}
+	assert.NoError(t, relaxed.Validate("ivan", "abcd"))
+}
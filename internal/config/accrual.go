@@ -0,0 +1,111 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/caarlos0/env/v11"
+)
+
+type AccrualConfigEnv struct {
+	RunAddress      HostAddress   `env:"RUN_ADDRESS,notEmpty"`
+	DatabaseURI     string        `env:"DATABASE_URI"`
+	RateLimit       int           `env:"ACCRUAL_RATE_LIMIT"`
+	ProcessInterval time.Duration `env:"ACCRUAL_PROCESS_INTERVAL"`
+}
+
+// AccrualConfig конфигурация эталонной системы расчета начислений (cmd/accrual)
+type AccrualConfig struct {
+	envs       AccrualConfigEnv
+	RunAddress HostAddress
+	// DatabaseURI адрес PostgreSQL, пустой - данные хранятся в памяти
+	DatabaseURI string
+	// RateLimit допустимое количество запросов информации о заказах в минуту, 0 - без ограничения
+	RateLimit int
+	// ProcessInterval интервал между шагами обработки заказов
+	ProcessInterval time.Duration
+
+	paramRunAddress      HostAddress
+	paramDatabaseURI     string
+	paramRateLimit       int
+	paramProcessInterval time.Duration
+}
+
+func NewAccrualConfig() *AccrualConfig {
+	return &AccrualConfig{
+		RunAddress: *NewHostAddress(),
+	}
+}
+
+func (ac *AccrualConfig) String() string {
+	return fmt.Sprintf("RunAddress=%s DatabaseURI=%s RateLimit=%d ProcessInterval=%s",
+		ac.RunAddress, ac.DatabaseURI, ac.RateLimit, ac.ProcessInterval)
+}
+
+func (ac *AccrualConfig) Init() {
+	ac.paramRunAddress = HostAddress{
+		Host: "localhost",
+		Port: 8081,
+	}
+
+	flag.Var(&ac.paramRunAddress, "a", "Net address host:port")
+	flag.StringVar(&ac.paramDatabaseURI, "d", "", "db uri, in-memory storage if empty")
+	flag.IntVar(&ac.paramRateLimit, "l", 0, "GET /api/orders requests per minute, 0 for no limit")
+	flag.DurationVar(&ac.paramProcessInterval, "i", time.Second, "interval between order processing steps")
+}
+
+func (ac *AccrualConfig) Parse() {
+	err := env.ParseWithOptions(&ac.envs, env.Options{
+		FuncMap: map[reflect.Type]env.ParserFunc{
+			reflect.TypeOf(HostAddress{}): func(v string) (interface{}, error) {
+				ha := NewHostAddress()
+				err := ha.Set(v)
+				return *ha, err
+			},
+		},
+	})
+
+	problemVars := make(map[string]bool)
+
+	if err != nil {
+		if err, ok := err.(env.AggregateError); ok {
+			for _, v := range err.Errors {
+				if err1, ok := v.(env.EmptyVarError); ok {
+					problemVars[err1.Key] = true
+				}
+
+				if err2, ok := v.(env.ParseError); ok {
+					problemVars[err2.Name] = true
+				}
+			}
+		}
+	}
+
+	flag.Parse()
+
+	if !problemVars["RUN_ADDRESS"] && !problemVars["RunAddress"] {
+		ac.RunAddress = ac.envs.RunAddress
+	} else {
+		ac.RunAddress = ac.paramRunAddress
+	}
+
+	if ac.envs.DatabaseURI != "" {
+		ac.DatabaseURI = ac.envs.DatabaseURI
+	} else {
+		ac.DatabaseURI = ac.paramDatabaseURI
+	}
+
+	if !problemVars["ACCRUAL_RATE_LIMIT"] && !problemVars["RateLimit"] && ac.envs.RateLimit > 0 {
+		ac.RateLimit = ac.envs.RateLimit
+	} else {
+		ac.RateLimit = ac.paramRateLimit
+	}
+
+	if !problemVars["ACCRUAL_PROCESS_INTERVAL"] && !problemVars["ProcessInterval"] && ac.envs.ProcessInterval > 0 {
+		ac.ProcessInterval = ac.envs.ProcessInterval
+	} else {
+		ac.ProcessInterval = ac.paramProcessInterval
+	}
+}
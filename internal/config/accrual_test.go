@@ -0,0 +1,78 @@
+package config
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestParseAccrualConfig(t *testing.T) {
+	tests := []struct {
+		name             string
+		envVars          map[string]string
+		flags            []string
+		expectedAddress  HostAddress
+		expectedDatabase string
+		expectedLimit    int
+		expectedInterval time.Duration
+	}{
+		{
+			name:             "Значения по умолчанию",
+			envVars:          map[string]string{"RUN_ADDRESS": "", "DATABASE_URI": "", "ACCRUAL_RATE_LIMIT": "", "ACCRUAL_PROCESS_INTERVAL": ""},
+			expectedAddress:  HostAddress{Host: "localhost", Port: 8081},
+			expectedInterval: time.Second,
+		},
+		{
+			name:             "Значения из флагов",
+			envVars:          map[string]string{"RUN_ADDRESS": "", "DATABASE_URI": "", "ACCRUAL_RATE_LIMIT": "", "ACCRUAL_PROCESS_INTERVAL": ""},
+			flags:            []string{"-a", "127.0.0.1:9000", "-d", "postgres://flag", "-l", "60", "-i", "200ms"},
+			expectedAddress:  HostAddress{Host: "127.0.0.1", Port: 9000},
+			expectedDatabase: "postgres://flag",
+			expectedLimit:    60,
+			expectedInterval: 200 * time.Millisecond,
+		},
+		{
+			name:             "Переменные окружения имеют приоритет над флагами",
+			envVars:          map[string]string{"RUN_ADDRESS": "localhost:9100", "DATABASE_URI": "postgres://env", "ACCRUAL_RATE_LIMIT": "10", "ACCRUAL_PROCESS_INTERVAL": "5s"},
+			flags:            []string{"-a", "127.0.0.1:9000", "-d", "postgres://flag", "-l", "60", "-i", "200ms"},
+			expectedAddress:  HostAddress{Host: "localhost", Port: 9100},
+			expectedDatabase: "postgres://env",
+			expectedLimit:    10,
+			expectedInterval: 5 * time.Second,
+		},
+		{
+			name:             "Некорректные переменные окружения",
+			envVars:          map[string]string{"RUN_ADDRESS": "нет порта", "DATABASE_URI": "", "ACCRUAL_RATE_LIMIT": "много", "ACCRUAL_PROCESS_INTERVAL": "часто"},
+			flags:            []string{"-l", "60"},
+			expectedAddress:  HostAddress{Host: "localhost", Port: 8081},
+			expectedLimit:    60,
+			expectedInterval: time.Second,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cleanup := setEnvVars(tt.envVars)
+			defer cleanup()
+
+			originalArgs := saveArgs()
+			defer restoreArgs(originalArgs)
+
+			resetFlags()
+			config := NewAccrualConfig()
+			config.Init()
+
+			os.Args = append([]string{"cmd"}, tt.flags...)
+			config.Parse()
+
+			assertHostAddress(t, tt.expectedAddress, config.RunAddress)
+			assertStringEqual(t, tt.expectedDatabase, config.DatabaseURI)
+			if config.RateLimit != tt.expectedLimit {
+				t.Errorf("Expected RateLimit %d, got %d", tt.expectedLimit, config.RateLimit)
+			}
+			if config.ProcessInterval != tt.expectedInterval {
+				t.Errorf("Expected ProcessInterval %s, got %s", tt.expectedInterval, config.ProcessInterval)
+			}
+		})
+	}
+}
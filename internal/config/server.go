@@ -2,17 +2,31 @@ package config
 
 import (
 	"flag"
+	"fmt"
+	"os"
 	"reflect"
 	"strings"
+	"time"
 
 	"github.com/caarlos0/env/v11"
 )
 
 type ServerConfigEnv struct {
-	AccrualSystemAddress string      `env:"ACCRUAL_SYSTEM_ADDRESS,notEmpty"`
-	RunAddress           HostAddress `env:"RUN_ADDRESS,notEmpty"`
-	DatabaseURI          string      `env:"DATABASE_URI,notEmpty"`
-	JWTSecret            string      `env:"JWT_SECRET"`
+	AccrualSystemAddress  string        `env:"ACCRUAL_SYSTEM_ADDRESS,notEmpty"`
+	RunAddress            HostAddress   `env:"RUN_ADDRESS,notEmpty"`
+	DatabaseURI           string        `env:"DATABASE_URI,notEmpty"`
+	JWTSecret             string        `env:"JWT_SECRET"`
+	JWTSecretFile         string        `env:"JWT_SECRET_FILE"`
+	DevMode               bool          `env:"DEV_MODE"`
+	JWTPrivateKeyFile     string        `env:"JWT_PRIVATE_KEY_FILE"`
+	JWTPublicKeyFiles     []string      `env:"JWT_PUBLIC_KEY_FILES"`
+	AccrualPollWorkers    int           `env:"ACCRUAL_POLL_WORKERS"`
+	AccrualGiveUp         int           `env:"ACCRUAL_GIVE_UP_ATTEMPTS"`
+	AccrualPollTimeout    time.Duration `env:"ACCRUAL_POLL_TIMEOUT"`
+	PasswordMinLength     int           `env:"PASSWORD_MIN_LENGTH"`
+	PasswordMinClasses    int           `env:"PASSWORD_MIN_CLASSES"`
+	AccrualCallbackSecret string        `env:"ACCRUAL_CALLBACK_SECRET"`
+	StorageBackend        string        `env:"STORAGE_BACKEND"`
 }
 
 type ServerConfig struct {
@@ -21,11 +35,50 @@ type ServerConfig struct {
 	RunAddress           HostAddress
 	DatabaseURI          string
 	JWTSecret            string
+	AccrualPollWorkers   int
+	AccrualGiveUp        int
+	PasswordMinLength    int
 
-	paramAccrualSystemAddress string
-	paramRunAddress           HostAddress
-	paramDatabaseURI          string
-	paramJWTSecret            string
+	// AccrualPollTimeout предельное время цикла опроса accrual системы и срок аренды заказов цикла.
+	// Должно превышать время повторных попыток запроса к accrual системе
+	AccrualPollTimeout time.Duration
+	PasswordMinClasses int
+
+	// JWTSecretFile путь к файлу с секретом JWT, например к секрету контейнера.
+	// Используется, если сам секрет не задан
+	JWTSecretFile string
+	// DevMode разрешает слабый секрет JWT, только для локальной разработки
+	DevMode bool
+
+	// JWTPrivateKeyFile путь к PEM файлу закрытого RSA или Ed25519 ключа подписи токенов.
+	// Если задан, токены подписываются им вместо JWTSecret
+	JWTPrivateKeyFile string
+	// JWTPublicKeyFiles пути к PEM файлам ключей, токены которых еще принимаются после ротации
+	JWTPublicKeyFiles []string
+
+	// AccrualCallbackSecret общий секрет подписи уведомлений accrual системы.
+	// Пустой - прием уведомлений отключен, статусы обновляются только опросом
+	AccrualCallbackSecret string
+
+	// StorageBackend хранилище данных: postgres, sqlite или memory.
+	// Для sqlite DatabaseURI - путь к файлу базы, для memory DatabaseURI не нужен
+	StorageBackend string
+
+	paramAccrualSystemAddress  string
+	paramRunAddress            HostAddress
+	paramDatabaseURI           string
+	paramJWTSecret             string
+	paramJWTSecretFile         string
+	paramDevMode               bool
+	paramJWTPrivateKeyFile     string
+	paramJWTPublicKeyFiles     string
+	paramAccrualPollWorkers    int
+	paramAccrualGiveUp         int
+	paramAccrualPollTimeout    time.Duration
+	paramPasswordMinLength     int
+	paramPasswordMinClasses    int
+	paramAccrualCallbackSecret string
+	paramStorageBackend        string
 }
 
 func NewServerConfig() *ServerConfig {
@@ -34,6 +87,22 @@ func NewServerConfig() *ServerConfig {
 	}
 }
 
+// String выводит конфигурацию без секретов JWT и уведомлений accrual системы
+func (se *ServerConfig) String() string {
+	secret := ""
+	if se.JWTSecret != "" {
+		secret = "***"
+	}
+	callbackSecret := ""
+	if se.AccrualCallbackSecret != "" {
+		callbackSecret = "***"
+	}
+	return fmt.Sprintf("AccrualSystemAddress=%s RunAddress=%s StorageBackend=%s DatabaseURI=%s JWTSecret=%s JWTSecretFile=%s JWTPrivateKeyFile=%s JWTPublicKeyFiles=%v DevMode=%t AccrualPollWorkers=%d AccrualGiveUp=%d AccrualPollTimeout=%s PasswordMinLength=%d PasswordMinClasses=%d AccrualCallbackSecret=%s",
+		se.AccrualSystemAddress, se.RunAddress, se.StorageBackend, se.DatabaseURI, secret, se.JWTSecretFile,
+		se.JWTPrivateKeyFile, se.JWTPublicKeyFiles, se.DevMode, se.AccrualPollWorkers, se.AccrualGiveUp,
+		se.AccrualPollTimeout, se.PasswordMinLength, se.PasswordMinClasses, callbackSecret)
+}
+
 func (se *ServerConfig) Init() {
 	se.paramRunAddress = HostAddress{
 		Host: "localhost",
@@ -41,9 +110,20 @@ func (se *ServerConfig) Init() {
 	}
 
 	flag.Var(&se.paramRunAddress, "a", "Net address host:port")
-	flag.StringVar(&se.paramDatabaseURI, "d", "", "db uri")
+	flag.StringVar(&se.paramDatabaseURI, "d", "", "db uri, SQLite database file path for sqlite storage")
+	flag.StringVar(&se.paramStorageBackend, "storage", StorageBackendPostgres, "storage backend: postgres, sqlite or memory")
 	flag.StringVar(&se.paramAccrualSystemAddress, "r", "http://localhost:8081", "Net accrual address http://host:port")
-	flag.StringVar(&se.paramJWTSecret, "j", "default-secret-key", "JWT secret key")
+	flag.StringVar(&se.paramJWTSecret, "j", "", "JWT secret key")
+	flag.StringVar(&se.paramJWTSecretFile, "s", "", "file with JWT secret key")
+	flag.BoolVar(&se.paramDevMode, "dev", false, "development mode, allows weak JWT secret")
+	flag.StringVar(&se.paramJWTPrivateKeyFile, "k", "", "PEM file with RSA or Ed25519 private key for signing JWT")
+	flag.StringVar(&se.paramJWTPublicKeyFiles, "v", "", "comma separated PEM files with previous JWT verification keys")
+	flag.IntVar(&se.paramAccrualPollWorkers, "w", 10, "number of concurrent accrual polling workers")
+	flag.IntVar(&se.paramPasswordMinLength, "password-min-length", 8, "minimal password length")
+	flag.IntVar(&se.paramPasswordMinClasses, "password-min-classes", 2, "minimal number of character classes in password: lower, upper, digits, other")
+	flag.IntVar(&se.paramAccrualGiveUp, "g", 20, "accrual polls before an unregistered order is marked INVALID, 0 to never give up")
+	flag.DurationVar(&se.paramAccrualPollTimeout, "poll-timeout", 15*time.Second, "accrual polling cycle deadline and order lease, must exceed accrual request retries")
+	flag.StringVar(&se.paramAccrualCallbackSecret, "callback-secret", "", "HMAC secret of accrual status callbacks, callbacks are disabled if empty")
 }
 
 func (se *ServerConfig) Parse() {
@@ -109,11 +189,96 @@ func (se *ServerConfig) Parse() {
 		se.DatabaseURI = se.paramDatabaseURI
 	}
 
-	_, ok1 = problemVars["JWT_SECRET"]
-	_, ok2 = problemVars["JWTSecret"]
-	if !ok1 && !ok2 {
+	// Секрет из окружения приоритетнее флагов, пустая переменная окружения флаг не перекрывает.
+	// Файл с секретом читается в Validate
+	switch {
+	case se.envs.JWTSecret != "":
 		se.JWTSecret = se.envs.JWTSecret
-	} else {
+	case se.envs.JWTSecretFile != "":
+		se.JWTSecretFile = se.envs.JWTSecretFile
+	default:
 		se.JWTSecret = se.paramJWTSecret
+		se.JWTSecretFile = se.paramJWTSecretFile
+	}
+
+	_, ok1 = problemVars["DEV_MODE"]
+	_, ok2 = problemVars["DevMode"]
+	se.DevMode = se.paramDevMode || (!ok1 && !ok2 && se.envs.DevMode)
+
+	if se.envs.JWTPrivateKeyFile != "" {
+		se.JWTPrivateKeyFile = se.envs.JWTPrivateKeyFile
+	} else {
+		se.JWTPrivateKeyFile = se.paramJWTPrivateKeyFile
+	}
+
+	if len(se.envs.JWTPublicKeyFiles) > 0 {
+		se.JWTPublicKeyFiles = se.envs.JWTPublicKeyFiles
+	} else {
+		se.JWTPublicKeyFiles = splitList(se.paramJWTPublicKeyFiles)
+	}
+
+	_, ok1 = problemVars["ACCRUAL_POLL_WORKERS"]
+	_, ok2 = problemVars["AccrualPollWorkers"]
+	if !ok1 && !ok2 && se.envs.AccrualPollWorkers > 0 {
+		se.AccrualPollWorkers = se.envs.AccrualPollWorkers
+	} else {
+		se.AccrualPollWorkers = se.paramAccrualPollWorkers
+	}
+
+	// 0 отключает отказ от опроса, поэтому переменная окружения применяется,
+	// если она задана, а не только при положительном значении
+	_, ok1 = problemVars["ACCRUAL_GIVE_UP_ATTEMPTS"]
+	_, ok2 = problemVars["AccrualGiveUp"]
+	if giveUp, set := os.LookupEnv("ACCRUAL_GIVE_UP_ATTEMPTS"); set && giveUp != "" && !ok1 && !ok2 {
+		se.AccrualGiveUp = se.envs.AccrualGiveUp
+	} else {
+		se.AccrualGiveUp = se.paramAccrualGiveUp
+	}
+
+	_, ok1 = problemVars["ACCRUAL_POLL_TIMEOUT"]
+	_, ok2 = problemVars["AccrualPollTimeout"]
+	if !ok1 && !ok2 && se.envs.AccrualPollTimeout > 0 {
+		se.AccrualPollTimeout = se.envs.AccrualPollTimeout
+	} else {
+		se.AccrualPollTimeout = se.paramAccrualPollTimeout
+	}
+
+	_, ok1 = problemVars["PASSWORD_MIN_LENGTH"]
+	_, ok2 = problemVars["PasswordMinLength"]
+	if !ok1 && !ok2 && se.envs.PasswordMinLength > 0 {
+		se.PasswordMinLength = se.envs.PasswordMinLength
+	} else {
+		se.PasswordMinLength = se.paramPasswordMinLength
+	}
+
+	_, ok1 = problemVars["PASSWORD_MIN_CLASSES"]
+	_, ok2 = problemVars["PasswordMinClasses"]
+	if !ok1 && !ok2 && se.envs.PasswordMinClasses > 0 {
+		se.PasswordMinClasses = se.envs.PasswordMinClasses
+	} else {
+		se.PasswordMinClasses = se.paramPasswordMinClasses
+	}
+
+	if se.envs.AccrualCallbackSecret != "" {
+		se.AccrualCallbackSecret = se.envs.AccrualCallbackSecret
+	} else {
+		se.AccrualCallbackSecret = se.paramAccrualCallbackSecret
+	}
+
+	if se.envs.StorageBackend != "" {
+		se.StorageBackend = se.envs.StorageBackend
+	} else {
+		se.StorageBackend = se.paramStorageBackend
+	}
+}
+
+// splitList разбивает список значений через запятую, пропуская пустые элементы
+func splitList(v string) []string {
+	var items []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
 	}
+	return items
 }
@@ -3,7 +3,9 @@ package config
 import (
 	"flag"
 	"os"
+	"reflect"
 	"testing"
+	"time"
 )
 
 // Вспомогательные функции для тестов
@@ -830,6 +832,228 @@ func TestParseWithInvalidEnvVars(t *testing.T) {
 	}
 }
 
+// Тесты для параметров опроса accrual системы
+func TestParseAccrualPollSettings(t *testing.T) {
+	tests := []struct {
+		name            string
+		envVars         map[string]string
+		flags           []string
+		expectedWorkers int
+		expectedGiveUp  int
+		expectedTimeout time.Duration
+	}{
+		{
+			name:            "Значения по умолчанию",
+			envVars:         map[string]string{"ACCRUAL_POLL_WORKERS": "", "ACCRUAL_GIVE_UP_ATTEMPTS": "", "ACCRUAL_POLL_TIMEOUT": ""},
+			flags:           []string{},
+			expectedWorkers: 10,
+			expectedGiveUp:  20,
+			expectedTimeout: 15 * time.Second,
+		},
+		{
+			name:            "Значения из флагов",
+			envVars:         map[string]string{"ACCRUAL_POLL_WORKERS": "", "ACCRUAL_GIVE_UP_ATTEMPTS": "", "ACCRUAL_POLL_TIMEOUT": ""},
+			flags:           []string{"-w", "4", "-g", "0", "-poll-timeout", "30s"},
+			expectedWorkers: 4,
+			expectedGiveUp:  0,
+			expectedTimeout: 30 * time.Second,
+		},
+		{
+			name:            "Переменные окружения имеют приоритет над флагами",
+			envVars:         map[string]string{"ACCRUAL_POLL_WORKERS": "32", "ACCRUAL_GIVE_UP_ATTEMPTS": "5", "ACCRUAL_POLL_TIMEOUT": "1m"},
+			flags:           []string{"-w", "4", "-g", "7", "-poll-timeout", "30s"},
+			expectedWorkers: 32,
+			expectedGiveUp:  5,
+			expectedTimeout: time.Minute,
+		},
+		{
+			name:            "Ноль в переменной окружения отключает отказ от опроса",
+			envVars:         map[string]string{"ACCRUAL_POLL_WORKERS": "", "ACCRUAL_GIVE_UP_ATTEMPTS": "0", "ACCRUAL_POLL_TIMEOUT": ""},
+			flags:           []string{"-g", "7"},
+			expectedWorkers: 10,
+			expectedGiveUp:  0,
+			expectedTimeout: 15 * time.Second,
+		},
+		{
+			name:            "Некорректные переменные окружения",
+			envVars:         map[string]string{"ACCRUAL_POLL_WORKERS": "много", "ACCRUAL_GIVE_UP_ATTEMPTS": "никогда", "ACCRUAL_POLL_TIMEOUT": "долго"},
+			flags:           []string{"-w", "4", "-g", "7", "-poll-timeout", "30s"},
+			expectedWorkers: 4,
+			expectedGiveUp:  7,
+			expectedTimeout: 30 * time.Second,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cleanup := setEnvVars(tt.envVars)
+			defer cleanup()
+
+			originalArgs := saveArgs()
+			defer restoreArgs(originalArgs)
+
+			config := createTestConfig()
+			config.Init()
+
+			os.Args = append([]string{"cmd"}, tt.flags...)
+			config.Parse()
+
+			if config.AccrualPollWorkers != tt.expectedWorkers {
+				t.Errorf("Expected AccrualPollWorkers %d, got %d", tt.expectedWorkers, config.AccrualPollWorkers)
+			}
+			if config.AccrualGiveUp != tt.expectedGiveUp {
+				t.Errorf("Expected AccrualGiveUp %d, got %d", tt.expectedGiveUp, config.AccrualGiveUp)
+			}
+			if config.AccrualPollTimeout != tt.expectedTimeout {
+				t.Errorf("Expected AccrualPollTimeout %s, got %s", tt.expectedTimeout, config.AccrualPollTimeout)
+			}
+		})
+	}
+}
+
+func TestParseAccrualCallbackSecret(t *testing.T) {
+	tests := []struct {
+		name     string
+		envVars  map[string]string
+		flags    []string
+		expected string
+	}{
+		{
+			name:     "Прием уведомлений отключен по умолчанию",
+			envVars:  map[string]string{"ACCRUAL_CALLBACK_SECRET": ""},
+			flags:    []string{},
+			expected: "",
+		},
+		{
+			name:     "Секрет из флага",
+			envVars:  map[string]string{"ACCRUAL_CALLBACK_SECRET": ""},
+			flags:    []string{"-callback-secret", "flag-secret"},
+			expected: "flag-secret",
+		},
+		{
+			name:     "Переменная окружения имеет приоритет над флагом",
+			envVars:  map[string]string{"ACCRUAL_CALLBACK_SECRET": "env-secret"},
+			flags:    []string{"-callback-secret", "flag-secret"},
+			expected: "env-secret",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cleanup := setEnvVars(tt.envVars)
+			defer cleanup()
+
+			originalArgs := saveArgs()
+			defer restoreArgs(originalArgs)
+
+			config := createTestConfig()
+			config.Init()
+
+			os.Args = append([]string{"cmd"}, tt.flags...)
+			config.Parse()
+
+			assertStringEqual(t, tt.expected, config.AccrualCallbackSecret)
+		})
+	}
+}
+
+func TestParseStorageBackend(t *testing.T) {
+	tests := []struct {
+		name     string
+		envVars  map[string]string
+		flags    []string
+		expected string
+	}{
+		{
+			name:     "PostgreSQL по умолчанию",
+			envVars:  map[string]string{"STORAGE_BACKEND": ""},
+			flags:    []string{},
+			expected: StorageBackendPostgres,
+		},
+		{
+			name:     "Хранилище из флага",
+			envVars:  map[string]string{"STORAGE_BACKEND": ""},
+			flags:    []string{"-storage", StorageBackendSQLite},
+			expected: StorageBackendSQLite,
+		},
+		{
+			name:     "Переменная окружения имеет приоритет над флагом",
+			envVars:  map[string]string{"STORAGE_BACKEND": StorageBackendMemory},
+			flags:    []string{"-storage", StorageBackendSQLite},
+			expected: StorageBackendMemory,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cleanup := setEnvVars(tt.envVars)
+			defer cleanup()
+
+			originalArgs := saveArgs()
+			defer restoreArgs(originalArgs)
+
+			config := createTestConfig()
+			config.Init()
+
+			os.Args = append([]string{"cmd"}, tt.flags...)
+			config.Parse()
+
+			assertStringEqual(t, tt.expected, config.StorageBackend)
+		})
+	}
+}
+
+func TestParseJWTKeyFiles(t *testing.T) {
+	tests := []struct {
+		name               string
+		envVars            map[string]string
+		flags              []string
+		expectedPrivateKey string
+		expectedPublicKeys []string
+	}{
+		{
+			name:    "Ключи не заданы",
+			envVars: map[string]string{"JWT_PRIVATE_KEY_FILE": "", "JWT_PUBLIC_KEY_FILES": ""},
+			flags:   []string{},
+		},
+		{
+			name:               "Ключи из флагов",
+			envVars:            map[string]string{"JWT_PRIVATE_KEY_FILE": "", "JWT_PUBLIC_KEY_FILES": ""},
+			flags:              []string{"-k", "keys/current.pem", "-v", "keys/old1.pem, keys/old2.pem,"},
+			expectedPrivateKey: "keys/current.pem",
+			expectedPublicKeys: []string{"keys/old1.pem", "keys/old2.pem"},
+		},
+		{
+			name:               "Переменные окружения имеют приоритет над флагами",
+			envVars:            map[string]string{"JWT_PRIVATE_KEY_FILE": "/etc/jwt/current.pem", "JWT_PUBLIC_KEY_FILES": "/etc/jwt/old.pem"},
+			flags:              []string{"-k", "keys/current.pem", "-v", "keys/old1.pem"},
+			expectedPrivateKey: "/etc/jwt/current.pem",
+			expectedPublicKeys: []string{"/etc/jwt/old.pem"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cleanup := setEnvVars(tt.envVars)
+			defer cleanup()
+
+			originalArgs := saveArgs()
+			defer restoreArgs(originalArgs)
+
+			config := createTestConfig()
+			config.Init()
+
+			os.Args = append([]string{"cmd"}, tt.flags...)
+			config.Parse()
+
+			assertStringEqual(t, tt.expectedPrivateKey, config.JWTPrivateKeyFile)
+			if !reflect.DeepEqual(tt.expectedPublicKeys, config.JWTPublicKeyFiles) {
+				t.Errorf("Expected JWTPublicKeyFiles %v, got %v", tt.expectedPublicKeys, config.JWTPublicKeyFiles)
+			}
+		})
+	}
+}
+
 // Бенчмарки для производительности
 func BenchmarkNewServerConfig(b *testing.B) {
 	for i := 0; i < b.N; i++ {
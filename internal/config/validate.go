@@ -0,0 +1,146 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+)
+
+// Требования к секрету JWT
+const (
+	MinJWTSecretLength      = 32
+	MinJWTSecretEntropyBits = 128
+)
+
+var (
+	ErrJWTSecretMissing = errors.New("не задан секрет JWT: укажите JWT_SECRET, JWT_SECRET_FILE или ключ подписи JWT_PRIVATE_KEY_FILE")
+	ErrJWTSecretWeak    = errors.New("слабый секрет JWT")
+
+	ErrCallbackSecretWeak = errors.New("слабый секрет уведомлений accrual системы")
+
+	ErrStorageBackendUnknown = errors.New("неизвестное хранилище: укажите STORAGE_BACKEND postgres, sqlite или memory")
+	ErrDatabaseURIMissing    = errors.New("не задан адрес PostgreSQL: укажите DATABASE_URI или выберите STORAGE_BACKEND sqlite или memory")
+
+	ErrAccrualGiveUpNegative = errors.New("отрицательное ACCRUAL_GIVE_UP_ATTEMPTS: укажите 0, чтобы не отказываться от опроса, или положительное число")
+)
+
+// Хранилища данных gophermart
+const (
+	StorageBackendPostgres = "postgres"
+	StorageBackendSQLite   = "sqlite"
+	StorageBackendMemory   = "memory"
+)
+
+// DefaultSQLitePath файл базы SQLite, если DatabaseURI не задан
+const DefaultSQLitePath = "gophermart.db"
+
+// knownWeakSecrets общеизвестные значения, которые отклоняются как секрет. В режиме разработки
+// стойкость секрета не проверяется, поэтому там они допускаются, как и любой другой непустой секрет
+var knownWeakSecrets = map[string]bool{
+	"default-secret-key": true,
+	"secret":             true,
+	"changeme":           true,
+	"jwt-secret":         true,
+}
+
+// Validate проверяет конфигурацию после Parse: проверяет выбор хранилища, загружает секрет JWT
+// из файла, если он задан файлом, и проверяет его стойкость. В режиме разработки слабый секрет
+// допускается, но не пустой. Секрет уведомлений accrual системы, если задан, проверяется так же
+func (se *ServerConfig) Validate() error {
+	if err := se.validateStorage(); err != nil {
+		return err
+	}
+
+	if se.AccrualGiveUp < 0 {
+		return fmt.Errorf("%w: %d", ErrAccrualGiveUpNegative, se.AccrualGiveUp)
+	}
+
+	if se.AccrualCallbackSecret != "" && !se.DevMode {
+		if err := validateJWTSecret(se.AccrualCallbackSecret); err != nil {
+			return fmt.Errorf("%w: %v", ErrCallbackSecretWeak, err)
+		}
+	}
+
+	if se.JWTPrivateKeyFile != "" {
+		// Токены подписываются асимметричным ключом, секрет не используется
+		return nil
+	}
+
+	if se.JWTSecret == "" && se.JWTSecretFile != "" {
+		data, err := os.ReadFile(se.JWTSecretFile)
+		if err != nil {
+			return fmt.Errorf("ошибка при чтении секрета JWT из файла: %w", err)
+		}
+		se.JWTSecret = strings.TrimRight(string(data), "\r\n")
+	}
+
+	if se.JWTSecret == "" {
+		return ErrJWTSecretMissing
+	}
+
+	if se.DevMode {
+		return nil
+	}
+
+	return validateJWTSecret(se.JWTSecret)
+}
+
+// validateStorage проверяет хранилище и его адрес. Для SQLite без адреса используется DefaultSQLitePath
+func (se *ServerConfig) validateStorage() error {
+	switch se.StorageBackend {
+	case StorageBackendPostgres:
+		if se.DatabaseURI == "" {
+			return ErrDatabaseURIMissing
+		}
+	case StorageBackendSQLite:
+		if se.DatabaseURI == "" {
+			se.DatabaseURI = DefaultSQLitePath
+		}
+	case StorageBackendMemory:
+	default:
+		return fmt.Errorf("%w: %q", ErrStorageBackendUnknown, se.StorageBackend)
+	}
+	return nil
+}
+
+// validateJWTSecret проверяет длину секрета и оценку его энтропии
+func validateJWTSecret(secret string) error {
+	if knownWeakSecrets[strings.ToLower(secret)] {
+		return fmt.Errorf("%w: используется общеизвестное значение", ErrJWTSecretWeak)
+	}
+
+	if len(secret) < MinJWTSecretLength {
+		return fmt.Errorf("%w: длина %d байт, нужно не меньше %d (например, openssl rand -base64 48)",
+			ErrJWTSecretWeak, len(secret), MinJWTSecretLength)
+	}
+
+	if bits := estimateEntropyBits(secret); bits < MinJWTSecretEntropyBits {
+		return fmt.Errorf("%w: оценка энтропии %.0f бит, нужно не меньше %d (например, openssl rand -base64 48)",
+			ErrJWTSecretWeak, bits, MinJWTSecretEntropyBits)
+	}
+
+	return nil
+}
+
+// estimateEntropyBits оценивает энтропию строки по частотам ее байтов (энтропия Шеннона на длину).
+// Повторяющиеся и однообразные строки получают низкую оценку
+func estimateEntropyBits(s string) float64 {
+	if len(s) == 0 {
+		return 0
+	}
+
+	counts := make(map[byte]int)
+	for i := 0; i < len(s); i++ {
+		counts[s[i]]++
+	}
+
+	var perByte float64
+	for _, count := range counts {
+		p := float64(count) / float64(len(s))
+		perByte -= p * math.Log2(p)
+	}
+
+	return perByte * float64(len(s))
+}
@@ -0,0 +1,251 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const strongTestSecret = "q3Vn8Zr1XyTb6Lw0PeKd4Hs9Ja2Mf7Uc5Gi-Rt_Ox"
+
+func TestValidateJWTSecret(t *testing.T) {
+	dir := t.TempDir()
+	secretFile := filepath.Join(dir, "jwt_secret")
+	if err := os.WriteFile(secretFile, []byte(strongTestSecret+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name           string
+		config         ServerConfig
+		expectedErr    error
+		expectedSecret string
+	}{
+		{
+			name:        "Секрет не задан",
+			config:      ServerConfig{},
+			expectedErr: ErrJWTSecretMissing,
+		},
+		{
+			name:        "Общеизвестный секрет",
+			config:      ServerConfig{JWTSecret: "default-secret-key"},
+			expectedErr: ErrJWTSecretWeak,
+		},
+		{
+			name:        "Короткий секрет",
+			config:      ServerConfig{JWTSecret: "Zr1XyTb6Lw0P"},
+			expectedErr: ErrJWTSecretWeak,
+		},
+		{
+			name:        "Секрет с низкой энтропией",
+			config:      ServerConfig{JWTSecret: "abababababababababababababababababababab"},
+			expectedErr: ErrJWTSecretWeak,
+		},
+		{
+			name:           "Стойкий секрет",
+			config:         ServerConfig{JWTSecret: strongTestSecret},
+			expectedSecret: strongTestSecret,
+		},
+		{
+			name:           "Слабый секрет в режиме разработки",
+			config:         ServerConfig{JWTSecret: "secret", DevMode: true},
+			expectedSecret: "secret",
+		},
+		{
+			name:        "Пустой секрет в режиме разработки",
+			config:      ServerConfig{DevMode: true},
+			expectedErr: ErrJWTSecretMissing,
+		},
+		{
+			name:           "Секрет из файла",
+			config:         ServerConfig{JWTSecretFile: secretFile},
+			expectedSecret: strongTestSecret,
+		},
+		{
+			name:        "Файл с секретом не найден",
+			config:      ServerConfig{JWTSecretFile: filepath.Join(dir, "missing")},
+			expectedErr: os.ErrNotExist,
+		},
+		{
+			name:   "Подпись асимметричным ключом",
+			config: ServerConfig{JWTPrivateKeyFile: "keys/current.pem"},
+		},
+		{
+			name:        "Слабый секрет уведомлений accrual",
+			config:      ServerConfig{JWTSecret: strongTestSecret, AccrualCallbackSecret: "callback"},
+			expectedErr: ErrCallbackSecretWeak,
+		},
+		{
+			name:        "Слабый секрет уведомлений accrual при подписи асимметричным ключом",
+			config:      ServerConfig{JWTPrivateKeyFile: "keys/current.pem", AccrualCallbackSecret: "callback"},
+			expectedErr: ErrCallbackSecretWeak,
+		},
+		{
+			name:           "Слабый секрет уведомлений accrual в режиме разработки",
+			config:         ServerConfig{JWTSecret: "secret", AccrualCallbackSecret: "callback", DevMode: true},
+			expectedSecret: "secret",
+		},
+		{
+			name:           "Стойкий секрет уведомлений accrual",
+			config:         ServerConfig{JWTSecret: strongTestSecret, AccrualCallbackSecret: strongTestSecret},
+			expectedSecret: strongTestSecret,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := tt.config
+			// Выбор хранилища проверяется в TestValidateStorage
+			config.StorageBackend = StorageBackendMemory
+			err := config.Validate()
+
+			if tt.expectedErr == nil && err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if tt.expectedErr != nil {
+				if !errors.Is(err, tt.expectedErr) {
+					t.Fatalf("Expected error %v, got %v", tt.expectedErr, err)
+				}
+				return
+			}
+			assertStringEqual(t, tt.expectedSecret, config.JWTSecret)
+		})
+	}
+}
+
+func TestValidateStorage(t *testing.T) {
+	tests := []struct {
+		name                string
+		config              ServerConfig
+		expectedErr         error
+		expectedDatabaseURI string
+	}{
+		{
+			name:                "PostgreSQL",
+			config:              ServerConfig{StorageBackend: StorageBackendPostgres, DatabaseURI: "postgres://localhost/gophermart"},
+			expectedDatabaseURI: "postgres://localhost/gophermart",
+		},
+		{
+			name:        "PostgreSQL без адреса",
+			config:      ServerConfig{StorageBackend: StorageBackendPostgres},
+			expectedErr: ErrDatabaseURIMissing,
+		},
+		{
+			name:                "SQLite с путем к файлу",
+			config:              ServerConfig{StorageBackend: StorageBackendSQLite, DatabaseURI: "/var/lib/gophermart/data.db"},
+			expectedDatabaseURI: "/var/lib/gophermart/data.db",
+		},
+		{
+			name:                "SQLite с файлом по умолчанию",
+			config:              ServerConfig{StorageBackend: StorageBackendSQLite},
+			expectedDatabaseURI: DefaultSQLitePath,
+		},
+		{
+			name:   "Хранилище в памяти",
+			config: ServerConfig{StorageBackend: StorageBackendMemory},
+		},
+		{
+			name:        "Неизвестное хранилище",
+			config:      ServerConfig{StorageBackend: "mysql", DatabaseURI: "mysql://localhost/gophermart"},
+			expectedErr: ErrStorageBackendUnknown,
+		},
+		{
+			name:        "Хранилище не выбрано",
+			config:      ServerConfig{},
+			expectedErr: ErrStorageBackendUnknown,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := tt.config
+			config.JWTSecret = strongTestSecret
+			err := config.Validate()
+
+			if tt.expectedErr == nil && err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if tt.expectedErr != nil {
+				if !errors.Is(err, tt.expectedErr) {
+					t.Fatalf("Expected error %v, got %v", tt.expectedErr, err)
+				}
+				return
+			}
+			assertStringEqual(t, tt.expectedDatabaseURI, config.DatabaseURI)
+		})
+	}
+}
+
+func TestValidateAccrualGiveUp(t *testing.T) {
+	for _, giveUp := range []int{0, 20} {
+		config := ServerConfig{StorageBackend: StorageBackendMemory, JWTSecret: strongTestSecret, AccrualGiveUp: giveUp}
+		if err := config.Validate(); err != nil {
+			t.Errorf("AccrualGiveUp=%d: expected no error, got %v", giveUp, err)
+		}
+	}
+
+	config := ServerConfig{StorageBackend: StorageBackendMemory, JWTSecret: strongTestSecret, AccrualGiveUp: -1}
+	if err := config.Validate(); !errors.Is(err, ErrAccrualGiveUpNegative) {
+		t.Errorf("Expected error %v, got %v", ErrAccrualGiveUpNegative, err)
+	}
+}
+
+func TestParseJWTSecretSources(t *testing.T) {
+	tests := []struct {
+		name               string
+		envVars            map[string]string
+		flags              []string
+		expectedSecret     string
+		expectedSecretFile string
+		expectedDevMode    bool
+	}{
+		{
+			name:    "Секрет не задан",
+			envVars: map[string]string{"JWT_SECRET": "", "JWT_SECRET_FILE": "", "DEV_MODE": ""},
+			flags:   []string{},
+		},
+		{
+			name:               "Файл из окружения приоритетнее флага с секретом",
+			envVars:            map[string]string{"JWT_SECRET": "", "JWT_SECRET_FILE": "/run/secrets/jwt", "DEV_MODE": ""},
+			flags:              []string{"-j", "flag-secret"},
+			expectedSecretFile: "/run/secrets/jwt",
+		},
+		{
+			name:            "Секрет из окружения и режим разработки",
+			envVars:         map[string]string{"JWT_SECRET": "env-secret", "JWT_SECRET_FILE": "/run/secrets/jwt", "DEV_MODE": "true"},
+			flags:           []string{"-j", "flag-secret"},
+			expectedSecret:  "env-secret",
+			expectedDevMode: true,
+		},
+		{
+			name:            "Значения из флагов",
+			envVars:         map[string]string{"JWT_SECRET": "", "JWT_SECRET_FILE": "", "DEV_MODE": ""},
+			flags:           []string{"-j", "flag-secret", "-dev"},
+			expectedSecret:  "flag-secret",
+			expectedDevMode: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cleanup := setEnvVars(tt.envVars)
+			defer cleanup()
+
+			originalArgs := saveArgs()
+			defer restoreArgs(originalArgs)
+
+			config := createTestConfig()
+			config.Init()
+
+			os.Args = append([]string{"cmd"}, tt.flags...)
+			config.Parse()
+
+			assertStringEqual(t, tt.expectedSecret, config.JWTSecret)
+			assertStringEqual(t, tt.expectedSecretFile, config.JWTSecretFile)
+			if config.DevMode != tt.expectedDevMode {
+				t.Errorf("Expected DevMode %t, got %t", tt.expectedDevMode, config.DevMode)
+			}
+		})
+	}
+}
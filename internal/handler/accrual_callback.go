@@ -0,0 +1,164 @@
+package handler
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/paxren/go-musthave-diploma-tpl/internal/models"
+	"github.com/paxren/go-musthave-diploma-tpl/internal/repository"
+	"github.com/paxren/go-musthave-diploma-tpl/internal/services"
+)
+
+// Заголовки подписи уведомления accrual системы
+const (
+	// AccrualTimestampHeader время отправки уведомления, Unix время в секундах
+	AccrualTimestampHeader = "X-Accrual-Timestamp"
+	// AccrualSignatureHeader подпись уведомления: "sha256=" и HMAC-SHA256 в hex
+	// от строки "<timestamp>.<тело запроса>" на общем секрете
+	AccrualSignatureHeader = "X-Accrual-Signature"
+)
+
+const (
+	// DefaultCallbackTolerance допустимое расхождение времени отправки уведомления с текущим.
+	// Перехваченное уведомление нельзя повторить позже этого срока
+	DefaultCallbackTolerance = 5 * time.Minute
+
+	// maxCallbackBody максимальный размер тела уведомления
+	maxCallbackBody = 64 << 10
+
+	accrualSignaturePrefix = "sha256="
+)
+
+// ErrInvalidSignature уведомление без подписи, с неверной подписью или устаревшее
+var ErrInvalidSignature = errors.New("неверная подпись уведомления")
+
+// AccrualCallback принимает уведомления об изменении статуса заказов от accrual системы
+// или ретранслятора. Уведомление применяется по тем же правилам, что и результат опроса,
+// опрос остается запасным способом сверки
+type AccrualCallback struct {
+	orderRepo repository.OrderBase
+	updater   *services.AccrualUpdater
+	secret    []byte
+	tolerance time.Duration
+	now       func() time.Time
+}
+
+// NewAccrualCallback создает обработчик уведомлений, подписанных секретом secret
+func NewAccrualCallback(orders repository.OrderBase, updater *services.AccrualUpdater, secret string) *AccrualCallback {
+	return &AccrualCallback{
+		orderRepo: orders,
+		updater:   updater,
+		secret:    []byte(secret),
+		tolerance: DefaultCallbackTolerance,
+		now:       time.Now,
+	}
+}
+
+// SetTolerance устанавливает допустимое расхождение времени отправки уведомления с текущим
+func (c *AccrualCallback) SetTolerance(tolerance time.Duration) {
+	if tolerance > 0 {
+		c.tolerance = tolerance
+	}
+}
+
+// SignAccrualCallback вычисляет значение заголовка AccrualSignatureHeader
+// для уведомления с телом body, отправленного в момент timestamp
+func SignAccrualCallback(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return accrualSignaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// verify проверяет подпись и свежесть уведомления
+func (c *AccrualCallback) verify(req *http.Request, body []byte) error {
+	timestampHeader := req.Header.Get(AccrualTimestampHeader)
+	signature := req.Header.Get(AccrualSignatureHeader)
+	if timestampHeader == "" || signature == "" {
+		return fmt.Errorf("%w: нужны заголовки %s и %s", ErrInvalidSignature, AccrualTimestampHeader, AccrualSignatureHeader)
+	}
+
+	timestamp, err := strconv.ParseInt(timestampHeader, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: некорректное время отправки", ErrInvalidSignature)
+	}
+
+	skew := c.now().Sub(time.Unix(timestamp, 0))
+	if skew < -c.tolerance || skew > c.tolerance {
+		return fmt.Errorf("%w: время отправки вне допустимого окна", ErrInvalidSignature)
+	}
+
+	expected := SignAccrualCallback(string(c.secret), timestamp, body)
+	if !strings.HasPrefix(signature, accrualSignaturePrefix) || !hmac.Equal([]byte(signature), []byte(expected)) {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
+
+// Callback обрабатывает POST /internal/accrual/callback. Тело уведомления совпадает
+// с ответом accrual системы на GET /api/orders/{number}. Повторные и устаревшие уведомления
+// принимаются без изменений заказа, чтобы отправитель не повторял их бесконечно
+func (c *AccrualCallback) Callback(res http.ResponseWriter, req *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(res, req.Body, maxCallbackBody))
+	if err != nil {
+		writeError(res, req, malformedBody(err))
+		return
+	}
+
+	// Подпись проверяется до разбора тела: неподписанным данным не доверяем
+	if err := c.verify(req, body); err != nil {
+		writeError(res, req, err)
+		return
+	}
+
+	if req.Header.Get("Content-Type") != "application/json" {
+		writeError(res, req, fmt.Errorf("%w: нужен application/json", ErrUnsupportedContentType))
+		return
+	}
+
+	var notification services.AccrualOrderResponse
+	if err := json.Unmarshal(body, &notification); err != nil {
+		writeError(res, req, malformedBody(err))
+		return
+	}
+	if notification.Order == "" {
+		writeError(res, req, ErrEmptyOrderNumber)
+		return
+	}
+
+	order, err := c.orderRepo.GetOrder(req.Context(), notification.Order)
+	if err != nil {
+		writeError(res, req, err)
+		return
+	}
+
+	err = c.updater.Apply(req.Context(), *order, &notification)
+	switch {
+	case err == nil:
+	case errors.Is(err, services.ErrStatusUnchanged),
+		errors.Is(err, services.ErrOrderAlreadyUpdated),
+		errors.Is(err, models.ErrIllegalStatusTransition):
+		// Уведомление повторное или пришло позже более нового, заказ уже в актуальном статусе
+		slog.Default().Info("Уведомление accrual системы не изменило заказ",
+			"order_id", order.OrderID,
+			"status", notification.Status,
+			"reason", err)
+	default:
+		writeError(res, req, err)
+		return
+	}
+
+	res.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,193 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/paxren/go-musthave-diploma-tpl/internal/models"
+	"github.com/paxren/go-musthave-diploma-tpl/internal/money"
+	"github.com/paxren/go-musthave-diploma-tpl/internal/repository"
+	"github.com/paxren/go-musthave-diploma-tpl/internal/services"
+)
+
+const testCallbackSecret = "q3Vn8Zr1XyTb6Lw0PeKd4Hs9Ja2Mf7Uc5Gi-Rt_Ox"
+
+// fakeCallbackRepo хранит один заказ и запоминает обновления его статуса
+type fakeCallbackRepo struct {
+	repository.OrderBase
+	order   models.Order
+	updates int
+}
+
+func (f *fakeCallbackRepo) GetOrder(_ context.Context, orderID string) (*models.Order, error) {
+	if orderID != f.order.OrderID {
+		return nil, repository.ErrOrderNotFound
+	}
+	order := f.order
+	return &order, nil
+}
+
+func (f *fakeCallbackRepo) UpdateOrderStatusAndValue(_ context.Context, orderID, status string, value money.Amount) error {
+	if !models.CanTransition(f.order.Status, status) {
+		return models.ErrIllegalStatusTransition
+	}
+	f.order.Status = status
+	f.order.Value = value
+	f.updates++
+	return nil
+}
+
+func TestAccrualCallback(t *testing.T) {
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	body := `{"order":"79927398713","status":"PROCESSED","accrual":729.98}`
+
+	tests := []struct {
+		name           string
+		status         string
+		body           string
+		contentType    string
+		timestamp      time.Time
+		signature      string
+		expectedStatus int
+		expectedCode   string
+		expectedOrder  string
+		expectedValue  money.Amount
+	}{
+		{
+			name:           "Заказ обработан",
+			status:         models.OrderStatusProcessing,
+			body:           body,
+			expectedStatus: http.StatusOK,
+			expectedOrder:  models.OrderStatusProcessed,
+			expectedValue:  72998,
+		},
+		{
+			name:           "Начисление точнее копейки",
+			status:         models.OrderStatusProcessing,
+			body:           `{"order":"79927398713","status":"PROCESSED","accrual":6.1725}`,
+			expectedStatus: http.StatusOK,
+			expectedOrder:  models.OrderStatusProcessed,
+			expectedValue:  617,
+		},
+		{
+			name:           "Повторное уведомление",
+			status:         models.OrderStatusProcessed,
+			body:           body,
+			expectedStatus: http.StatusOK,
+			expectedOrder:  models.OrderStatusProcessed,
+		},
+		{
+			name:           "Устаревшее уведомление",
+			status:         models.OrderStatusProcessed,
+			body:           `{"order":"79927398713","status":"PROCESSING"}`,
+			expectedStatus: http.StatusOK,
+			expectedOrder:  models.OrderStatusProcessed,
+		},
+		{
+			name:           "Без подписи",
+			status:         models.OrderStatusNew,
+			body:           body,
+			signature:      "-",
+			expectedStatus: http.StatusUnauthorized,
+			expectedCode:   "invalid_signature",
+			expectedOrder:  models.OrderStatusNew,
+		},
+		{
+			name:           "Подпись другим секретом",
+			status:         models.OrderStatusNew,
+			body:           body,
+			signature:      SignAccrualCallback("другой секрет", now.Unix(), []byte(body)),
+			expectedStatus: http.StatusUnauthorized,
+			expectedCode:   "invalid_signature",
+			expectedOrder:  models.OrderStatusNew,
+		},
+		{
+			name:           "Просроченное уведомление",
+			status:         models.OrderStatusNew,
+			body:           body,
+			timestamp:      now.Add(-time.Hour),
+			expectedStatus: http.StatusUnauthorized,
+			expectedCode:   "invalid_signature",
+			expectedOrder:  models.OrderStatusNew,
+		},
+		{
+			name:           "Неподдерживаемый Content-Type",
+			status:         models.OrderStatusNew,
+			body:           body,
+			contentType:    "text/plain",
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   "unsupported_content_type",
+			expectedOrder:  models.OrderStatusNew,
+		},
+		{
+			name:           "Некорректное тело",
+			status:         models.OrderStatusNew,
+			body:           `{"order":`,
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   "malformed_body",
+			expectedOrder:  models.OrderStatusNew,
+		},
+		{
+			name:           "Заказ не найден",
+			status:         models.OrderStatusNew,
+			body:           `{"order":"12345678903","status":"PROCESSING"}`,
+			expectedStatus: http.StatusNotFound,
+			expectedCode:   "order_not_found",
+			expectedOrder:  models.OrderStatusNew,
+		},
+		{
+			name:           "Неизвестный статус",
+			status:         models.OrderStatusNew,
+			body:           `{"order":"79927398713","status":"UNKNOWN"}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   "unknown_accrual_status",
+			expectedOrder:  models.OrderStatusNew,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &fakeCallbackRepo{order: models.Order{OrderID: "79927398713", Type: models.OrderType, Status: tt.status}}
+			callback := NewAccrualCallback(repo, services.NewAccrualUpdater(repo), testCallbackSecret)
+			callback.now = func() time.Time { return now }
+
+			timestamp := tt.timestamp
+			if timestamp.IsZero() {
+				timestamp = now
+			}
+			signature := tt.signature
+			if signature == "" {
+				signature = SignAccrualCallback(testCallbackSecret, timestamp.Unix(), []byte(tt.body))
+			}
+			contentType := tt.contentType
+			if contentType == "" {
+				contentType = "application/json"
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/internal/accrual/callback", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", contentType)
+			req.Header.Set(AccrualTimestampHeader, strconv.FormatInt(timestamp.Unix(), 10))
+			if signature != "-" {
+				req.Header.Set(AccrualSignatureHeader, signature)
+			}
+			res := httptest.NewRecorder()
+
+			callback.Callback(res, req)
+
+			require.Equal(t, tt.expectedStatus, res.Code)
+			if tt.expectedCode != "" {
+				assert.Equal(t, tt.expectedCode, decodeProblem(t, res).Code)
+			}
+			assert.Equal(t, tt.expectedOrder, repo.order.Status)
+			assert.Equal(t, tt.expectedValue, repo.order.Value)
+		})
+	}
+}
@@ -1,6 +1,8 @@
 package handler
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"strings"
 
@@ -9,15 +11,19 @@ import (
 )
 
 type authorizer struct {
-	userRepo   repository.UsersBase
-	jwtService *auth.JWTService
+	sessionRepo repository.SessionBase
+	jwtService  *auth.JWTService
+	userCache   *UserCache
 }
 
-func MakeAuthorizer(userRepo repository.UsersBase, jwtService *auth.JWTService) *authorizer {
+// MakeAuthorizer создает проверку авторизации. Подписанным утверждениям токена доверяем,
+// а действующую сессию проверяем в базе не чаще раза в TTL кеша userCache
+func MakeAuthorizer(sessionRepo repository.SessionBase, jwtService *auth.JWTService, userCache *UserCache) *authorizer {
 
 	return &authorizer{
-		userRepo:   userRepo,
-		jwtService: jwtService,
+		sessionRepo: sessionRepo,
+		jwtService:  jwtService,
+		userCache:   userCache,
 	}
 }
 
@@ -27,7 +33,7 @@ func (auth *authorizer) AuthMiddleware(h http.HandlerFunc) http.HandlerFunc {
 		// Извлекаем токен из заголовка Authorization
 		authHeader := req.Header.Get("Authorization")
 		if authHeader == "" {
-			http.Error(res, "отсутствует заголовок авторизации", http.StatusUnauthorized)
+			writeError(res, req, ErrMissingAuthorization)
 			return
 		}
 
@@ -42,32 +48,40 @@ func (auth *authorizer) AuthMiddleware(h http.HandlerFunc) http.HandlerFunc {
 			// Формат просто <token> (обратная совместимость)
 			tokenString = tokenParts[0]
 		} else {
-			http.Error(res, "неверный формат заголовка авторизации", http.StatusUnauthorized)
+			writeError(res, req, fmt.Errorf("%w: неверный формат заголовка авторизации", ErrInvalidToken))
 			return
 		}
 
 		// Валидируем JWT токен
 		claims, err := auth.jwtService.ValidateToken(tokenString)
 		if err != nil {
-			http.Error(res, "невалидный токен", http.StatusUnauthorized)
+			writeError(res, req, fmt.Errorf("%w: %v", ErrInvalidToken, err))
 			return
 		}
 
-		// Получаем пользователя из базы данных для проверки существования
-		user := auth.userRepo.GetUser(claims.Login)
-		if user == nil {
-			http.Error(res, "пользователь не найден", http.StatusUnauthorized)
-			return
+		user, ok := auth.userCache.Get(claims.SessionID)
+		if !ok {
+			// Одним запросом проверяем, что сессия и токен не отозваны и пользователь существует
+			user, err = auth.sessionRepo.GetSessionUser(req.Context(), claims.SessionID, claims.ID)
+			if err != nil {
+				if errors.Is(err, repository.ErrSessionNotFound) {
+					err = ErrTokenRevoked
+				}
+				writeError(res, req, err)
+				return
+			}
+			auth.userCache.Put(claims.SessionID, *user)
 		}
 
 		// Проверяем, что ID пользователя совпадает с ID в токене
 		if user.UserID == nil || *user.UserID != claims.UserID {
-			http.Error(res, "несоответствие данных пользователя", http.StatusUnauthorized)
+			writeError(res, req, fmt.Errorf("%w: несоответствие данных пользователя", ErrInvalidToken))
 			return
 		}
 
-		// Добавляем пользователя в контекст запроса
+		// Добавляем пользователя и утверждения токена в контекст запроса
 		ctx := SetUserContext(req.Context(), user)
+		ctx = SetClaimsContext(ctx, claims)
 		req = req.WithContext(ctx)
 
 		h.ServeHTTP(res, req)
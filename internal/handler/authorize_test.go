@@ -0,0 +1,132 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/paxren/go-musthave-diploma-tpl/internal/auth"
+	"github.com/paxren/go-musthave-diploma-tpl/internal/models"
+	"github.com/paxren/go-musthave-diploma-tpl/internal/repository"
+)
+
+// fakeSessionRepo считает проверки сессий, действующими считаются сессии из sessions
+type fakeSessionRepo struct {
+	sessions map[string]models.User
+	lookups  int
+}
+
+func (f *fakeSessionRepo) CreateSession(_ context.Context, _ models.Session, _ string) error {
+	return nil
+}
+
+func (f *fakeSessionRepo) RotateSession(_ context.Context, _, _ string, _ time.Time) (*models.Session, error) {
+	return nil, repository.ErrSessionNotFound
+}
+
+func (f *fakeSessionRepo) RevokeSession(_ context.Context, sessionID string) error {
+	delete(f.sessions, sessionID)
+	return nil
+}
+
+func (f *fakeSessionRepo) RevokeUserSessions(_ context.Context, _ uint64) error {
+	return nil
+}
+
+func (f *fakeSessionRepo) RevokeToken(_ context.Context, _ string, _ time.Time) error {
+	return nil
+}
+
+func (f *fakeSessionRepo) GetSessionUser(_ context.Context, sessionID, _ string) (*models.User, error) {
+	f.lookups++
+	user, ok := f.sessions[sessionID]
+	if !ok {
+		return nil, repository.ErrSessionNotFound
+	}
+	return &user, nil
+}
+
+func TestAuthMiddleware_UserCache(t *testing.T) {
+	userID := uint64(7)
+	sessions := &fakeSessionRepo{sessions: map[string]models.User{
+		"session-1": {UserID: &userID, Login: "user"},
+	}}
+	jwtService := auth.NewJWTService("test-secret-key")
+	cache := NewUserCache(time.Minute)
+	authMidl := MakeAuthorizer(sessions, jwtService, cache)
+
+	var gotUser *models.User
+	handler := authMidl.AuthMiddleware(func(res http.ResponseWriter, req *http.Request) {
+		gotUser, _ = GetUserFromContext(req.Context())
+	})
+
+	send := func(token string) int {
+		req := httptest.NewRequest(http.MethodGet, "/api/user/orders", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		res := httptest.NewRecorder()
+		handler(res, req)
+		return res.Code
+	}
+
+	token, err := jwtService.GenerateToken(userID, "user", "session-1")
+	require.NoError(t, err)
+
+	// Первый запрос проверяет сессию в базе, следующие берут пользователя из кеша
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusOK, send(token))
+	}
+	assert.Equal(t, 1, sessions.lookups)
+	require.NotNil(t, gotUser)
+	assert.Equal(t, userID, *gotUser.UserID)
+
+	// После выхода сессия удаляется из кеша и токен перестает действовать
+	require.NoError(t, sessions.RevokeSession(context.Background(), "session-1"))
+	cache.InvalidateSession("session-1")
+	assert.Equal(t, http.StatusUnauthorized, send(token))
+
+	// Токен с чужим идентификатором пользователя не принимается
+	otherID := uint64(8)
+	sessions.sessions["session-2"] = models.User{UserID: &otherID, Login: "other"}
+	forged, err := jwtService.GenerateToken(userID, "user", "session-2")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, send(forged))
+}
+
+func TestUserCache(t *testing.T) {
+	now := time.Now()
+	cache := NewUserCache(time.Minute)
+	cache.now = func() time.Time { return now }
+
+	userID := uint64(1)
+	cache.Put("session-1", models.User{UserID: &userID, Login: "user"})
+	cache.Put("session-2", models.User{UserID: &userID, Login: "user"})
+
+	user, ok := cache.Get("session-1")
+	require.True(t, ok)
+	assert.Equal(t, "user", user.Login)
+
+	// Запись устаревает по истечении TTL
+	now = now.Add(time.Minute)
+	_, ok = cache.Get("session-1")
+	assert.False(t, ok)
+
+	// Сброс по пользователю удаляет все его сессии
+	cache.Put("session-1", models.User{UserID: &userID, Login: "user"})
+	cache.Put("session-2", models.User{UserID: &userID, Login: "user"})
+	cache.InvalidateUser(userID)
+	_, ok = cache.Get("session-1")
+	assert.False(t, ok)
+	_, ok = cache.Get("session-2")
+	assert.False(t, ok)
+
+	// nil кеш ничего не хранит
+	var disabled *UserCache
+	disabled.Put("session-1", models.User{UserID: &userID})
+	_, ok = disabled.Get("session-1")
+	assert.False(t, ok)
+}
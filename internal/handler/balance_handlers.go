@@ -4,9 +4,8 @@ import (
 	"bytes"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
-	"sort"
-	"time"
 
 	"github.com/paxren/go-musthave-diploma-tpl/internal/models"
 	"github.com/paxren/go-musthave-diploma-tpl/internal/money"
@@ -19,23 +18,23 @@ func (h Handler) GetBalance(res http.ResponseWriter, req *http.Request) {
 	// Получаем пользователя из контекста
 	user, err := GetUserFromContext(req.Context())
 	if err != nil {
-		http.Error(res, err.Error(), http.StatusUnauthorized)
+		writeError(res, req, err)
 		return
 	}
 
-	balance, err := h.orderRepo.GetBalance(*user)
+	balance, err := h.orderRepo.GetBalance(req.Context(), *user.UserID)
 	if err != nil {
-		http.Error(res, err.Error(), http.StatusInternalServerError)
+		writeError(res, req, err)
 		return
 	}
 	exportBalance := BalanceExport{
-		Current:   money.KopecksToRubles(balance.Current),
-		Withdrawn: money.KopecksToRubles(balance.Withdrawn),
+		Current:   balance.Current,
+		Withdrawn: balance.Withdrawn,
 	}
 
 	balanceJSON, err := json.Marshal(exportBalance)
 	if err != nil {
-		http.Error(res, err.Error(), http.StatusInternalServerError)
+		writeError(res, req, err)
 		return
 	}
 
@@ -48,7 +47,7 @@ func (h Handler) GetBalance(res http.ResponseWriter, req *http.Request) {
 func (h Handler) WithdrawBalance(res http.ResponseWriter, req *http.Request) {
 	// Проверяем Content-Type
 	if req.Header.Get("Content-Type") != "application/json" {
-		http.Error(res, "нужен application/json", http.StatusBadRequest)
+		writeError(res, req, fmt.Errorf("%w: нужен application/json", ErrUnsupportedContentType))
 		return
 	}
 
@@ -57,58 +56,47 @@ func (h Handler) WithdrawBalance(res http.ResponseWriter, req *http.Request) {
 	var buf bytes.Buffer
 	_, err := buf.ReadFrom(req.Body)
 	if err != nil {
-		http.Error(res, err.Error(), http.StatusBadRequest)
+		writeError(res, req, malformedBody(err))
 		return
 	}
 	defer req.Body.Close()
 
-	// Десериализуем JSON
+	// Десериализуем JSON, сумма разбирается точно, без float64
 	if err = json.Unmarshal(buf.Bytes(), &withdrawReq); err != nil {
-		http.Error(res, err.Error(), http.StatusBadRequest)
+		if errors.Is(err, money.ErrInvalidAmount) || errors.Is(err, money.ErrOverflow) {
+			writeError(res, req, err)
+			return
+		}
+		writeError(res, req, malformedBody(err))
 		return
 	}
 
 	// Валидация номера заказа по алгоритму Луна
 	if !models.LunaCheck(withdrawReq.Order) {
-		http.Error(res, "неверный номер заказа", http.StatusUnprocessableEntity)
+		writeError(res, req, repository.ErrBadOrderID)
 		return
 	}
 
 	// Проверяем, что сумма списания больше 0
 	if withdrawReq.Sum == 0 {
-		http.Error(res, "сумма списания должна быть больше 0", http.StatusBadRequest)
+		writeError(res, req, ErrInvalidAmount)
 		return
 	}
 
 	// Получаем пользователя из контекста
 	user, err := GetUserFromContext(req.Context())
 	if err != nil {
-		http.Error(res, err.Error(), http.StatusUnauthorized)
+		writeError(res, req, err)
 		return
 	}
 
-	// Конвертируем сумму из рублей в копейки для хранения в БД с корректным округлением
-	sumInKopecks := money.RublesToKopecks(withdrawReq.Sum)
-
 	// Создаем заказ на списание
-	withdrawOrder := *models.MakeWithdraw(*user, withdrawReq.Order, sumInKopecks)
+	withdrawOrder := *models.MakeWithdraw(*user, withdrawReq.Order, withdrawReq.Sum)
 
 	// Добавляем заказ в базу данных
-	err = h.orderRepo.AddOrder(*user, withdrawOrder)
+	err = h.orderRepo.AddOrder(req.Context(), *user.UserID, withdrawOrder)
 	if err != nil {
-		if errors.Is(err, repository.ErrIncafitionFunds) {
-			http.Error(res, "на счету недостаточно средств", http.StatusPaymentRequired)
-			return
-		}
-		if errors.Is(err, repository.ErrOrderExistThisUser) {
-			http.Error(res, "заказ с таким номером уже существует", http.StatusConflict)
-			return
-		}
-		if errors.Is(err, repository.ErrOrderExistAnotherUser) {
-			http.Error(res, "заказ с таким номером уже существует у другого пользователя", http.StatusConflict)
-			return
-		}
-		http.Error(res, err.Error(), http.StatusInternalServerError)
+		writeError(res, req, err)
 		return
 	}
 
@@ -120,16 +108,23 @@ func (h Handler) GetWithdrawals(res http.ResponseWriter, req *http.Request) {
 	// Получаем пользователя из контекста
 	user, err := GetUserFromContext(req.Context())
 	if err != nil {
-		http.Error(res, err.Error(), http.StatusUnauthorized)
+		writeError(res, req, err)
+		return
+	}
+
+	query, err := parseOrderQuery(req, models.WithdrawType)
+	if err != nil {
+		writeError(res, req, err)
 		return
 	}
 
 	// Получаем историю выводов
-	withdrawals, err := h.orderRepo.GetWithdrawals(*user)
+	page, err := h.orderRepo.GetOrders(req.Context(), *user.UserID, query)
 	if err != nil {
-		http.Error(res, err.Error(), http.StatusInternalServerError)
+		writeError(res, req, err)
 		return
 	}
+	withdrawals := page.Orders
 
 	// Если нет выводов, возвращаем 204
 	if len(withdrawals) == 0 {
@@ -140,38 +135,27 @@ func (h Handler) GetWithdrawals(res http.ResponseWriter, req *http.Request) {
 	// Преобразуем в формат ответа
 	var withdrawalsResponse []WithdrawResponse
 	for _, withdrawal := range withdrawals {
+		// Списание обрабатывается сразу, для старых записей без processed_at берем время создания
+		processedAt := withdrawal.UploadedAt
+		if withdrawal.ProcessedAt != nil {
+			processedAt = *withdrawal.ProcessedAt
+		}
+
 		withdrawalsResponse = append(withdrawalsResponse, WithdrawResponse{
 			Order:       withdrawal.OrderID,
-			Sum:         money.KopecksToRubles(withdrawal.Value), // Конвертируем из копеек в рубли
-			ProcessedAt: withdrawal.Date,
+			Sum:         withdrawal.Value,
+			ProcessedAt: processedAt,
 		})
 	}
 
-	// Сортируем по дате (от новых к старым)
-	sort.Slice(withdrawalsResponse, func(i, j int) bool {
-		dateI, errI := time.Parse(time.RFC3339, withdrawalsResponse[i].ProcessedAt)
-		dateJ, errJ := time.Parse(time.RFC3339, withdrawalsResponse[j].ProcessedAt)
-
-		if errI != nil && errJ != nil {
-			return false
-		}
-		if errI != nil {
-			return false
-		}
-		if errJ != nil {
-			return true
-		}
-
-		return dateI.After(dateJ)
-	})
-
 	// Сериализуем и отправляем ответ
 	withdrawalsJSON, err := json.Marshal(withdrawalsResponse)
 	if err != nil {
-		http.Error(res, err.Error(), http.StatusInternalServerError)
+		writeError(res, req, err)
 		return
 	}
 
+	writeNextPage(res, req, query, page)
 	res.Header().Set("Content-Type", "application/json")
 	res.WriteHeader(http.StatusOK)
 	res.Write(withdrawalsJSON)
@@ -0,0 +1,57 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/paxren/go-musthave-diploma-tpl/internal/models"
+	"github.com/paxren/go-musthave-diploma-tpl/internal/money"
+)
+
+func TestHandler_WithdrawBalance_Amount(t *testing.T) {
+	tests := []struct {
+		name           string
+		sum            string
+		expectedStatus int
+		expectedCode   string
+		expectedValue  money.Amount
+	}{
+		{name: "Сумма без потери копейки", sum: "729.98", expectedStatus: http.StatusOK, expectedValue: 72998},
+		{name: "Целая сумма", sum: "100", expectedStatus: http.StatusOK, expectedValue: 10000},
+		{name: "Точнее копейки", sum: "1.009", expectedStatus: http.StatusBadRequest, expectedCode: "malformed_amount"},
+		{name: "Отрицательная сумма", sum: "-5", expectedStatus: http.StatusBadRequest, expectedCode: "malformed_amount"},
+		{name: "Сумма строкой", sum: `"5"`, expectedStatus: http.StatusBadRequest, expectedCode: "malformed_amount"},
+		{name: "Нулевая сумма", sum: "0", expectedStatus: http.StatusBadRequest, expectedCode: "invalid_amount"},
+		{name: "Слишком большая сумма", sum: "1e30", expectedStatus: http.StatusBadRequest, expectedCode: "amount_too_large"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userID := uint64(1)
+			orders := &fakeOrdersRepo{}
+			h := NewHandler(nil, orders, nil, nil, nil)
+
+			body := `{"order":"79927398713","sum":` + tt.sum + `}`
+			req := httptest.NewRequest(http.MethodPost, "/api/user/balance/withdraw", strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			req = req.WithContext(SetUserContext(req.Context(), &models.User{UserID: &userID, Login: "user"}))
+			res := httptest.NewRecorder()
+
+			h.WithdrawBalance(res, req)
+
+			require.Equal(t, tt.expectedStatus, res.Code)
+			if tt.expectedCode != "" {
+				assert.Equal(t, tt.expectedCode, decodeProblem(t, res).Code)
+				assert.Empty(t, orders.added)
+				return
+			}
+			require.Len(t, orders.added, 1)
+			assert.Equal(t, tt.expectedValue, orders.added[0].Value)
+		})
+	}
+}
@@ -2,15 +2,18 @@ package handler
 
 import (
 	"context"
-	"errors"
 
+	"github.com/paxren/go-musthave-diploma-tpl/internal/auth"
 	"github.com/paxren/go-musthave-diploma-tpl/internal/models"
 )
 
 // userContextKey используется для хранения пользователя в контексте
 type userContextKey string
 
-const UserKey userContextKey = "user"
+const (
+	UserKey   userContextKey = "user"
+	ClaimsKey userContextKey = "claims"
+)
 
 // SetUserContext добавляет пользователя в контекст запроса
 func SetUserContext(ctx context.Context, user *models.User) context.Context {
@@ -21,7 +24,21 @@ func SetUserContext(ctx context.Context, user *models.User) context.Context {
 func GetUserFromContext(ctx context.Context) (*models.User, error) {
 	user, ok := ctx.Value(UserKey).(*models.User)
 	if !ok || user == nil {
-		return nil, errors.New("пользователь не найден в контексте")
+		return nil, ErrNotAuthenticated
 	}
 	return user, nil
 }
+
+// SetClaimsContext добавляет утверждения access токена в контекст запроса
+func SetClaimsContext(ctx context.Context, claims *auth.Claims) context.Context {
+	return context.WithValue(ctx, ClaimsKey, claims)
+}
+
+// GetClaimsFromContext извлекает утверждения access токена из контекста запроса
+func GetClaimsFromContext(ctx context.Context) (*auth.Claims, error) {
+	claims, ok := ctx.Value(ClaimsKey).(*auth.Claims)
+	if !ok || claims == nil {
+		return nil, ErrNotAuthenticated
+	}
+	return claims, nil
+}
@@ -7,16 +7,33 @@ import (
 
 // Handler основная структура обработчика
 type Handler struct {
-	userRepo   repository.UsersBase
-	orderRepo  repository.OrderBase
-	jwtService *auth.JWTService
+	userRepo        repository.UsersBase
+	orderRepo       repository.OrderBase
+	idempotencyRepo repository.IdempotencyBase
+	sessionRepo     repository.SessionBase
+	jwtService      *auth.JWTService
+	passwordPolicy  auth.PasswordPolicy
+	userCache       *UserCache
 }
 
 // NewHandler конструктор обработчика
-func NewHandler(users repository.UsersBase, orders repository.OrderBase, jwtService *auth.JWTService) *Handler {
+func NewHandler(users repository.UsersBase, orders repository.OrderBase, idempotency repository.IdempotencyBase, sessions repository.SessionBase, jwtService *auth.JWTService) *Handler {
 	return &Handler{
-		userRepo:   users,
-		orderRepo:  orders,
-		jwtService: jwtService,
+		userRepo:        users,
+		orderRepo:       orders,
+		idempotencyRepo: idempotency,
+		sessionRepo:     sessions,
+		jwtService:      jwtService,
+		passwordPolicy:  auth.DefaultPasswordPolicy(),
 	}
 }
+
+// SetPasswordPolicy устанавливает требования к паролям при регистрации и смене пароля
+func (h *Handler) SetPasswordPolicy(policy auth.PasswordPolicy) {
+	h.passwordPolicy = policy
+}
+
+// SetUserCache устанавливает кеш AuthMiddleware, который нужно сбрасывать при выходе и смене пароля
+func (h *Handler) SetUserCache(cache *UserCache) {
+	h.userCache = cache
+}
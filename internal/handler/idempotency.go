@@ -0,0 +1,150 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"github.com/paxren/go-musthave-diploma-tpl/internal/models"
+)
+
+// IdempotencyKeyHeader заголовок, которым клиент помечает повторяемый запрос
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// maxIdempotencyKeyLength максимальная длина ключа идемпотентности
+const maxIdempotencyKeyLength = 255
+
+// responseRecorder пропускает ответ клиенту и одновременно запоминает код и тело ответа
+type responseRecorder struct {
+	http.ResponseWriter
+	statusCode int
+	body       bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(statusCode int) {
+	r.statusCode = statusCode
+	r.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	if r.statusCode == 0 {
+		r.statusCode = http.StatusOK
+	}
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+// Idempotent оборачивает обработчик поддержкой заголовка Idempotency-Key.
+// Ответ на первый запрос с ключом сохраняется, повтор с тем же телом возвращает его без
+// повторного выполнения, повтор с другим телом отклоняется с кодом 422.
+// Ответы 5xx и паника обработчика не сохраняются, чтобы клиент мог повторить запрос.
+// Должен вызываться после AuthMiddleware
+func (h Handler) Idempotent(next http.HandlerFunc) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		key := req.Header.Get(IdempotencyKeyHeader)
+		if key == "" {
+			next(res, req)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			writeError(res, req, ErrIdempotencyKeyTooLong)
+			return
+		}
+
+		user, err := GetUserFromContext(req.Context())
+		if err != nil {
+			writeError(res, req, err)
+			return
+		}
+
+		// Читаем тело, чтобы посчитать хеш, и возвращаем его обработчику
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			writeError(res, req, malformedBody(err))
+			return
+		}
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(body))
+
+		hash := sha256.Sum256(body)
+		requestHash := hex.EncodeToString(hash[:])
+
+		record, err := h.idempotencyRepo.ReserveIdempotencyKey(req.Context(), *user.UserID, key, requestHash)
+		if err != nil {
+			writeError(res, req, err)
+			return
+		}
+
+		if record != nil {
+			if record.RequestHash != requestHash {
+				writeError(res, req, ErrIdempotencyKeyReused)
+				return
+			}
+			if record.StatusCode == 0 {
+				writeError(res, req, ErrIdempotencyKeyInProgress)
+				return
+			}
+
+			// Повтор запроса, возвращаем сохраненный ответ
+			res.Header().Set("Idempotent-Replayed", "true")
+			if len(record.Body) > 0 {
+				res.Header().Set("Content-Type", replayContentType(record))
+			}
+			res.WriteHeader(record.StatusCode)
+			res.Write(record.Body)
+			return
+		}
+
+		// Запрос не отменяем вместе с клиентом: результат уже применен и должен быть сохранен
+		ctx := context.WithoutCancel(req.Context())
+		release := func() {
+			if err := h.idempotencyRepo.ReleaseIdempotencyKey(ctx, *user.UserID, key); err != nil {
+				slog.Default().Error("Ошибка при освобождении ключа идемпотентности", "error", err)
+			}
+		}
+
+		// Паника обработчика освобождает ключ, чтобы повтор не ждал истечения резерва,
+		// и передается дальше
+		defer func() {
+			if p := recover(); p != nil {
+				release()
+				panic(p)
+			}
+		}()
+
+		recorder := &responseRecorder{ResponseWriter: res}
+		next(recorder, req)
+
+		statusCode := recorder.statusCode
+		if statusCode == 0 {
+			statusCode = http.StatusOK
+		}
+
+		if statusCode >= http.StatusInternalServerError {
+			release()
+			return
+		}
+
+		// Если ответ сохранить не удалось, резерв остается и перехватывается повтором после истечения срока
+		if err := h.idempotencyRepo.CompleteIdempotencyKey(ctx, *user.UserID, key, statusCode, recorder.body.Bytes()); err != nil {
+			slog.Default().Error("Ошибка при сохранении ответа для ключа идемпотентности", "error", err)
+		}
+	}
+}
+
+// replayContentType определяет тип содержимого сохраненного ответа: тела ошибок
+// отдаются в формате application/problem+json, остальные JSON ответы как application/json
+func replayContentType(record *models.IdempotencyRecord) string {
+	if !json.Valid(record.Body) {
+		return http.DetectContentType(record.Body)
+	}
+	if record.StatusCode >= http.StatusBadRequest {
+		return ProblemContentType
+	}
+	return "application/json"
+}
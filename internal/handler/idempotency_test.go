@@ -0,0 +1,118 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/paxren/go-musthave-diploma-tpl/internal/models"
+)
+
+// fakeIdempotencyRepo хранит ключи идемпотентности в памяти
+type fakeIdempotencyRepo struct {
+	mutex   sync.Mutex
+	records map[string]models.IdempotencyRecord
+}
+
+func (f *fakeIdempotencyRepo) ReserveIdempotencyKey(_ context.Context, _ uint64, key, requestHash string) (*models.IdempotencyRecord, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if record, ok := f.records[key]; ok {
+		return &record, nil
+	}
+	f.records[key] = models.IdempotencyRecord{RequestHash: requestHash}
+	return nil, nil
+}
+
+func (f *fakeIdempotencyRepo) CompleteIdempotencyKey(_ context.Context, _ uint64, key string, statusCode int, body []byte) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	record := f.records[key]
+	record.StatusCode = statusCode
+	record.Body = body
+	f.records[key] = record
+	return nil
+}
+
+func (f *fakeIdempotencyRepo) ReleaseIdempotencyKey(_ context.Context, _ uint64, key string) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	delete(f.records, key)
+	return nil
+}
+
+func TestHandler_Idempotent(t *testing.T) {
+	userID := uint64(1)
+	user := &models.User{UserID: &userID, Login: "user"}
+
+	repo := &fakeIdempotencyRepo{records: make(map[string]models.IdempotencyRecord)}
+	h := Handler{idempotencyRepo: repo}
+
+	calls := 0
+	statusCode := http.StatusPaymentRequired
+	wrapped := h.Idempotent(func(res http.ResponseWriter, req *http.Request) {
+		calls++
+		http.Error(res, "на счету недостаточно средств", statusCode)
+	})
+
+	send := func(key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/user/balance/withdraw", strings.NewReader(body))
+		if key != "" {
+			req.Header.Set(IdempotencyKeyHeader, key)
+		}
+		req = req.WithContext(SetUserContext(req.Context(), user))
+		res := httptest.NewRecorder()
+		wrapped(res, req)
+		return res
+	}
+
+	body := `{"order":"2377225624","sum":751}`
+
+	// Первый запрос выполняется
+	res := send("key-1", body)
+	assert.Equal(t, http.StatusPaymentRequired, res.Code)
+	assert.Equal(t, 1, calls)
+
+	// Повтор возвращает сохраненный ответ без выполнения
+	res = send("key-1", body)
+	assert.Equal(t, http.StatusPaymentRequired, res.Code)
+	assert.Equal(t, "true", res.Header().Get("Idempotent-Replayed"))
+	assert.Contains(t, res.Body.String(), "недостаточно средств")
+	assert.Equal(t, 1, calls)
+
+	// Повтор с другим телом отклоняется
+	res = send("key-1", `{"order":"2377225624","sum":1}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, res.Code)
+	assert.Equal(t, 1, calls)
+
+	// Без ключа запрос выполняется каждый раз
+	send("", body)
+	send("", body)
+	assert.Equal(t, 3, calls)
+
+	// Ответ 5xx не сохраняется, запрос можно повторить
+	statusCode = http.StatusInternalServerError
+	send("key-2", body)
+	statusCode = http.StatusOK
+	res = send("key-2", body)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, 5, calls)
+
+	// Паника обработчика освобождает ключ и передается дальше
+	panicking := h.Idempotent(func(http.ResponseWriter, *http.Request) {
+		panic("сбой обработчика")
+	})
+	req := httptest.NewRequest(http.MethodPost, "/api/user/balance/withdraw", strings.NewReader(body))
+	req.Header.Set(IdempotencyKeyHeader, "key-3")
+	req = req.WithContext(SetUserContext(req.Context(), user))
+	assert.Panics(t, func() { panicking(httptest.NewRecorder(), req) })
+	res = send("key-3", body)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Empty(t, res.Header().Get("Idempotent-Replayed"))
+	assert.Equal(t, 6, calls)
+}
@@ -3,13 +3,11 @@ package handler
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
-	"sort"
-	"time"
 
 	"github.com/paxren/go-musthave-diploma-tpl/internal/models"
-	"github.com/paxren/go-musthave-diploma-tpl/internal/money"
 	"github.com/paxren/go-musthave-diploma-tpl/internal/repository"
 )
 
@@ -17,14 +15,14 @@ import (
 func (h Handler) AddOrder(res http.ResponseWriter, req *http.Request) {
 
 	if req.Header.Get("Content-Type") != "text/plain" {
-		http.Error(res, "нужен плейн текст", http.StatusBadRequest)
+		writeError(res, req, fmt.Errorf("%w: нужен text/plain", ErrUnsupportedContentType))
 		return
 	}
 
 	// Читаем тело запроса
 	body, err := io.ReadAll(req.Body)
 	if err != nil {
-		http.Error(res, err.Error(), http.StatusBadRequest)
+		writeError(res, req, malformedBody(err))
 		return
 	}
 	defer req.Body.Close()
@@ -33,32 +31,24 @@ func (h Handler) AddOrder(res http.ResponseWriter, req *http.Request) {
 	orderString := string(body)
 	// Здесь можно добавить валидацию номера заказа
 	if orderString == "" {
-		http.Error(res, "пустой номер заказа", http.StatusBadRequest)
+		writeError(res, req, ErrEmptyOrderNumber)
 		return
 	}
 
 	// Получаем пользователя из контекста
 	user, err := GetUserFromContext(req.Context())
 	if err != nil {
-		http.Error(res, err.Error(), http.StatusUnauthorized)
+		writeError(res, req, err)
 		return
 	}
 
-	err = h.orderRepo.AddOrder(*user, *models.MakeNewOrder(*user, orderString))
+	err = h.orderRepo.AddOrder(req.Context(), *user.UserID, *models.MakeNewOrder(*user, orderString))
 	if err != nil {
 		if errors.Is(err, repository.ErrOrderExistThisUser) {
 			res.WriteHeader(http.StatusOK)
 			return
 		}
-		if errors.Is(err, repository.ErrOrderExistAnotherUser) {
-			http.Error(res, "номер заказа уже был загружен другим пользователем", http.StatusConflict)
-			return
-		}
-		if errors.Is(err, repository.ErrBadOrderID) {
-			http.Error(res, "плохой номер заказа, нелунуется", http.StatusUnprocessableEntity)
-			return
-		}
-		http.Error(res, err.Error(), http.StatusInternalServerError)
+		writeError(res, req, err)
 		return
 
 	}
@@ -72,52 +62,42 @@ func (h Handler) GetOrders(res http.ResponseWriter, req *http.Request) {
 	// Получаем пользователя из контекста
 	user, err := GetUserFromContext(req.Context())
 	if err != nil {
-		http.Error(res, err.Error(), http.StatusUnauthorized)
+		writeError(res, req, err)
+		return
+	}
+
+	query, err := parseOrderQuery(req, models.OrderType)
+	if err != nil {
+		writeError(res, req, err)
 		return
 	}
 
-	orders, err := h.orderRepo.GetOrders(*user, models.OrderType)
+	page, err := h.orderRepo.GetOrders(req.Context(), *user.UserID, query)
 	if err != nil {
-		http.Error(res, err.Error(), http.StatusInternalServerError)
+		writeError(res, req, err)
 		return
 	}
+	orders := page.Orders
 	if len(orders) == 0 {
 		res.WriteHeader(http.StatusNoContent)
 		return
 	}
 
-	//сразу сортировка по дате
-	sort.Slice(orders, func(i, j int) bool {
-		dateI, errI := time.Parse(time.RFC3339, orders[i].Date)
-		dateJ, errJ := time.Parse(time.RFC3339, orders[j].Date)
-
-		if errI != nil && errJ != nil {
-			return false
-		}
-		if errI != nil {
-			return false
-		}
-		if errJ != nil {
-			return true
-		}
-
-		return dateI.After(dateJ) // от новых к старым
-	})
-
 	// Преобразуем orders в exportOrders с правильным форматированием поля accrual
 	var exportOrders []OrderExport
 	for _, order := range orders {
 		exportOrder := OrderExport{
-			OrderID: order.OrderID,
-			User:    order.User,
-			Type:    order.Type,
-			Status:  order.Status,
-			Date:    order.Date,
+			OrderID:     order.OrderID,
+			User:        order.User,
+			Type:        order.Type,
+			Status:      order.Status,
+			UploadedAt:  order.UploadedAt,
+			ProcessedAt: order.ProcessedAt,
 		}
 
 		// Добавляем поле accrual только если значение не нулевое
 		if order.Value > 0 {
-			accrual := money.KopecksToRubles(order.Value)
+			accrual := order.Value
 			exportOrder.Value = &accrual
 		}
 
@@ -126,10 +106,11 @@ func (h Handler) GetOrders(res http.ResponseWriter, req *http.Request) {
 
 	ordersJSON, err := json.Marshal(exportOrders)
 	if err != nil {
-		http.Error(res, err.Error(), http.StatusInternalServerError)
+		writeError(res, req, err)
 		return
 	}
 
+	writeNextPage(res, req, query, page)
 	res.Header().Set("Content-Type", "application/json")
 	res.WriteHeader(http.StatusOK)
 	res.Write(ordersJSON)
@@ -0,0 +1,115 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/paxren/go-musthave-diploma-tpl/internal/models"
+)
+
+// Параметры запроса списков заказов и списаний
+const (
+	queryParamLimit  = "limit"
+	queryParamCursor = "cursor"
+	queryParamStatus = "status"
+	queryParamFrom   = "from"
+	queryParamTo     = "to"
+	queryParamSort   = "sort"
+)
+
+// NextCursorHeader заголовок с курсором следующей страницы. Тело ответа остается массивом,
+// как и без пагинации, поэтому курсор передается в заголовках
+const NextCursorHeader = "X-Next-Cursor"
+
+// parseOrderQuery разбирает параметры фильтрации, сортировки и пагинации списка заказов.
+// Без параметров возвращает выборку всех заказов от новых к старым, как раньше
+func parseOrderQuery(req *http.Request, orderType string) (models.OrderQuery, error) {
+	params := req.URL.Query()
+	query := models.OrderQuery{Type: orderType}
+
+	if value := params.Get(queryParamLimit); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > models.MaxPageLimit {
+			return query, fmt.Errorf("%w: %s должен быть числом от 1 до %d", ErrInvalidQueryParameter, queryParamLimit, models.MaxPageLimit)
+		}
+		query.Limit = limit
+	}
+
+	if value := params.Get(queryParamCursor); value != "" {
+		cursor, err := models.DecodeOrderCursor(value)
+		if err != nil {
+			return query, err
+		}
+		query.After = cursor
+		if query.Limit == 0 {
+			query.Limit = models.DefaultPageLimit
+		}
+	}
+
+	// Статусы передаются через запятую или повторением параметра
+	for _, value := range params[queryParamStatus] {
+		for _, status := range strings.Split(value, ",") {
+			status = strings.ToUpper(strings.TrimSpace(status))
+			if !models.IsOrderStatus(status) {
+				return query, fmt.Errorf("%w: неизвестный статус %q", ErrInvalidQueryParameter, status)
+			}
+			query.Statuses = append(query.Statuses, status)
+		}
+	}
+
+	var err error
+	if query.From, err = parseQueryTime(params, queryParamFrom); err != nil {
+		return query, err
+	}
+	if query.To, err = parseQueryTime(params, queryParamTo); err != nil {
+		return query, err
+	}
+	if !query.From.IsZero() && !query.To.IsZero() && !query.From.Before(query.To) {
+		return query, fmt.Errorf("%w: %s должен быть раньше %s", ErrInvalidQueryParameter, queryParamFrom, queryParamTo)
+	}
+
+	switch strings.ToLower(params.Get(queryParamSort)) {
+	case "", "desc":
+	case "asc":
+		query.Ascending = true
+	default:
+		return query, fmt.Errorf("%w: %s может быть asc или desc", ErrInvalidQueryParameter, queryParamSort)
+	}
+
+	return query, nil
+}
+
+// parseQueryTime разбирает дату в формате RFC 3339, пустой параметр - нулевая дата
+func parseQueryTime(params url.Values, name string) (time.Time, error) {
+	value := params.Get(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: %s должен быть датой в формате RFC 3339", ErrInvalidQueryParameter, name)
+	}
+	return t, nil
+}
+
+// writeNextPage сообщает клиенту курсор следующей страницы, если она есть:
+// в заголовке X-Next-Cursor и ссылкой в заголовке Link (RFC 8288)
+func writeNextPage(res http.ResponseWriter, req *http.Request, query models.OrderQuery, page *models.OrderPage) {
+	if page.Next == nil {
+		return
+	}
+
+	cursor := page.Next.Encode()
+	params := req.URL.Query()
+	params.Set(queryParamCursor, cursor)
+	params.Set(queryParamLimit, strconv.Itoa(query.Limit))
+	next := url.URL{Path: req.URL.Path, RawQuery: params.Encode()}
+
+	res.Header().Set(NextCursorHeader, cursor)
+	res.Header().Set("Link", fmt.Sprintf(`<%s>; rel="next"`, next.String()))
+}
@@ -0,0 +1,146 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/paxren/go-musthave-diploma-tpl/internal/models"
+	"github.com/paxren/go-musthave-diploma-tpl/internal/repository"
+)
+
+// fakeOrdersRepo отдает заранее заданную страницу и запоминает запрос и добавленные заказы
+type fakeOrdersRepo struct {
+	repository.OrderBase
+	page  models.OrderPage
+	query models.OrderQuery
+	added []models.Order
+}
+
+func (f *fakeOrdersRepo) AddOrder(_ context.Context, _ uint64, order models.Order) error {
+	f.added = append(f.added, order)
+	return nil
+}
+
+func (f *fakeOrdersRepo) GetOrders(_ context.Context, _ uint64, query models.OrderQuery) (*models.OrderPage, error) {
+	f.query = query
+	return &f.page, nil
+}
+
+func TestParseOrderQuery(t *testing.T) {
+	cursor := models.OrderCursor{CreatedAt: time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC), OrderID: "12345678903"}
+
+	tests := []struct {
+		name        string
+		rawQuery    string
+		expected    models.OrderQuery
+		expectedErr error
+	}{
+		{
+			name:     "Без параметров",
+			expected: models.OrderQuery{Type: models.OrderType},
+		},
+		{
+			name:     "Все параметры",
+			rawQuery: "limit=10&status=new,Processed&status=INVALID&from=2025-01-01T00:00:00Z&to=2025-02-01T00:00:00%2B03:00&sort=asc",
+			expected: models.OrderQuery{
+				Type:      models.OrderType,
+				Limit:     10,
+				Statuses:  []string{models.OrderStatusNew, models.OrderStatusProcessed, models.OrderStatusInvalid},
+				From:      time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+				To:        time.Date(2025, 1, 31, 21, 0, 0, 0, time.UTC),
+				Ascending: true,
+			},
+		},
+		{
+			name:     "Курсор без limit",
+			rawQuery: "cursor=" + cursor.Encode(),
+			expected: models.OrderQuery{Type: models.OrderType, Limit: models.DefaultPageLimit, After: &cursor},
+		},
+		{name: "limit вне диапазона", rawQuery: "limit=0", expectedErr: ErrInvalidQueryParameter},
+		{name: "limit не число", rawQuery: "limit=ten", expectedErr: ErrInvalidQueryParameter},
+		{name: "Неизвестный статус", rawQuery: "status=DONE", expectedErr: ErrInvalidQueryParameter},
+		{name: "Неверная дата", rawQuery: "from=2025-01-01", expectedErr: ErrInvalidQueryParameter},
+		{name: "Пустой период", rawQuery: "from=2025-02-01T00:00:00Z&to=2025-01-01T00:00:00Z", expectedErr: ErrInvalidQueryParameter},
+		{name: "Неверная сортировка", rawQuery: "sort=up", expectedErr: ErrInvalidQueryParameter},
+		{name: "Неверный курсор", rawQuery: "cursor=abc", expectedErr: models.ErrInvalidCursor},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/user/orders?"+tt.rawQuery, nil)
+
+			query, err := parseOrderQuery(req, models.OrderType)
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.expected.Type, query.Type)
+			assert.Equal(t, tt.expected.Limit, query.Limit)
+			assert.Equal(t, tt.expected.Statuses, query.Statuses)
+			assert.True(t, tt.expected.From.Equal(query.From))
+			assert.True(t, tt.expected.To.Equal(query.To))
+			assert.Equal(t, tt.expected.Ascending, query.Ascending)
+			if tt.expected.After != nil {
+				require.NotNil(t, query.After)
+				assert.Equal(t, tt.expected.After.OrderID, query.After.OrderID)
+			}
+		})
+	}
+}
+
+func TestHandler_GetWithdrawals_NextPage(t *testing.T) {
+	userID := uint64(1)
+	uploadedAt := time.Date(2025, 3, 1, 12, 30, 0, 250000000, time.UTC)
+	next := models.OrderCursor{CreatedAt: uploadedAt, OrderID: "79927398713"}
+	orders := &fakeOrdersRepo{page: models.OrderPage{
+		Orders: []models.Order{{OrderID: "79927398713", Type: models.WithdrawType, Value: 500, UploadedAt: uploadedAt}},
+		Next:   &next,
+	}}
+	h := NewHandler(nil, orders, nil, nil, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/user/withdrawals?limit=1&sort=desc", nil)
+	req = req.WithContext(SetUserContext(req.Context(), &models.User{UserID: &userID, Login: "user"}))
+	res := httptest.NewRecorder()
+
+	h.GetWithdrawals(res, req)
+
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, models.WithdrawType, orders.query.Type)
+	assert.Equal(t, 1, orders.query.Limit)
+	assert.JSONEq(t, `[{"order":"79927398713","sum":5,"processed_at":"2025-03-01T12:30:00.25Z"}]`, res.Body.String())
+
+	assert.Equal(t, next.Encode(), res.Header().Get(NextCursorHeader))
+	assert.Equal(t, `</api/user/withdrawals?cursor=`+next.Encode()+`&limit=1&sort=desc>; rel="next"`, res.Header().Get("Link"))
+}
+
+func TestHandler_GetOrders_Dates(t *testing.T) {
+	userID := uint64(1)
+	uploadedAt := time.Date(2025, 3, 1, 12, 0, 0, 0, time.FixedZone("MSK", 3*60*60))
+	processedAt := uploadedAt.Add(1500 * time.Millisecond)
+	orders := &fakeOrdersRepo{page: models.OrderPage{Orders: []models.Order{
+		{OrderID: "79927398713", Type: models.OrderType, Status: models.OrderStatusProcessed, Value: 72998, UploadedAt: uploadedAt, ProcessedAt: &processedAt},
+		{OrderID: "12345678903", Type: models.OrderType, Status: models.OrderStatusNew, UploadedAt: uploadedAt},
+	}}}
+	h := NewHandler(nil, orders, nil, nil, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/user/orders", nil)
+	req = req.WithContext(SetUserContext(req.Context(), &models.User{UserID: &userID, Login: "user"}))
+	res := httptest.NewRecorder()
+
+	h.GetOrders(res, req)
+
+	require.Equal(t, http.StatusOK, res.Code)
+	assert.Empty(t, res.Header().Get(NextCursorHeader))
+	assert.JSONEq(t, `[
+		{"number":"79927398713","status":"PROCESSED","accrual":729.98,"uploaded_at":"2025-03-01T12:00:00+03:00","processed_at":"2025-03-01T12:00:01.5+03:00"},
+		{"number":"12345678903","status":"NEW","uploaded_at":"2025-03-01T12:00:00+03:00"}
+	]`, res.Body.String())
+}
@@ -0,0 +1,156 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/paxren/go-musthave-diploma-tpl/internal/auth"
+	"github.com/paxren/go-musthave-diploma-tpl/internal/models"
+	"github.com/paxren/go-musthave-diploma-tpl/internal/money"
+	"github.com/paxren/go-musthave-diploma-tpl/internal/repository"
+)
+
+// ProblemContentType тип содержимого ответа с ошибкой по RFC 7807
+const ProblemContentType = "application/problem+json"
+
+// problemTypePrefix префикс URI типа ошибки, к нему дописывается код ошибки
+const problemTypePrefix = "urn:gophermart:problem:"
+
+// Ошибки запроса, которые обнаруживают сами обработчики
+var (
+	ErrUnsupportedContentType = errors.New("неподдерживаемый Content-Type")
+	ErrMalformedBody          = errors.New("не удалось разобрать тело запроса")
+	ErrEmptyOrderNumber       = errors.New("пустой номер заказа")
+	ErrEmptyCredentials       = errors.New("пустой логин и/или пароль")
+	ErrEmptyPassword          = errors.New("пустой пароль")
+	ErrEmptyRefreshToken      = errors.New("пустой refresh токен")
+	ErrInvalidAmount          = errors.New("сумма списания должна быть больше 0")
+	ErrInvalidQueryParameter  = errors.New("некорректный параметр запроса")
+
+	ErrMissingAuthorization = errors.New("отсутствует заголовок авторизации")
+	ErrInvalidToken         = errors.New("невалидный токен")
+	ErrTokenRevoked         = errors.New("токен отозван")
+	ErrNotAuthenticated     = errors.New("пользователь не авторизован")
+
+	ErrIdempotencyKeyTooLong    = errors.New("слишком длинный ключ идемпотентности")
+	ErrIdempotencyKeyReused     = errors.New("ключ идемпотентности уже использован с другим запросом")
+	ErrIdempotencyKeyInProgress = errors.New("запрос с этим ключом идемпотентности еще выполняется")
+)
+
+// Problem тело ответа с ошибкой в формате application/problem+json (RFC 7807).
+// Code - стабильный машиночитаемый код ошибки, по нему клиент выбирает локализованное сообщение
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	Code     string `json:"code"`
+}
+
+// problemMapping описывает, каким ответом отвечать на ошибку
+type problemMapping struct {
+	err    error
+	status int
+	code   string
+	title  string
+}
+
+// problemMappings таблица соответствия ошибок ответам. Коды ошибок - часть API,
+// менять их нельзя, только добавлять новые
+var problemMappings = []problemMapping{
+	{repository.ErrBadOrderID, http.StatusUnprocessableEntity, "bad_order_number", "Неверный номер заказа"},
+	{repository.ErrIncafitionFunds, http.StatusPaymentRequired, "insufficient_funds", "Недостаточно средств"},
+	{repository.ErrOrderExistThisUser, http.StatusConflict, "order_already_uploaded", "Заказ уже загружен"},
+	{repository.ErrOrderExistAnotherUser, http.StatusConflict, "order_owned_by_another_user", "Заказ загружен другим пользователем"},
+	{repository.ErrOrderNotFound, http.StatusNotFound, "order_not_found", "Заказ не найден"},
+	{repository.ErrOrderType, http.StatusBadRequest, "unknown_order_type", "Неизвестный тип заказа"},
+	{repository.ErrUserExist, http.StatusConflict, "login_taken", "Логин уже занят"},
+	{repository.ErrBadLogin, http.StatusUnauthorized, "invalid_credentials", "Неверный логин или пароль"},
+	{repository.ErrWrongPassword, http.StatusForbidden, "wrong_password", "Неверный текущий пароль"},
+	{repository.ErrLoginLocked, http.StatusTooManyRequests, "login_locked", "Вход временно заблокирован"},
+	{repository.ErrSessionNotFound, http.StatusUnauthorized, "session_expired", "Сессия истекла или отозвана"},
+	{models.ErrInvalidLogin, http.StatusBadRequest, "invalid_login", "Некорректный логин"},
+	{auth.ErrWeakPassword, http.StatusBadRequest, "weak_password", "Пароль не соответствует требованиям"},
+	{models.ErrUnknownAccrualStatus, http.StatusBadRequest, "unknown_accrual_status", "Неизвестный статус accrual системы"},
+	{models.ErrInvalidCursor, http.StatusBadRequest, "invalid_cursor", "Некорректный курсор"},
+	{money.ErrInvalidAmount, http.StatusBadRequest, "malformed_amount", "Некорректная денежная сумма"},
+	{money.ErrOverflow, http.StatusBadRequest, "amount_too_large", "Слишком большая сумма"},
+
+	{ErrUnsupportedContentType, http.StatusBadRequest, "unsupported_content_type", "Неподдерживаемый формат запроса"},
+	{ErrMalformedBody, http.StatusBadRequest, "malformed_body", "Некорректное тело запроса"},
+	{ErrEmptyOrderNumber, http.StatusBadRequest, "empty_order_number", "Пустой номер заказа"},
+	{ErrEmptyCredentials, http.StatusBadRequest, "empty_credentials", "Пустой логин или пароль"},
+	{ErrEmptyPassword, http.StatusBadRequest, "empty_password", "Пустой пароль"},
+	{ErrEmptyRefreshToken, http.StatusBadRequest, "empty_refresh_token", "Пустой refresh токен"},
+	{ErrInvalidAmount, http.StatusBadRequest, "invalid_amount", "Некорректная сумма"},
+	{ErrInvalidQueryParameter, http.StatusBadRequest, "invalid_query_parameter", "Некорректный параметр запроса"},
+	{ErrMissingAuthorization, http.StatusUnauthorized, "missing_authorization", "Требуется авторизация"},
+	{ErrInvalidToken, http.StatusUnauthorized, "invalid_token", "Невалидный токен"},
+	{ErrTokenRevoked, http.StatusUnauthorized, "token_revoked", "Токен отозван"},
+	{ErrNotAuthenticated, http.StatusUnauthorized, "unauthenticated", "Требуется авторизация"},
+	{ErrInvalidSignature, http.StatusUnauthorized, "invalid_signature", "Неверная подпись уведомления"},
+	{ErrIdempotencyKeyTooLong, http.StatusBadRequest, "idempotency_key_too_long", "Слишком длинный ключ идемпотентности"},
+	{ErrIdempotencyKeyReused, http.StatusUnprocessableEntity, "idempotency_key_reused", "Ключ идемпотентности уже использован"},
+	{ErrIdempotencyKeyInProgress, http.StatusConflict, "idempotency_key_in_progress", "Запрос еще выполняется"},
+}
+
+// internalProblem ответ на ошибку, которой нет в таблице. Текст ошибки клиенту не отдается
+var internalProblem = problemMapping{nil, http.StatusInternalServerError, "internal_error", "Внутренняя ошибка сервера"}
+
+// writeError отвечает на ошибку в формате application/problem+json.
+// Единственное место, где ошибки превращаются в коды ответа
+func writeError(res http.ResponseWriter, req *http.Request, err error) {
+	mapping := internalProblem
+	for _, m := range problemMappings {
+		if errors.Is(err, m.err) {
+			mapping = m
+			break
+		}
+	}
+
+	problem := Problem{
+		Type:     problemTypePrefix + mapping.code,
+		Title:    mapping.title,
+		Status:   mapping.status,
+		Instance: req.URL.Path,
+		Code:     mapping.code,
+	}
+
+	if mapping.status >= http.StatusInternalServerError {
+		slog.Default().Error("Ошибка при обработке запроса", "path", req.URL.Path, "error", err)
+	} else {
+		problem.Detail = err.Error()
+	}
+
+	var lockedErr *repository.LoginLockedError
+	if errors.As(err, &lockedErr) {
+		res.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(lockedErr.RetryAfter.Seconds()))))
+	}
+
+	writeProblem(res, problem)
+}
+
+// writeProblem отправляет тело ошибки
+func writeProblem(res http.ResponseWriter, problem Problem) {
+	body, err := json.Marshal(problem)
+	if err != nil {
+		http.Error(res, problem.Title, problem.Status)
+		return
+	}
+
+	res.Header().Set("Content-Type", ProblemContentType)
+	res.Header().Set("X-Content-Type-Options", "nosniff")
+	res.WriteHeader(problem.Status)
+	res.Write(body)
+}
+
+// malformedBody оборачивает ошибку разбора тела запроса
+func malformedBody(err error) error {
+	return fmt.Errorf("%w: %v", ErrMalformedBody, err)
+}
@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/paxren/go-musthave-diploma-tpl/internal/repository"
+)
+
+func decodeProblem(t *testing.T, res *httptest.ResponseRecorder) Problem {
+	t.Helper()
+	assert.Equal(t, ProblemContentType, res.Header().Get("Content-Type"))
+
+	var problem Problem
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &problem))
+	return problem
+}
+
+func TestWriteError(t *testing.T) {
+	tests := []struct {
+		name           string
+		err            error
+		expectedStatus int
+		expectedCode   string
+		expectedDetail string
+	}{
+		{
+			name:           "Ошибка репозитория",
+			err:            repository.ErrIncafitionFunds,
+			expectedStatus: http.StatusPaymentRequired,
+			expectedCode:   "insufficient_funds",
+			expectedDetail: repository.ErrIncafitionFunds.Error(),
+		},
+		{
+			name:           "Обернутая ошибка",
+			err:            fmt.Errorf("ошибка при добавлении заказа: %w", repository.ErrOrderExistAnotherUser),
+			expectedStatus: http.StatusConflict,
+			expectedCode:   "order_owned_by_another_user",
+			expectedDetail: "ошибка при добавлении заказа: " + repository.ErrOrderExistAnotherUser.Error(),
+		},
+		{
+			name:           "Неизвестная ошибка не раскрывается клиенту",
+			err:            errors.New("pq: connection refused"),
+			expectedStatus: http.StatusInternalServerError,
+			expectedCode:   "internal_error",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/user/orders", nil)
+			res := httptest.NewRecorder()
+
+			writeError(res, req, tt.err)
+
+			assert.Equal(t, tt.expectedStatus, res.Code)
+			problem := decodeProblem(t, res)
+			assert.Equal(t, tt.expectedStatus, problem.Status)
+			assert.Equal(t, tt.expectedCode, problem.Code)
+			assert.Equal(t, problemTypePrefix+tt.expectedCode, problem.Type)
+			assert.Equal(t, tt.expectedDetail, problem.Detail)
+			assert.Equal(t, "/api/user/orders", problem.Instance)
+			assert.NotEmpty(t, problem.Title)
+		})
+	}
+}
+
+func TestWriteError_LoginLocked(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/api/user/login", nil)
+	res := httptest.NewRecorder()
+
+	writeError(res, req, &repository.LoginLockedError{RetryAfter: 30 * time.Second})
+
+	assert.Equal(t, http.StatusTooManyRequests, res.Code)
+	assert.Equal(t, "30", res.Header().Get("Retry-After"))
+	assert.Equal(t, "login_locked", decodeProblem(t, res).Code)
+}
+
+func TestProblemMappings_UniqueCodes(t *testing.T) {
+	codes := make(map[string]bool)
+	for _, m := range problemMappings {
+		assert.False(t, codes[m.code], "код %s повторяется", m.code)
+		codes[m.code] = true
+	}
+}
+
+func TestHandler_WithdrawBalance_Problem(t *testing.T) {
+	h := Handler{}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/user/balance/withdraw", strings.NewReader(`{"order":"12345","sum":10}`))
+	req.Header.Set("Content-Type", "application/json")
+	res := httptest.NewRecorder()
+
+	h.WithdrawBalance(res, req)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, res.Code)
+	assert.Equal(t, "bad_order_number", decodeProblem(t, res).Code)
+}
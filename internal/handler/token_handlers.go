@@ -0,0 +1,137 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/paxren/go-musthave-diploma-tpl/internal/auth"
+	"github.com/paxren/go-musthave-diploma-tpl/internal/models"
+)
+
+// writeTokens выдает access токен сессии и отправляет его вместе с refresh токеном.
+// Access токен по-прежнему передается в заголовке Authorization
+func (h Handler) writeTokens(res http.ResponseWriter, req *http.Request, session models.Session, refreshToken string) {
+	token, err := h.jwtService.GenerateToken(session.UserID, session.Login, session.ID)
+	if err != nil {
+		writeError(res, req, fmt.Errorf("ошибка при генерации токена: %w", err))
+		return
+	}
+
+	body, err := json.Marshal(AuthResponse{Token: token, RefreshToken: refreshToken})
+	if err != nil {
+		writeError(res, req, err)
+		return
+	}
+
+	res.Header().Set("Authorization", token)
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(http.StatusOK)
+	res.Write(body)
+}
+
+// startSession открывает новую сессию пользователя и выдает ему токены
+func (h Handler) startSession(res http.ResponseWriter, req *http.Request, user models.User) {
+	sessionID, err := auth.GenerateSessionID()
+	if err != nil {
+		writeError(res, req, fmt.Errorf("ошибка при создании сессии: %w", err))
+		return
+	}
+
+	refreshToken, refreshHash, err := auth.GenerateRefreshToken()
+	if err != nil {
+		writeError(res, req, fmt.Errorf("ошибка при генерации токена: %w", err))
+		return
+	}
+
+	session := models.Session{
+		ID:        sessionID,
+		UserID:    *user.UserID,
+		Login:     user.Login,
+		ExpiresAt: time.Now().Add(auth.DefaultRefreshTokenTTL),
+	}
+	if err = h.sessionRepo.CreateSession(req.Context(), session, refreshHash); err != nil {
+		writeError(res, req, err)
+		return
+	}
+
+	h.writeTokens(res, req, session, refreshToken)
+}
+
+// RefreshToken обменивает refresh токен на новую пару токенов.
+// Предъявленный refresh токен после обмена становится недействительным
+func (h Handler) RefreshToken(res http.ResponseWriter, req *http.Request) {
+	if req.Header.Get("Content-Type") != "application/json" {
+		writeError(res, req, fmt.Errorf("%w: нужен application/json", ErrUnsupportedContentType))
+		return
+	}
+
+	var refreshReq RefreshRequest
+	if err := json.NewDecoder(req.Body).Decode(&refreshReq); err != nil {
+		writeError(res, req, malformedBody(err))
+		return
+	}
+	defer req.Body.Close()
+
+	if refreshReq.RefreshToken == "" {
+		writeError(res, req, ErrEmptyRefreshToken)
+		return
+	}
+
+	newRefreshToken, newRefreshHash, err := auth.GenerateRefreshToken()
+	if err != nil {
+		writeError(res, req, fmt.Errorf("ошибка при генерации токена: %w", err))
+		return
+	}
+
+	session, err := h.sessionRepo.RotateSession(req.Context(),
+		auth.HashRefreshToken(refreshReq.RefreshToken),
+		newRefreshHash,
+		time.Now().Add(auth.DefaultRefreshTokenTTL))
+	if err != nil {
+		writeError(res, req, err)
+		return
+	}
+
+	h.writeTokens(res, req, *session, newRefreshToken)
+}
+
+// Logout завершает текущую сессию: отзывает ее refresh токен и предъявленный access токен
+func (h Handler) Logout(res http.ResponseWriter, req *http.Request) {
+	claims, err := GetClaimsFromContext(req.Context())
+	if err != nil {
+		writeError(res, req, err)
+		return
+	}
+
+	if err = h.sessionRepo.RevokeSession(req.Context(), claims.SessionID); err != nil {
+		writeError(res, req, err)
+		return
+	}
+	h.userCache.InvalidateSession(claims.SessionID)
+
+	if claims.ID != "" && claims.ExpiresAt != nil {
+		if err = h.sessionRepo.RevokeToken(req.Context(), claims.ID, claims.ExpiresAt.Time); err != nil {
+			writeError(res, req, err)
+			return
+		}
+	}
+
+	res.WriteHeader(http.StatusOK)
+}
+
+// JWKS отдает открытые ключи проверки подписи токенов в формате JSON Web Key Set,
+// чтобы другие сервисы могли проверять токены без общего секрета
+func (h Handler) JWKS(res http.ResponseWriter, req *http.Request) {
+	body, err := json.Marshal(h.jwtService.JWKS())
+	if err != nil {
+		writeError(res, req, err)
+		return
+	}
+
+	res.Header().Set("Content-Type", "application/json")
+	res.Header().Set("Cache-Control", "public, max-age=300")
+	res.WriteHeader(http.StatusOK)
+	res.Write(body)
+}
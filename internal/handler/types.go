@@ -1,35 +1,55 @@
 package handler
 
+import (
+	"time"
+
+	"github.com/paxren/go-musthave-diploma-tpl/internal/money"
+)
+
 // BalanceExport представляет структуру для экспорта баланса
 type BalanceExport struct {
-	Current   float64 `json:"current"`
-	Withdrawn float64 `json:"withdrawn"`
+	Current   money.Amount `json:"current"`
+	Withdrawn money.Amount `json:"withdrawn"`
 }
 
-// OrderExport представляет структуру для экспорта заказов
+// OrderExport представляет структуру для экспорта заказов.
+// Даты сериализуются в формате RFC 3339 с долями секунды
 type OrderExport struct {
-	OrderID string   `json:"number"`
-	User    string   `json:"-"`
-	Type    string   `json:"-"`
-	Status  string   `json:"status"`
-	Date    string   `json:"uploaded_at"`
-	Value   *float64 `json:"accrual,omitempty"`
+	OrderID     string        `json:"number"`
+	User        string        `json:"-"`
+	Type        string        `json:"-"`
+	Status      string        `json:"status"`
+	UploadedAt  time.Time     `json:"uploaded_at"`
+	ProcessedAt *time.Time    `json:"processed_at,omitempty"`
+	Value       *money.Amount `json:"accrual,omitempty"`
 }
 
 // WithdrawRequest представляет запрос на списание баллов
 type WithdrawRequest struct {
-	Order string  `json:"order"`
-	Sum   float64 `json:"sum"`
+	Order string       `json:"order"`
+	Sum   money.Amount `json:"sum"`
 }
 
 // WithdrawResponse представляет ответ с информацией о выводе средств
 type WithdrawResponse struct {
-	Order       string  `json:"order"`
-	Sum         float64 `json:"sum"`
-	ProcessedAt string  `json:"processed_at"`
+	Order       string       `json:"order"`
+	Sum         money.Amount `json:"sum"`
+	ProcessedAt time.Time    `json:"processed_at"`
 }
 
-// AuthResponse представляет ответ аутентификации с JWT токеном
+// AuthResponse представляет ответ аутентификации с access и refresh токенами
 type AuthResponse struct {
-	Token string `json:"token"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// RefreshRequest представляет запрос на обновление токенов
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// ChangePasswordRequest представляет запрос на смену пароля
+type ChangePasswordRequest struct {
+	OldPassword string `json:"old_password"`
+	NewPassword string `json:"new_password"`
 }
@@ -0,0 +1,114 @@
+package handler
+
+import (
+	"sync"
+	"time"
+
+	"github.com/paxren/go-musthave-diploma-tpl/internal/models"
+)
+
+// DefaultUserCacheTTL время, в течение которого AuthMiddleware не перепроверяет сессию в базе.
+// Отзыв сессии на другом экземпляре сервиса вступает в силу не позже, чем через это время
+const DefaultUserCacheTTL = 30 * time.Second
+
+// maxUserCacheEntries при превышении из кеша удаляются устаревшие записи
+const maxUserCacheEntries = 10000
+
+type userCacheEntry struct {
+	user      models.User
+	expiresAt time.Time
+}
+
+// UserCache кеширует пользователей действующих сессий, чтобы не обращаться к базе
+// на каждый запрос. Ключ - идентификатор сессии из токена.
+// Методы безопасны для nil, nil кеш ничего не хранит
+type UserCache struct {
+	mutex   sync.RWMutex
+	ttl     time.Duration
+	entries map[string]userCacheEntry
+	now     func() time.Time
+}
+
+// NewUserCache создает кеш пользователей с временем жизни записи ttl
+func NewUserCache(ttl time.Duration) *UserCache {
+	if ttl <= 0 {
+		ttl = DefaultUserCacheTTL
+	}
+	return &UserCache{
+		ttl:     ttl,
+		entries: make(map[string]userCacheEntry),
+		now:     time.Now,
+	}
+}
+
+// Get возвращает пользователя сессии, если запись есть и не устарела
+func (c *UserCache) Get(sessionID string) (*models.User, bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	c.mutex.RLock()
+	entry, ok := c.entries[sessionID]
+	c.mutex.RUnlock()
+
+	if !ok || !c.now().Before(entry.expiresAt) {
+		return nil, false
+	}
+	user := entry.user
+	return &user, true
+}
+
+// Put запоминает пользователя действующей сессии
+func (c *UserCache) Put(sessionID string, user models.User) {
+	if c == nil {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := c.now()
+	if len(c.entries) >= maxUserCacheEntries {
+		for id, entry := range c.entries {
+			if !now.Before(entry.expiresAt) {
+				delete(c.entries, id)
+			}
+		}
+		if len(c.entries) >= maxUserCacheEntries {
+			c.entries = make(map[string]userCacheEntry)
+		}
+	}
+
+	c.entries[sessionID] = userCacheEntry{user: user, expiresAt: now.Add(c.ttl)}
+}
+
+// InvalidateSession удаляет сессию из кеша, например при выходе пользователя
+func (c *UserCache) InvalidateSession(sessionID string) {
+	if c == nil {
+		return
+	}
+
+	c.mutex.Lock()
+	delete(c.entries, sessionID)
+	c.mutex.Unlock()
+}
+
+// InvalidateUser удаляет из кеша все сессии пользователя.
+// Вызывается при смене пароля, когда сессии пользователя отзываются. Блокировка входа после
+// неудачных попыток (LoginLockedError) запрещает только новые входы и сессии не отзывает,
+// поэтому кеш при ней не сбрасывается. Удаления пользователей в сервисе нет; если оно появится,
+// его нужно сопровождать отзывом сессий и вызовом InvalidateUser
+func (c *UserCache) InvalidateUser(userID uint64) {
+	if c == nil {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for id, entry := range c.entries {
+		if entry.user.UserID != nil && *entry.user.UserID == userID {
+			delete(c.entries, id)
+		}
+	}
+}
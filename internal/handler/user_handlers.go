@@ -4,18 +4,20 @@ import (
 	"bytes"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"net"
 	"net/http"
 
 	"github.com/paxren/go-musthave-diploma-tpl/internal/models"
-	"github.com/paxren/go-musthave-diploma-tpl/internal/repository"
 )
 
 // readUser читает и валидирует данные пользователя из запроса
 func readUser(res http.ResponseWriter, req *http.Request) (*models.User, error) {
 
 	if req.Header.Get("Content-Type") != "application/json" {
-		res.WriteHeader(http.StatusResetContent)
-		return nil, errors.New("нужен джейсон")
+		err := fmt.Errorf("%w: нужен application/json", ErrUnsupportedContentType)
+		writeError(res, req, err)
+		return nil, err
 	}
 
 	var user models.User
@@ -23,23 +25,35 @@ func readUser(res http.ResponseWriter, req *http.Request) (*models.User, error)
 	// читаем тело запроса
 	_, err := buf.ReadFrom(req.Body)
 	if err != nil {
-		http.Error(res, err.Error(), http.StatusBadRequest)
+		err = malformedBody(err)
+		writeError(res, req, err)
 		return nil, err
 	}
 	// десериализуем JSON в Metric
 	if err = json.Unmarshal(buf.Bytes(), &user); err != nil {
-		http.Error(res, err.Error(), http.StatusBadRequest)
+		err = malformedBody(err)
+		writeError(res, req, err)
 		return nil, err
 	}
 
 	if user.Login == "" || user.Password == "" {
-		http.Error(res, "пустой логин и/или пароль", http.StatusBadRequest)
-		return nil, errors.New("пустой логин и/или пароль")
+		writeError(res, req, ErrEmptyCredentials)
+		return nil, ErrEmptyCredentials
 	}
 
 	return &user, nil
 }
 
+// clientIP возвращает IP адрес клиента из адреса соединения.
+// Заголовкам X-Forwarded-For не доверяем: их может подделать сам клиент
+func clientIP(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
+
 // RegisterUser обрабатывает регистрацию нового пользователя
 func (h Handler) RegisterUser(res http.ResponseWriter, req *http.Request) {
 	//_ := chi.URLParam(req, "metric_type")
@@ -49,33 +63,29 @@ func (h Handler) RegisterUser(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	if err = h.userRepo.RegisterUser(*user); err != nil {
-		if errors.Is(err, repository.ErrUserExist) {
-			http.Error(res, "логин уже занят", http.StatusConflict)
-		} else {
-			http.Error(res, "другая ошибка при попытке зарегистрировать пользователя", http.StatusInternalServerError)
-		}
-
+	if err = models.ValidateLogin(user.Login); err != nil {
+		writeError(res, req, err)
+		return
+	}
+	if err = h.passwordPolicy.Validate(user.Login, user.Password); err != nil {
+		writeError(res, req, err)
 		return
 	}
 
-	// Получаем пользователя из базы данных для получения ID
-	registeredUser := h.userRepo.GetUser(user.Login)
-	if registeredUser == nil {
-		http.Error(res, "ошибка при получении данных зарегистрированного пользователя", http.StatusInternalServerError)
+	if err = h.userRepo.RegisterUser(req.Context(), *user); err != nil {
+		writeError(res, req, err)
 		return
 	}
 
-	// Генерируем JWT токен
-	token, err := h.jwtService.GenerateToken(*registeredUser.UserID, registeredUser.Login)
-	if err != nil {
-		http.Error(res, "ошибка при генерации токена", http.StatusInternalServerError)
+	// Получаем пользователя из базы данных для получения ID
+	registeredUser := h.userRepo.GetUser(req.Context(), user.Login)
+	if registeredUser == nil {
+		writeError(res, req, errors.New("ошибка при получении данных зарегистрированного пользователя"))
 		return
 	}
 
-	// Устанавливаем токен в заголовок Authorization
-	res.Header().Set("Authorization", token)
-	res.WriteHeader(http.StatusOK)
+	// Открываем сессию и выдаем токены
+	h.startSession(res, req, *registeredUser)
 }
 
 // LoginUser обрабатывает авторизацию пользователя
@@ -86,26 +96,59 @@ func (h Handler) LoginUser(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	if err = h.userRepo.LoginUser(*user); err != nil {
-		http.Error(res, "не авторизован", http.StatusUnauthorized)
+	if err = h.userRepo.LoginUser(req.Context(), *user, clientIP(req)); err != nil {
+		writeError(res, req, err)
 		return
 	}
 
 	// Получаем пользователя из базы данных для получения ID
-	loggedUser := h.userRepo.GetUser(user.Login)
+	loggedUser := h.userRepo.GetUser(req.Context(), user.Login)
 	if loggedUser == nil {
-		http.Error(res, "ошибка при получении данных пользователя", http.StatusInternalServerError)
+		writeError(res, req, errors.New("ошибка при получении данных пользователя"))
+		return
+	}
+
+	// Открываем сессию и выдаем токены
+	h.startSession(res, req, *loggedUser)
+}
+
+// ChangePassword меняет пароль текущего пользователя по старому паролю.
+// Все сессии пользователя отзываются, вызывающему выдаются новые токены
+func (h Handler) ChangePassword(res http.ResponseWriter, req *http.Request) {
+	user, err := GetUserFromContext(req.Context())
+	if err != nil {
+		writeError(res, req, err)
+		return
+	}
+
+	if req.Header.Get("Content-Type") != "application/json" {
+		writeError(res, req, fmt.Errorf("%w: нужен application/json", ErrUnsupportedContentType))
+		return
+	}
+
+	var changeReq ChangePasswordRequest
+	if err = json.NewDecoder(req.Body).Decode(&changeReq); err != nil {
+		writeError(res, req, malformedBody(err))
+		return
+	}
+	defer req.Body.Close()
+
+	if changeReq.OldPassword == "" || changeReq.NewPassword == "" {
+		writeError(res, req, ErrEmptyPassword)
+		return
+	}
+	if err = h.passwordPolicy.Validate(user.Login, changeReq.NewPassword); err != nil {
+		writeError(res, req, err)
 		return
 	}
 
-	// Генерируем JWT токен
-	token, err := h.jwtService.GenerateToken(*loggedUser.UserID, loggedUser.Login)
+	// Хранилище отзывает сессии пользователя в той же транзакции, что и меняет пароль
+	err = h.userRepo.ChangePassword(req.Context(), *user.UserID, changeReq.OldPassword, changeReq.NewPassword, clientIP(req))
 	if err != nil {
-		http.Error(res, "ошибка при генерации токена", http.StatusInternalServerError)
+		writeError(res, req, err)
 		return
 	}
+	h.userCache.InvalidateUser(*user.UserID)
 
-	// Устанавливаем токен в заголовок Authorization
-	res.Header().Set("Authorization", token)
-	res.WriteHeader(http.StatusOK)
+	h.startSession(res, req, *user)
 }
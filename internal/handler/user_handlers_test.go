@@ -0,0 +1,123 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/paxren/go-musthave-diploma-tpl/internal/auth"
+	"github.com/paxren/go-musthave-diploma-tpl/internal/models"
+	"github.com/paxren/go-musthave-diploma-tpl/internal/repository"
+)
+
+// fakeUsersRepo возвращает заданную ошибку входа и запоминает IP адрес клиента
+type fakeUsersRepo struct {
+	loginErr error
+	clientIP string
+}
+
+func (f *fakeUsersRepo) GetUser(_ context.Context, _ string) *models.User {
+	return nil
+}
+
+func (f *fakeUsersRepo) RegisterUser(_ context.Context, _ models.User) error {
+	return nil
+}
+
+func (f *fakeUsersRepo) LoginUser(_ context.Context, _ models.User, clientIP string) error {
+	f.clientIP = clientIP
+	return f.loginErr
+}
+
+func (f *fakeUsersRepo) ChangePassword(_ context.Context, _ uint64, _, _, clientIP string) error {
+	f.clientIP = clientIP
+	return f.loginErr
+}
+
+func TestHandler_LoginUser_Locked(t *testing.T) {
+	tests := []struct {
+		name               string
+		loginErr           error
+		expectedCode       int
+		expectedRetryAfter string
+	}{
+		{
+			name:         "Неверный пароль",
+			loginErr:     repository.ErrBadLogin,
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name:               "Вход заблокирован",
+			loginErr:           &repository.LoginLockedError{RetryAfter: 90500 * time.Millisecond},
+			expectedCode:       http.StatusTooManyRequests,
+			expectedRetryAfter: "91",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &fakeUsersRepo{loginErr: tt.loginErr}
+			h := Handler{userRepo: repo}
+
+			req := httptest.NewRequest(http.MethodPost, "/api/user/login", strings.NewReader(`{"login":"user","password":"password"}`))
+			req.Header.Set("Content-Type", "application/json")
+			req.RemoteAddr = "192.0.2.10:54321"
+			res := httptest.NewRecorder()
+
+			h.LoginUser(res, req)
+
+			assert.Equal(t, tt.expectedCode, res.Code)
+			assert.Equal(t, tt.expectedRetryAfter, res.Header().Get("Retry-After"))
+			assert.Equal(t, "192.0.2.10", repo.clientIP)
+		})
+	}
+}
+
+func TestHandler_ChangePassword_Locked(t *testing.T) {
+	repo := &fakeUsersRepo{loginErr: &repository.LoginLockedError{RetryAfter: 30 * time.Second}}
+	h := Handler{userRepo: repo, passwordPolicy: auth.DefaultPasswordPolicy()}
+
+	userID := uint64(1)
+	req := httptest.NewRequest(http.MethodPut, "/api/user/password", strings.NewReader(`{"old_password":"guess","new_password":"correct-horse-7"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.RemoteAddr = "192.0.2.10:54321"
+	req = req.WithContext(SetUserContext(req.Context(), &models.User{UserID: &userID, Login: "user"}))
+	res := httptest.NewRecorder()
+
+	h.ChangePassword(res, req)
+
+	assert.Equal(t, http.StatusTooManyRequests, res.Code)
+	assert.Equal(t, "30", res.Header().Get("Retry-After"))
+	assert.Equal(t, "192.0.2.10", repo.clientIP)
+}
+
+func TestHandler_RegisterUser_Validation(t *testing.T) {
+	tests := []struct {
+		name         string
+		body         string
+		expectedCode int
+	}{
+		{name: "Слабый пароль", body: `{"login":"a","password":"1"}`, expectedCode: http.StatusBadRequest},
+		{name: "Пустой логин после обрезки пробелов", body: `{"login":"   ","password":"correct-horse-7"}`, expectedCode: http.StatusBadRequest},
+		{name: "Пароль содержит логин", body: `{"login":"ivan","password":"Ivan-2024!"}`, expectedCode: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHandler(&fakeUsersRepo{}, nil, nil, nil, nil)
+
+			req := httptest.NewRequest(http.MethodPost, "/api/user/register", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			res := httptest.NewRecorder()
+
+			h.RegisterUser(res, req)
+
+			assert.Equal(t, tt.expectedCode, res.Code)
+		})
+	}
+}
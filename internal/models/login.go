@@ -0,0 +1,48 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// MaxLoginLength максимальная длина логина в символах, совпадает с размером колонки в базе
+const MaxLoginLength = 255
+
+var ErrInvalidLogin = errors.New("некорректный логин")
+
+var loginFolder = cases.Fold()
+
+// NormalizeLogin приводит логин к каноническому виду: обрезает пробелы по краям,
+// приводит к форме NFC и выполняет свертку регистра. Логины, совпадающие после
+// нормализации, считаются одним пользователем
+func NormalizeLogin(login string) string {
+	login = norm.NFC.String(strings.TrimSpace(login))
+	// Свертка регистра может нарушить форму NFC, поэтому нормализуем еще раз
+	return norm.NFC.String(loginFolder.String(login))
+}
+
+// ValidateLogin проверяет логин, введенный пользователем
+func ValidateLogin(login string) error {
+	login = strings.TrimSpace(login)
+	if login == "" {
+		return fmt.Errorf("%w: пустой логин", ErrInvalidLogin)
+	}
+	if !utf8.ValidString(login) {
+		return fmt.Errorf("%w: логин не в кодировке UTF-8", ErrInvalidLogin)
+	}
+	if utf8.RuneCountInString(login) > MaxLoginLength || utf8.RuneCountInString(NormalizeLogin(login)) > MaxLoginLength {
+		return fmt.Errorf("%w: логин длиннее %d символов", ErrInvalidLogin, MaxLoginLength)
+	}
+	for _, r := range login {
+		if unicode.IsControl(r) {
+			return fmt.Errorf("%w: логин содержит управляющие символы", ErrInvalidLogin)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeLogin(t *testing.T) {
+	tests := []struct {
+		name     string
+		a, b     string
+		expected bool
+	}{
+		{name: "Регистр", a: "Ivan", b: "iVAN", expected: true},
+		{name: "Пробелы по краям", a: "  ivan\t", b: "ivan", expected: true},
+		{name: "Кириллица", a: "Иван", b: "иван", expected: true},
+		{name: "Составной и предсоставленный символ", a: "Jos\u00e9", b: "JOSE\u0301", expected: true},
+		{name: "Свертка регистра", a: "Straße", b: "STRASSE", expected: true},
+		{name: "Разные логины", a: "ivan", b: "ivan2", expected: false},
+		{name: "Пробел внутри сохраняется", a: "iv an", b: "ivan", expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, NormalizeLogin(tt.a) == NormalizeLogin(tt.b))
+		})
+	}
+}
+
+func TestValidateLogin(t *testing.T) {
+	assert.NoError(t, ValidateLogin("ivan"))
+	assert.NoError(t, ValidateLogin("Иван Петров"))
+	assert.ErrorIs(t, ValidateLogin("   "), ErrInvalidLogin)
+	assert.ErrorIs(t, ValidateLogin("iv\x00an"), ErrInvalidLogin)
+	assert.ErrorIs(t, ValidateLogin("\xff\xfe"), ErrInvalidLogin)
+	assert.ErrorIs(t, ValidateLogin(strings.Repeat("a", MaxLoginLength+1)), ErrInvalidLogin)
+}
@@ -0,0 +1,73 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	// DefaultPageLimit размер страницы, если передан курсор, но не передан limit
+	DefaultPageLimit = 100
+	// MaxPageLimit максимальный размер страницы
+	MaxPageLimit = 1000
+)
+
+var ErrInvalidCursor = errors.New("некорректный курсор")
+
+// OrderCursor позиция в списке заказов: дата создания и номер последнего отданного заказа.
+// Клиенту передается в закодированном виде и разбирается только сервером
+type OrderCursor struct {
+	CreatedAt time.Time `json:"t"`
+	OrderID   string    `json:"id"`
+}
+
+// Encode кодирует курсор в непрозрачную строку для клиента
+func (c OrderCursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeOrderCursor разбирает курсор, полученный от клиента
+func DecodeOrderCursor(s string) (*OrderCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCursor, err)
+	}
+
+	var cursor OrderCursor
+	if err = json.Unmarshal(data, &cursor); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCursor, err)
+	}
+	if cursor.CreatedAt.IsZero() || cursor.OrderID == "" {
+		return nil, ErrInvalidCursor
+	}
+
+	return &cursor, nil
+}
+
+// OrderQuery параметры выборки заказов пользователя.
+// Нулевое значение - все заказы пользователя от новых к старым
+type OrderQuery struct {
+	Type      string    // тип заказа, пустая строка - любой
+	Statuses  []string  // статусы заказа, пустой список - любой
+	From      time.Time // заказы, созданные не раньше From, нулевое значение - без ограничения
+	To        time.Time // заказы, созданные раньше To, нулевое значение - без ограничения
+	Ascending bool      // сортировка от старых к новым
+	Limit     int       // размер страницы, 0 - без ограничения
+	After     *OrderCursor
+}
+
+// OrderPage страница заказов. Next задан, если за страницей есть еще заказы
+type OrderPage struct {
+	Orders []Order
+	Next   *OrderCursor
+}
+
+// IsOrderStatus проверяет, что status - известный статус заказа
+func IsOrderStatus(status string) bool {
+	_, ok := orderStatusTransitions[status]
+	return ok
+}
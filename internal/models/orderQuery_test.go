@@ -0,0 +1,26 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOrderCursor(t *testing.T) {
+	cursor := OrderCursor{
+		CreatedAt: time.Date(2025, 3, 1, 12, 30, 0, 123456000, time.UTC),
+		OrderID:   "12345678903",
+	}
+
+	decoded, err := DecodeOrderCursor(cursor.Encode())
+	require.NoError(t, err)
+	assert.True(t, cursor.CreatedAt.Equal(decoded.CreatedAt))
+	assert.Equal(t, cursor.OrderID, decoded.OrderID)
+
+	for _, bad := range []string{"не base64", "bm90IGpzb24", OrderCursor{OrderID: "1"}.Encode()} {
+		_, err = DecodeOrderCursor(bad)
+		assert.ErrorIs(t, err, ErrInvalidCursor, bad)
+	}
+}
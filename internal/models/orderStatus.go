@@ -0,0 +1,70 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Статусы расчета начислений в accrual системе
+const (
+	AccrualStatusRegistered = "REGISTERED"
+	AccrualStatusInvalid    = "INVALID"
+	AccrualStatusProcessing = "PROCESSING"
+	AccrualStatusProcessed  = "PROCESSED"
+)
+
+var (
+	ErrUnknownAccrualStatus    = errors.New("неизвестный статус accrual системы")
+	ErrIllegalStatusTransition = errors.New("недопустимый переход статуса заказа")
+)
+
+// orderStatusTransitions допустимые переходы статусов заказа.
+// INVALID и PROCESSED конечные, назад статус заказа не возвращается
+var orderStatusTransitions = map[string][]string{
+	OrderStatusNew:        {OrderStatusProcessing, OrderStatusInvalid, OrderStatusProcessed},
+	OrderStatusProcessing: {OrderStatusInvalid, OrderStatusProcessed},
+	OrderStatusInvalid:    {},
+	OrderStatusProcessed:  {},
+}
+
+// OrderStatusFromAccrual переводит статус accrual системы в статус заказа.
+// REGISTERED означает, что заказ принят в обработку, поэтому соответствует PROCESSING
+func OrderStatusFromAccrual(accrualStatus string) (string, error) {
+	switch accrualStatus {
+	case AccrualStatusRegistered, AccrualStatusProcessing:
+		return OrderStatusProcessing, nil
+	case AccrualStatusInvalid:
+		return OrderStatusInvalid, nil
+	case AccrualStatusProcessed:
+		return OrderStatusProcessed, nil
+	default:
+		return "", fmt.Errorf("%w: %q", ErrUnknownAccrualStatus, accrualStatus)
+	}
+}
+
+// CanTransition проверяет, может ли заказ перейти из статуса from в статус to
+func CanTransition(from, to string) bool {
+	for _, next := range orderStatusTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// IsFinalStatus проверяет, что status конечный и заказ больше не обрабатывается
+func IsFinalStatus(status string) bool {
+	next, ok := orderStatusTransitions[status]
+	return ok && len(next) == 0
+}
+
+// StatusesBefore возвращает статусы, из которых заказ может перейти в статус to
+func StatusesBefore(to string) []string {
+	var from []string
+	for _, status := range []string{OrderStatusNew, OrderStatusProcessing, OrderStatusInvalid, OrderStatusProcessed} {
+		if CanTransition(status, to) {
+			from = append(from, status)
+		}
+	}
+	return from
+}
@@ -0,0 +1,70 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOrderStatusFromAccrual(t *testing.T) {
+	tests := []struct {
+		accrualStatus string
+		expected      string
+	}{
+		{AccrualStatusRegistered, OrderStatusProcessing},
+		{AccrualStatusProcessing, OrderStatusProcessing},
+		{AccrualStatusInvalid, OrderStatusInvalid},
+		{AccrualStatusProcessed, OrderStatusProcessed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.accrualStatus, func(t *testing.T) {
+			status, err := OrderStatusFromAccrual(tt.accrualStatus)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, status)
+		})
+	}
+
+	_, err := OrderStatusFromAccrual("UNKNOWN")
+	assert.ErrorIs(t, err, ErrUnknownAccrualStatus)
+}
+
+func TestCanTransition(t *testing.T) {
+	tests := []struct {
+		from     string
+		to       string
+		expected bool
+	}{
+		{OrderStatusNew, OrderStatusProcessing, true},
+		{OrderStatusNew, OrderStatusProcessed, true},
+		{OrderStatusNew, OrderStatusInvalid, true},
+		{OrderStatusProcessing, OrderStatusProcessed, true},
+		{OrderStatusProcessing, OrderStatusInvalid, true},
+		{OrderStatusProcessing, OrderStatusNew, false},
+		{OrderStatusProcessing, OrderStatusProcessing, false},
+		{OrderStatusProcessed, OrderStatusProcessing, false},
+		{OrderStatusProcessed, OrderStatusInvalid, false},
+		{OrderStatusInvalid, OrderStatusProcessed, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.from+"->"+tt.to, func(t *testing.T) {
+			assert.Equal(t, tt.expected, CanTransition(tt.from, tt.to))
+		})
+	}
+}
+
+func TestStatusesBefore(t *testing.T) {
+	assert.Equal(t, []string{OrderStatusNew, OrderStatusProcessing}, StatusesBefore(OrderStatusProcessed))
+	assert.Equal(t, []string{OrderStatusNew}, StatusesBefore(OrderStatusProcessing))
+	assert.Empty(t, StatusesBefore(OrderStatusNew))
+}
+
+func TestIsFinalStatus(t *testing.T) {
+	assert.True(t, IsFinalStatus(OrderStatusProcessed))
+	assert.True(t, IsFinalStatus(OrderStatusInvalid))
+	assert.False(t, IsFinalStatus(OrderStatusNew))
+	assert.False(t, IsFinalStatus(OrderStatusProcessing))
+	assert.False(t, IsFinalStatus("UNKNOWN"))
+}
@@ -1,6 +1,10 @@
 package models
 
-import "time"
+import (
+	"time"
+
+	"github.com/paxren/go-musthave-diploma-tpl/internal/money"
+)
 
 const (
 	OrderStatusNew        = "NEW"
@@ -12,8 +16,6 @@ const (
 	WithdrawType = "WITHDRAW"
 )
 
-type money uint64
-
 type User struct {
 	UserID   *uint64 `json:"user_id,omitempty"`
 	Login    string  `json:"login"`
@@ -21,49 +23,72 @@ type User struct {
 }
 
 type Order struct {
-	OrderID string `json:"number"`
-	User    string `json:"-"`
-	Type    string `json:"-"`
-	Status  string `json:"status"`
-	Date    string `json:"uploaded_at"` //TODO может быть переделать на дату всё же?
-	Value   uint64 `json:"-"`
+	OrderID string       `json:"number"`
+	User    string       `json:"-"`
+	Type    string       `json:"-"`
+	Status  string       `json:"status"`
+	Value   money.Amount `json:"-"`
+
+	UploadedAt  time.Time  `json:"uploaded_at"`
+	UpdatedAt   time.Time  `json:"-"`
+	ProcessedAt *time.Time `json:"processed_at,omitempty"` // время перехода в конечный статус, nil - заказ еще обрабатывается
+
+	PollAttempts int `json:"-"` // количество подряд идущих опросов accrual без изменения статуса
+	// NotRegisteredPolls количество подряд идущих ответов accrual "заказ не зарегистрирован" (204).
+	// Ошибки и другие ответы accrual системы его сбрасывают
+	NotRegisteredPolls int `json:"-"`
+	// LeaseToken номер аренды, под которой заказ захвачен для опроса. Увеличивается при каждом захвате,
+	// поэтому по нему отличается аренда, перехваченная другим экземпляром после истечения
+	LeaseToken int64 `json:"-"`
 }
 
-// type Order struct {
-// 	OrderID uint64 `json:"order_id,omitempty"`
-// 	User    string `json:"user"`
-// 	Type    string `json:"type"`
-// 	Status  string `json:"status"`
-// 	Date    string `json:"date"` //TODO может быть переделать на дату всё же?
-// 	Value   uint64 `json:"value"`
-// }
+// Session сессия пользователя, продлеваемая refresh токеном
+type Session struct {
+	ID        string
+	UserID    uint64
+	Login     string
+	ExpiresAt time.Time
+}
+
+// IdempotencyRecord сохраненный результат запроса с заголовком Idempotency-Key
+type IdempotencyRecord struct {
+	RequestHash string
+	StatusCode  int // 0 - запрос с этим ключом еще выполняется
+	Body        []byte
+}
 
 type Balance struct {
-	Current   uint64 `json:"current"`
-	Withdrawn uint64 `json:"withdrawn"`
+	Current   money.Amount `json:"current"`
+	Withdrawn money.Amount `json:"withdrawn"`
 }
 
 func MakeNewOrder(user User, orderID string) *Order {
+	now := time.Now()
 
 	return &Order{
-		OrderID: orderID,
-		User:    user.Login,
-		Type:    OrderType,
-		Status:  OrderStatusNew,
-		Date:    time.Now().Format(time.RFC3339),
-		Value:   0,
+		OrderID:    orderID,
+		User:       user.Login,
+		Type:       OrderType,
+		Status:     OrderStatusNew,
+		Value:      0,
+		UploadedAt: now,
+		UpdatedAt:  now,
 	}
 }
 
-func MakeWithdraw(user User, orderID string, sum uint64) *Order {
+func MakeWithdraw(user User, orderID string, sum money.Amount) *Order {
+	now := time.Now()
 
+	// Списание выполняется сразу, поэтому создается уже обработанным
 	return &Order{
-		OrderID: orderID,
-		User:    user.Login,
-		Type:    WithdrawType,
-		Status:  OrderStatusProcessed,
-		Date:    time.Now().Format(time.RFC3339),
-		Value:   sum,
+		OrderID:     orderID,
+		User:        user.Login,
+		Type:        WithdrawType,
+		Status:      OrderStatusProcessed,
+		Value:       sum,
+		UploadedAt:  now,
+		UpdatedAt:   now,
+		ProcessedAt: &now,
 	}
 }
 
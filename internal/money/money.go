@@ -1,39 +1,182 @@
 package money
 
 import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"math"
+	"regexp"
+	"strconv"
+	"strings"
 )
 
-var ErrOverflow = errors.New("переполнение при конвертации денежных значений")
+var (
+	ErrOverflow      = errors.New("переполнение при конвертации денежных значений")
+	ErrInvalidAmount = errors.New("некорректная денежная сумма")
+)
+
+// MaxAmount максимальная сумма в копейках, помещается в BIGINT колонки базы
+const MaxAmount Amount = math.MaxInt64
+
+// maxAmountDigits количество цифр в MaxAmount
+const maxAmountDigits = 19
 
-// KopecksToRubles конвертирует копейки в рубли
-func KopecksToRubles(kopecks uint64) float64 {
-	return float64(kopecks) / 100.0
+// amountPattern десятичное число в формате JSON: знак, целая часть, дробная часть, экспонента
+var amountPattern = regexp.MustCompile(`^(-?)(0|[1-9][0-9]*)(?:\.([0-9]+))?(?:[eE]([+-]?[0-9]+))?$`)
+
+// Amount денежная сумма в копейках. В JSON представляется числом в рублях
+// и разбирается без преобразования во float64, поэтому не теряет точность
+type Amount uint64
+
+// ParseAmount разбирает сумму в рублях, записанную десятичным числом (например "729.98").
+// Отрицательные суммы и суммы точнее копейки не принимаются
+func ParseAmount(s string) (Amount, error) {
+	return parseAmount(s, false)
 }
 
-// RublesToKopecks конвертирует рубли в копейки с корректным округлением
-func RublesToKopecks(rubles float64) uint64 {
-	// Используем math.Round для корректного округления до ближайшего целого
-	return uint64(math.Round(rubles * 100))
+// ParseAmountFloor разбирает сумму как ParseAmount, но доли копейки отбрасывает
+// (например "6.1725" - 6.17). Подходит для сумм, рассчитанных другими системами,
+// пользовательский ввод разбирается строго через ParseAmount
+func ParseAmountFloor(s string) (Amount, error) {
+	return parseAmount(s, true)
 }
 
-// AccrualToKopecks конвертирует значение от accrual системы (в рублях) в копейки
-// с проверкой на переполнение
-func AccrualToKopecks(accrualRubles float64) (uint64, error) {
-	// Проверяем на переполнение: max uint64 / 100
-	const maxSafeValue = 18446744073709551 // math.MaxUint64 / 100
+// parseAmount разбирает сумму в рублях. Если floor, доли копейки отбрасываются, иначе это ошибка
+func parseAmount(s string, floor bool) (Amount, error) {
+	m := amountPattern.FindStringSubmatch(s)
+	if m == nil {
+		return 0, fmt.Errorf("%w: %q не является числом", ErrInvalidAmount, s)
+	}
+	negative, intPart, fracPart, expPart := m[1] != "", m[2], m[3], m[4]
 
-	if accrualRubles > maxSafeValue {
-		return 0, ErrOverflow
+	// Сумма в копейках равна digits * 10^shift
+	digits := strings.TrimLeft(intPart+fracPart, "0")
+	if digits == "" {
+		return 0, nil
 	}
+	if negative {
+		return 0, fmt.Errorf("%w: отрицательная сумма %s", ErrInvalidAmount, s)
+	}
+
+	exp := 0
+	if expPart != "" {
+		var err error
+		exp, err = strconv.Atoi(expPart)
+		if err != nil || exp > 2*maxAmountDigits || exp < -2*maxAmountDigits {
+			return 0, fmt.Errorf("%w: %s", ErrOverflow, s)
+		}
+	}
+	shift := exp - len(fracPart) + 2
 
-	return uint64(accrualRubles * 100), nil
+	// Нули в конце дробной части не меняют сумму
+	for shift < 0 && strings.HasSuffix(digits, "0") {
+		digits = digits[:len(digits)-1]
+		shift++
+	}
+	if shift < 0 && floor {
+		digits = digits[:max(len(digits)+shift, 0)]
+		shift = 0
+	}
+	if shift < 0 {
+		return 0, fmt.Errorf("%w: сумма %s точнее копейки", ErrInvalidAmount, s)
+	}
+	if digits == "" {
+		return 0, nil
+	}
+	if len(digits)+shift > maxAmountDigits {
+		return 0, fmt.Errorf("%w: %s", ErrOverflow, s)
+	}
+
+	kopecks, err := strconv.ParseUint(digits+strings.Repeat("0", shift), 10, 64)
+	if err != nil || Amount(kopecks) > MaxAmount {
+		return 0, fmt.Errorf("%w: %s", ErrOverflow, s)
+	}
+	return Amount(kopecks), nil
 }
 
-// FormatRubles форматирует копейки в строку с рублями
-func FormatRubles(kopecks uint64) string {
-	rubles := float64(kopecks) / 100.0
-	return fmt.Sprintf("%.2f", rubles)
+// FromKopecks создает сумму из количества копеек
+func FromKopecks(kopecks uint64) Amount {
+	return Amount(kopecks)
+}
+
+// Kopecks возвращает сумму в копейках
+func (a Amount) Kopecks() uint64 {
+	return uint64(a)
+}
+
+// String форматирует сумму в рублях с двумя знаками после точки
+func (a Amount) String() string {
+	return fmt.Sprintf("%d.%02d", a/100, a%100)
+}
+
+// MarshalJSON записывает сумму числом в рублях без лишних нулей в дробной части
+func (a Amount) MarshalJSON() ([]byte, error) {
+	s := a.String()
+	s = strings.TrimSuffix(strings.TrimRight(s, "0"), ".")
+	return []byte(s), nil
+}
+
+// UnmarshalJSON разбирает сумму из числа JSON. Строки и null не принимаются
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	number, err := jsonNumber(data)
+	if err != nil {
+		return err
+	}
+
+	amount, err := ParseAmount(number)
+	if err != nil {
+		return err
+	}
+	*a = amount
+	return nil
+}
+
+// UnmarshalAmountFloor разбирает сумму из числа JSON как UnmarshalJSON,
+// но доли копейки отбрасывает, как ParseAmountFloor
+func UnmarshalAmountFloor(data []byte) (Amount, error) {
+	number, err := jsonNumber(data)
+	if err != nil {
+		return 0, err
+	}
+	return ParseAmountFloor(number)
+}
+
+// jsonNumber возвращает запись числа JSON. Строки и null не принимаются
+func jsonNumber(data []byte) (string, error) {
+	if len(data) == 0 || data[0] == '"' || bytes.Equal(data, []byte("null")) {
+		return "", fmt.Errorf("%w: ожидалось число, получено %s", ErrInvalidAmount, data)
+	}
+
+	var number json.Number
+	if err := json.Unmarshal(data, &number); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidAmount, err)
+	}
+	return number.String(), nil
+}
+
+// Value сохраняет сумму в базу в копейках
+func (a Amount) Value() (driver.Value, error) {
+	if a > MaxAmount {
+		return nil, ErrOverflow
+	}
+	return int64(a), nil
+}
+
+// Scan читает сумму в копейках из базы
+func (a *Amount) Scan(src any) error {
+	switch v := src.(type) {
+	case int64:
+		if v < 0 {
+			return fmt.Errorf("%w: отрицательная сумма %d", ErrInvalidAmount, v)
+		}
+		*a = Amount(v)
+		return nil
+	case nil:
+		*a = 0
+		return nil
+	default:
+		return fmt.Errorf("%w: неподдерживаемый тип %T", ErrInvalidAmount, src)
+	}
 }
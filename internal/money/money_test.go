@@ -1,134 +1,188 @@
 package money
 
 import (
+	"encoding/json"
+	"errors"
 	"testing"
 )
 
-func TestKopecksToRubles(t *testing.T) {
+func TestParseAmount(t *testing.T) {
 	tests := []struct {
-		name     string
-		kopecks  uint64
-		expected float64
+		name        string
+		input       string
+		expected    Amount
+		expectedErr error
 	}{
-		{"0 копеек", 0, 0.0},
-		{"1 копейка", 1, 0.01},
-		{"100 копеек", 100, 1.0},
-		{"101 копейка", 101, 1.01},
-		{"999 копеек", 999, 9.99},
-		{"1000 копеек", 1000, 10.0},
-		{"1505 копеек", 1505, 15.05},
+		{"0 рублей", "0", 0, nil},
+		{"1 рубль", "1", 100, nil},
+		{"1.01 рубль", "1.01", 101, nil},
+		{"0.01 рубль", "0.01", 1, nil},
+		{"9.99 рублей", "9.99", 999, nil},
+		{"15.05 рублей", "15.05", 1505, nil},
+		{"50.5 рублей", "50.5", 5050, nil},
+		{"729.98 рублей без потери копейки", "729.98", 72998, nil},
+		{"Нули в конце дробной части", "10.000", 1000, nil},
+		{"Экспонента", "1.5e2", 15000, nil},
+		{"Отрицательная экспонента", "1234e-2", 1234, nil},
+		{"Отрицательный ноль", "-0.00", 0, nil},
+		{"Максимальная сумма", "92233720368547758.07", MaxAmount, nil},
+		{"Точнее копейки", "1.001", 0, ErrInvalidAmount},
+		{"Точнее копейки с экспонентой", "1e-3", 0, ErrInvalidAmount},
+		{"Отрицательная сумма", "-1.5", 0, ErrInvalidAmount},
+		{"Не число", "abc", 0, ErrInvalidAmount},
+		{"Лишние нули в начале", "01.5", 0, ErrInvalidAmount},
+		{"Шестнадцатеричное число", "0x10", 0, ErrInvalidAmount},
+		{"Переполнение", "92233720368547758.08", 0, ErrOverflow},
+		{"Переполнение uint64", "184467440737095517", 0, ErrOverflow},
+		{"Огромная экспонента", "1e1000000", 0, ErrOverflow},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := KopecksToRubles(tt.kopecks)
+			result, err := ParseAmount(tt.input)
+			if tt.expectedErr != nil {
+				if !errors.Is(err, tt.expectedErr) {
+					t.Errorf("ParseAmount(%q) вернул ошибку %v, ожидалось %v", tt.input, err, tt.expectedErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("ParseAmount(%q) вернул неожиданную ошибку: %v", tt.input, err)
+				return
+			}
 			if result != tt.expected {
-				t.Errorf("KopecksToRubles(%d) = %.2f; ожидалось %.2f",
-					tt.kopecks, result, tt.expected)
+				t.Errorf("ParseAmount(%q) = %d; ожидалось %d", tt.input, result, tt.expected)
 			}
 		})
 	}
 }
 
-func TestRublesToKopecks(t *testing.T) {
+func TestParseAmountFloor(t *testing.T) {
 	tests := []struct {
-		name     string
-		rubles   float64
-		expected uint64
+		name        string
+		input       string
+		expected    Amount
+		expectedErr error
 	}{
-		{"0 рублей", 0.0, 0},
-		{"1 рубль", 1.0, 100},
-		{"1.01 рубль", 1.01, 101},
-		{"0.01 рубль", 0.01, 1},
-		{"9.99 рублей", 9.99, 999},
-		{"10.0 рублей", 10.0, 1000},
-		{"15.05 рублей", 15.05, 1505},
-		{"50.50 рублей", 50.50, 5050},
-		{"100.99 рублей", 100.99, 10099},
+		{"Ровно копейки", "729.98", 72998, nil},
+		{"Доли копейки отбрасываются", "6.1725", 617, nil},
+		{"Погрешность float64", "729.9800000000001", 72998, nil},
+		{"Погрешность float64 вниз", "729.9799999999999", 72997, nil},
+		{"Меньше копейки", "0.004", 0, nil},
+		{"Меньше копейки с экспонентой", "1e-5", 0, nil},
+		{"Экспонента с долями копейки", "61725e-4", 617, nil},
+		{"Отрицательная сумма", "-6.1725", 0, ErrInvalidAmount},
+		{"Не число", "abc", 0, ErrInvalidAmount},
+		{"Переполнение", "92233720368547758.089", 0, ErrOverflow},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := RublesToKopecks(tt.rubles)
+			result, err := ParseAmountFloor(tt.input)
+			if tt.expectedErr != nil {
+				if !errors.Is(err, tt.expectedErr) {
+					t.Errorf("ParseAmountFloor(%q) вернул ошибку %v, ожидалось %v", tt.input, err, tt.expectedErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("ParseAmountFloor(%q) вернул неожиданную ошибку: %v", tt.input, err)
+				return
+			}
 			if result != tt.expected {
-				t.Errorf("RublesToKopecks(%.3f) = %d; ожидалось %d",
-					tt.rubles, result, tt.expected)
+				t.Errorf("ParseAmountFloor(%q) = %d; ожидалось %d", tt.input, result, tt.expected)
 			}
 		})
 	}
 }
 
-func TestAccrualToKopecks(t *testing.T) {
+func TestAmountJSON(t *testing.T) {
 	tests := []struct {
-		name         string
-		accrualValue float64
-		expected     uint64
-		shouldError  bool
+		name     string
+		kopecks  uint64
+		expected string
 	}{
-		{"0 рублей", 0, 0, false},
-		{"1 рубль", 1, 100, false},
-		{"10 рублей", 10, 1000, false},
-		{"100 рублей", 100, 10000, false},
-		{"1000 рублей", 1000, 100000, false},
-		{"10000 рублей", 10000, 1000000, false},
-		{"100000 рублей", 100000, 10000000, false},
-		{"1000000 рублей", 1000000, 100000000, false},
-		{"123.45 рублей", 123.45, 12345, false},
-		{"Максимальное безопасное значение", 18446744073709551, 1844674407370955100, false},
-		{"Значение, вызывающее переполнение", 18446744073709552, 0, true},
+		{"0 копеек", 0, "0"},
+		{"1 копейка", 1, "0.01"},
+		{"100 копеек", 100, "1"},
+		{"150 копеек", 150, "1.5"},
+		{"999 копеек", 999, "9.99"},
+		{"72998 копеек", 72998, "729.98"},
+		{"Максимальная сумма", uint64(MaxAmount), "92233720368547758.07"},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result, err := AccrualToKopecks(tt.accrualValue)
-
-			if tt.shouldError {
-				if err == nil {
-					t.Errorf("AccrualToKopecks(%f) ожидал ошибку, но ошибки не было", tt.accrualValue)
-				}
-				if err != ErrOverflow {
-					t.Errorf("AccrualToKopecks(%f) вернул ошибку %v, ожидалось %v",
-						tt.accrualValue, err, ErrOverflow)
-				}
-				return
-			}
-
+			data, err := json.Marshal(FromKopecks(tt.kopecks))
 			if err != nil {
-				t.Errorf("AccrualToKopecks(%f) вернул неожиданную ошибку: %v",
-					tt.accrualValue, err)
-				return
+				t.Fatalf("json.Marshal(%d) вернул ошибку: %v", tt.kopecks, err)
+			}
+			if string(data) != tt.expected {
+				t.Errorf("json.Marshal(%d) = %s; ожидалось %s", tt.kopecks, data, tt.expected)
 			}
 
-			if result != tt.expected {
-				t.Errorf("AccrualToKopecks(%f) = %d; ожидалось %d",
-					tt.accrualValue, result, tt.expected)
+			// Сумма читается обратно без изменений
+			var decoded Amount
+			if err = json.Unmarshal(data, &decoded); err != nil {
+				t.Fatalf("json.Unmarshal(%s) вернул ошибку: %v", data, err)
+			}
+			if decoded.Kopecks() != tt.kopecks {
+				t.Errorf("json.Unmarshal(%s) = %d; ожидалось %d", data, decoded, tt.kopecks)
 			}
 		})
 	}
 }
 
-func TestFormatRubles(t *testing.T) {
+func TestAmountUnmarshalJSON_Invalid(t *testing.T) {
+	for _, input := range []string{`"729.98"`, `null`, `-1`, `1.001`, `true`} {
+		var request struct {
+			Sum Amount `json:"sum"`
+		}
+		err := json.Unmarshal([]byte(`{"sum":`+input+`}`), &request)
+		if !errors.Is(err, ErrInvalidAmount) {
+			t.Errorf("json.Unmarshal(%s) вернул ошибку %v, ожидалось %v", input, err, ErrInvalidAmount)
+		}
+	}
+}
+
+func TestUnmarshalAmountFloor(t *testing.T) {
+	if a, err := UnmarshalAmountFloor([]byte(`6.1725`)); err != nil || a != 617 {
+		t.Errorf("UnmarshalAmountFloor(6.1725) = %d, %v", a, err)
+	}
+	for _, input := range []string{`"6.17"`, `null`, `true`} {
+		if _, err := UnmarshalAmountFloor([]byte(input)); !errors.Is(err, ErrInvalidAmount) {
+			t.Errorf("UnmarshalAmountFloor(%s) вернул ошибку %v, ожидалось %v", input, err, ErrInvalidAmount)
+		}
+	}
+}
+
+func TestAmountString(t *testing.T) {
 	tests := []struct {
-		name     string
 		kopecks  uint64
 		expected string
 	}{
-		{"0 копеек", 0, "0.00"},
-		{"1 копейка", 1, "0.01"},
-		{"100 копеек", 100, "1.00"},
-		{"101 копейка", 101, "1.01"},
-		{"999 копеек", 999, "9.99"},
-		{"1000 копеек", 1000, "10.00"},
-		{"1505 копеек", 1505, "15.05"},
+		{0, "0.00"},
+		{1, "0.01"},
+		{100, "1.00"},
+		{1505, "15.05"},
 	}
 
 	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			result := FormatRubles(tt.kopecks)
-			if result != tt.expected {
-				t.Errorf("FormatRubles(%d) = %s; ожидалось %s",
-					tt.kopecks, result, tt.expected)
-			}
-		})
+		if result := FromKopecks(tt.kopecks).String(); result != tt.expected {
+			t.Errorf("FromKopecks(%d).String() = %s; ожидалось %s", tt.kopecks, result, tt.expected)
+		}
+	}
+}
+
+func TestAmountScan(t *testing.T) {
+	var a Amount
+	if err := a.Scan(int64(72998)); err != nil || a != 72998 {
+		t.Errorf("Scan(72998) = %d, %v", a, err)
+	}
+	if err := a.Scan(nil); err != nil || a != 0 {
+		t.Errorf("Scan(nil) = %d, %v", a, err)
+	}
+	if err := a.Scan(int64(-1)); !errors.Is(err, ErrInvalidAmount) {
+		t.Errorf("Scan(-1) вернул ошибку %v, ожидалось %v", err, ErrInvalidAmount)
 	}
 }
@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/paxren/go-musthave-diploma-tpl/internal/models"
+)
+
+// memIdempotencyKey ключ идемпотентности пользователя
+type memIdempotencyKey struct {
+	userID uint64
+	key    string
+}
+
+// memIdempotencyRecord сохраненный запрос с ключом и время резервирования ключа
+type memIdempotencyRecord struct {
+	record    models.IdempotencyRecord
+	createdAt time.Time
+}
+
+// IdempotencyMemStorage хранилище ключей идемпотентности в памяти.
+// Повторяет поведение IdempotencyPostgresStorage, включая срок хранения ключа
+type IdempotencyMemStorage struct {
+	mutex   sync.Mutex
+	records map[memIdempotencyKey]*memIdempotencyRecord
+	now     func() time.Time
+}
+
+func MakeIdempotencyMemStorage() *IdempotencyMemStorage {
+	return &IdempotencyMemStorage{
+		records: make(map[memIdempotencyKey]*memIdempotencyRecord),
+		now:     time.Now,
+	}
+}
+
+// ReserveIdempotencyKey резервирует ключ за пользователем. Если ключ уже использовался,
+// ничего не резервирует и возвращает сохраненную запись. Брошенный резерв без ответа
+// старше idempotencyInProgressTTL перехватывается
+func (st *IdempotencyMemStorage) ReserveIdempotencyKey(ctx context.Context, userID uint64, key, requestHash string) (*models.IdempotencyRecord, error) {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+
+	now := st.now()
+	id := memIdempotencyKey{userID: userID, key: key}
+	if stored, ok := st.records[id]; ok {
+		ttl := idempotencyKeyTTL
+		if stored.record.StatusCode == 0 {
+			ttl = idempotencyInProgressTTL
+		}
+		if stored.createdAt.After(now.Add(-ttl)) {
+			record := stored.record
+			return &record, nil
+		}
+	}
+
+	st.records[id] = &memIdempotencyRecord{
+		record:    models.IdempotencyRecord{RequestHash: requestHash},
+		createdAt: now,
+	}
+	return nil, nil
+}
+
+// CompleteIdempotencyKey сохраняет ответ на запрос с зарезервированным ключом
+func (st *IdempotencyMemStorage) CompleteIdempotencyKey(ctx context.Context, userID uint64, key string, statusCode int, body []byte) error {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+
+	if stored, ok := st.records[memIdempotencyKey{userID: userID, key: key}]; ok {
+		stored.record.StatusCode = statusCode
+		stored.record.Body = append([]byte(nil), body...)
+	}
+	return nil
+}
+
+// ReleaseIdempotencyKey снимает резерв ключа, если запрос завершился ошибкой и может быть повторен
+func (st *IdempotencyMemStorage) ReleaseIdempotencyKey(ctx context.Context, userID uint64, key string) error {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+
+	id := memIdempotencyKey{userID: userID, key: key}
+	if stored, ok := st.records[id]; ok && stored.record.StatusCode == 0 {
+		delete(st.records, id)
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/paxren/go-musthave-diploma-tpl/internal/models"
+)
+
+// idempotencyKeyTTL время, в течение которого повтор запроса с тем же ключом возвращает сохраненный ответ
+const idempotencyKeyTTL = 24 * time.Hour
+
+// idempotencyInProgressTTL время, после которого резерв ключа без сохраненного ответа считается брошенным:
+// сервис упал или не смог сохранить ответ. Такой резерв перехватывает следующий запрос с тем же ключом.
+// Повторное выполнение безопасно, так как номер списания уникален и второй раз не списывается
+const idempotencyInProgressTTL = time.Minute
+
+type IdempotencyPostgresStorage struct {
+	db *PostgresConnection
+}
+
+func MakeIdempotencyPostgresStorage(pc *PostgresConnection) *IdempotencyPostgresStorage {
+	return &IdempotencyPostgresStorage{
+		db: pc,
+	}
+}
+
+// ReserveIdempotencyKey резервирует ключ за пользователем. Если ключ уже использовался,
+// ничего не резервирует и возвращает сохраненную запись. Брошенный резерв без ответа
+// старше idempotencyInProgressTTL перехватывается
+func (st *IdempotencyPostgresStorage) ReserveIdempotencyKey(ctx context.Context, userID uint64, key, requestHash string) (*models.IdempotencyRecord, error) {
+	// Удаляем просроченную запись или брошенный резерв, чтобы ключ можно было использовать заново
+	expireQuery := `
+		DELETE FROM gophermart_idempotency_keys
+		WHERE user_id = $1 AND key = $2
+		  AND (created_at < CURRENT_TIMESTAMP - $3::double precision * INTERVAL '1 second'
+		       OR (status_code IS NULL AND created_at < CURRENT_TIMESTAMP - $4::double precision * INTERVAL '1 second'))
+	`
+	_, err := st.db.db.ExecContext(ctx, expireQuery, userID, key, idempotencyKeyTTL.Seconds(), idempotencyInProgressTTL.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при удалении просроченного ключа идемпотентности: %w", err)
+	}
+
+	reserveQuery := `
+		INSERT INTO gophermart_idempotency_keys (user_id, key, request_hash)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, key) DO NOTHING
+	`
+	result, err := st.db.db.ExecContext(ctx, reserveQuery, userID, key, requestHash)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при резервировании ключа идемпотентности: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении количества добавленных строк: %w", err)
+	}
+
+	if rowsAffected == 1 {
+		return nil, nil
+	}
+
+	// Ключ уже использовался, возвращаем сохраненную запись
+	var record models.IdempotencyRecord
+	var statusCode sql.NullInt64
+	selectQuery := `
+		SELECT request_hash, status_code, response_body
+		FROM gophermart_idempotency_keys
+		WHERE user_id = $1 AND key = $2
+	`
+	err = st.db.db.QueryRowContext(ctx, selectQuery, userID, key).Scan(&record.RequestHash, &statusCode, &record.Body)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			// Запись успели освободить между INSERT и SELECT, считаем запрос еще выполняющимся
+			return &models.IdempotencyRecord{RequestHash: requestHash}, nil
+		}
+		return nil, fmt.Errorf("ошибка при получении ключа идемпотентности: %w", err)
+	}
+	record.StatusCode = int(statusCode.Int64)
+
+	return &record, nil
+}
+
+// CompleteIdempotencyKey сохраняет ответ на запрос с зарезервированным ключом
+func (st *IdempotencyPostgresStorage) CompleteIdempotencyKey(ctx context.Context, userID uint64, key string, statusCode int, body []byte) error {
+	query := `
+		UPDATE gophermart_idempotency_keys
+		SET status_code = $3, response_body = $4
+		WHERE user_id = $1 AND key = $2
+	`
+	if _, err := st.db.db.ExecContext(ctx, query, userID, key, statusCode, body); err != nil {
+		return fmt.Errorf("ошибка при сохранении ответа для ключа идемпотентности: %w", err)
+	}
+	return nil
+}
+
+// ReleaseIdempotencyKey снимает резерв ключа, если запрос завершился ошибкой и может быть повторен
+func (st *IdempotencyPostgresStorage) ReleaseIdempotencyKey(ctx context.Context, userID uint64, key string) error {
+	query := "DELETE FROM gophermart_idempotency_keys WHERE user_id = $1 AND key = $2 AND status_code IS NULL"
+	if _, err := st.db.db.ExecContext(ctx, query, userID, key); err != nil {
+		return fmt.Errorf("ошибка при освобождении ключа идемпотентности: %w", err)
+	}
+	return nil
+}
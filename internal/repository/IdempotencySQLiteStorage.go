@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/paxren/go-musthave-diploma-tpl/internal/models"
+)
+
+type IdempotencySQLiteStorage struct {
+	db *SQLiteConnection
+}
+
+func MakeIdempotencySQLiteStorage(sc *SQLiteConnection) *IdempotencySQLiteStorage {
+	return &IdempotencySQLiteStorage{
+		db: sc,
+	}
+}
+
+// ReserveIdempotencyKey резервирует ключ за пользователем. Если ключ уже использовался,
+// ничего не резервирует и возвращает сохраненную запись. Брошенный резерв без ответа
+// старше idempotencyInProgressTTL перехватывается
+func (st *IdempotencySQLiteStorage) ReserveIdempotencyKey(ctx context.Context, userID uint64, key, requestHash string) (*models.IdempotencyRecord, error) {
+	now := st.db.now()
+
+	var record *models.IdempotencyRecord
+	err := st.db.withTx(ctx, func(tx *sql.Tx) error {
+		// Удаляем просроченную запись или брошенный резерв, чтобы ключ можно было использовать заново
+		expireQuery := `
+			DELETE FROM gophermart_idempotency_keys
+			WHERE user_id = ? AND key = ? AND (created_at < ? OR (status_code IS NULL AND created_at < ?))
+		`
+		_, err := tx.ExecContext(ctx, expireQuery, userID, key,
+			toSQLiteTime(now.Add(-idempotencyKeyTTL)), toSQLiteTime(now.Add(-idempotencyInProgressTTL)))
+		if err != nil {
+			return fmt.Errorf("ошибка при удалении просроченного ключа идемпотентности: %w", err)
+		}
+
+		reserveQuery := `
+			INSERT INTO gophermart_idempotency_keys (user_id, key, request_hash, created_at)
+			VALUES (?, ?, ?, ?)
+			ON CONFLICT (user_id, key) DO NOTHING
+		`
+		result, err := tx.ExecContext(ctx, reserveQuery, userID, key, requestHash, toSQLiteTime(now))
+		if err != nil {
+			return fmt.Errorf("ошибка при резервировании ключа идемпотентности: %w", err)
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("ошибка при получении количества добавленных строк: %w", err)
+		}
+		if rowsAffected == 1 {
+			return nil
+		}
+
+		// Ключ уже использовался, возвращаем сохраненную запись
+		record = &models.IdempotencyRecord{}
+		var statusCode sql.NullInt64
+		selectQuery := "SELECT request_hash, status_code, response_body FROM gophermart_idempotency_keys WHERE user_id = ? AND key = ?"
+		err = tx.QueryRowContext(ctx, selectQuery, userID, key).Scan(&record.RequestHash, &statusCode, &record.Body)
+		if err != nil {
+			return fmt.Errorf("ошибка при получении ключа идемпотентности: %w", err)
+		}
+		record.StatusCode = int(statusCode.Int64)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return record, nil
+}
+
+// CompleteIdempotencyKey сохраняет ответ на запрос с зарезервированным ключом
+func (st *IdempotencySQLiteStorage) CompleteIdempotencyKey(ctx context.Context, userID uint64, key string, statusCode int, body []byte) error {
+	query := "UPDATE gophermart_idempotency_keys SET status_code = ?, response_body = ? WHERE user_id = ? AND key = ?"
+	if _, err := st.db.db.ExecContext(ctx, query, statusCode, body, userID, key); err != nil {
+		return fmt.Errorf("ошибка при сохранении ответа для ключа идемпотентности: %w", err)
+	}
+	return nil
+}
+
+// ReleaseIdempotencyKey снимает резерв ключа, если запрос завершился ошибкой и может быть повторен
+func (st *IdempotencySQLiteStorage) ReleaseIdempotencyKey(ctx context.Context, userID uint64, key string) error {
+	query := "DELETE FROM gophermart_idempotency_keys WHERE user_id = ? AND key = ? AND status_code IS NULL"
+	if _, err := st.db.db.ExecContext(ctx, query, userID, key); err != nil {
+		return fmt.Errorf("ошибка при освобождении ключа идемпотентности: %w", err)
+	}
+	return nil
+}
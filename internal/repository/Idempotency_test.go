@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// checkAbandonedReservation проверяет, что брошенный резерв ключа без ответа перехватывается
+// после idempotencyInProgressTTL, а сохраненный ответ хранится до idempotencyKeyTTL
+func checkAbandonedReservation(t *testing.T, backend storageBackend, advance func(time.Duration)) {
+	ctx := context.Background()
+	user := registerUser(t, backend)
+
+	record, err := backend.idempotency.ReserveIdempotencyKey(ctx, *user.UserID, "abandoned", "hash")
+	require.NoError(t, err)
+	assert.Nil(t, record)
+
+	// До истечения срока резерв считается выполняющимся запросом
+	advance(idempotencyInProgressTTL - time.Second)
+	record, err = backend.idempotency.ReserveIdempotencyKey(ctx, *user.UserID, "abandoned", "hash")
+	require.NoError(t, err)
+	require.NotNil(t, record)
+	assert.Zero(t, record.StatusCode)
+
+	// Ответ так и не сохранен, повтор перехватывает резерв
+	advance(2 * time.Second)
+	record, err = backend.idempotency.ReserveIdempotencyKey(ctx, *user.UserID, "abandoned", "hash")
+	require.NoError(t, err)
+	assert.Nil(t, record)
+
+	// Ключ с сохраненным ответом не перехватывается
+	require.NoError(t, backend.idempotency.CompleteIdempotencyKey(ctx, *user.UserID, "abandoned", 200, nil))
+	advance(2 * idempotencyInProgressTTL)
+	record, err = backend.idempotency.ReserveIdempotencyKey(ctx, *user.UserID, "abandoned", "hash")
+	require.NoError(t, err)
+	require.NotNil(t, record)
+	assert.Equal(t, 200, record.StatusCode)
+
+	advance(idempotencyKeyTTL)
+	record, err = backend.idempotency.ReserveIdempotencyKey(ctx, *user.UserID, "abandoned", "hash")
+	require.NoError(t, err)
+	assert.Nil(t, record)
+}
+
+func TestIdempotencyMemStorage_AbandonedReservation(t *testing.T) {
+	idempotency := MakeIdempotencyMemStorage()
+	current := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	idempotency.now = func() time.Time { return current }
+
+	checkAbandonedReservation(t, storageBackend{
+		users:       MakeUserMemStorage(),
+		idempotency: idempotency,
+		forgetUser:  func(*testing.T, string) {},
+	}, func(d time.Duration) { current = current.Add(d) })
+}
+
+func TestIdempotencySQLiteStorage_AbandonedReservation(t *testing.T) {
+	sc, err := MakeSQLiteStorage(filepath.Join(t.TempDir(), "gophermart.db"))
+	require.NoError(t, err)
+	defer sc.Close()
+
+	current := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	sc.now = func() time.Time { return current }
+
+	checkAbandonedReservation(t, storageBackend{
+		users:       MakeUserSQLiteStorage(sc),
+		idempotency: MakeIdempotencySQLiteStorage(sc),
+		forgetUser:  func(*testing.T, string) {},
+	}, func(d time.Duration) { current = current.Add(d) })
+}
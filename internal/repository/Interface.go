@@ -1,36 +1,85 @@
 package repository
 
 import (
+	"context"
 	"errors"
+	"time"
 
 	"github.com/paxren/go-musthave-diploma-tpl/internal/models"
+	"github.com/paxren/go-musthave-diploma-tpl/internal/money"
 )
 
 var (
 	ErrUserExist = errors.New("пользаватель уже существует")
 	ErrBadLogin  = errors.New("не авторизован. неверный логин и/или пароль")
 
+	ErrWrongPassword = errors.New("неверный текущий пароль")
+
 	ErrOrderExistThisUser    = errors.New("заказ уже существует у этого пользователя")
 	ErrOrderExistAnotherUser = errors.New("заказ уже существует у другого пользователя")
 
-	ErrOrderType = errors.New("неизвестный тип заказа")
+	ErrOrderType     = errors.New("неизвестный тип заказа")
+	ErrOrderNotFound = errors.New("заказ не найден")
 
 	ErrIncafitionFunds = errors.New("недостаточно средств для списания")
 
 	ErrBadOrderID = errors.New("плохой номер заказа (не луноподходящий)")
+
+	ErrSessionNotFound = errors.New("сессия не найдена, истекла или отозвана")
+
+	// ErrLeaseLost аренда заказа истекла или заказ уже захвачен другим обработчиком
+	ErrLeaseLost = errors.New("аренда заказа для опроса истекла или перехвачена")
 )
 
 type UsersBase interface {
-	GetUser(name string) *models.User
-	RegisterUser(user models.User) error
-	LoginUser(user models.User) error
+	GetUser(ctx context.Context, name string) *models.User
+	RegisterUser(ctx context.Context, user models.User) error
+	// LoginUser проверяет логин и пароль. clientIP используется для защиты от перебора паролей
+	LoginUser(ctx context.Context, user models.User, clientIP string) error
+	// ChangePassword меняет пароль пользователя, если старый пароль указан верно, и отзывает все его сессии.
+	// Неверный старый пароль учитывается в защите от перебора так же, как неудачный вход
+	ChangePassword(ctx context.Context, userID uint64, oldPassword, newPassword, clientIP string) error
 }
 
 type OrderBase interface {
-	AddOrder(user models.User, order models.Order) error
-	GetOrders(user models.User, orderType string) ([]models.Order, error)
-	GetBalance(user models.User) (*models.Balance, error)
-	GetOrdersWithStatuses(statuses []string) ([]models.Order, error)
-	UpdateOrderStatusAndValue(orderID, status string, value uint64) error
-	GetWithdrawals(user models.User) ([]models.Order, error)
+	AddOrder(ctx context.Context, userID uint64, order models.Order) error
+	// GetOrders возвращает страницу заказов пользователя, отобранных по query
+	GetOrders(ctx context.Context, userID uint64, query models.OrderQuery) (*models.OrderPage, error)
+	GetBalance(ctx context.Context, userID uint64) (*models.Balance, error)
+	// GetOrder возвращает заказ на начисление по номеру, ErrOrderNotFound - заказа нет
+	GetOrder(ctx context.Context, orderID string) (*models.Order, error)
+	GetOrdersWithStatuses(ctx context.Context, statuses []string) ([]models.Order, error)
+	ClaimOrdersWithStatuses(ctx context.Context, statuses []string, limit int, lease time.Duration) ([]models.Order, error)
+	UpdateOrderStatusAndValue(ctx context.Context, orderID, status string, value money.Amount) error
+	// PostponeOrderPoll откладывает опрос заказа, захваченного под арендой leaseToken. notRegistered - accrual
+	// система ответила, что заказ не зарегистрирован: такие ответы подряд считаются отдельно от остальных попыток.
+	// Если аренда истекла или перехвачена, ничего не меняет и возвращает ErrLeaseLost
+	PostponeOrderPoll(ctx context.Context, orderID string, leaseToken int64, delay time.Duration, notRegistered bool) error
+}
+
+type IdempotencyBase interface {
+	// ReserveIdempotencyKey резервирует ключ за пользователем. Если ключ уже использовался,
+	// ничего не резервирует и возвращает сохраненную запись. Резерв, ответ на который
+	// не сохранен за idempotencyInProgressTTL, считается брошенным и перехватывается
+	ReserveIdempotencyKey(ctx context.Context, userID uint64, key, requestHash string) (*models.IdempotencyRecord, error)
+	// CompleteIdempotencyKey сохраняет ответ на запрос с зарезервированным ключом
+	CompleteIdempotencyKey(ctx context.Context, userID uint64, key string, statusCode int, body []byte) error
+	// ReleaseIdempotencyKey снимает резерв ключа, если запрос завершился ошибкой и может быть повторен
+	ReleaseIdempotencyKey(ctx context.Context, userID uint64, key string) error
+}
+
+type SessionBase interface {
+	// CreateSession создает сессию пользователя с хешем refresh токена
+	CreateSession(ctx context.Context, session models.Session, refreshTokenHash string) error
+	// RotateSession находит действующую сессию по хешу refresh токена и заменяет его новым
+	RotateSession(ctx context.Context, refreshTokenHash, newRefreshTokenHash string, expiresAt time.Time) (*models.Session, error)
+	// RevokeSession отзывает сессию и все выданные в ней access токены
+	RevokeSession(ctx context.Context, sessionID string) error
+	// RevokeUserSessions отзывает все сессии пользователя
+	RevokeUserSessions(ctx context.Context, userID uint64) error
+	// RevokeToken отзывает отдельный access токен до истечения его срока действия
+	RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error
+	// GetSessionUser возвращает пользователя действующей сессии. Если сессия или access токен
+	// отозваны либо пользователь удален, возвращает ErrSessionNotFound
+	GetSessionUser(ctx context.Context, sessionID, jti string) (*models.User, error)
 }
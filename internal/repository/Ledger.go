@@ -0,0 +1,153 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+
+	"github.com/paxren/go-musthave-diploma-tpl/internal/money"
+)
+
+// Счета леджера. Каждая операция переводит баллы с одного счета на другой:
+// начисление - со счета ACCRUAL на счет пользователя, списание - со счета пользователя на WITHDRAWAL
+const (
+	ledgerAccountAccrual    = "ACCRUAL"
+	ledgerAccountUser       = "USER"
+	ledgerAccountWithdrawal = "WITHDRAWAL"
+)
+
+// postLedgerTransfer записывает в леджер перевод amount со счета from на счет to двумя проводками
+func postLedgerTransfer(ctx context.Context, tx *sql.Tx, userID uint64, orderID, from, to string, amount money.Amount) error {
+	query := `
+		INSERT INTO gophermart_ledger (user_id, order_id, account, amount)
+		VALUES ($1, $2, $3, $4), ($1, $2, $5, $6)
+	`
+	_, err := tx.ExecContext(ctx, query, userID, orderID, from, -int64(amount), to, int64(amount))
+	if err != nil {
+		return fmt.Errorf("ошибка при записи проводок в леджер: %w", err)
+	}
+	return nil
+}
+
+// creditBalance зачисляет amount на баланс пользователя, создавая строку баланса при необходимости
+func creditBalance(ctx context.Context, tx *sql.Tx, userID uint64, amount money.Amount) error {
+	query := `
+		INSERT INTO gophermart_balances (user_id, current, withdrawn, updated_at)
+		VALUES ($1, $2, 0, CURRENT_TIMESTAMP)
+		ON CONFLICT (user_id) DO UPDATE
+		SET current = gophermart_balances.current + EXCLUDED.current,
+		    updated_at = CURRENT_TIMESTAMP
+	`
+	if _, err := tx.ExecContext(ctx, query, userID, amount); err != nil {
+		return fmt.Errorf("ошибка при зачислении на баланс: %w", err)
+	}
+	return nil
+}
+
+// debitBalance списывает amount с баланса пользователя.
+// Проверка достаточности средств выполняется условием самого UPDATE
+func debitBalance(ctx context.Context, tx *sql.Tx, userID uint64, amount money.Amount) error {
+	query := `
+		UPDATE gophermart_balances
+		SET current = current - $2, withdrawn = withdrawn + $2, updated_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND current >= $2
+	`
+	result, err := tx.ExecContext(ctx, query, userID, amount)
+	if err != nil {
+		return fmt.Errorf("ошибка при списании с баланса: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("ошибка при получении количества обновленных строк: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrIncafitionFunds
+	}
+	return nil
+}
+
+// balanceCheckName имя ограничения current >= 0 таблицы балансов.
+// Совпадает с именем, которое PostgreSQL дает ограничению, объявленному в колонке,
+// поэтому базы, где миграция 000006 создала его сразу, ничего не меняют
+const balanceCheckName = "gophermart_balances_current_check"
+
+// overdrawnBalance пользователь, баланс которого после переноса истории отрицательный
+type overdrawnBalance struct {
+	userID  uint64
+	login   string
+	current int64
+}
+
+// ensureBalanceCheck добавляет ограничение current >= 0 таблице балансов, если его еще нет
+// и отрицательных балансов не осталось. Иначе возвращает список пользователей с отрицательным
+// балансом, ограничение не добавляется до следующего запуска. Списания таким пользователям
+// запрещены и без ограничения, а начисления постепенно закрывают долг
+func ensureBalanceCheck(ctx context.Context, db *sql.DB) ([]overdrawnBalance, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при начале транзакции: %w", err)
+	}
+	// После Commit откат ничего не делает
+	defer tx.Rollback()
+
+	// Блокировка не дает параллельно изменить балансы между проверкой и добавлением ограничения
+	if _, err = tx.ExecContext(ctx, "LOCK TABLE gophermart_balances IN SHARE ROW EXCLUSIVE MODE"); err != nil {
+		return nil, fmt.Errorf("ошибка при блокировке таблицы балансов: %w", err)
+	}
+
+	var exists bool
+	existsQuery := `
+		SELECT EXISTS (
+			SELECT 1 FROM pg_constraint
+			WHERE conrelid = 'gophermart_balances'::regclass AND conname = $1
+		)
+	`
+	if err = tx.QueryRowContext(ctx, existsQuery, balanceCheckName).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("ошибка при проверке ограничения баланса: %w", err)
+	}
+	if exists {
+		return nil, nil
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT b.user_id, u.login, b.current
+		FROM gophermart_balances b
+		JOIN gophermart_users u ON u.id = b.user_id
+		WHERE b.current < 0
+		ORDER BY b.user_id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при поиске отрицательных балансов: %w", err)
+	}
+	defer rows.Close()
+
+	var overdrawn []overdrawnBalance
+	for rows.Next() {
+		var balance overdrawnBalance
+		if err = rows.Scan(&balance.userID, &balance.login, &balance.current); err != nil {
+			return nil, fmt.Errorf("ошибка при чтении отрицательного баланса: %w", err)
+		}
+		overdrawn = append(overdrawn, balance)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при поиске отрицательных балансов: %w", err)
+	}
+	if len(overdrawn) > 0 {
+		return overdrawn, nil
+	}
+
+	addQuery := "ALTER TABLE gophermart_balances ADD CONSTRAINT " + balanceCheckName + " CHECK (current >= 0)"
+	if _, err = tx.ExecContext(ctx, addQuery); err != nil {
+		return nil, fmt.Errorf("ошибка при добавлении ограничения баланса: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("ошибка при подтверждении транзакции: %w", err)
+	}
+
+	slog.Default().Info("Добавлено ограничение неотрицательного баланса")
+	return nil, nil
+}
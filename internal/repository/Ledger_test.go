@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/paxren/go-musthave-diploma-tpl/internal/models"
+)
+
+// migrateTestSchema применяет к db миграции до версии version или все, если version равна нулю
+func migrateTestSchema(t *testing.T, db *sql.DB, version uint) {
+	t.Helper()
+
+	driver, err := postgres.WithInstance(db, &postgres.Config{MigrationsTable: "schema_migrations_gophermart"})
+	require.NoError(t, err)
+	m, err := migrate.NewWithDatabaseInstance("file://../../migrations", "postgres", driver)
+	require.NoError(t, err)
+
+	if version == 0 {
+		err = m.Up()
+	} else {
+		err = m.Migrate(version)
+	}
+	require.NoError(t, err)
+}
+
+func TestLedgerMigration_OverdrawnUser(t *testing.T) {
+	ctx := context.Background()
+	db := newTestSchemaDB(t, "test_ledger")
+
+	// История до появления леджера: пользователь списал больше, чем ему начислено
+	migrateTestSchema(t, db, 5)
+	_, err := db.Exec(`
+		INSERT INTO gophermart_users (id, login, password_hash) VALUES (1, 'overdrawn', 'hash'), (2, 'regular', 'hash');
+		INSERT INTO gophermart_orders (id, user_id, type, status, value) VALUES
+			('1', 1, 'ORDER', 'PROCESSED', 10000),
+			('2', 1, 'WITHDRAW', 'PROCESSED', 15000),
+			('3', 2, 'ORDER', 'PROCESSED', 5000);
+	`)
+	require.NoError(t, err)
+
+	// Миграции проходят, отрицательный баланс переносится как есть
+	migrateTestSchema(t, db, 0)
+
+	var current int64
+	require.NoError(t, db.QueryRow("SELECT current FROM gophermart_balances WHERE user_id = 1").Scan(&current))
+	assert.Equal(t, int64(-5000), current)
+
+	// Пока баланс отрицательный, ограничение не добавляется, а пользователь попадает в отчет
+	overdrawn, err := ensureBalanceCheck(ctx, db)
+	require.NoError(t, err)
+	assert.Equal(t, []overdrawnBalance{{userID: 1, login: "overdrawn", current: -5000}}, overdrawn)
+
+	// Пользователь видит нулевой баланс и не может ничего списать
+	orders := MakeOrderPostgresStorage(&PostgresConnection{db: db})
+	balance, err := orders.GetBalance(ctx, 1)
+	require.NoError(t, err)
+	assert.Zero(t, balance.Current)
+	withdraw := models.MakeWithdraw(models.User{Login: "overdrawn"}, "4", 1)
+	assert.ErrorIs(t, orders.AddOrder(ctx, 1, *withdraw), ErrIncafitionFunds)
+
+	// Начисление, не закрывающее долг, не отклоняется
+	_, err = db.Exec("UPDATE gophermart_balances SET current = current + 1000 WHERE user_id = 1")
+	require.NoError(t, err)
+
+	// Долг закрыт, при следующем запуске ограничение добавляется
+	_, err = db.Exec("UPDATE gophermart_balances SET current = current + 4000 WHERE user_id = 1")
+	require.NoError(t, err)
+	overdrawn, err = ensureBalanceCheck(ctx, db)
+	require.NoError(t, err)
+	assert.Empty(t, overdrawn)
+
+	// Повторный запуск ничего не меняет
+	overdrawn, err = ensureBalanceCheck(ctx, db)
+	require.NoError(t, err)
+	assert.Empty(t, overdrawn)
+
+	_, err = db.Exec("UPDATE gophermart_balances SET current = -1 WHERE user_id = 2")
+	assert.Error(t, err, "после проверки отрицательный баланс запрещен")
+}
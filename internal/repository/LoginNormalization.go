@@ -0,0 +1,123 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+
+	"github.com/paxren/go-musthave-diploma-tpl/internal/models"
+)
+
+// ErrLoginCollision логины разных пользователей совпадают после нормализации.
+// Сервис не запускается, пока конфликтующие логины не переименованы вручную
+var ErrLoginCollision = errors.New("логины пользователей совпадают после нормализации")
+
+// legacyLogin пользователь и его нормализованный логин, если он уже заполнен
+type legacyLogin struct {
+	id         uint64
+	login      string
+	normalized sql.NullString
+}
+
+// normalizeLegacyLogins возвращает нормализованные логины пользователей, у которых они еще не заполнены.
+// Если логины нескольких пользователей совпадают после нормализации, возвращает ErrLoginCollision
+// со списком таких логинов: автоматически выбрать, кто из пользователей сохранит логин, нельзя
+func normalizeLegacyLogins(users []legacyLogin) (map[uint64]string, error) {
+	owners := make(map[string][]string, len(users))
+	updates := make(map[uint64]string)
+	for _, user := range users {
+		normalized := user.normalized.String
+		if !user.normalized.Valid {
+			normalized = models.NormalizeLogin(user.login)
+			updates[user.id] = normalized
+		}
+		owners[normalized] = append(owners[normalized], fmt.Sprintf("%q (id %d)", user.login, user.id))
+	}
+
+	var collisions []string
+	for _, logins := range owners {
+		if len(logins) > 1 {
+			collisions = append(collisions, strings.Join(logins, ", "))
+		}
+	}
+	if len(collisions) > 0 {
+		sort.Strings(collisions)
+		return nil, fmt.Errorf("%w: %s", ErrLoginCollision, strings.Join(collisions, "; "))
+	}
+
+	return updates, nil
+}
+
+// backfillLoginNormalized заполняет login_normalized у пользователей, зарегистрированных до миграции 000010,
+// и делает колонку NOT NULL. Выполняется при каждом запуске, но после первого успешного заполнения
+// ничего не меняет. Таблица пользователей блокируется от изменений до конца заполнения,
+// поэтому одновременно запущенные экземпляры сервиса не мешают друг другу
+func backfillLoginNormalized(ctx context.Context, db *sql.DB) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("ошибка при начале транзакции: %w", err)
+	}
+	// После Commit откат ничего не делает
+	defer tx.Rollback()
+
+	if _, err = tx.ExecContext(ctx, "LOCK TABLE gophermart_users IN SHARE ROW EXCLUSIVE MODE"); err != nil {
+		return fmt.Errorf("ошибка при блокировке таблицы пользователей: %w", err)
+	}
+
+	var nullable string
+	nullableQuery := `
+		SELECT is_nullable FROM information_schema.columns
+		WHERE table_schema = current_schema() AND table_name = 'gophermart_users' AND column_name = 'login_normalized'
+	`
+	if err = tx.QueryRowContext(ctx, nullableQuery).Scan(&nullable); err != nil {
+		return fmt.Errorf("ошибка при проверке колонки login_normalized: %w", err)
+	}
+	if nullable == "NO" {
+		return nil
+	}
+
+	rows, err := tx.QueryContext(ctx, "SELECT id, login, login_normalized FROM gophermart_users")
+	if err != nil {
+		return fmt.Errorf("ошибка при получении логинов пользователей: %w", err)
+	}
+	defer rows.Close()
+
+	var users []legacyLogin
+	for rows.Next() {
+		var user legacyLogin
+		if err = rows.Scan(&user.id, &user.login, &user.normalized); err != nil {
+			return fmt.Errorf("ошибка при чтении логина пользователя: %w", err)
+		}
+		users = append(users, user)
+	}
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("ошибка при получении логинов пользователей: %w", err)
+	}
+
+	updates, err := normalizeLegacyLogins(users)
+	if err != nil {
+		return err
+	}
+
+	updateQuery := "UPDATE gophermart_users SET login_normalized = $2 WHERE id = $1"
+	for id, normalized := range updates {
+		if _, err = tx.ExecContext(ctx, updateQuery, id, normalized); err != nil {
+			return fmt.Errorf("ошибка при заполнении нормализованного логина: %w", err)
+		}
+	}
+
+	if _, err = tx.ExecContext(ctx, "ALTER TABLE gophermart_users ALTER COLUMN login_normalized SET NOT NULL"); err != nil {
+		return fmt.Errorf("ошибка при установке NOT NULL для login_normalized: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("ошибка при подтверждении транзакции: %w", err)
+	}
+
+	slog.Default().Info("Нормализованные логины пользователей заполнены", "users", len(updates))
+	return nil
+}
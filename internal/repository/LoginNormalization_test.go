@@ -0,0 +1,131 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeLegacyLogins(t *testing.T) {
+	updates, err := normalizeLegacyLogins([]legacyLogin{
+		{id: 1, login: " Straße "},
+		{id: 2, login: "ΣΊΣΥΦΟΣ"},
+		{id: 3, login: "ivan", normalized: sql.NullString{String: "ivan", Valid: true}},
+	})
+	require.NoError(t, err)
+	// Заполняются только пустые логины, свертка регистра полная, а не lower()
+	assert.Equal(t, map[uint64]string{1: "strasse", 2: "σίσυφοσ"}, updates)
+
+	_, err = normalizeLegacyLogins([]legacyLogin{
+		{id: 1, login: "Ivan", normalized: sql.NullString{String: "ivan", Valid: true}},
+		{id: 2, login: "IVAN"},
+		{id: 3, login: "strasse"},
+		{id: 4, login: "STRASSE"},
+		{id: 5, login: "petr"},
+	})
+	require.ErrorIs(t, err, ErrLoginCollision)
+	assert.Contains(t, err.Error(), `"Ivan" (id 1), "IVAN" (id 2)`)
+	assert.Contains(t, err.Error(), `"strasse" (id 3), "STRASSE" (id 4)`)
+	assert.NotContains(t, err.Error(), "petr")
+}
+
+// newTestSchemaDB создает в тестовой базе отдельную пустую схему и возвращает соединение,
+// работающее в этой схеме. Схема удаляется после теста
+func newTestSchemaDB(t *testing.T, prefix string) *sql.DB {
+	t.Helper()
+
+	uri := os.Getenv("TEST_DATABASE_URI")
+	if uri == "" {
+		t.Skip("TEST_DATABASE_URI не задан, тест с PostgreSQL пропущен")
+	}
+
+	admin, err := sql.Open("pgx", uri)
+	require.NoError(t, err)
+	t.Cleanup(func() { admin.Close() })
+
+	schema := fmt.Sprintf("%s_%d", prefix, time.Now().UnixNano())
+	_, err = admin.Exec("CREATE SCHEMA " + schema)
+	require.NoError(t, err)
+	t.Cleanup(func() { admin.Exec("DROP SCHEMA " + schema + " CASCADE") })
+
+	separator := " "
+	if strings.Contains(uri, "://") {
+		separator = "?"
+		if strings.Contains(uri, "?") {
+			separator = "&"
+		}
+	}
+	db, err := sql.Open("pgx", uri+separator+"search_path="+schema)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// newLegacyUsersDB создает в тестовой базе отдельную схему с таблицей пользователей
+// в виде сразу после миграции 000010 и возвращает соединение, работающее в этой схеме
+func newLegacyUsersDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db := newTestSchemaDB(t, "test_backfill")
+	_, err := db.Exec(`
+		CREATE TABLE gophermart_users (
+			id SERIAL PRIMARY KEY,
+			login VARCHAR(255) NOT NULL UNIQUE,
+			password_hash VARCHAR(255) NOT NULL,
+			login_normalized VARCHAR(255)
+		);
+		CREATE UNIQUE INDEX idx_gophermart_users_login_normalized ON gophermart_users(login_normalized);
+	`)
+	require.NoError(t, err)
+	return db
+}
+
+func TestBackfillLoginNormalized(t *testing.T) {
+	ctx := context.Background()
+	db := newLegacyUsersDB(t)
+
+	_, err := db.Exec("INSERT INTO gophermart_users (login, password_hash) VALUES (' Straße ', 'hash'), ('ΣΊΣΥΦΟΣ', 'hash')")
+	require.NoError(t, err)
+
+	require.NoError(t, backfillLoginNormalized(ctx, db))
+	// Повторный запуск ничего не меняет
+	require.NoError(t, backfillLoginNormalized(ctx, db))
+
+	var normalized string
+	require.NoError(t, db.QueryRow("SELECT login_normalized FROM gophermart_users WHERE login = ' Straße '").Scan(&normalized))
+	assert.Equal(t, "strasse", normalized)
+	require.NoError(t, db.QueryRow("SELECT login_normalized FROM gophermart_users WHERE login = 'ΣΊΣΥΦΟΣ'").Scan(&normalized))
+	assert.Equal(t, "σίσυφοσ", normalized)
+
+	_, err = db.Exec("INSERT INTO gophermart_users (login, password_hash) VALUES ('nobody', 'hash')")
+	assert.Error(t, err, "после заполнения login_normalized обязателен")
+}
+
+func TestBackfillLoginNormalized_Collision(t *testing.T) {
+	ctx := context.Background()
+	db := newLegacyUsersDB(t)
+
+	_, err := db.Exec("INSERT INTO gophermart_users (login, password_hash) VALUES ('Strasse', 'hash'), ('STRASSE', 'hash'), ('petr', 'hash')")
+	require.NoError(t, err)
+
+	err = backfillLoginNormalized(ctx, db)
+	require.ErrorIs(t, err, ErrLoginCollision)
+	assert.Contains(t, err.Error(), `"Strasse"`)
+	assert.Contains(t, err.Error(), `"STRASSE"`)
+
+	// Ничего не заполнено, колонка осталась необязательной до исправления логинов
+	var filled int
+	require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM gophermart_users WHERE login_normalized IS NOT NULL").Scan(&filled))
+	assert.Zero(t, filled)
+
+	_, err = db.Exec("UPDATE gophermart_users SET login = 'strasse-2' WHERE login = 'STRASSE'")
+	require.NoError(t, err)
+	assert.NoError(t, backfillLoginNormalized(ctx, db))
+}
@@ -0,0 +1,180 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// Параметры защиты входа от перебора паролей
+const (
+	// loginFailuresThreshold неудачных попыток для одного логина до первой блокировки
+	loginFailuresThreshold = 5
+	// ipFailuresThreshold неудачных попыток с одного IP адреса до первой блокировки.
+	// Порог выше, чем для логина: за одним адресом может быть много пользователей
+	ipFailuresThreshold = 20
+	// loginLockoutBase длительность первой блокировки, каждая следующая неудачная попытка ее удваивает
+	loginLockoutBase = 30 * time.Second
+	// loginLockoutMax максимальная длительность блокировки
+	loginLockoutMax = time.Hour
+	// loginAttemptsWindow после такого перерыва без неудачных попыток счетчик начинается заново
+	loginAttemptsWindow = time.Hour
+	// loginAttemptsCleanupInterval не чаще этого интервала удаляются счетчики, переставшие действовать
+	loginAttemptsCleanupInterval = time.Minute
+)
+
+// Типы субъектов, для которых ведутся счетчики неудачных попыток входа
+const (
+	loginSubjectLogin = "login"
+	loginSubjectIP    = "ip"
+)
+
+// ErrLoginLocked возвращается, пока вход заблокирован после серии неудачных попыток
+var ErrLoginLocked = errors.New("вход временно заблокирован после неудачных попыток")
+
+// LoginLockedError сообщает, через сколько можно повторить попытку входа
+type LoginLockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LoginLockedError) Error() string {
+	return fmt.Sprintf("%s, повторите через %s", ErrLoginLocked.Error(), e.RetryAfter)
+}
+
+func (e *LoginLockedError) Unwrap() error {
+	return ErrLoginLocked
+}
+
+// loginLockoutDelay вычисляет длительность блокировки после failures неудачных попыток.
+// До порога блокировки нет, дальше она растет экспоненциально до loginLockoutMax
+func loginLockoutDelay(failures, threshold int) time.Duration {
+	if failures < threshold {
+		return 0
+	}
+
+	delay := loginLockoutBase
+	for i := threshold; i < failures; i++ {
+		delay *= 2
+		if delay >= loginLockoutMax {
+			return loginLockoutMax
+		}
+	}
+	return delay
+}
+
+// loginAttemptsCleanup решает, пора ли удалять устаревшие счетчики неудачных попыток.
+// Каждая неудачная попытка с нового IP адреса или для несуществующего логина заводит счетчик,
+// поэтому без очистки таблица счетчиков растет неограниченно
+type loginAttemptsCleanup struct {
+	lastRun atomic.Int64 // время последней очистки, наносекунды Unix
+}
+
+// due возвращает true не чаще раза в loginAttemptsCleanupInterval, одному из одновременных вызовов
+func (c *loginAttemptsCleanup) due(now time.Time) bool {
+	last := c.lastRun.Load()
+	if now.UnixNano()-last < int64(loginAttemptsCleanupInterval) {
+		return false
+	}
+	return c.lastRun.CompareAndSwap(last, now.UnixNano())
+}
+
+// isStaleLoginAttempts проверяет, что счетчик больше не влияет на вход: блокировки нет,
+// а следующая неудачная попытка все равно начнет счет заново
+func isStaleLoginAttempts(lastFailureAt, lockedUntil, now time.Time) bool {
+	return lastFailureAt.Before(now.Add(-loginAttemptsWindow)) && !lockedUntil.After(now)
+}
+
+// checkLoginLock проверяет, заблокирован ли вход для логина или IP адреса
+func (ps *UserPostgresStorage) checkLoginLock(ctx context.Context, login, clientIP string) error {
+	query := `
+		SELECT EXTRACT(EPOCH FROM (MAX(locked_until) - CURRENT_TIMESTAMP))::double precision
+		FROM gophermart_login_attempts
+		WHERE ((subject_type = $1 AND subject = $2) OR (subject_type = $3 AND subject = $4))
+		  AND locked_until > CURRENT_TIMESTAMP
+	`
+
+	var seconds sql.NullFloat64
+	err := ps.db.db.QueryRowContext(ctx, query, loginSubjectLogin, login, loginSubjectIP, clientIP).Scan(&seconds)
+	if err != nil {
+		return fmt.Errorf("ошибка при проверке блокировки входа: %w", err)
+	}
+
+	if seconds.Valid && seconds.Float64 > 0 {
+		return &LoginLockedError{RetryAfter: time.Duration(seconds.Float64 * float64(time.Second))}
+	}
+	return nil
+}
+
+// recordLoginFailure увеличивает счетчик неудачных попыток и блокирует субъект после порога
+func (ps *UserPostgresStorage) recordLoginFailure(ctx context.Context, subjectType, subject string, threshold int) error {
+	if subject == "" {
+		return nil
+	}
+
+	query := `
+		INSERT INTO gophermart_login_attempts (subject_type, subject, failures, last_failure_at)
+		VALUES ($1, $2, 1, CURRENT_TIMESTAMP)
+		ON CONFLICT (subject_type, subject) DO UPDATE
+		SET failures = CASE
+				WHEN gophermart_login_attempts.last_failure_at < CURRENT_TIMESTAMP - $3::double precision * INTERVAL '1 second'
+				THEN 1
+				ELSE gophermart_login_attempts.failures + 1
+			END,
+			last_failure_at = CURRENT_TIMESTAMP
+		RETURNING failures
+	`
+
+	var failures int
+	err := ps.db.db.QueryRowContext(ctx, query, subjectType, subject, loginAttemptsWindow.Seconds()).Scan(&failures)
+	if err != nil {
+		return fmt.Errorf("ошибка при учете неудачной попытки входа: %w", err)
+	}
+
+	if ps.attemptsCleanup.due(time.Now()) {
+		if err = ps.deleteStaleLoginAttempts(ctx); err != nil {
+			return err
+		}
+	}
+
+	delay := loginLockoutDelay(failures, threshold)
+	if delay == 0 {
+		return nil
+	}
+
+	lockQuery := `
+		UPDATE gophermart_login_attempts
+		SET locked_until = CURRENT_TIMESTAMP + $3::double precision * INTERVAL '1 second'
+		WHERE subject_type = $1 AND subject = $2
+	`
+	if _, err = ps.db.db.ExecContext(ctx, lockQuery, subjectType, subject, delay.Seconds()); err != nil {
+		return fmt.Errorf("ошибка при блокировке входа: %w", err)
+	}
+	return nil
+}
+
+// deleteStaleLoginAttempts удаляет счетчики без действующей блокировки,
+// неудачных попыток по которым не было дольше loginAttemptsWindow
+func (ps *UserPostgresStorage) deleteStaleLoginAttempts(ctx context.Context) error {
+	query := `
+		DELETE FROM gophermart_login_attempts
+		WHERE last_failure_at < CURRENT_TIMESTAMP - $1::double precision * INTERVAL '1 second'
+		  AND (locked_until IS NULL OR locked_until <= CURRENT_TIMESTAMP)
+	`
+	if _, err := ps.db.db.ExecContext(ctx, query, loginAttemptsWindow.Seconds()); err != nil {
+		return fmt.Errorf("ошибка при удалении устаревших неудачных попыток входа: %w", err)
+	}
+	return nil
+}
+
+// resetLoginFailures сбрасывает счетчик неудачных попыток логина после успешного входа.
+// Счетчик IP адреса не сбрасывается, иначе вход в свою учетную запись позволял бы продолжать перебор чужих
+func (ps *UserPostgresStorage) resetLoginFailures(ctx context.Context, login string) error {
+	query := "DELETE FROM gophermart_login_attempts WHERE subject_type = $1 AND subject = $2"
+	if _, err := ps.db.db.ExecContext(ctx, query, loginSubjectLogin, login); err != nil {
+		return fmt.Errorf("ошибка при сбросе неудачных попыток входа: %w", err)
+	}
+	return nil
+}
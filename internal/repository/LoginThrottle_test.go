@@ -0,0 +1,208 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/paxren/go-musthave-diploma-tpl/internal/models"
+)
+
+func TestLoginLockoutDelay(t *testing.T) {
+	tests := []struct {
+		failures int
+		expected time.Duration
+	}{
+		{failures: 1, expected: 0},
+		{failures: loginFailuresThreshold - 1, expected: 0},
+		{failures: loginFailuresThreshold, expected: loginLockoutBase},
+		{failures: loginFailuresThreshold + 1, expected: 2 * loginLockoutBase},
+		{failures: loginFailuresThreshold + 3, expected: 8 * loginLockoutBase},
+		{failures: loginFailuresThreshold + 100, expected: loginLockoutMax},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, loginLockoutDelay(tt.failures, loginFailuresThreshold), "failures=%d", tt.failures)
+	}
+}
+
+func TestUserPostgresStorage_LoginLockout(t *testing.T) {
+	pc := newTestPostgres(t)
+	ctx := context.Background()
+	users := MakeUserPostgresStorage(pc)
+	user := newTestUser(t, pc)
+
+	clientIP := "192.0.2." + time.Now().Format("150405")
+	t.Cleanup(func() {
+		pc.db.Exec("DELETE FROM gophermart_login_attempts WHERE subject IN ($1, $2)", user.Login, clientIP)
+	})
+
+	wrong := user
+	wrong.Password = "wrong-password"
+	for i := 0; i < loginFailuresThreshold; i++ {
+		assert.ErrorIs(t, users.LoginUser(ctx, wrong, clientIP), ErrBadLogin)
+	}
+
+	// Логин заблокирован, даже верный пароль не принимается
+	right := user
+	right.Password = "password"
+	err := users.LoginUser(ctx, right, clientIP)
+	require.ErrorIs(t, err, ErrLoginLocked)
+
+	var lockedErr *LoginLockedError
+	require.True(t, errors.As(err, &lockedErr))
+	assert.InDelta(t, loginLockoutBase.Seconds(), lockedErr.RetryAfter.Seconds(), 5)
+
+	// После снятия блокировки верный пароль сбрасывает счетчик логина
+	_, err = pc.db.Exec("UPDATE gophermart_login_attempts SET locked_until = NULL WHERE subject = $1", user.Login)
+	require.NoError(t, err)
+	require.NoError(t, users.LoginUser(ctx, right, clientIP))
+
+	assert.ErrorIs(t, users.LoginUser(ctx, wrong, clientIP), ErrBadLogin)
+	assert.NoError(t, users.LoginUser(ctx, right, clientIP))
+}
+
+func TestUserMemStorage_LoginLockout(t *testing.T) {
+	ctx := context.Background()
+	users := MakeUserMemStorage()
+	current := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	users.now = func() time.Time { return current }
+
+	right := models.User{Login: "user", Password: "password"}
+	require.NoError(t, users.RegisterUser(ctx, right))
+
+	wrong := right
+	wrong.Password = "wrong-password"
+	for i := 0; i < loginFailuresThreshold; i++ {
+		assert.ErrorIs(t, users.LoginUser(ctx, wrong, "192.0.2.1"), ErrBadLogin)
+	}
+
+	// Логин заблокирован, даже верный пароль не принимается, в том числе с другого адреса
+	err := users.LoginUser(ctx, right, "192.0.2.2")
+	require.ErrorIs(t, err, ErrLoginLocked)
+
+	var lockedErr *LoginLockedError
+	require.True(t, errors.As(err, &lockedErr))
+	assert.Equal(t, loginLockoutBase, lockedErr.RetryAfter)
+
+	// После снятия блокировки верный пароль сбрасывает счетчик логина
+	current = current.Add(loginLockoutBase)
+	require.NoError(t, users.LoginUser(ctx, right, "192.0.2.1"))
+
+	assert.ErrorIs(t, users.LoginUser(ctx, wrong, "192.0.2.1"), ErrBadLogin)
+	assert.NoError(t, users.LoginUser(ctx, right, "192.0.2.1"))
+}
+
+func TestUserMemStorage_StaleLoginAttemptsCleanup(t *testing.T) {
+	ctx := context.Background()
+	users := MakeUserMemStorage()
+	current := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	users.now = func() time.Time { return current }
+
+	// Перебор несуществующих логинов с разных адресов заводит счетчики
+	for i := 0; i < 10; i++ {
+		user := models.User{Login: fmt.Sprintf("missing-%d", i), Password: "password"}
+		assert.ErrorIs(t, users.LoginUser(ctx, user, fmt.Sprintf("192.0.2.%d", i)), ErrBadLogin)
+	}
+	// Логин, заблокированный дольше окна счета
+	users.attempts[loginAttemptsKey(loginSubjectLogin, "locked")] = &memLoginAttempts{
+		failures:      100,
+		lastFailureAt: current,
+		lockedUntil:   current.Add(3 * loginAttemptsWindow),
+	}
+	require.Len(t, users.attempts, 21)
+
+	// Спустя окно счета все счетчики без действующей блокировки удаляются при очередной неудаче
+	current = current.Add(loginAttemptsWindow + time.Second)
+	assert.ErrorIs(t, users.LoginUser(ctx, models.User{Login: "fresh", Password: "password"}, ""), ErrBadLogin)
+
+	assert.Len(t, users.attempts, 2)
+	assert.Contains(t, users.attempts, loginAttemptsKey(loginSubjectLogin, "locked"))
+	assert.Contains(t, users.attempts, loginAttemptsKey(loginSubjectLogin, "fresh"))
+}
+
+func TestUserSQLiteStorage_StaleLoginAttemptsCleanup(t *testing.T) {
+	ctx := context.Background()
+	sc, err := MakeSQLiteStorage(filepath.Join(t.TempDir(), "gophermart.db"))
+	require.NoError(t, err)
+	defer sc.Close()
+
+	current := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	sc.now = func() time.Time { return current }
+	users := MakeUserSQLiteStorage(sc)
+
+	for i := 0; i < 10; i++ {
+		user := models.User{Login: fmt.Sprintf("missing-%d", i), Password: "password"}
+		assert.ErrorIs(t, users.LoginUser(ctx, user, fmt.Sprintf("192.0.2.%d", i)), ErrBadLogin)
+	}
+	// Логин, заблокированный дольше окна счета
+	_, err = sc.db.Exec(`INSERT INTO gophermart_login_attempts (subject_type, subject, failures, locked_until, last_failure_at)
+		VALUES (?, 'locked', 100, ?, ?)`, loginSubjectLogin, toSQLiteTime(current.Add(3*loginAttemptsWindow)), toSQLiteTime(current))
+	require.NoError(t, err)
+
+	current = current.Add(loginAttemptsWindow + time.Second)
+	assert.ErrorIs(t, users.LoginUser(ctx, models.User{Login: "fresh", Password: "password"}, ""), ErrBadLogin)
+
+	var subjects []string
+	rows, err := sc.db.Query("SELECT subject FROM gophermart_login_attempts ORDER BY subject")
+	require.NoError(t, err)
+	defer rows.Close()
+	for rows.Next() {
+		var subject string
+		require.NoError(t, rows.Scan(&subject))
+		subjects = append(subjects, subject)
+	}
+	require.NoError(t, rows.Err())
+	assert.Equal(t, []string{"fresh", "locked"}, subjects)
+}
+
+func TestUserPostgresStorage_StaleLoginAttemptsCleanup(t *testing.T) {
+	pc := newTestPostgres(t)
+	ctx := context.Background()
+	users := MakeUserPostgresStorage(pc)
+
+	prefix := fmt.Sprintf("cleanup-%d", time.Now().UnixNano())
+	t.Cleanup(func() {
+		pc.db.Exec("DELETE FROM gophermart_login_attempts WHERE subject LIKE $1", prefix+"%")
+	})
+
+	query := `
+		INSERT INTO gophermart_login_attempts (subject_type, subject, failures, locked_until, last_failure_at)
+		VALUES ($1, $2, 1, $3, $4)
+	`
+	now := time.Now()
+	old := now.Add(-2 * loginAttemptsWindow)
+	for _, row := range []struct {
+		subject       string
+		lockedUntil   *time.Time
+		lastFailureAt time.Time
+	}{
+		{subject: prefix + "-stale", lastFailureAt: old},
+		{subject: prefix + "-expired-lock", lockedUntil: &old, lastFailureAt: old},
+		{subject: prefix + "-locked", lockedUntil: &[]time.Time{now.Add(time.Hour)}[0], lastFailureAt: old},
+		{subject: prefix + "-recent", lastFailureAt: now},
+	} {
+		_, err := pc.db.Exec(query, loginSubjectIP, row.subject, row.lockedUntil, row.lastFailureAt)
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, users.deleteStaleLoginAttempts(ctx))
+
+	rows, err := pc.db.Query("SELECT subject FROM gophermart_login_attempts WHERE subject LIKE $1 ORDER BY subject", prefix+"%")
+	require.NoError(t, err)
+	defer rows.Close()
+	var subjects []string
+	for rows.Next() {
+		var subject string
+		require.NoError(t, rows.Scan(&subject))
+		subjects = append(subjects, subject)
+	}
+	require.NoError(t, rows.Err())
+	assert.Equal(t, []string{prefix + "-locked", prefix + "-recent"}, subjects)
+}
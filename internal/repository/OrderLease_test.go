@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/paxren/go-musthave-diploma-tpl/internal/models"
+)
+
+// checkExpiredLease проверяет, что по истекшей аренде заказ не переносится,
+// а после повторного захвата переносится только по новой аренде
+func checkExpiredLease(t *testing.T, backend storageBackend, advance func(time.Duration)) {
+	ctx := context.Background()
+	user := registerUser(t, backend)
+	number := uniqueOrderNumber(0)
+	require.NoError(t, backend.orders.AddOrder(ctx, *user.UserID, *models.MakeNewOrder(user, number)))
+
+	statuses := []string{models.OrderStatusNew}
+	claimed, err := backend.orders.ClaimOrdersWithStatuses(ctx, statuses, 10, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+	stale := claimed[0].LeaseToken
+
+	advance(time.Minute + time.Second)
+	assert.ErrorIs(t, backend.orders.PostponeOrderPoll(ctx, number, stale, time.Hour, true), ErrLeaseLost)
+
+	claimed, err = backend.orders.ClaimOrdersWithStatuses(ctx, statuses, 10, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+	assert.ErrorIs(t, backend.orders.PostponeOrderPoll(ctx, number, stale, time.Hour, true), ErrLeaseLost)
+	require.NoError(t, backend.orders.PostponeOrderPoll(ctx, number, claimed[0].LeaseToken, time.Hour, true))
+
+	order, err := backend.orders.GetOrder(ctx, number)
+	require.NoError(t, err)
+	assert.Equal(t, 1, order.PollAttempts)
+	assert.Equal(t, 1, order.NotRegisteredPolls)
+}
+
+func TestOrderMemStorage_ExpiredLease(t *testing.T) {
+	orders := MakeOrderMemStorage()
+	current := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	orders.now = func() time.Time { return current }
+
+	checkExpiredLease(t, storageBackend{
+		users:      MakeUserMemStorage(),
+		orders:     orders,
+		forgetUser: func(*testing.T, string) {},
+	}, func(d time.Duration) { current = current.Add(d) })
+}
+
+func TestOrderSQLiteStorage_ExpiredLease(t *testing.T) {
+	sc, err := MakeSQLiteStorage(filepath.Join(t.TempDir(), "gophermart.db"))
+	require.NoError(t, err)
+	defer sc.Close()
+
+	current := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	sc.now = func() time.Time { return current }
+
+	checkExpiredLease(t, storageBackend{
+		users:      MakeUserSQLiteStorage(sc),
+		orders:     MakeOrderSQLiteStorage(sc),
+		forgetUser: func(*testing.T, string) {},
+	}, func(d time.Duration) { current = current.Add(d) })
+}
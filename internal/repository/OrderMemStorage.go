@@ -1,122 +1,307 @@
 package repository
 
 import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/paxren/go-musthave-diploma-tpl/internal/models"
+	"github.com/paxren/go-musthave-diploma-tpl/internal/money"
 )
 
-// ПОТОКО НЕБЕЗОПАСНО!
+// memOrder заказ вместе со служебными полями опроса, которые в PostgreSQL хранятся в строке заказа
+type memOrder struct {
+	userID     uint64
+	order      models.Order
+	nextPollAt time.Time
+	leaseUntil time.Time
+}
 
+// OrderMemStorage хранилище заказов и балансов в памяти. Повторяет поведение OrderPostgresStorage,
+// включая проверку переходов статуса, аренду заказов для опроса и курсорную пагинацию.
+// Все операции выполняются под одной блокировкой, поэтому списания одного пользователя
+// не могут вместе превысить его баланс
 type OrderMemStorage struct {
-	orders map[string][]models.Order
-	mutex  sync.Mutex //TODO добавить мутекс в каждого пользователя и блокировать попользовательно
+	mutex    sync.Mutex
+	orders   map[string]*memOrder
+	balances map[uint64]models.Balance
+	now      func() time.Time
 }
 
 func MakeOrderMemStorage() *OrderMemStorage {
-
 	return &OrderMemStorage{
-		orders: make(map[string][]models.Order),
+		orders:   make(map[string]*memOrder),
+		balances: make(map[uint64]models.Balance),
+		now:      time.Now,
 	}
 }
 
-func (st *OrderMemStorage) AddOrder(user models.User, order models.Order) error {
+func (st *OrderMemStorage) AddOrder(ctx context.Context, userID uint64, order models.Order) error {
+	// Проверяем корректность номера заказа по алгоритму Луна
+	if !models.LunaCheck(order.OrderID) {
+		return ErrBadOrderID
+	}
 
 	st.mutex.Lock()
 	defer st.mutex.Unlock()
 
-	if !models.LunaCheck(order.OrderID) {
-		return ErrBadOrderID
+	if existing, ok := st.orders[order.OrderID]; ok {
+		if existing.userID == userID {
+			return ErrOrderExistThisUser
+		}
+		return ErrOrderExistAnotherUser
 	}
 
-	orders, ok := st.orders[user.Login]
+	if order.Type != models.OrderType && order.Type != models.WithdrawType {
+		return ErrOrderType
+	}
 
-	if !ok {
-		orders = make([]models.Order, 0, 10)
+	now := st.now()
+	if order.UploadedAt.IsZero() {
+		order.UploadedAt = now
 	}
+	order.UpdatedAt = order.UploadedAt
+	order.ProcessedAt = nil
+	order.PollAttempts = 0
+	order.NotRegisteredPolls = 0
 
-	for _, v := range orders {
-		if v.OrderID == order.OrderID {
-			return ErrOrderExistThisUser
+	if order.Type == models.WithdrawType {
+		balance := st.balances[userID]
+		if order.Value > balance.Current {
+			return ErrIncafitionFunds
 		}
+		balance.Current -= order.Value
+		balance.Withdrawn += order.Value
+		st.balances[userID] = balance
+
+		// Списание сразу считается обработанным
+		processedAt := order.UploadedAt
+		order.ProcessedAt = &processedAt
+	}
+
+	st.orders[order.OrderID] = &memOrder{
+		userID:     userID,
+		order:      order,
+		nextPollAt: now,
+	}
+	return nil
+}
+
+// GetOrders получает страницу заказов пользователя с теми же фильтрами,
+// порядком (created_at, id) и курсором, что и OrderPostgresStorage
+func (st *OrderMemStorage) GetOrders(ctx context.Context, userID uint64, query models.OrderQuery) (*models.OrderPage, error) {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+
+	statuses := make(map[string]bool, len(query.Statuses))
+	for _, status := range query.Statuses {
+		statuses[status] = true
 	}
 
-	for _, list := range st.orders {
-		for _, v := range list {
-			if v.OrderID == order.OrderID {
-				return ErrOrderExistAnotherUser
-			}
+	// after проверяет, что заказ идет после курсора в порядке выдачи
+	after := func(order models.Order) bool {
+		if query.After == nil {
+			return true
 		}
+		cmp := compareOrderKeys(order.UploadedAt, order.OrderID, query.After.CreatedAt, query.After.OrderID)
+		if query.Ascending {
+			return cmp > 0
+		}
+		return cmp < 0
 	}
 
-	if order.Type == models.WithdrawType {
+	var orders []models.Order
+	for _, stored := range st.orders {
+		order := stored.order
+		switch {
+		case stored.userID != userID:
+		case query.Type != "" && order.Type != query.Type:
+		case len(statuses) > 0 && !statuses[order.Status]:
+		case !query.From.IsZero() && order.UploadedAt.Before(query.From):
+		case !query.To.IsZero() && !order.UploadedAt.Before(query.To):
+		case !after(order):
+		default:
+			orders = append(orders, order)
+		}
+	}
 
-		var sumOrder uint64
-		for _, v := range orders {
-			if v.Type == models.OrderType {
-				sumOrder += v.Value
-			}
+	sort.Slice(orders, func(i, j int) bool {
+		cmp := compareOrderKeys(orders[i].UploadedAt, orders[i].OrderID, orders[j].UploadedAt, orders[j].OrderID)
+		if query.Ascending {
+			return cmp < 0
 		}
+		return cmp > 0
+	})
 
-		if order.Value > sumOrder {
-			return ErrIncafitionFunds
+	page := &models.OrderPage{}
+	if query.Limit > 0 && len(orders) > query.Limit {
+		orders = orders[:query.Limit]
+		last := orders[len(orders)-1]
+		page.Next = &models.OrderCursor{CreatedAt: last.UploadedAt, OrderID: last.OrderID}
+	}
+	page.Orders = orders
+
+	return page, nil
+}
+
+func (st *OrderMemStorage) GetBalance(ctx context.Context, userID uint64) (*models.Balance, error) {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+
+	balance := st.balances[userID]
+	return &balance, nil
+}
+
+// GetOrder возвращает заказ на начисление по номеру
+func (st *OrderMemStorage) GetOrder(ctx context.Context, orderID string) (*models.Order, error) {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+
+	stored, ok := st.orders[orderID]
+	if !ok || stored.order.Type != models.OrderType {
+		return nil, fmt.Errorf("%w: ID %s", ErrOrderNotFound, orderID)
+	}
+
+	order := stored.order
+	return &order, nil
+}
+
+// GetOrdersWithStatuses получает заказы с указанными статусами от старых к новым
+func (st *OrderMemStorage) GetOrdersWithStatuses(ctx context.Context, statuses []string) ([]models.Order, error) {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+
+	orders := []models.Order{}
+	for _, stored := range st.orders {
+		if hasStatus(statuses, stored.order.Status) {
+			orders = append(orders, stored.order)
 		}
+	}
 
-	} else if order.Type != models.OrderType {
-		return ErrOrderType
+	sort.Slice(orders, func(i, j int) bool { return orders[i].UploadedAt.Before(orders[j].UploadedAt) })
+	return orders, nil
+}
+
+// ClaimOrdersWithStatuses захватывает в аренду до limit заказов с указанными статусами,
+// срок опроса которых уже наступил, начиная с самых давно ожидающих
+func (st *OrderMemStorage) ClaimOrdersWithStatuses(ctx context.Context, statuses []string, limit int, lease time.Duration) ([]models.Order, error) {
+	if len(statuses) == 0 || limit <= 0 {
+		return []models.Order{}, nil
 	}
 
-	orders = append(orders, order)
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+
+	now := st.now()
+	var candidates []*memOrder
+	for _, stored := range st.orders {
+		if stored.order.Type == models.OrderType &&
+			hasStatus(statuses, stored.order.Status) &&
+			!stored.nextPollAt.After(now) &&
+			!stored.leaseUntil.After(now) {
+			candidates = append(candidates, stored)
+		}
+	}
 
-	st.orders[user.Login] = orders
-	return nil
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].nextPollAt.Before(candidates[j].nextPollAt) })
+	if len(candidates) > limit {
+		candidates = candidates[:limit]
+	}
 
+	orders := make([]models.Order, 0, len(candidates))
+	for _, stored := range candidates {
+		stored.leaseUntil = now.Add(lease)
+		stored.order.LeaseToken++
+		orders = append(orders, stored.order)
+	}
+	return orders, nil
 }
 
-func (st *OrderMemStorage) GetOrders(user models.User, orderType string) ([]models.Order, error) {
-	orders, ok := st.orders[user.Login]
+// UpdateOrderStatusAndValue обновляет статус и значение заказа, проверяя допустимость перехода.
+// Начисление по обработанному заказу зачисляется на баланс пользователя
+func (st *OrderMemStorage) UpdateOrderStatusAndValue(ctx context.Context, orderID, status string, value money.Amount) error {
+	allowedFrom := models.StatusesBefore(status)
+	if len(allowedFrom) == 0 {
+		return fmt.Errorf("%w: в статус %s", models.ErrIllegalStatusTransition, status)
+	}
+
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+
+	stored, ok := st.orders[orderID]
 	if !ok {
-		return make([]models.Order, 0), nil
+		return fmt.Errorf("%w: ID %s", ErrOrderNotFound, orderID)
+	}
+	if stored.order.Type != models.OrderType || !hasStatus(allowedFrom, stored.order.Status) {
+		return fmt.Errorf("%w: %s -> %s", models.ErrIllegalStatusTransition, stored.order.Status, status)
 	}
 
-	ordersTyped := make([]models.Order, 0, 10)
+	now := st.now()
+	stored.order.Status = status
+	stored.order.Value = value
+	stored.order.UpdatedAt = now
+	stored.order.ProcessedAt = nil
+	if models.IsFinalStatus(status) {
+		stored.order.ProcessedAt = &now
+	}
+	stored.order.PollAttempts = 0
+	stored.order.NotRegisteredPolls = 0
+	stored.leaseUntil = time.Time{}
+	stored.nextPollAt = now
 
-	for _, v := range orders {
-		if v.Type == orderType {
-			ordersTyped = append(ordersTyped, v)
-		}
+	if status == models.OrderStatusProcessed && value > 0 {
+		balance := st.balances[stored.userID]
+		balance.Current += value
+		st.balances[stored.userID] = balance
 	}
 
-	return ordersTyped, nil
+	return nil
 }
 
-func (st *OrderMemStorage) GetBalance(user models.User) (*models.Balance, error) {
+// PostponeOrderPoll откладывает следующий опрос заказа на delay, пока действует аренда leaseToken,
+// по тем же правилам, что и OrderPostgresStorage
+func (st *OrderMemStorage) PostponeOrderPoll(ctx context.Context, orderID string, leaseToken int64, delay time.Duration, notRegistered bool) error {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
 
-	orders, ok := st.orders[user.Login]
+	stored, ok := st.orders[orderID]
 	if !ok {
-		return &models.Balance{
-				Current:   0,
-				Withdrawn: 0,
-			},
-			nil
+		return fmt.Errorf("%w: ID %s", ErrOrderNotFound, orderID)
 	}
 
-	var sumOrder, sumWithdraw uint64
+	now := st.now()
+	if stored.order.LeaseToken != leaseToken || !stored.leaseUntil.After(now) {
+		return fmt.Errorf("%w: ID %s", ErrLeaseLost, orderID)
+	}
 
-	for _, v := range orders {
-		switch v.Type {
-		case models.OrderType:
-			sumOrder += v.Value
-		case models.WithdrawType:
-			sumWithdraw += v.Value
-		}
-		//TODO что делать если обнаружили невалидный тип??
+	stored.nextPollAt = now.Add(delay)
+	stored.order.PollAttempts++
+	if notRegistered {
+		stored.order.NotRegisteredPolls++
+	} else {
+		stored.order.NotRegisteredPolls = 0
+	}
+	stored.leaseUntil = time.Time{}
+	return nil
+}
 
+// compareOrderKeys сравнивает заказы по паре (created_at, id), по которой строятся страницы
+func compareOrderKeys(aTime time.Time, aID string, bTime time.Time, bID string) int {
+	if c := aTime.Compare(bTime); c != 0 {
+		return c
 	}
+	return strings.Compare(aID, bID)
+}
 
-	return &models.Balance{
-			Current:   sumOrder,
-			Withdrawn: sumWithdraw,
-		},
-		nil
+// hasStatus проверяет, что status есть в списке statuses
+func hasStatus(statuses []string, status string) bool {
+	for _, s := range statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
 }
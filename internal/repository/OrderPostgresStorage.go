@@ -1,12 +1,15 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/paxren/go-musthave-diploma-tpl/internal/models"
+	"github.com/paxren/go-musthave-diploma-tpl/internal/money"
 )
 
 // ПОТОКО НЕБЕЗОПАСНО!
@@ -22,27 +25,16 @@ func MakeOrderPostgresStorage(pc *PostgresConnection) *OrderPostgresStorage {
 	}
 }
 
-func (st *OrderPostgresStorage) AddOrder(user models.User, order models.Order) error {
+func (st *OrderPostgresStorage) AddOrder(ctx context.Context, userID uint64, order models.Order) error {
 	// Проверяем корректность номера заказа по алгоритму Луна
 	if !models.LunaCheck(order.OrderID) {
 		return ErrBadOrderID
 	}
 
-	// Получаем ID пользователя
-	var userID uint64
-	query := "SELECT id FROM gophermart_users WHERE login = $1"
-	err := st.db.db.QueryRow(query, user.Login).Scan(&userID)
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return ErrBadLogin
-		}
-		return fmt.Errorf("ошибка при получении ID пользователя: %w", err)
-	}
-
 	// Проверяем, существует ли уже такой заказ у этого пользователя
 	var existingUserID uint64
 	checkQuery := "SELECT user_id FROM gophermart_orders WHERE id = $1"
-	err = st.db.db.QueryRow(checkQuery, order.OrderID).Scan(&existingUserID)
+	err := st.db.db.QueryRowContext(ctx, checkQuery, order.OrderID).Scan(&existingUserID)
 	if err == nil {
 		// Заказ существует, проверяем у какого пользователя
 		if existingUserID == userID {
@@ -59,195 +51,246 @@ func (st *OrderPostgresStorage) AddOrder(user models.User, order models.Order) e
 		return ErrOrderType
 	}
 
-	// Преобразуем строку даты в time.Time
-	createdAt, err := time.Parse(time.RFC3339, order.Date)
-	if err != nil {
-		// Если не удалось распарсить дату, используем текущее время
-		createdAt = time.Now()
+	if order.UploadedAt.IsZero() {
+		order.UploadedAt = time.Now()
 	}
 
-	// Если это операция списания, используем транзакцию для атомарности
+	// Списание выполняется в транзакции с блокировкой баланса пользователя,
+	// при конфликте с параллельной транзакцией она повторяется целиком
 	if order.Type == models.WithdrawType {
-		// Начинаем транзакцию
-		tx, err := st.db.db.Begin()
-		if err != nil {
-			return fmt.Errorf("ошибка при начале транзакции: %w", err)
-		}
-		defer func() {
-			if err != nil {
-				tx.Rollback()
-			}
-		}()
+		return retryTx(ctx, func() error {
+			return st.addWithdraw(ctx, userID, order)
+		})
+	}
 
-		// Проверяем текущий баланс пользователя в рамках транзакции
-		var currentBalance uint64
-		balanceQuery := `
-			SELECT COALESCE(SUM(CASE WHEN type = 'ORDER' THEN value ELSE 0 END), 0) -
-			       COALESCE(SUM(CASE WHEN type = 'WITHDRAW' THEN value ELSE 0 END), 0)
-			FROM gophermart_orders
-			WHERE user_id = $1
-		`
-		err = tx.QueryRow(balanceQuery, userID).Scan(&currentBalance)
-		if err != nil {
-			return fmt.Errorf("ошибка при получении баланса в транзакции: %w", err)
+	// Для обычных заказов (не списаний) добавляем без транзакции
+	insertQuery := `
+		INSERT INTO gophermart_orders (id, user_id, type, status, value, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $6)
+	`
+	_, err = st.db.db.ExecContext(ctx, insertQuery, order.OrderID, userID, order.Type, order.Status, order.Value, order.UploadedAt)
+	if err != nil {
+		// Проверяем ошибку уникального ограничения на случай гонки состояний
+		if isUniqueViolationError(err) {
+			// Повторно проверяем, у какого пользователя существует заказ
+			err = st.db.db.QueryRowContext(ctx, checkQuery, order.OrderID).Scan(&existingUserID)
+			if err == nil {
+				if existingUserID == userID {
+					return ErrOrderExistThisUser
+				}
+				return ErrOrderExistAnotherUser
+			}
 		}
+		return fmt.Errorf("ошибка при добавлении заказа: %w", err)
+	}
 
-		// Проверяем, достаточно ли средств для списания
-		if order.Value > currentBalance {
+	return nil
+}
+
+// addWithdraw добавляет списание и списывает баллы с баланса в одной транзакции.
+// Строка баланса блокируется (SELECT ... FOR UPDATE) до конца транзакции, поэтому
+// параллельные списания одного пользователя выполняются строго по очереди
+// и не могут вместе превысить баланс
+func (st *OrderPostgresStorage) addWithdraw(ctx context.Context, userID uint64, order models.Order) error {
+	tx, err := st.db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("ошибка при начале транзакции: %w", err)
+	}
+	// После Commit откат ничего не делает
+	defer tx.Rollback()
+
+	// Блокируем строку баланса и проверяем, достаточно ли средств для списания.
+	// Отрицательный баланс, перенесенный из старой истории, считается нулевым
+	var current money.Amount
+	lockQuery := "SELECT GREATEST(current, 0) FROM gophermart_balances WHERE user_id = $1 FOR UPDATE"
+	err = tx.QueryRowContext(ctx, lockQuery, userID).Scan(&current)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			// Строки баланса нет - пользователю еще ничего не начислялось
 			return ErrIncafitionFunds
 		}
+		return fmt.Errorf("ошибка при блокировке баланса: %w", err)
+	}
+	if order.Value > current {
+		return ErrIncafitionFunds
+	}
 
-		// Добавляем заказ на списание в рамках транзакции
-		insertQuery := `
-			INSERT INTO gophermart_orders (id, user_id, type, status, value, created_at)
-			VALUES ($1, $2, $3, $4, $5, $6)
-		`
-		_, err = tx.Exec(insertQuery, order.OrderID, userID, order.Type, order.Status, order.Value, createdAt)
-		if err != nil {
-			// Проверяем ошибку уникального ограничения на случай гонки состояний
-			if isUniqueViolationError(err) {
-				// Повторно проверяем, у какого пользователя существует заказ
-				err = tx.QueryRow(checkQuery, order.OrderID).Scan(&existingUserID)
-				if err == nil {
-					if existingUserID == userID {
-						return ErrOrderExistThisUser
-					}
-					return ErrOrderExistAnotherUser
+	// Добавляем заказ на списание в рамках транзакции
+	// Списание сразу считается обработанным
+	insertQuery := `
+		INSERT INTO gophermart_orders (id, user_id, type, status, value, created_at, updated_at, processed_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $6, $6)
+	`
+	_, err = tx.ExecContext(ctx, insertQuery, order.OrderID, userID, order.Type, order.Status, order.Value, order.UploadedAt)
+	if err != nil {
+		// Проверяем ошибку уникального ограничения на случай гонки состояний
+		if isUniqueViolationError(err) {
+			// Повторно проверяем, у какого пользователя существует заказ (вне прерванной транзакции)
+			var existingUserID uint64
+			checkQuery := "SELECT user_id FROM gophermart_orders WHERE id = $1"
+			if err = st.db.db.QueryRowContext(ctx, checkQuery, order.OrderID).Scan(&existingUserID); err == nil {
+				if existingUserID == userID {
+					return ErrOrderExistThisUser
 				}
+				return ErrOrderExistAnotherUser
 			}
-			return fmt.Errorf("ошибка при добавлении заказа в транзакции: %w", err)
 		}
+		return fmt.Errorf("ошибка при добавлении заказа в транзакции: %w", err)
+	}
 
-		// Подтверждаем транзакцию
-		err = tx.Commit()
-		if err != nil {
-			return fmt.Errorf("ошибка при подтверждении транзакции: %w", err)
-		}
-	} else {
-		// Для обычных заказов (не списаний) добавляем без транзакции
-		insertQuery := `
-			INSERT INTO gophermart_orders (id, user_id, type, status, value, created_at)
-			VALUES ($1, $2, $3, $4, $5, $6)
-		`
-		_, err = st.db.db.Exec(insertQuery, order.OrderID, userID, order.Type, order.Status, order.Value, createdAt)
-		if err != nil {
-			// Проверяем ошибку уникального ограничения на случай гонки состояний
-			if isUniqueViolationError(err) {
-				// Повторно проверяем, у какого пользователя существует заказ
-				err = st.db.db.QueryRow(checkQuery, order.OrderID).Scan(&existingUserID)
-				if err == nil {
-					if existingUserID == userID {
-						return ErrOrderExistThisUser
-					}
-					return ErrOrderExistAnotherUser
-				}
-			}
-			return fmt.Errorf("ошибка при добавлении заказа: %w", err)
-		}
+	// Списываем баллы с баланса (условие в UPDATE дублирует проверку выше)
+	if err = debitBalance(ctx, tx, userID, order.Value); err != nil {
+		return err
+	}
+
+	if err = postLedgerTransfer(ctx, tx, userID, order.OrderID, ledgerAccountUser, ledgerAccountWithdrawal, order.Value); err != nil {
+		return err
+	}
+
+	// Подтверждаем транзакцию
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("ошибка при подтверждении транзакции: %w", err)
 	}
 
 	return nil
 }
 
-func (st *OrderPostgresStorage) GetOrders(user models.User, orderType string) ([]models.Order, error) {
-	// Получаем ID пользователя
-	var userID uint64
-	query := "SELECT id FROM gophermart_users WHERE login = $1"
-	err := st.db.db.QueryRow(query, user.Login).Scan(&userID)
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return []models.Order{}, nil
+// GetOrders получает страницу заказов пользователя. Фильтры, сортировка и пагинация
+// выполняются в базе: страницы отсчитываются от курсора по паре (created_at, id),
+// поэтому добавление новых заказов не сдвигает уже полученные страницы
+func (st *OrderPostgresStorage) GetOrders(ctx context.Context, userID uint64, query models.OrderQuery) (*models.OrderPage, error) {
+	conditions := []string{"user_id = $1"}
+	args := []interface{}{userID}
+	addCondition := func(condition string, values ...interface{}) {
+		placeholders := make([]interface{}, len(values))
+		for i, value := range values {
+			args = append(args, value)
+			placeholders[i] = len(args)
 		}
-		return nil, fmt.Errorf("ошибка при получении ID пользователя: %w", err)
+		conditions = append(conditions, fmt.Sprintf(condition, placeholders...))
+	}
+
+	if query.Type != "" {
+		addCondition("type = $%d", query.Type)
+	}
+	if len(query.Statuses) > 0 {
+		addCondition("status = ANY($%d)", query.Statuses)
+	}
+	if !query.From.IsZero() {
+		addCondition("created_at >= $%d", query.From)
+	}
+	if !query.To.IsZero() {
+		addCondition("created_at < $%d", query.To)
 	}
 
-	// Формируем запрос в зависимости от типа заказа
-	var ordersQuery string
-	var args []interface{}
+	direction, comparison := "DESC", "<"
+	if query.Ascending {
+		direction, comparison = "ASC", ">"
+	}
+	if query.After != nil {
+		addCondition("(created_at, id) "+comparison+" ($%d, $%d)", query.After.CreatedAt, query.After.OrderID)
+	}
 
-	if orderType == "" {
-		// Если тип не указан, получаем все заказы
-		ordersQuery = `
-			SELECT id, type, status, value, created_at
-			FROM gophermart_orders
-			WHERE user_id = $1
-			ORDER BY created_at DESC
-		`
-		args = []interface{}{userID}
-	} else {
-		// Если тип указан, фильтруем по типу
-		ordersQuery = `
-			SELECT id, type, status, value, created_at
-			FROM gophermart_orders
-			WHERE user_id = $1 AND type = $2
-			ORDER BY created_at DESC
-		`
-		args = []interface{}{userID, orderType}
+	ordersQuery := fmt.Sprintf(`
+		SELECT id, type, status, value, created_at, updated_at, processed_at
+		FROM gophermart_orders
+		WHERE %s
+		ORDER BY created_at %s, id %s
+	`, strings.Join(conditions, " AND "), direction, direction)
+
+	// Запрашиваем на одну запись больше, чтобы узнать, есть ли следующая страница
+	if query.Limit > 0 {
+		args = append(args, query.Limit+1)
+		ordersQuery += fmt.Sprintf("LIMIT $%d", len(args))
 	}
 
-	rows, err := st.db.db.Query(ordersQuery, args...)
+	rows, err := st.db.db.QueryContext(ctx, ordersQuery, args...)
 	if err != nil {
 		return nil, fmt.Errorf("ошибка при получении заказов: %w", err)
 	}
 	defer rows.Close()
 
-	var orders []models.Order
+	page := &models.OrderPage{}
 	for rows.Next() {
 		var order models.Order
-		var createdAt time.Time
+		var processedAt sql.NullTime
 
-		err := rows.Scan(&order.OrderID, &order.Type, &order.Status, &order.Value, &createdAt)
+		err := rows.Scan(&order.OrderID, &order.Type, &order.Status, &order.Value, &order.UploadedAt, &order.UpdatedAt, &processedAt)
 		if err != nil {
 			return nil, fmt.Errorf("ошибка при сканировании заказа: %w", err)
 		}
 
-		// Устанавливаем пользователя и дату
-		order.User = user.Login
-		order.Date = createdAt.Format(time.RFC3339)
+		if query.Limit > 0 && len(page.Orders) == query.Limit {
+			last := page.Orders[len(page.Orders)-1]
+			page.Next = &models.OrderCursor{CreatedAt: last.UploadedAt, OrderID: last.OrderID}
+			break
+		}
 
-		orders = append(orders, order)
+		if processedAt.Valid {
+			order.ProcessedAt = &processedAt.Time
+		}
+
+		page.Orders = append(page.Orders, order)
 	}
 
 	if err = rows.Err(); err != nil {
 		return nil, fmt.Errorf("ошибка при итерации по заказам: %w", err)
 	}
 
-	return orders, nil
+	return page, nil
 }
 
-func (st *OrderPostgresStorage) GetBalance(user models.User) (*models.Balance, error) {
-	// Получаем ID пользователя
-	var userID uint64
-	query := "SELECT id FROM gophermart_users WHERE login = $1"
-	err := st.db.db.QueryRow(query, user.Login).Scan(&userID)
+func (st *OrderPostgresStorage) GetBalance(ctx context.Context, userID uint64) (*models.Balance, error) {
+	// Баланс хранится готовой строкой, которая обновляется вместе с проводками леджера.
+	// Отрицательный баланс, перенесенный из старой истории (см. ensureBalanceCheck), показывается нулевым
+	balanceQuery := `
+		SELECT GREATEST(current, 0), withdrawn
+		FROM gophermart_balances
+		WHERE user_id = $1
+	`
+
+	var balance models.Balance
+	err := st.db.db.QueryRowContext(ctx, balanceQuery, userID).Scan(&balance.Current, &balance.Withdrawn)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
+			// Пользователю еще ничего не начислялось
 			return &models.Balance{Current: 0, Withdrawn: 0}, nil
 		}
-		return nil, fmt.Errorf("ошибка при получении ID пользователя: %w", err)
+		return nil, fmt.Errorf("ошибка при получении баланса: %w", err)
 	}
 
-	// Получаем сумму всех заказов и списаний
-	balanceQuery := `
-		SELECT
-			COALESCE(SUM(CASE WHEN type = 'ORDER' THEN value ELSE 0 END), 0) -
-			COALESCE(SUM(CASE WHEN type = 'WITHDRAW' THEN value ELSE 0 END), 0) as current,
-			COALESCE(SUM(CASE WHEN type = 'WITHDRAW' THEN value ELSE 0 END), 0) as withdrawn
-		FROM gophermart_orders
-		WHERE user_id = $1
+	return &balance, nil
+}
+
+// GetOrder возвращает заказ на начисление по номеру вместе с логином владельца
+func (st *OrderPostgresStorage) GetOrder(ctx context.Context, orderID string) (*models.Order, error) {
+	query := `
+		SELECT o.id, u.login, o.type, o.status, o.value, o.created_at, o.updated_at, o.processed_at, o.poll_attempts, o.not_registered_polls
+		FROM gophermart_orders o
+		JOIN gophermart_users u ON u.id = o.user_id
+		WHERE o.id = $1 AND o.type = $2
 	`
 
-	var balance models.Balance
-	err = st.db.db.QueryRow(balanceQuery, userID).Scan(&balance.Current, &balance.Withdrawn)
+	var order models.Order
+	var processedAt sql.NullTime
+	err := st.db.db.QueryRowContext(ctx, query, orderID, models.OrderType).Scan(&order.OrderID, &order.User, &order.Type,
+		&order.Status, &order.Value, &order.UploadedAt, &order.UpdatedAt, &processedAt, &order.PollAttempts, &order.NotRegisteredPolls)
 	if err != nil {
-		return nil, fmt.Errorf("ошибка при получении баланса: %w", err)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%w: ID %s", ErrOrderNotFound, orderID)
+		}
+		return nil, fmt.Errorf("ошибка при получении заказа: %w", err)
 	}
 
-	return &balance, nil
+	if processedAt.Valid {
+		order.ProcessedAt = &processedAt.Time
+	}
+
+	return &order, nil
 }
 
 // GetOrdersWithStatuses получает заказы с указанными статусами
-func (st *OrderPostgresStorage) GetOrdersWithStatuses(statuses []string) ([]models.Order, error) {
+func (st *OrderPostgresStorage) GetOrdersWithStatuses(ctx context.Context, statuses []string) ([]models.Order, error) {
 	if len(statuses) == 0 {
 		return []models.Order{}, nil
 	}
@@ -260,7 +303,7 @@ func (st *OrderPostgresStorage) GetOrdersWithStatuses(statuses []string) ([]mode
 		ORDER BY created_at ASC
 	`
 
-	rows, err := st.db.db.Query(query, statuses)
+	rows, err := st.db.db.QueryContext(ctx, query, statuses)
 	if err != nil {
 		return nil, fmt.Errorf("ошибка при получении заказов по статусам: %w", err)
 	}
@@ -270,9 +313,8 @@ func (st *OrderPostgresStorage) GetOrdersWithStatuses(statuses []string) ([]mode
 	for rows.Next() {
 		var order models.Order
 		var userID uint64
-		var createdAt time.Time
 
-		err := rows.Scan(&order.OrderID, &userID, &order.Type, &order.Status, &order.Value, &createdAt)
+		err := rows.Scan(&order.OrderID, &userID, &order.Type, &order.Status, &order.Value, &order.UploadedAt)
 		if err != nil {
 			return nil, fmt.Errorf("ошибка при сканировании заказа: %w", err)
 		}
@@ -280,14 +322,12 @@ func (st *OrderPostgresStorage) GetOrdersWithStatuses(statuses []string) ([]mode
 		// Получаем логин пользователя по ID
 		var userLogin string
 		userQuery := "SELECT login FROM gophermart_users WHERE id = $1"
-		err = st.db.db.QueryRow(userQuery, userID).Scan(&userLogin)
+		err = st.db.db.QueryRowContext(ctx, userQuery, userID).Scan(&userLogin)
 		if err != nil {
 			return nil, fmt.Errorf("ошибка при получении логина пользователя: %w", err)
 		}
 
-		// Устанавливаем пользователя и дату
 		order.User = userLogin
-		order.Date = createdAt.Format(time.RFC3339)
 
 		orders = append(orders, order)
 	}
@@ -299,78 +339,160 @@ func (st *OrderPostgresStorage) GetOrdersWithStatuses(statuses []string) ([]mode
 	return orders, nil
 }
 
-// UpdateOrderStatusAndValue обновляет статус и значение заказа
-func (st *OrderPostgresStorage) UpdateOrderStatusAndValue(orderID, status string, value uint64) error {
+// ClaimOrdersWithStatuses захватывает в аренду до limit заказов с указанными статусами,
+// срок опроса которых (next_poll_at) уже наступил. Заказы, захваченные другим экземпляром и еще не освобожденные, пропускаются
+// (FOR UPDATE SKIP LOCKED + poll_lease_until), поэтому параллельные экземпляры
+// получают непересекающиеся пачки. Аренда снимается при обновлении статуса заказа
+// либо истекает сама, если экземпляр упал, не закончив опрос
+func (st *OrderPostgresStorage) ClaimOrdersWithStatuses(ctx context.Context, statuses []string, limit int, lease time.Duration) ([]models.Order, error) {
+	if len(statuses) == 0 || limit <= 0 {
+		return []models.Order{}, nil
+	}
+
 	query := `
-		UPDATE gophermart_orders
-		SET status = $1, value = $2, updated_at = CURRENT_TIMESTAMP
-		WHERE id = $3
+		WITH claimed AS (
+			SELECT id
+			FROM gophermart_orders
+			WHERE status = ANY($1)
+			  AND type = $2
+			  AND next_poll_at <= CURRENT_TIMESTAMP
+			  AND (poll_lease_until IS NULL OR poll_lease_until < CURRENT_TIMESTAMP)
+			ORDER BY next_poll_at ASC
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		)
+		UPDATE gophermart_orders o
+		SET poll_lease_until = CURRENT_TIMESTAMP + $4::double precision * INTERVAL '1 second',
+		    poll_lease_token = o.poll_lease_token + 1
+		FROM claimed, gophermart_users u
+		WHERE o.id = claimed.id AND u.id = o.user_id
+		RETURNING o.id, u.login, o.type, o.status, o.value, o.created_at, o.poll_attempts, o.not_registered_polls, o.poll_lease_token
 	`
 
-	result, err := st.db.db.Exec(query, status, value, orderID)
+	rows, err := st.db.db.QueryContext(ctx, query, statuses, models.OrderType, limit, lease.Seconds())
 	if err != nil {
-		return fmt.Errorf("ошибка при обновлении статуса заказа: %w", err)
+		return nil, fmt.Errorf("ошибка при захвате заказов для опроса: %w", err)
 	}
+	defer rows.Close()
 
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return fmt.Errorf("ошибка при получении количества обновленных строк: %w", err)
+	var orders []models.Order
+	for rows.Next() {
+		var order models.Order
+
+		err := rows.Scan(&order.OrderID, &order.User, &order.Type, &order.Status, &order.Value, &order.UploadedAt,
+			&order.PollAttempts, &order.NotRegisteredPolls, &order.LeaseToken)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании заказа: %w", err)
+		}
+
+		orders = append(orders, order)
 	}
 
-	if rowsAffected == 0 {
-		return fmt.Errorf("заказ с ID %s не найден", orderID)
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при итерации по заказам: %w", err)
 	}
 
-	return nil
+	return orders, nil
 }
 
-// GetWithdrawals получает историю выводов средств пользователя
-func (st *OrderPostgresStorage) GetWithdrawals(user models.User) ([]models.Order, error) {
-	// Получаем ID пользователя
-	var userID uint64
-	query := "SELECT id FROM gophermart_users WHERE login = $1"
-	err := st.db.db.QueryRow(query, user.Login).Scan(&userID)
+// UpdateOrderStatusAndValue обновляет статус и значение заказа.
+// Переход статуса проверяется атомарно условием на текущий статус в самом UPDATE,
+// поэтому конкурирующие обновления не могут вернуть заказ в предыдущий статус.
+// Начисление по обработанному заказу зачисляется на баланс и в леджер в той же транзакции
+func (st *OrderPostgresStorage) UpdateOrderStatusAndValue(ctx context.Context, orderID, status string, value money.Amount) error {
+	allowedFrom := models.StatusesBefore(status)
+	if len(allowedFrom) == 0 {
+		return fmt.Errorf("%w: в статус %s", models.ErrIllegalStatusTransition, status)
+	}
+
+	tx, err := st.db.db.BeginTx(ctx, nil)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return []models.Order{}, nil
-		}
-		return nil, fmt.Errorf("ошибка при получении ID пользователя: %w", err)
+		return fmt.Errorf("ошибка при начале транзакции: %w", err)
 	}
+	// После Commit откат ничего не делает
+	defer tx.Rollback()
 
-	// Получаем только операции списания
-	withdrawalsQuery := `
-		SELECT id, type, status, value, created_at
-		FROM gophermart_orders
-		WHERE user_id = $1 AND type = $2
-		ORDER BY created_at DESC
+	query := `
+		UPDATE gophermart_orders
+		SET status = $1, value = $2, updated_at = CURRENT_TIMESTAMP,
+		    processed_at = CASE WHEN $6 THEN CURRENT_TIMESTAMP ELSE NULL END,
+		    poll_lease_until = NULL, poll_attempts = 0, not_registered_polls = 0, next_poll_at = CURRENT_TIMESTAMP
+		WHERE id = $3 AND type = $4 AND status = ANY($5)
+		RETURNING user_id
 	`
 
-	rows, err := st.db.db.Query(withdrawalsQuery, userID, models.WithdrawType)
+	var userID uint64
+	err = tx.QueryRowContext(ctx, query, status, value, orderID, models.OrderType, allowedFrom, models.IsFinalStatus(status)).Scan(&userID)
 	if err != nil {
-		return nil, fmt.Errorf("ошибка при получении истории выводов: %w", err)
-	}
-	defer rows.Close()
-
-	var withdrawals []models.Order
-	for rows.Next() {
-		var withdrawal models.Order
-		var createdAt time.Time
+		if !errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("ошибка при обновлении статуса заказа: %w", err)
+		}
 
-		err := rows.Scan(&withdrawal.OrderID, &withdrawal.Type, &withdrawal.Status, &withdrawal.Value, &createdAt)
+		// Выясняем, отсутствует заказ или переход статуса недопустим
+		var currentStatus string
+		err = tx.QueryRowContext(ctx, "SELECT status FROM gophermart_orders WHERE id = $1", orderID).Scan(&currentStatus)
 		if err != nil {
-			return nil, fmt.Errorf("ошибка при сканировании вывода: %w", err)
+			if errors.Is(err, sql.ErrNoRows) {
+				return fmt.Errorf("%w: ID %s", ErrOrderNotFound, orderID)
+			}
+			return fmt.Errorf("ошибка при проверке статуса заказа: %w", err)
 		}
+		return fmt.Errorf("%w: %s -> %s", models.ErrIllegalStatusTransition, currentStatus, status)
+	}
 
-		// Устанавливаем пользователя и дату
-		withdrawal.User = user.Login
-		withdrawal.Date = createdAt.Format(time.RFC3339)
+	if status == models.OrderStatusProcessed && value > 0 {
+		if err = creditBalance(ctx, tx, userID, value); err != nil {
+			return err
+		}
+		if err = postLedgerTransfer(ctx, tx, userID, orderID, ledgerAccountAccrual, ledgerAccountUser, value); err != nil {
+			return err
+		}
+	}
 
-		withdrawals = append(withdrawals, withdrawal)
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("ошибка при подтверждении транзакции: %w", err)
 	}
 
-	if err = rows.Err(); err != nil {
-		return nil, fmt.Errorf("ошибка при итерации по выводам: %w", err)
+	return nil
+}
+
+// PostponeOrderPoll откладывает следующий опрос заказа на delay,
+// увеличивает счетчик попыток и снимает аренду. Счетчик ответов "не зарегистрирован"
+// увеличивается при notRegistered и сбрасывается в остальных случаях.
+// Заказ меняется, только пока действует аренда leaseToken: обработчик, цикл которого пережил аренду,
+// не должен сдвигать расписание заказа, уже захваченного другим экземпляром
+func (st *OrderPostgresStorage) PostponeOrderPoll(ctx context.Context, orderID string, leaseToken int64, delay time.Duration, notRegistered bool) error {
+	query := `
+		UPDATE gophermart_orders
+		SET next_poll_at = CURRENT_TIMESTAMP + $1::double precision * INTERVAL '1 second',
+		    poll_attempts = poll_attempts + 1,
+		    not_registered_polls = CASE WHEN $3 THEN not_registered_polls + 1 ELSE 0 END,
+		    poll_lease_until = NULL
+		WHERE id = $2 AND poll_lease_token = $4 AND poll_lease_until > CURRENT_TIMESTAMP
+	`
+
+	result, err := st.db.db.ExecContext(ctx, query, delay.Seconds(), orderID, notRegistered, leaseToken)
+	if err != nil {
+		return fmt.Errorf("ошибка при переносе опроса заказа: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("ошибка при получении количества обновленных строк: %w", err)
 	}
 
-	return withdrawals, nil
+	if rowsAffected == 0 {
+		// Выясняем, отсутствует заказ или аренда потеряна
+		var exists bool
+		err = st.db.db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM gophermart_orders WHERE id = $1)", orderID).Scan(&exists)
+		if err != nil {
+			return fmt.Errorf("ошибка при проверке заказа: %w", err)
+		}
+		if !exists {
+			return fmt.Errorf("%w: ID %s", ErrOrderNotFound, orderID)
+		}
+		return fmt.Errorf("%w: ID %s", ErrLeaseLost, orderID)
+	}
+
+	return nil
 }
@@ -0,0 +1,134 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/paxren/go-musthave-diploma-tpl/internal/models"
+)
+
+// newTestPostgres подключается к тестовой базе из TEST_DATABASE_URI
+// или пропускает тест, если переменная не задана
+func newTestPostgres(t *testing.T) *PostgresConnection {
+	t.Helper()
+
+	uri := os.Getenv("TEST_DATABASE_URI")
+	if uri == "" {
+		t.Skip("TEST_DATABASE_URI не задан, тест с PostgreSQL пропущен")
+	}
+
+	migrationsSource = "file://../../migrations"
+	pc, err := MakePostgresStorage(uri)
+	require.NoError(t, err)
+	t.Cleanup(func() { pc.Close() })
+
+	return pc
+}
+
+// newTestUser регистрирует пользователя с уникальным логином и удаляет его после теста
+func newTestUser(t *testing.T, pc *PostgresConnection) models.User {
+	t.Helper()
+	ctx := context.Background()
+
+	users := MakeUserPostgresStorage(pc)
+	user := models.User{
+		Login:    fmt.Sprintf("test-%s-%d", t.Name(), time.Now().UnixNano()),
+		Password: "password",
+	}
+	require.NoError(t, users.RegisterUser(ctx, user))
+
+	registered := users.GetUser(ctx, user.Login)
+	require.NotNil(t, registered)
+
+	t.Cleanup(func() {
+		pc.db.Exec("DELETE FROM gophermart_users WHERE id = $1", *registered.UserID)
+	})
+
+	return *registered
+}
+
+// luhnNumber дополняет base контрольной цифрой по алгоритму Луна
+func luhnNumber(base string) string {
+	for d := 0; d <= 9; d++ {
+		candidate := base + strconv.Itoa(d)
+		if models.LunaCheck(candidate) {
+			return candidate
+		}
+	}
+	panic("контрольная цифра не найдена")
+}
+
+func TestOrderPostgresStorage_ConcurrentWithdrawals(t *testing.T) {
+	pc := newTestPostgres(t)
+	pc.db.SetMaxOpenConns(20)
+
+	ctx := context.Background()
+	orders := MakeOrderPostgresStorage(pc)
+	user := newTestUser(t, pc)
+
+	// Начисляем пользователю 100 баллов (10000 копеек)
+	prefix := strconv.FormatInt(time.Now().UnixNano(), 10)
+	accrualOrder := *models.MakeNewOrder(user, luhnNumber(prefix+"0000"))
+	require.NoError(t, orders.AddOrder(ctx, *user.UserID, accrualOrder))
+	require.NoError(t, orders.UpdateOrderStatusAndValue(ctx, accrualOrder.OrderID, models.OrderStatusProcessed, 10000))
+
+	// Одновременно пытаемся списать по 1 баллу 300 раз
+	const withdrawals = 300
+	const sum = 100
+
+	var succeeded, rejected atomic.Int64
+	var wg sync.WaitGroup
+	errs := make(chan error, withdrawals)
+
+	for i := 0; i < withdrawals; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			withdraw := *models.MakeWithdraw(user, luhnNumber(fmt.Sprintf("%s1%03d", prefix, i)), sum)
+			err := orders.AddOrder(ctx, *user.UserID, withdraw)
+			switch {
+			case err == nil:
+				succeeded.Add(1)
+			case errors.Is(err, ErrIncafitionFunds):
+				rejected.Add(1)
+			default:
+				errs <- err
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("неожиданная ошибка списания: %v", err)
+	}
+
+	// Ровно 100 списаний проходят, баланс не уходит в минус
+	assert.EqualValues(t, 100, succeeded.Load())
+	assert.EqualValues(t, withdrawals-100, rejected.Load())
+
+	balance, err := orders.GetBalance(ctx, *user.UserID)
+	require.NoError(t, err)
+	assert.EqualValues(t, 0, balance.Current)
+	assert.EqualValues(t, 10000, balance.Withdrawn)
+
+	// Сумма проводок по счету пользователя совпадает с балансом
+	var ledgerSum int64
+	err = pc.db.QueryRow(
+		"SELECT COALESCE(SUM(amount), 0) FROM gophermart_ledger WHERE user_id = $1 AND account = $2",
+		*user.UserID, ledgerAccountUser,
+	).Scan(&ledgerSum)
+	require.NoError(t, err)
+	assert.EqualValues(t, 0, ledgerSum)
+}
@@ -0,0 +1,464 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/paxren/go-musthave-diploma-tpl/internal/models"
+	"github.com/paxren/go-musthave-diploma-tpl/internal/money"
+)
+
+// OrderSQLiteStorage хранилище заказов, балансов и леджера в SQLite. Повторяет поведение
+// OrderPostgresStorage. Блокировки строк в SQLite нет, вместо нее транзакции выполняются
+// по очереди через единственное соединение SQLiteConnection
+type OrderSQLiteStorage struct {
+	db *SQLiteConnection
+}
+
+func MakeOrderSQLiteStorage(sc *SQLiteConnection) *OrderSQLiteStorage {
+	return &OrderSQLiteStorage{
+		db: sc,
+	}
+}
+
+func (st *OrderSQLiteStorage) AddOrder(ctx context.Context, userID uint64, order models.Order) error {
+	// Проверяем корректность номера заказа по алгоритму Луна
+	if !models.LunaCheck(order.OrderID) {
+		return ErrBadOrderID
+	}
+
+	now := st.db.now()
+	if order.UploadedAt.IsZero() {
+		order.UploadedAt = now
+	}
+	uploadedAt := toSQLiteTime(order.UploadedAt)
+
+	return st.db.withTx(ctx, func(tx *sql.Tx) error {
+		var existingUserID uint64
+		err := tx.QueryRowContext(ctx, "SELECT user_id FROM gophermart_orders WHERE id = ?", order.OrderID).Scan(&existingUserID)
+		if err == nil {
+			if existingUserID == userID {
+				return ErrOrderExistThisUser
+			}
+			return ErrOrderExistAnotherUser
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("ошибка при проверке существования заказа: %w", err)
+		}
+
+		if order.Type != models.OrderType && order.Type != models.WithdrawType {
+			return ErrOrderType
+		}
+
+		// Списание сразу считается обработанным
+		var processedAt interface{}
+		if order.Type == models.WithdrawType {
+			processedAt = uploadedAt
+		}
+
+		insertQuery := `
+			INSERT INTO gophermart_orders (id, user_id, type, status, value, created_at, updated_at, processed_at, next_poll_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`
+		_, err = tx.ExecContext(ctx, insertQuery, order.OrderID, userID, order.Type, order.Status, order.Value,
+			uploadedAt, uploadedAt, processedAt, toSQLiteTime(now))
+		if err != nil {
+			return fmt.Errorf("ошибка при добавлении заказа: %w", err)
+		}
+
+		if order.Type != models.WithdrawType {
+			return nil
+		}
+
+		// Списываем баллы с баланса, при нехватке средств транзакция откатывается вместе с заказом
+		if err = sqliteDebitBalance(ctx, tx, userID, order.Value, now); err != nil {
+			return err
+		}
+		return sqlitePostLedgerTransfer(ctx, tx, userID, order.OrderID, ledgerAccountUser, ledgerAccountWithdrawal, order.Value, now)
+	})
+}
+
+// GetOrders получает страницу заказов пользователя с теми же фильтрами,
+// порядком (created_at, id) и курсором, что и OrderPostgresStorage
+func (st *OrderSQLiteStorage) GetOrders(ctx context.Context, userID uint64, query models.OrderQuery) (*models.OrderPage, error) {
+	conditions := []string{"user_id = ?"}
+	args := []interface{}{userID}
+
+	if query.Type != "" {
+		conditions = append(conditions, "type = ?")
+		args = append(args, query.Type)
+	}
+	if len(query.Statuses) > 0 {
+		placeholders, statusArgs := sqliteInList(query.Statuses)
+		conditions = append(conditions, "status IN ("+placeholders+")")
+		args = append(args, statusArgs...)
+	}
+	if !query.From.IsZero() {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, toSQLiteTime(query.From))
+	}
+	if !query.To.IsZero() {
+		conditions = append(conditions, "created_at < ?")
+		args = append(args, toSQLiteTime(query.To))
+	}
+
+	direction, comparison := "DESC", "<"
+	if query.Ascending {
+		direction, comparison = "ASC", ">"
+	}
+	if query.After != nil {
+		conditions = append(conditions, "(created_at, id) "+comparison+" (?, ?)")
+		args = append(args, toSQLiteTime(query.After.CreatedAt), query.After.OrderID)
+	}
+
+	ordersQuery := fmt.Sprintf(`
+		SELECT id, type, status, value, created_at, updated_at, processed_at
+		FROM gophermart_orders
+		WHERE %s
+		ORDER BY created_at %s, id %s
+	`, strings.Join(conditions, " AND "), direction, direction)
+
+	// Запрашиваем на одну запись больше, чтобы узнать, есть ли следующая страница
+	if query.Limit > 0 {
+		ordersQuery += "LIMIT ?"
+		args = append(args, query.Limit+1)
+	}
+
+	rows, err := st.db.db.QueryContext(ctx, ordersQuery, args...)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении заказов: %w", err)
+	}
+	defer rows.Close()
+
+	page := &models.OrderPage{}
+	for rows.Next() {
+		var order models.Order
+		var createdAt, updatedAt int64
+		var processedAt sql.NullInt64
+
+		err := rows.Scan(&order.OrderID, &order.Type, &order.Status, &order.Value, &createdAt, &updatedAt, &processedAt)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании заказа: %w", err)
+		}
+
+		if query.Limit > 0 && len(page.Orders) == query.Limit {
+			last := page.Orders[len(page.Orders)-1]
+			page.Next = &models.OrderCursor{CreatedAt: last.UploadedAt, OrderID: last.OrderID}
+			break
+		}
+
+		order.UploadedAt = fromSQLiteTime(createdAt)
+		order.UpdatedAt = fromSQLiteTime(updatedAt)
+		order.ProcessedAt = fromSQLiteNullTime(processedAt)
+		page.Orders = append(page.Orders, order)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при итерации по заказам: %w", err)
+	}
+
+	return page, nil
+}
+
+func (st *OrderSQLiteStorage) GetBalance(ctx context.Context, userID uint64) (*models.Balance, error) {
+	var balance models.Balance
+	query := "SELECT current, withdrawn FROM gophermart_balances WHERE user_id = ?"
+	err := st.db.db.QueryRowContext(ctx, query, userID).Scan(&balance.Current, &balance.Withdrawn)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			// Пользователю еще ничего не начислялось
+			return &models.Balance{}, nil
+		}
+		return nil, fmt.Errorf("ошибка при получении баланса: %w", err)
+	}
+
+	return &balance, nil
+}
+
+// GetOrder возвращает заказ на начисление по номеру вместе с логином владельца
+func (st *OrderSQLiteStorage) GetOrder(ctx context.Context, orderID string) (*models.Order, error) {
+	query := `
+		SELECT o.id, u.login, o.type, o.status, o.value, o.created_at, o.updated_at, o.processed_at, o.poll_attempts, o.not_registered_polls
+		FROM gophermart_orders o
+		JOIN gophermart_users u ON u.id = o.user_id
+		WHERE o.id = ? AND o.type = ?
+	`
+
+	var order models.Order
+	var createdAt, updatedAt int64
+	var processedAt sql.NullInt64
+	err := st.db.db.QueryRowContext(ctx, query, orderID, models.OrderType).Scan(&order.OrderID, &order.User, &order.Type,
+		&order.Status, &order.Value, &createdAt, &updatedAt, &processedAt, &order.PollAttempts, &order.NotRegisteredPolls)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%w: ID %s", ErrOrderNotFound, orderID)
+		}
+		return nil, fmt.Errorf("ошибка при получении заказа: %w", err)
+	}
+
+	order.UploadedAt = fromSQLiteTime(createdAt)
+	order.UpdatedAt = fromSQLiteTime(updatedAt)
+	order.ProcessedAt = fromSQLiteNullTime(processedAt)
+	return &order, nil
+}
+
+// GetOrdersWithStatuses получает заказы с указанными статусами от старых к новым
+func (st *OrderSQLiteStorage) GetOrdersWithStatuses(ctx context.Context, statuses []string) ([]models.Order, error) {
+	if len(statuses) == 0 {
+		return []models.Order{}, nil
+	}
+
+	placeholders, args := sqliteInList(statuses)
+	query := `
+		SELECT o.id, u.login, o.type, o.status, o.value, o.created_at
+		FROM gophermart_orders o
+		JOIN gophermart_users u ON u.id = o.user_id
+		WHERE o.status IN (` + placeholders + `)
+		ORDER BY o.created_at ASC
+	`
+
+	rows, err := st.db.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении заказов по статусам: %w", err)
+	}
+	defer rows.Close()
+
+	orders, err := scanSQLiteOrders(rows)
+	if err != nil {
+		return nil, err
+	}
+	return orders, nil
+}
+
+// ClaimOrdersWithStatuses захватывает в аренду до limit заказов с указанными статусами,
+// срок опроса которых уже наступил. Выборка и захват выполняются в одной транзакции,
+// поэтому два опрашивающих обработчика не получат один и тот же заказ
+func (st *OrderSQLiteStorage) ClaimOrdersWithStatuses(ctx context.Context, statuses []string, limit int, lease time.Duration) ([]models.Order, error) {
+	if len(statuses) == 0 || limit <= 0 {
+		return []models.Order{}, nil
+	}
+
+	now := toSQLiteTime(st.db.now())
+	placeholders, args := sqliteInList(statuses)
+	args = append(args, models.OrderType, now, now, limit)
+	query := `
+		SELECT o.id, u.login, o.type, o.status, o.value, o.created_at, o.poll_attempts, o.not_registered_polls
+		FROM gophermart_orders o
+		JOIN gophermart_users u ON u.id = o.user_id
+		WHERE o.status IN (` + placeholders + `)
+		  AND o.type = ?
+		  AND o.next_poll_at <= ?
+		  AND (o.poll_lease_until IS NULL OR o.poll_lease_until < ?)
+		ORDER BY o.next_poll_at ASC
+		LIMIT ?
+	`
+
+	var orders []models.Order
+	err := st.db.withTx(ctx, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, query, args...)
+		if err != nil {
+			return fmt.Errorf("ошибка при захвате заказов для опроса: %w", err)
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var order models.Order
+			var createdAt int64
+			err := rows.Scan(&order.OrderID, &order.User, &order.Type, &order.Status, &order.Value, &createdAt,
+				&order.PollAttempts, &order.NotRegisteredPolls)
+			if err != nil {
+				return fmt.Errorf("ошибка при сканировании заказа: %w", err)
+			}
+			order.UploadedAt = fromSQLiteTime(createdAt)
+			orders = append(orders, order)
+		}
+		if err = rows.Err(); err != nil {
+			return fmt.Errorf("ошибка при итерации по заказам: %w", err)
+		}
+		rows.Close()
+
+		leaseUntil := now + lease.Microseconds()
+		for i := range orders {
+			leaseQuery := `
+				UPDATE gophermart_orders SET poll_lease_until = ?, poll_lease_token = poll_lease_token + 1
+				WHERE id = ?
+				RETURNING poll_lease_token
+			`
+			if err = tx.QueryRowContext(ctx, leaseQuery, leaseUntil, orders[i].OrderID).Scan(&orders[i].LeaseToken); err != nil {
+				return fmt.Errorf("ошибка при захвате заказа для опроса: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return orders, nil
+}
+
+// UpdateOrderStatusAndValue обновляет статус и значение заказа.
+// Переход статуса проверяется условием на текущий статус в самом UPDATE.
+// Начисление по обработанному заказу зачисляется на баланс и в леджер в той же транзакции
+func (st *OrderSQLiteStorage) UpdateOrderStatusAndValue(ctx context.Context, orderID, status string, value money.Amount) error {
+	allowedFrom := models.StatusesBefore(status)
+	if len(allowedFrom) == 0 {
+		return fmt.Errorf("%w: в статус %s", models.ErrIllegalStatusTransition, status)
+	}
+
+	now := st.db.now()
+	var processedAt interface{}
+	if models.IsFinalStatus(status) {
+		processedAt = toSQLiteTime(now)
+	}
+
+	placeholders, statusArgs := sqliteInList(allowedFrom)
+	args := append([]interface{}{status, value, toSQLiteTime(now), processedAt, toSQLiteTime(now), orderID, models.OrderType}, statusArgs...)
+	query := `
+		UPDATE gophermart_orders
+		SET status = ?, value = ?, updated_at = ?, processed_at = ?,
+		    poll_lease_until = NULL, poll_attempts = 0, not_registered_polls = 0, next_poll_at = ?
+		WHERE id = ? AND type = ? AND status IN (` + placeholders + `)
+		RETURNING user_id
+	`
+
+	return st.db.withTx(ctx, func(tx *sql.Tx) error {
+		var userID uint64
+		err := tx.QueryRowContext(ctx, query, args...).Scan(&userID)
+		if err != nil {
+			if !errors.Is(err, sql.ErrNoRows) {
+				return fmt.Errorf("ошибка при обновлении статуса заказа: %w", err)
+			}
+
+			// Выясняем, отсутствует заказ или переход статуса недопустим
+			var currentStatus string
+			err = tx.QueryRowContext(ctx, "SELECT status FROM gophermart_orders WHERE id = ?", orderID).Scan(&currentStatus)
+			if err != nil {
+				if errors.Is(err, sql.ErrNoRows) {
+					return fmt.Errorf("%w: ID %s", ErrOrderNotFound, orderID)
+				}
+				return fmt.Errorf("ошибка при проверке статуса заказа: %w", err)
+			}
+			return fmt.Errorf("%w: %s -> %s", models.ErrIllegalStatusTransition, currentStatus, status)
+		}
+
+		if status != models.OrderStatusProcessed || value == 0 {
+			return nil
+		}
+		if err = sqliteCreditBalance(ctx, tx, userID, value, now); err != nil {
+			return err
+		}
+		return sqlitePostLedgerTransfer(ctx, tx, userID, orderID, ledgerAccountAccrual, ledgerAccountUser, value, now)
+	})
+}
+
+// PostponeOrderPoll откладывает следующий опрос заказа на delay, пока действует аренда leaseToken,
+// по тем же правилам, что и OrderPostgresStorage
+func (st *OrderSQLiteStorage) PostponeOrderPoll(ctx context.Context, orderID string, leaseToken int64, delay time.Duration, notRegistered bool) error {
+	now := st.db.now()
+	query := `
+		UPDATE gophermart_orders
+		SET next_poll_at = ?, poll_attempts = poll_attempts + 1,
+		    not_registered_polls = CASE WHEN ? THEN not_registered_polls + 1 ELSE 0 END,
+		    poll_lease_until = NULL
+		WHERE id = ? AND poll_lease_token = ? AND poll_lease_until > ?
+	`
+
+	result, err := st.db.db.ExecContext(ctx, query, toSQLiteTime(now.Add(delay)), notRegistered, orderID, leaseToken, toSQLiteTime(now))
+	if err != nil {
+		return fmt.Errorf("ошибка при переносе опроса заказа: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("ошибка при получении количества обновленных строк: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		// Выясняем, отсутствует заказ или аренда потеряна
+		var exists bool
+		err = st.db.db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM gophermart_orders WHERE id = ?)", orderID).Scan(&exists)
+		if err != nil {
+			return fmt.Errorf("ошибка при проверке заказа: %w", err)
+		}
+		if !exists {
+			return fmt.Errorf("%w: ID %s", ErrOrderNotFound, orderID)
+		}
+		return fmt.Errorf("%w: ID %s", ErrLeaseLost, orderID)
+	}
+
+	return nil
+}
+
+// scanSQLiteOrders читает заказы с логином владельца и временем создания
+func scanSQLiteOrders(rows *sql.Rows) ([]models.Order, error) {
+	var orders []models.Order
+	for rows.Next() {
+		var order models.Order
+		var createdAt int64
+		if err := rows.Scan(&order.OrderID, &order.User, &order.Type, &order.Status, &order.Value, &createdAt); err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании заказа: %w", err)
+		}
+		order.UploadedAt = fromSQLiteTime(createdAt)
+		orders = append(orders, order)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при итерации по заказам: %w", err)
+	}
+	return orders, nil
+}
+
+// sqlitePostLedgerTransfer записывает в леджер перевод amount со счета from на счет to двумя проводками
+func sqlitePostLedgerTransfer(ctx context.Context, tx *sql.Tx, userID uint64, orderID, from, to string, amount money.Amount, now time.Time) error {
+	query := `
+		INSERT INTO gophermart_ledger (user_id, order_id, account, amount, created_at)
+		VALUES (?1, ?2, ?3, ?4, ?7), (?1, ?2, ?5, ?6, ?7)
+	`
+	_, err := tx.ExecContext(ctx, query, userID, orderID, from, -int64(amount), to, int64(amount), toSQLiteTime(now))
+	if err != nil {
+		return fmt.Errorf("ошибка при записи проводок в леджер: %w", err)
+	}
+	return nil
+}
+
+// sqliteCreditBalance зачисляет amount на баланс пользователя, создавая строку баланса при необходимости
+func sqliteCreditBalance(ctx context.Context, tx *sql.Tx, userID uint64, amount money.Amount, now time.Time) error {
+	query := `
+		INSERT INTO gophermart_balances (user_id, current, withdrawn, updated_at)
+		VALUES (?, ?, 0, ?)
+		ON CONFLICT (user_id) DO UPDATE
+		SET current = current + excluded.current, updated_at = excluded.updated_at
+	`
+	if _, err := tx.ExecContext(ctx, query, userID, amount, toSQLiteTime(now)); err != nil {
+		return fmt.Errorf("ошибка при зачислении на баланс: %w", err)
+	}
+	return nil
+}
+
+// sqliteDebitBalance списывает amount с баланса пользователя.
+// Проверка достаточности средств выполняется условием самого UPDATE
+func sqliteDebitBalance(ctx context.Context, tx *sql.Tx, userID uint64, amount money.Amount, now time.Time) error {
+	query := `
+		UPDATE gophermart_balances
+		SET current = current - ?1, withdrawn = withdrawn + ?1, updated_at = ?3
+		WHERE user_id = ?2 AND current >= ?1
+	`
+	result, err := tx.ExecContext(ctx, query, amount, userID, toSQLiteTime(now))
+	if err != nil {
+		return fmt.Errorf("ошибка при списании с баланса: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("ошибка при получении количества обновленных строк: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrIncafitionFunds
+	}
+	return nil
+}
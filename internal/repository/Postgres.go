@@ -7,6 +7,7 @@ import (
 	"log/slog"
 	"time"
 
+	"github.com/jackc/pgx/v5/pgconn"
 	_ "github.com/jackc/pgx/v5/stdlib"
 
 	"github.com/golang-migrate/migrate/v4"
@@ -14,11 +15,57 @@ import (
 	_ "github.com/golang-migrate/migrate/v4/source/file"
 )
 
+// Коды ошибок PostgreSQL (SQLSTATE), которые обрабатываются отдельно
+const (
+	pgCodeUniqueViolation      = "23505"
+	pgCodeSerializationFailure = "40001"
+	pgCodeDeadlockDetected     = "40P01"
+)
+
+// maxTxRetries количество попыток выполнить транзакцию, прерванную из-за конфликта параллельных транзакций
+const maxTxRetries = 5
+
+// migrationsSource расположение файлов миграций
+var migrationsSource = "file://./migrations"
+
 type PostgresConnection struct {
 	db *sql.DB
 }
 
 func MakePostgresStorage(con string) (*PostgresConnection, error) {
+	db, err := OpenPostgres(con, migrationsSource, "schema_migrations_gophermart")
+	if err != nil {
+		return nil, err
+	}
+
+	// Нормализованные логины заполняются в Go, так как в SQL нет такой же свертки регистра
+	if err = backfillLoginNormalized(context.Background(), db); err != nil {
+		slog.Default().Error("Ошибка при заполнении нормализованных логинов", "error", err)
+		db.Close()
+		return nil, err
+	}
+
+	// Отрицательные балансы, перенесенные из старой истории, не мешают запуску, но о них сообщается,
+	// чтобы их разобрали вручную
+	overdrawn, err := ensureBalanceCheck(context.Background(), db)
+	if err != nil {
+		slog.Default().Error("Ошибка при проверке балансов пользователей", "error", err)
+		db.Close()
+		return nil, err
+	}
+	for _, balance := range overdrawn {
+		slog.Default().Warn("Отрицательный баланс пользователя, ограничение current >= 0 не добавлено",
+			"user_id", balance.userID,
+			"login", balance.login,
+			"current", balance.current)
+	}
+	return &PostgresConnection{db: db}, nil
+}
+
+// OpenPostgres открывает соединение с PostgreSQL и применяет миграции из source.
+// migrationsTable - имя таблицы версий миграций, у каждого сервиса своя,
+// поэтому сервисы могут использовать одну базу данных
+func OpenPostgres(con, source, migrationsTable string) (*sql.DB, error) {
 	logger := slog.Default()
 
 	logger.Info("Подключение к PostgreSQL", "step", 1)
@@ -36,7 +83,7 @@ func MakePostgresStorage(con string) (*PostgresConnection, error) {
 	logger.Info("Создание конфигурации для миграций", "step", 2)
 	// Создаем конфигурацию для драйвера PostgreSQL с кастомным именем таблицы миграций
 	postgresConfig := &postgres.Config{
-		MigrationsTable: "schema_migrations_gophermart",
+		MigrationsTable: migrationsTable,
 	}
 
 	driver, err := postgres.WithInstance(db, postgresConfig)
@@ -47,7 +94,7 @@ func MakePostgresStorage(con string) (*PostgresConnection, error) {
 
 	logger.Info("Инициализация миграций", "step", 3)
 	m, err := migrate.NewWithDatabaseInstance(
-		"file://./migrations",
+		source,
 		"postgres", driver)
 	if err != nil {
 		logger.Error("Ошибка при инициализации миграций", "error", err)
@@ -70,7 +117,7 @@ func MakePostgresStorage(con string) (*PostgresConnection, error) {
 	}
 
 	logger.Info("PostgreSQL успешно инициализирован")
-	return &PostgresConnection{db: db}, nil
+	return db, nil
 }
 
 func (ps *PostgresConnection) Close() error {
@@ -86,3 +133,41 @@ func (ps *PostgresConnection) Close() error {
 	logger.Info("Соединение с PostgreSQL успешно закрыто")
 	return nil
 }
+
+// pgErrorCode возвращает код SQLSTATE ошибки PostgreSQL или пустую строку
+func pgErrorCode(err error) string {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code
+	}
+	return ""
+}
+
+// isRetryableTxError проверяет, была ли транзакция прервана из-за конфликта
+// с параллельной транзакцией и может быть безопасно повторена
+func isRetryableTxError(err error) bool {
+	code := pgErrorCode(err)
+	return code == pgCodeSerializationFailure || code == pgCodeDeadlockDetected
+}
+
+// retryTx выполняет fn, повторяя ее при ошибках сериализации и взаимных блокировках.
+// fn должна целиком выполнять транзакцию: начинать, откатывать и подтверждать ее
+func retryTx(ctx context.Context, fn func() error) error {
+	var err error
+	for attempt := 0; attempt < maxTxRetries; attempt++ {
+		err = fn()
+		if !isRetryableTxError(err) {
+			return err
+		}
+
+		slog.Default().Debug("Повтор транзакции после конфликта", "attempt", attempt+1, "error", err)
+
+		// Небольшая растущая пауза, чтобы конфликтующие транзакции разошлись
+		select {
+		case <-time.After(time.Duration(attempt+1) * 10 * time.Millisecond):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return err
+}
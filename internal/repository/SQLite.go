@@ -0,0 +1,176 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database/sqlite"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+)
+
+// sqliteMigrations миграции схемы SQLite встроены в бинарный файл,
+// поэтому файл базы можно создать в любом каталоге без исходников
+//
+//go:embed migrations_sqlite/*.sql
+var sqliteMigrations embed.FS
+
+// sqliteBusyTimeout сколько ждать снятия блокировки файла базы другим процессом
+const sqliteBusyTimeout = 5 * time.Second
+
+// SQLiteConnection соединение с файлом базы SQLite.
+// Соединение с базой одно, поэтому транзакции выполняются строго по очереди:
+// этого достаточно для демонстрации и локальной разработки и избавляет от конфликтов блокировок.
+// Внутри транзакции все запросы должны идти через нее, запрос мимо транзакции будет ждать вечно
+type SQLiteConnection struct {
+	db  *sql.DB
+	now func() time.Time
+}
+
+// MakeSQLiteStorage открывает файл базы SQLite, создавая его при необходимости,
+// и применяет встроенные миграции
+func MakeSQLiteStorage(path string) (*SQLiteConnection, error) {
+	logger := slog.Default()
+
+	logger.Info("Подключение к SQLite", "path", path, "step", 1)
+	db, err := sql.Open("sqlite", sqliteDSN(path))
+	if err != nil {
+		logger.Error("Ошибка при открытии файла SQLite", "error", err)
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			db.Close()
+		}
+	}()
+	db.SetMaxOpenConns(1)
+
+	logger.Info("Создание конфигурации для миграций", "step", 2)
+	driver, err := sqlite.WithInstance(db, &sqlite.Config{
+		MigrationsTable: "schema_migrations_gophermart",
+	})
+	if err != nil {
+		logger.Error("Ошибка при создании конфигурации для миграций", "error", err)
+		return nil, err
+	}
+
+	source, err := iofs.New(sqliteMigrations, "migrations_sqlite")
+	if err != nil {
+		logger.Error("Ошибка при чтении встроенных миграций", "error", err)
+		return nil, err
+	}
+
+	logger.Info("Инициализация миграций", "step", 3)
+	m, err := migrate.NewWithInstance("iofs", source, "sqlite", driver)
+	if err != nil {
+		logger.Error("Ошибка при инициализации миграций", "error", err)
+		return nil, err
+	}
+
+	logger.Info("Применение миграций", "step", 4)
+	err = m.Up()
+	if err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		logger.Error("Ошибка при применении миграций", "error", err)
+		return nil, err
+	}
+
+	logger.Info("Проверка соединения с базой данных", "step", 5)
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+	if err = db.PingContext(ctx); err != nil {
+		logger.Error("Ошибка при проверке соединения с базой данных", "error", err)
+		return nil, err
+	}
+
+	logger.Info("SQLite успешно инициализирована", "path", path)
+	return &SQLiteConnection{db: db, now: time.Now}, nil
+}
+
+// sqliteDSN строит строку подключения: внешние ключи включены (в SQLite по умолчанию выключены),
+// журнал WAL позволяет читать файл базы, пока идет запись
+func sqliteDSN(path string) string {
+	params := url.Values{}
+	params.Add("_pragma", "foreign_keys(1)")
+	params.Add("_pragma", fmt.Sprintf("busy_timeout(%d)", sqliteBusyTimeout.Milliseconds()))
+	params.Add("_pragma", "journal_mode(WAL)")
+
+	dsn := path
+	if !strings.HasPrefix(dsn, "file:") {
+		dsn = "file:" + dsn
+	}
+	separator := "?"
+	if strings.Contains(dsn, "?") {
+		separator = "&"
+	}
+	return dsn + separator + params.Encode()
+}
+
+func (sc *SQLiteConnection) Close() error {
+	logger := slog.Default()
+	logger.Info("Закрытие соединения с SQLite")
+
+	err := sc.db.Close()
+	if err != nil {
+		logger.Error("Ошибка при закрытии соединения с SQLite", "error", err)
+		return err
+	}
+
+	logger.Info("Соединение с SQLite успешно закрыто")
+	return nil
+}
+
+// withTx выполняет fn в транзакции и подтверждает ее, если fn не вернула ошибку
+func (sc *SQLiteConnection) withTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := sc.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("ошибка при начале транзакции: %w", err)
+	}
+	// После Commit откат ничего не делает
+	defer tx.Rollback()
+
+	if err = fn(tx); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("ошибка при подтверждении транзакции: %w", err)
+	}
+	return nil
+}
+
+// toSQLiteTime переводит время в микросекунды Unix, в которых даты хранятся в SQLite
+func toSQLiteTime(t time.Time) int64 {
+	return t.UnixMicro()
+}
+
+// fromSQLiteTime переводит микросекунды Unix из SQLite во время
+func fromSQLiteTime(v int64) time.Time {
+	return time.UnixMicro(v)
+}
+
+// fromSQLiteNullTime переводит необязательную дату из SQLite, NULL - nil
+func fromSQLiteNullTime(v sql.NullInt64) *time.Time {
+	if !v.Valid {
+		return nil
+	}
+	t := fromSQLiteTime(v.Int64)
+	return &t
+}
+
+// sqliteInList возвращает плейсхолдеры "?, ?, ..." и аргументы для условия IN со списком значений
+func sqliteInList(values []string) (string, []interface{}) {
+	placeholders := make([]string, len(values))
+	args := make([]interface{}, len(values))
+	for i, value := range values {
+		placeholders[i] = "?"
+		args[i] = value
+	}
+	return strings.Join(placeholders, ", "), args
+}
@@ -0,0 +1,44 @@
+package repository
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/paxren/go-musthave-diploma-tpl/internal/models"
+)
+
+func TestMakeSQLiteStorage_Reopen(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "gophermart.db")
+
+	sc, err := MakeSQLiteStorage(path)
+	require.NoError(t, err)
+	require.NoError(t, MakeUserSQLiteStorage(sc).RegisterUser(ctx, models.User{Login: "persistent", Password: "password"}))
+	user := MakeUserSQLiteStorage(sc).GetUser(ctx, "persistent")
+	require.NotNil(t, user)
+	number := luhnNumber("7992739871")
+	require.NoError(t, MakeOrderSQLiteStorage(sc).AddOrder(ctx, *user.UserID, *models.MakeNewOrder(*user, number)))
+	require.NoError(t, sc.Close())
+
+	// Повторное открытие не применяет миграции заново, данные сохраняются в файле
+	sc, err = MakeSQLiteStorage(path)
+	require.NoError(t, err)
+	defer sc.Close()
+
+	assert.NoError(t, MakeUserSQLiteStorage(sc).LoginUser(ctx, models.User{Login: "persistent", Password: "password"}, "192.0.2.1"))
+	order, err := MakeOrderSQLiteStorage(sc).GetOrder(ctx, number)
+	require.NoError(t, err)
+	assert.Equal(t, "persistent", order.User)
+}
+
+func TestSQLiteDSN(t *testing.T) {
+	pragmas := "_pragma=foreign_keys%281%29&_pragma=busy_timeout%285000%29&_pragma=journal_mode%28WAL%29"
+
+	assert.Equal(t, "file:gophermart.db?"+pragmas, sqliteDSN("gophermart.db"))
+	assert.Equal(t, "file:/var/lib/gophermart.db?"+pragmas, sqliteDSN("/var/lib/gophermart.db"))
+	assert.Equal(t, "file:data.db?mode=rwc&"+pragmas, sqliteDSN("file:data.db?mode=rwc"))
+}
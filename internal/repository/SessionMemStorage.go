@@ -0,0 +1,126 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/paxren/go-musthave-diploma-tpl/internal/models"
+)
+
+// memSession сессия в памяти вместе с хешем refresh токена
+type memSession struct {
+	session          models.Session
+	refreshTokenHash string
+	revoked          bool
+}
+
+// SessionMemStorage хранилище сессий и отозванных токенов в памяти.
+// Повторяет поведение SessionPostgresStorage
+type SessionMemStorage struct {
+	mutex         sync.Mutex
+	sessions      map[string]*memSession // по идентификатору сессии
+	revokedTokens map[string]time.Time   // срок действия отозванного токена по jti
+	now           func() time.Time
+}
+
+func MakeSessionMemStorage() *SessionMemStorage {
+	return &SessionMemStorage{
+		sessions:      make(map[string]*memSession),
+		revokedTokens: make(map[string]time.Time),
+		now:           time.Now,
+	}
+}
+
+// CreateSession создает сессию пользователя с хешем refresh токена
+func (st *SessionMemStorage) CreateSession(ctx context.Context, session models.Session, refreshTokenHash string) error {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+
+	st.sessions[session.ID] = &memSession{
+		session:          session,
+		refreshTokenHash: refreshTokenHash,
+	}
+	return nil
+}
+
+// RotateSession находит действующую сессию по хешу refresh токена и заменяет его новым.
+// Старый refresh токен после этого использовать нельзя
+func (st *SessionMemStorage) RotateSession(ctx context.Context, refreshTokenHash, newRefreshTokenHash string, expiresAt time.Time) (*models.Session, error) {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+
+	now := st.now()
+	for _, stored := range st.sessions {
+		if stored.refreshTokenHash != refreshTokenHash || stored.revoked || !stored.session.ExpiresAt.After(now) {
+			continue
+		}
+
+		stored.refreshTokenHash = newRefreshTokenHash
+		stored.session.ExpiresAt = expiresAt
+		session := stored.session
+		return &session, nil
+	}
+	return nil, ErrSessionNotFound
+}
+
+// RevokeSession отзывает сессию и все выданные в ней access токены
+func (st *SessionMemStorage) RevokeSession(ctx context.Context, sessionID string) error {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+
+	if stored, ok := st.sessions[sessionID]; ok {
+		stored.revoked = true
+	}
+	return nil
+}
+
+// RevokeUserSessions отзывает все сессии пользователя
+func (st *SessionMemStorage) RevokeUserSessions(ctx context.Context, userID uint64) error {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+
+	for _, stored := range st.sessions {
+		if stored.session.UserID == userID {
+			stored.revoked = true
+		}
+	}
+	return nil
+}
+
+// RevokeToken отзывает отдельный access токен до истечения его срока действия.
+// Заодно удаляются записи об отзыве уже истекших токенов
+func (st *SessionMemStorage) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+
+	if _, ok := st.revokedTokens[jti]; !ok {
+		st.revokedTokens[jti] = expiresAt
+	}
+
+	now := st.now()
+	for revoked, until := range st.revokedTokens {
+		if until.Before(now) {
+			delete(st.revokedTokens, revoked)
+		}
+	}
+	return nil
+}
+
+// GetSessionUser возвращает пользователя действующей сессии. Если сессия или access токен
+// отозваны, возвращает ErrSessionNotFound
+func (st *SessionMemStorage) GetSessionUser(ctx context.Context, sessionID, jti string) (*models.User, error) {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+
+	stored, ok := st.sessions[sessionID]
+	if !ok || stored.revoked {
+		return nil, ErrSessionNotFound
+	}
+	if _, revoked := st.revokedTokens[jti]; revoked {
+		return nil, ErrSessionNotFound
+	}
+
+	userID := stored.session.UserID
+	return &models.User{UserID: &userID, Login: stored.session.Login}, nil
+}
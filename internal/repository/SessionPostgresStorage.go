@@ -0,0 +1,122 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/paxren/go-musthave-diploma-tpl/internal/models"
+)
+
+type SessionPostgresStorage struct {
+	db *PostgresConnection
+}
+
+func MakeSessionPostgresStorage(pc *PostgresConnection) *SessionPostgresStorage {
+	return &SessionPostgresStorage{
+		db: pc,
+	}
+}
+
+// CreateSession создает сессию пользователя с хешем refresh токена
+func (st *SessionPostgresStorage) CreateSession(ctx context.Context, session models.Session, refreshTokenHash string) error {
+	query := `
+		INSERT INTO gophermart_sessions (id, user_id, refresh_token_hash, expires_at)
+		VALUES ($1, $2, $3, $4)
+	`
+	_, err := st.db.db.ExecContext(ctx, query, session.ID, session.UserID, refreshTokenHash, session.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("ошибка при создании сессии: %w", err)
+	}
+	return nil
+}
+
+// RotateSession находит действующую сессию по хешу refresh токена и заменяет его новым.
+// Старый refresh токен после этого использовать нельзя
+func (st *SessionPostgresStorage) RotateSession(ctx context.Context, refreshTokenHash, newRefreshTokenHash string, expiresAt time.Time) (*models.Session, error) {
+	query := `
+		UPDATE gophermart_sessions s
+		SET refresh_token_hash = $2, expires_at = $3
+		FROM gophermart_users u
+		WHERE s.refresh_token_hash = $1
+		  AND s.revoked_at IS NULL
+		  AND s.expires_at > CURRENT_TIMESTAMP
+		  AND u.id = s.user_id
+		RETURNING s.id, s.user_id, u.login, s.expires_at
+	`
+
+	var session models.Session
+	err := st.db.db.QueryRowContext(ctx, query, refreshTokenHash, newRefreshTokenHash, expiresAt).
+		Scan(&session.ID, &session.UserID, &session.Login, &session.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrSessionNotFound
+		}
+		return nil, fmt.Errorf("ошибка при обновлении сессии: %w", err)
+	}
+
+	return &session, nil
+}
+
+// RevokeSession отзывает сессию и все выданные в ней access токены
+func (st *SessionPostgresStorage) RevokeSession(ctx context.Context, sessionID string) error {
+	query := "UPDATE gophermart_sessions SET revoked_at = CURRENT_TIMESTAMP WHERE id = $1 AND revoked_at IS NULL"
+	if _, err := st.db.db.ExecContext(ctx, query, sessionID); err != nil {
+		return fmt.Errorf("ошибка при отзыве сессии: %w", err)
+	}
+	return nil
+}
+
+// RevokeUserSessions отзывает все сессии пользователя
+func (st *SessionPostgresStorage) RevokeUserSessions(ctx context.Context, userID uint64) error {
+	query := "UPDATE gophermart_sessions SET revoked_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND revoked_at IS NULL"
+	if _, err := st.db.db.ExecContext(ctx, query, userID); err != nil {
+		return fmt.Errorf("ошибка при отзыве сессий пользователя: %w", err)
+	}
+	return nil
+}
+
+// RevokeToken отзывает отдельный access токен до истечения его срока действия.
+// Заодно удаляются записи об отзыве уже истекших токенов
+func (st *SessionPostgresStorage) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	query := `
+		INSERT INTO gophermart_revoked_tokens (jti, expires_at)
+		VALUES ($1, $2)
+		ON CONFLICT (jti) DO NOTHING
+	`
+	if _, err := st.db.db.ExecContext(ctx, query, jti, expiresAt); err != nil {
+		return fmt.Errorf("ошибка при отзыве токена: %w", err)
+	}
+
+	cleanupQuery := "DELETE FROM gophermart_revoked_tokens WHERE expires_at < CURRENT_TIMESTAMP"
+	if _, err := st.db.db.ExecContext(ctx, cleanupQuery); err != nil {
+		return fmt.Errorf("ошибка при удалении истекших отозванных токенов: %w", err)
+	}
+	return nil
+}
+
+// GetSessionUser возвращает пользователя действующей сессии. Если сессия или access токен
+// отозваны либо пользователь удален, возвращает ErrSessionNotFound
+func (st *SessionPostgresStorage) GetSessionUser(ctx context.Context, sessionID, jti string) (*models.User, error) {
+	query := `
+		SELECT u.id, u.login
+		FROM gophermart_sessions s
+		JOIN gophermart_users u ON u.id = s.user_id
+		WHERE s.id = $1
+		  AND s.revoked_at IS NULL
+		  AND NOT EXISTS (SELECT 1 FROM gophermart_revoked_tokens WHERE jti = $2)
+	`
+
+	var user models.User
+	err := st.db.db.QueryRowContext(ctx, query, sessionID, jti).Scan(&user.UserID, &user.Login)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrSessionNotFound
+		}
+		return nil, fmt.Errorf("ошибка при проверке сессии: %w", err)
+	}
+
+	return &user, nil
+}
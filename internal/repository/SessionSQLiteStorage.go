@@ -0,0 +1,131 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/paxren/go-musthave-diploma-tpl/internal/models"
+)
+
+type SessionSQLiteStorage struct {
+	db *SQLiteConnection
+}
+
+func MakeSessionSQLiteStorage(sc *SQLiteConnection) *SessionSQLiteStorage {
+	return &SessionSQLiteStorage{
+		db: sc,
+	}
+}
+
+// CreateSession создает сессию пользователя с хешем refresh токена
+func (st *SessionSQLiteStorage) CreateSession(ctx context.Context, session models.Session, refreshTokenHash string) error {
+	query := `
+		INSERT INTO gophermart_sessions (id, user_id, refresh_token_hash, expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?)
+	`
+	_, err := st.db.db.ExecContext(ctx, query, session.ID, session.UserID, refreshTokenHash,
+		toSQLiteTime(session.ExpiresAt), toSQLiteTime(st.db.now()))
+	if err != nil {
+		return fmt.Errorf("ошибка при создании сессии: %w", err)
+	}
+	return nil
+}
+
+// RotateSession находит действующую сессию по хешу refresh токена и заменяет его новым.
+// Старый refresh токен после этого использовать нельзя
+func (st *SessionSQLiteStorage) RotateSession(ctx context.Context, refreshTokenHash, newRefreshTokenHash string, expiresAt time.Time) (*models.Session, error) {
+	query := `
+		UPDATE gophermart_sessions
+		SET refresh_token_hash = ?, expires_at = ?
+		WHERE refresh_token_hash = ? AND revoked_at IS NULL AND expires_at > ?
+		RETURNING id, user_id, expires_at
+	`
+
+	var session models.Session
+	err := st.db.withTx(ctx, func(tx *sql.Tx) error {
+		var sessionExpiresAt int64
+		err := tx.QueryRowContext(ctx, query, newRefreshTokenHash, toSQLiteTime(expiresAt), refreshTokenHash, toSQLiteTime(st.db.now())).
+			Scan(&session.ID, &session.UserID, &sessionExpiresAt)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrSessionNotFound
+			}
+			return fmt.Errorf("ошибка при обновлении сессии: %w", err)
+		}
+		session.ExpiresAt = fromSQLiteTime(sessionExpiresAt)
+
+		err = tx.QueryRowContext(ctx, "SELECT login FROM gophermart_users WHERE id = ?", session.UserID).Scan(&session.Login)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrSessionNotFound
+			}
+			return fmt.Errorf("ошибка при получении пользователя сессии: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &session, nil
+}
+
+// RevokeSession отзывает сессию и все выданные в ней access токены
+func (st *SessionSQLiteStorage) RevokeSession(ctx context.Context, sessionID string) error {
+	query := "UPDATE gophermart_sessions SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL"
+	if _, err := st.db.db.ExecContext(ctx, query, toSQLiteTime(st.db.now()), sessionID); err != nil {
+		return fmt.Errorf("ошибка при отзыве сессии: %w", err)
+	}
+	return nil
+}
+
+// RevokeUserSessions отзывает все сессии пользователя
+func (st *SessionSQLiteStorage) RevokeUserSessions(ctx context.Context, userID uint64) error {
+	query := "UPDATE gophermart_sessions SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL"
+	if _, err := st.db.db.ExecContext(ctx, query, toSQLiteTime(st.db.now()), userID); err != nil {
+		return fmt.Errorf("ошибка при отзыве сессий пользователя: %w", err)
+	}
+	return nil
+}
+
+// RevokeToken отзывает отдельный access токен до истечения его срока действия.
+// Заодно удаляются записи об отзыве уже истекших токенов
+func (st *SessionSQLiteStorage) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	query := "INSERT INTO gophermart_revoked_tokens (jti, expires_at) VALUES (?, ?) ON CONFLICT (jti) DO NOTHING"
+	if _, err := st.db.db.ExecContext(ctx, query, jti, toSQLiteTime(expiresAt)); err != nil {
+		return fmt.Errorf("ошибка при отзыве токена: %w", err)
+	}
+
+	cleanupQuery := "DELETE FROM gophermart_revoked_tokens WHERE expires_at < ?"
+	if _, err := st.db.db.ExecContext(ctx, cleanupQuery, toSQLiteTime(st.db.now())); err != nil {
+		return fmt.Errorf("ошибка при удалении истекших отозванных токенов: %w", err)
+	}
+	return nil
+}
+
+// GetSessionUser возвращает пользователя действующей сессии. Если сессия или access токен
+// отозваны либо пользователь удален, возвращает ErrSessionNotFound
+func (st *SessionSQLiteStorage) GetSessionUser(ctx context.Context, sessionID, jti string) (*models.User, error) {
+	query := `
+		SELECT u.id, u.login
+		FROM gophermart_sessions s
+		JOIN gophermart_users u ON u.id = s.user_id
+		WHERE s.id = ?
+		  AND s.revoked_at IS NULL
+		  AND NOT EXISTS (SELECT 1 FROM gophermart_revoked_tokens WHERE jti = ?)
+	`
+
+	var user models.User
+	err := st.db.db.QueryRowContext(ctx, query, sessionID, jti).Scan(&user.UserID, &user.Login)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrSessionNotFound
+		}
+		return nil, fmt.Errorf("ошибка при проверке сессии: %w", err)
+	}
+
+	return &user, nil
+}
@@ -1,53 +1,264 @@
 package repository
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
 	"github.com/paxren/go-musthave-diploma-tpl/internal/models"
 )
 
-// ПОТОКО НЕБЕЗОПАСНО!
+// memUser пользователь в памяти, пароль хранится только хешем bcrypt
+type memUser struct {
+	id           uint64
+	login        string
+	passwordHash string
+}
+
+// memLoginAttempts счетчик неудачных попыток входа одного логина или IP адреса
+type memLoginAttempts struct {
+	failures      int
+	lastFailureAt time.Time
+	lockedUntil   time.Time
+}
 
+// UserMemStorage хранилище пользователей в памяти. Повторяет поведение UserPostgresStorage:
+// пароли хешируются bcrypt, логины сравниваются без учета регистра, вход защищен от перебора
 type UserMemStorage struct {
-	users map[string]models.User
+	mutex    sync.RWMutex
+	users    map[string]*memUser // по нормализованному логину
+	nextID   uint64
+	attempts map[string]*memLoginAttempts // по типу субъекта и субъекту
+	now      func() time.Time
+
+	// sessions хранилище сессий, которые отзываются при смене пароля
+	sessions *SessionMemStorage
+
+	attemptsCleanup loginAttemptsCleanup
 }
 
 func MakeUserMemStorage() *UserMemStorage {
-
 	return &UserMemStorage{
-		users: make(map[string]models.User),
+		users:    make(map[string]*memUser),
+		attempts: make(map[string]*memLoginAttempts),
+		now:      time.Now,
 	}
 }
 
-func (m *UserMemStorage) GetUser(login string) *models.User {
+// SetSessions задает хранилище сессий, в котором ChangePassword отзывает сессии пользователя
+func (m *UserMemStorage) SetSessions(sessions *SessionMemStorage) {
+	m.sessions = sessions
+}
 
-	v, ok := m.users[login]
+func (m *UserMemStorage) GetUser(ctx context.Context, login string) *models.User {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
 
+	stored, ok := m.users[models.NormalizeLogin(login)]
 	if !ok {
 		return nil
 	}
 
-	return &v
+	// В поле Password не отдаем хеш, так как оно используется только для аутентификации
+	id := stored.id
+	return &models.User{UserID: &id, Login: stored.login}
 }
 
-func (m *UserMemStorage) RegisterUser(user models.User) error {
-	if m.GetUser(user.Login) != nil {
+func (m *UserMemStorage) RegisterUser(ctx context.Context, user models.User) error {
+	// Хешируем пароль до блокировки: bcrypt медленный и не должен задерживать других
+	hashedPassword, err := hashPassword(user.Password)
+	if err != nil {
+		return fmt.Errorf("ошибка хеширования пароля: %w", err)
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	login := models.NormalizeLogin(user.Login)
+	if _, ok := m.users[login]; ok {
 		return ErrUserExist
 	}
-	id := uint64(len(m.users) + 1)
-	user.UserID = &id
-	m.users[user.Login] = user
 
-	//todo доработать крайние случаи
+	m.nextID++
+	m.users[login] = &memUser{
+		id:           m.nextID,
+		login:        strings.TrimSpace(user.Login),
+		passwordHash: hashedPassword,
+	}
+	return nil
+}
+
+// LoginUser проверяет логин и пароль пользователя с защитой от перебора по тем же правилам,
+// что и UserPostgresStorage
+func (m *UserMemStorage) LoginUser(ctx context.Context, user models.User, clientIP string) error {
+	login := models.NormalizeLogin(user.Login)
+
+	if err := m.checkLoginLock(login, clientIP); err != nil {
+		return err
+	}
+
+	m.mutex.RLock()
+	stored, ok := m.users[login]
+	var passwordHash string
+	if ok {
+		passwordHash = stored.passwordHash
+	}
+	m.mutex.RUnlock()
+
+	err := ErrBadLogin
+	if ok {
+		err = verifyPasswordHash(user.Password, passwordHash, ErrBadLogin)
+	}
+
+	if errors.Is(err, ErrBadLogin) {
+		m.recordLoginFailure(loginSubjectLogin, login, loginFailuresThreshold)
+		m.recordLoginFailure(loginSubjectIP, clientIP, ipFailuresThreshold)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	// Счетчик IP адреса не сбрасывается, иначе вход в свою учетную запись позволял бы продолжать перебор чужих
+	m.mutex.Lock()
+	delete(m.attempts, loginAttemptsKey(loginSubjectLogin, login))
+	m.mutex.Unlock()
+
+	return nil
+}
+
+// ChangePassword меняет пароль пользователя и отзывает все его сессии по тем же правилам,
+// что и UserPostgresStorage. Смена пароля и отзыв сессий выполняются под одной блокировкой
+func (m *UserMemStorage) ChangePassword(ctx context.Context, userID uint64, oldPassword, newPassword, clientIP string) error {
+	stored := m.userByID(userID)
+	if stored == nil {
+		return ErrBadLogin
+	}
+
+	m.mutex.RLock()
+	login := models.NormalizeLogin(stored.login)
+	passwordHash := stored.passwordHash
+	m.mutex.RUnlock()
+
+	if err := m.checkLoginLock(login, clientIP); err != nil {
+		return err
+	}
+
+	err := verifyPasswordHash(oldPassword, passwordHash, ErrWrongPassword)
+	if errors.Is(err, ErrWrongPassword) {
+		m.recordLoginFailure(loginSubjectLogin, login, loginFailuresThreshold)
+		m.recordLoginFailure(loginSubjectIP, clientIP, ipFailuresThreshold)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	hashedPassword, err := hashPassword(newPassword)
+	if err != nil {
+		return fmt.Errorf("ошибка хеширования пароля: %w", err)
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	stored.passwordHash = hashedPassword
+	if m.sessions != nil {
+		// Токены, выданные со старым паролем, больше не действуют
+		m.sessions.RevokeUserSessions(ctx, userID)
+	}
+	delete(m.attempts, loginAttemptsKey(loginSubjectLogin, login))
 
 	return nil
+}
+
+// userByID находит пользователя по идентификатору
+func (m *UserMemStorage) userByID(userID uint64) *memUser {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
 
+	for _, stored := range m.users {
+		if stored.id == userID {
+			return stored
+		}
+	}
+	return nil
 }
 
-func (m *UserMemStorage) LoginUser(user models.User) error {
+// checkLoginLock проверяет, заблокирован ли вход для логина или IP адреса
+func (m *UserMemStorage) checkLoginLock(login, clientIP string) error {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
 
-	dbUser := m.GetUser(user.Login)
-	if dbUser == nil || (dbUser.Login != user.Login) || (dbUser.Password != user.Password) {
-		return ErrBadLogin
+	now := m.now()
+	var retryAfter time.Duration
+	for _, key := range []string{loginAttemptsKey(loginSubjectLogin, login), loginAttemptsKey(loginSubjectIP, clientIP)} {
+		if attempts, ok := m.attempts[key]; ok && attempts.lockedUntil.After(now) {
+			retryAfter = max(retryAfter, attempts.lockedUntil.Sub(now))
+		}
+	}
+
+	if retryAfter > 0 {
+		return &LoginLockedError{RetryAfter: retryAfter}
+	}
+	return nil
+}
+
+// recordLoginFailure увеличивает счетчик неудачных попыток и блокирует субъект после порога
+func (m *UserMemStorage) recordLoginFailure(subjectType, subject string, threshold int) {
+	if subject == "" {
+		return
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	now := m.now()
+	if m.attemptsCleanup.due(now) {
+		for key, attempts := range m.attempts {
+			if isStaleLoginAttempts(attempts.lastFailureAt, attempts.lockedUntil, now) {
+				delete(m.attempts, key)
+			}
+		}
+	}
+
+	key := loginAttemptsKey(subjectType, subject)
+	attempts, ok := m.attempts[key]
+	if !ok {
+		attempts = &memLoginAttempts{}
+		m.attempts[key] = attempts
 	}
 
+	// После долгого перерыва без неудачных попыток счетчик начинается заново
+	if attempts.lastFailureAt.Before(now.Add(-loginAttemptsWindow)) {
+		attempts.failures = 0
+	}
+	attempts.failures++
+	attempts.lastFailureAt = now
+
+	if delay := loginLockoutDelay(attempts.failures, threshold); delay > 0 {
+		attempts.lockedUntil = now.Add(delay)
+	}
+}
+
+// loginAttemptsKey ключ счетчика неудачных попыток входа
+func loginAttemptsKey(subjectType, subject string) string {
+	return subjectType + ":" + subject
+}
+
+// verifyPasswordHash сверяет пароль с хешем bcrypt, при несовпадении возвращает mismatchErr
+func verifyPasswordHash(password, hash string, mismatchErr error) error {
+	err := checkPassword(password, hash)
+	if err != nil {
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return mismatchErr
+		}
+		return fmt.Errorf("ошибка при проверке пароля: %w", err)
+	}
 	return nil
 }
@@ -1,10 +1,12 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
 	"log/slog"
+	"strings"
 
 	"golang.org/x/crypto/bcrypt"
 
@@ -14,7 +16,8 @@ import (
 // ПОТОКО НЕБЕЗОПАСНО!
 
 type UserPostgresStorage struct {
-	db *PostgresConnection
+	db              *PostgresConnection
+	attemptsCleanup loginAttemptsCleanup
 }
 
 func MakeUserPostgresStorage(pc *PostgresConnection) *UserPostgresStorage {
@@ -37,15 +40,15 @@ func checkPassword(password, hash string) error {
 	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
 }
 
-func (ps *UserPostgresStorage) GetUser(login string) *models.User {
+func (ps *UserPostgresStorage) GetUser(ctx context.Context, login string) *models.User {
 	logger := slog.Default()
 	logger.Debug("Получение пользователя", "login", login)
 
 	var user models.User
 	var passwordHash string
 
-	query := "SELECT id, login, password_hash FROM gophermart_users WHERE login = $1"
-	err := ps.db.db.QueryRow(query, login).Scan(&user.UserID, &user.Login, &passwordHash)
+	query := "SELECT id, login, password_hash FROM gophermart_users WHERE login_normalized = $1"
+	err := ps.db.db.QueryRowContext(ctx, query, models.NormalizeLogin(login)).Scan(&user.UserID, &user.Login, &passwordHash)
 
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -63,12 +66,12 @@ func (ps *UserPostgresStorage) GetUser(login string) *models.User {
 	return &user
 }
 
-func (ps *UserPostgresStorage) RegisterUser(user models.User) error {
+func (ps *UserPostgresStorage) RegisterUser(ctx context.Context, user models.User) error {
 	logger := slog.Default()
 	logger.Info("Попытка регистрации пользователя", "login", user.Login)
 
 	// Проверяем, существует ли пользователь с таким логином
-	existingUser := ps.GetUser(user.Login)
+	existingUser := ps.GetUser(ctx, user.Login)
 	if existingUser != nil {
 		logger.Warn("Пользователь уже существует", "login", user.Login)
 		return ErrUserExist
@@ -83,8 +86,8 @@ func (ps *UserPostgresStorage) RegisterUser(user models.User) error {
 
 	// Вставляем нового пользователя в базу данных
 	var userID uint64
-	query := "INSERT INTO gophermart_users (login, password_hash) VALUES ($1, $2) RETURNING id"
-	err = ps.db.db.QueryRow(query, user.Login, hashedPassword).Scan(&userID)
+	query := "INSERT INTO gophermart_users (login, login_normalized, password_hash) VALUES ($1, $2, $3) RETURNING id"
+	err = ps.db.db.QueryRowContext(ctx, query, strings.TrimSpace(user.Login), models.NormalizeLogin(user.Login), hashedPassword).Scan(&userID)
 
 	if err != nil {
 		logger.Error("Ошибка при вставке пользователя", "login", user.Login, "error", err)
@@ -103,12 +106,49 @@ func (ps *UserPostgresStorage) RegisterUser(user models.User) error {
 	return nil
 }
 
-func (ps *UserPostgresStorage) LoginUser(user models.User) error {
+// LoginUser проверяет логин и пароль пользователя с защитой от перебора.
+// Пока логин или IP адрес клиента заблокирован после серии неудачных попыток,
+// пароль не проверяется и возвращается *LoginLockedError
+func (ps *UserPostgresStorage) LoginUser(ctx context.Context, user models.User, clientIP string) error {
 	logger := slog.Default()
 	logger.Debug("Попытка входа пользователя", "login", user.Login)
 
+	// Счетчики ведем по нормализованному логину, чтобы блокировку нельзя было обойти сменой регистра
+	login := models.NormalizeLogin(user.Login)
+
+	if err := ps.checkLoginLock(ctx, login, clientIP); err != nil {
+		logger.Warn("Вход заблокирован", "login", user.Login, "client_ip", clientIP, "error", err)
+		return err
+	}
+
+	err := ps.verifyPassword(ctx, user)
+	if errors.Is(err, ErrBadLogin) {
+		if err := ps.recordLoginFailure(ctx, loginSubjectLogin, login, loginFailuresThreshold); err != nil {
+			logger.Error("Ошибка при учете неудачной попытки входа", "login", user.Login, "error", err)
+		}
+		if err := ps.recordLoginFailure(ctx, loginSubjectIP, clientIP, ipFailuresThreshold); err != nil {
+			logger.Error("Ошибка при учете неудачной попытки входа", "client_ip", clientIP, "error", err)
+		}
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := ps.resetLoginFailures(ctx, login); err != nil {
+		logger.Error("Ошибка при сбросе неудачных попыток входа", "login", user.Login, "error", err)
+	}
+
+	logger.Info("Пользователь успешно авторизован", "login", user.Login)
+	return nil
+}
+
+// verifyPassword сверяет пароль пользователя с хешем из базы данных
+func (ps *UserPostgresStorage) verifyPassword(ctx context.Context, user models.User) error {
+	logger := slog.Default()
+
 	// Получаем пользователя из базы данных
-	dbUser := ps.GetUser(user.Login)
+	dbUser := ps.GetUser(ctx, user.Login)
 	if dbUser == nil {
 		logger.Warn("Пользователь не найден", "login", user.Login)
 		return ErrBadLogin
@@ -116,8 +156,8 @@ func (ps *UserPostgresStorage) LoginUser(user models.User) error {
 
 	// Получаем хеш пароля из базы данных
 	var passwordHash string
-	query := "SELECT password_hash FROM gophermart_users WHERE login = $1"
-	err := ps.db.db.QueryRow(query, user.Login).Scan(&passwordHash)
+	query := "SELECT password_hash FROM gophermart_users WHERE login_normalized = $1"
+	err := ps.db.db.QueryRowContext(ctx, query, models.NormalizeLogin(user.Login)).Scan(&passwordHash)
 
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -140,16 +180,82 @@ func (ps *UserPostgresStorage) LoginUser(user models.User) error {
 		return fmt.Errorf("ошибка при проверке пароля: %w", err)
 	}
 
-	logger.Info("Пользователь успешно авторизован", "login", user.Login)
+	return nil
+}
+
+// ChangePassword меняет пароль пользователя, если старый пароль указан верно, и отзывает все его сессии.
+// Проверка старого пароля защищена от перебора так же, как вход: неверный пароль учитывается
+// в счетчиках логина и IP адреса, при блокировке пароль не проверяется и возвращается *LoginLockedError.
+// Смена пароля и отзыв сессий выполняются в одной транзакции
+func (ps *UserPostgresStorage) ChangePassword(ctx context.Context, userID uint64, oldPassword, newPassword, clientIP string) error {
+	logger := slog.Default()
+
+	var login, passwordHash string
+	query := "SELECT login_normalized, password_hash FROM gophermart_users WHERE id = $1"
+	err := ps.db.db.QueryRowContext(ctx, query, userID).Scan(&login, &passwordHash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrBadLogin
+		}
+		return fmt.Errorf("ошибка при получении пароля пользователя: %w", err)
+	}
+
+	if err = ps.checkLoginLock(ctx, login, clientIP); err != nil {
+		logger.Warn("Смена пароля заблокирована", "user_id", userID, "client_ip", clientIP, "error", err)
+		return err
+	}
+
+	err = checkPassword(oldPassword, passwordHash)
+	if err != nil {
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			logger.Warn("Неверный старый пароль при смене пароля", "user_id", userID)
+			if err := ps.recordLoginFailure(ctx, loginSubjectLogin, login, loginFailuresThreshold); err != nil {
+				logger.Error("Ошибка при учете неудачной попытки входа", "user_id", userID, "error", err)
+			}
+			if err := ps.recordLoginFailure(ctx, loginSubjectIP, clientIP, ipFailuresThreshold); err != nil {
+				logger.Error("Ошибка при учете неудачной попытки входа", "client_ip", clientIP, "error", err)
+			}
+			return ErrWrongPassword
+		}
+		return fmt.Errorf("ошибка при проверке пароля: %w", err)
+	}
+
+	hashedPassword, err := hashPassword(newPassword)
+	if err != nil {
+		return fmt.Errorf("ошибка хеширования пароля: %w", err)
+	}
+
+	tx, err := ps.db.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("ошибка при начале транзакции: %w", err)
+	}
+	// После Commit откат ничего не делает
+	defer tx.Rollback()
+
+	updateQuery := "UPDATE gophermart_users SET password_hash = $2 WHERE id = $1"
+	if _, err = tx.ExecContext(ctx, updateQuery, userID, hashedPassword); err != nil {
+		return fmt.Errorf("ошибка при смене пароля: %w", err)
+	}
+
+	// Токены, выданные со старым паролем, больше не действуют
+	revokeQuery := "UPDATE gophermart_sessions SET revoked_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND revoked_at IS NULL"
+	if _, err = tx.ExecContext(ctx, revokeQuery, userID); err != nil {
+		return fmt.Errorf("ошибка при отзыве сессий пользователя: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("ошибка при подтверждении транзакции: %w", err)
+	}
+
+	if err = ps.resetLoginFailures(ctx, login); err != nil {
+		logger.Error("Ошибка при сбросе неудачных попыток входа", "user_id", userID, "error", err)
+	}
+
+	logger.Info("Пароль пользователя изменен", "user_id", userID)
 	return nil
 }
 
 // isUniqueViolationError проверяет, является ли ошибка ошибкой нарушения уникального ограничения
 func isUniqueViolationError(err error) bool {
-	// PostgreSQL код ошибки для нарушения уникального ограничения
-	// Это может потребовать дополнительной настройки в зависимости от драйвера
-	if err != nil && err.Error() == "pq: duplicate key value violates unique constraint" {
-		return true
-	}
-	return false
+	return pgErrorCode(err) == pgCodeUniqueViolation
 }
@@ -0,0 +1,256 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/paxren/go-musthave-diploma-tpl/internal/models"
+)
+
+// UserSQLiteStorage хранилище пользователей в SQLite. Повторяет поведение UserPostgresStorage,
+// включая защиту входа от перебора паролей
+type UserSQLiteStorage struct {
+	db              *SQLiteConnection
+	attemptsCleanup loginAttemptsCleanup
+}
+
+func MakeUserSQLiteStorage(sc *SQLiteConnection) *UserSQLiteStorage {
+	return &UserSQLiteStorage{
+		db: sc,
+	}
+}
+
+func (st *UserSQLiteStorage) GetUser(ctx context.Context, login string) *models.User {
+	var user models.User
+	var userID uint64
+
+	query := "SELECT id, login FROM gophermart_users WHERE login_normalized = ?"
+	err := st.db.db.QueryRowContext(ctx, query, models.NormalizeLogin(login)).Scan(&userID, &user.Login)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			slog.Default().Error("Ошибка при получении пользователя", "login", login, "error", err)
+		}
+		return nil
+	}
+
+	user.UserID = &userID
+	return &user
+}
+
+func (st *UserSQLiteStorage) RegisterUser(ctx context.Context, user models.User) error {
+	hashedPassword, err := hashPassword(user.Password)
+	if err != nil {
+		return fmt.Errorf("ошибка хеширования пароля: %w", err)
+	}
+
+	// Уникальность логина проверяет сама база, повторная регистрация ничего не вставит
+	query := `
+		INSERT INTO gophermart_users (login, login_normalized, password_hash, created_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT DO NOTHING
+	`
+	result, err := st.db.db.ExecContext(ctx, query, strings.TrimSpace(user.Login), models.NormalizeLogin(user.Login),
+		hashedPassword, toSQLiteTime(st.db.now()))
+	if err != nil {
+		return fmt.Errorf("ошибка при регистрации пользователя: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("ошибка при получении количества добавленных строк: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrUserExist
+	}
+
+	slog.Default().Info("Пользователь успешно зарегистрирован", "login", user.Login)
+	return nil
+}
+
+// LoginUser проверяет логин и пароль пользователя с защитой от перебора по тем же правилам,
+// что и UserPostgresStorage
+func (st *UserSQLiteStorage) LoginUser(ctx context.Context, user models.User, clientIP string) error {
+	login := models.NormalizeLogin(user.Login)
+
+	if err := st.checkLoginLock(ctx, login, clientIP); err != nil {
+		return err
+	}
+
+	var passwordHash string
+	query := "SELECT password_hash FROM gophermart_users WHERE login_normalized = ?"
+	err := st.db.db.QueryRowContext(ctx, query, login).Scan(&passwordHash)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		err = ErrBadLogin
+	case err != nil:
+		return fmt.Errorf("ошибка при аутентификации пользователя: %w", err)
+	default:
+		err = verifyPasswordHash(user.Password, passwordHash, ErrBadLogin)
+	}
+
+	logger := slog.Default()
+	if errors.Is(err, ErrBadLogin) {
+		if err := st.recordLoginFailure(ctx, loginSubjectLogin, login, loginFailuresThreshold); err != nil {
+			logger.Error("Ошибка при учете неудачной попытки входа", "login", user.Login, "error", err)
+		}
+		if err := st.recordLoginFailure(ctx, loginSubjectIP, clientIP, ipFailuresThreshold); err != nil {
+			logger.Error("Ошибка при учете неудачной попытки входа", "client_ip", clientIP, "error", err)
+		}
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	// Счетчик IP адреса не сбрасывается, иначе вход в свою учетную запись позволял бы продолжать перебор чужих
+	resetQuery := "DELETE FROM gophermart_login_attempts WHERE subject_type = ? AND subject = ?"
+	if _, err := st.db.db.ExecContext(ctx, resetQuery, loginSubjectLogin, login); err != nil {
+		logger.Error("Ошибка при сбросе неудачных попыток входа", "login", user.Login, "error", err)
+	}
+
+	return nil
+}
+
+// ChangePassword меняет пароль пользователя и отзывает все его сессии по тем же правилам,
+// что и UserPostgresStorage: проверка старого пароля защищена от перебора,
+// смена пароля и отзыв сессий выполняются в одной транзакции
+func (st *UserSQLiteStorage) ChangePassword(ctx context.Context, userID uint64, oldPassword, newPassword, clientIP string) error {
+	var login, passwordHash string
+	query := "SELECT login_normalized, password_hash FROM gophermart_users WHERE id = ?"
+	err := st.db.db.QueryRowContext(ctx, query, userID).Scan(&login, &passwordHash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrBadLogin
+		}
+		return fmt.Errorf("ошибка при получении пароля пользователя: %w", err)
+	}
+
+	if err = st.checkLoginLock(ctx, login, clientIP); err != nil {
+		return err
+	}
+
+	logger := slog.Default()
+	err = verifyPasswordHash(oldPassword, passwordHash, ErrWrongPassword)
+	if errors.Is(err, ErrWrongPassword) {
+		if err := st.recordLoginFailure(ctx, loginSubjectLogin, login, loginFailuresThreshold); err != nil {
+			logger.Error("Ошибка при учете неудачной попытки входа", "user_id", userID, "error", err)
+		}
+		if err := st.recordLoginFailure(ctx, loginSubjectIP, clientIP, ipFailuresThreshold); err != nil {
+			logger.Error("Ошибка при учете неудачной попытки входа", "client_ip", clientIP, "error", err)
+		}
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	hashedPassword, err := hashPassword(newPassword)
+	if err != nil {
+		return fmt.Errorf("ошибка хеширования пароля: %w", err)
+	}
+
+	err = st.db.withTx(ctx, func(tx *sql.Tx) error {
+		updateQuery := "UPDATE gophermart_users SET password_hash = ? WHERE id = ?"
+		if _, err := tx.ExecContext(ctx, updateQuery, hashedPassword, userID); err != nil {
+			return fmt.Errorf("ошибка при смене пароля: %w", err)
+		}
+
+		revokeQuery := "UPDATE gophermart_sessions SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL"
+		if _, err := tx.ExecContext(ctx, revokeQuery, toSQLiteTime(st.db.now()), userID); err != nil {
+			return fmt.Errorf("ошибка при отзыве сессий пользователя: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	resetQuery := "DELETE FROM gophermart_login_attempts WHERE subject_type = ? AND subject = ?"
+	if _, err := st.db.db.ExecContext(ctx, resetQuery, loginSubjectLogin, login); err != nil {
+		logger.Error("Ошибка при сбросе неудачных попыток входа", "user_id", userID, "error", err)
+	}
+	return nil
+}
+
+// checkLoginLock проверяет, заблокирован ли вход для логина или IP адреса
+func (st *UserSQLiteStorage) checkLoginLock(ctx context.Context, login, clientIP string) error {
+	now := st.db.now()
+	query := `
+		SELECT MAX(locked_until)
+		FROM gophermart_login_attempts
+		WHERE ((subject_type = ? AND subject = ?) OR (subject_type = ? AND subject = ?))
+		  AND locked_until > ?
+	`
+
+	var lockedUntil sql.NullInt64
+	err := st.db.db.QueryRowContext(ctx, query, loginSubjectLogin, login, loginSubjectIP, clientIP, toSQLiteTime(now)).Scan(&lockedUntil)
+	if err != nil {
+		return fmt.Errorf("ошибка при проверке блокировки входа: %w", err)
+	}
+
+	if until := fromSQLiteNullTime(lockedUntil); until != nil {
+		return &LoginLockedError{RetryAfter: until.Sub(now)}
+	}
+	return nil
+}
+
+// recordLoginFailure увеличивает счетчик неудачных попыток и блокирует субъект после порога
+func (st *UserSQLiteStorage) recordLoginFailure(ctx context.Context, subjectType, subject string, threshold int) error {
+	if subject == "" {
+		return nil
+	}
+
+	now := st.db.now()
+	return st.db.withTx(ctx, func(tx *sql.Tx) error {
+		query := `
+			INSERT INTO gophermart_login_attempts (subject_type, subject, failures, last_failure_at)
+			VALUES (?, ?, 1, ?)
+			ON CONFLICT (subject_type, subject) DO UPDATE
+			SET failures = CASE WHEN last_failure_at < ? THEN 1 ELSE failures + 1 END,
+				last_failure_at = excluded.last_failure_at
+			RETURNING failures
+		`
+
+		var failures int
+		err := tx.QueryRowContext(ctx, query, subjectType, subject, toSQLiteTime(now),
+			toSQLiteTime(now.Add(-loginAttemptsWindow))).Scan(&failures)
+		if err != nil {
+			return fmt.Errorf("ошибка при учете неудачной попытки входа: %w", err)
+		}
+
+		if st.attemptsCleanup.due(now) {
+			if err = deleteStaleSQLiteLoginAttempts(ctx, tx, now); err != nil {
+				return err
+			}
+		}
+
+		delay := loginLockoutDelay(failures, threshold)
+		if delay == 0 {
+			return nil
+		}
+
+		lockQuery := "UPDATE gophermart_login_attempts SET locked_until = ? WHERE subject_type = ? AND subject = ?"
+		if _, err = tx.ExecContext(ctx, lockQuery, toSQLiteTime(now.Add(delay)), subjectType, subject); err != nil {
+			return fmt.Errorf("ошибка при блокировке входа: %w", err)
+		}
+		return nil
+	})
+}
+
+// deleteStaleSQLiteLoginAttempts удаляет счетчики без действующей блокировки,
+// неудачных попыток по которым не было дольше loginAttemptsWindow
+func deleteStaleSQLiteLoginAttempts(ctx context.Context, tx *sql.Tx, now time.Time) error {
+	query := `
+		DELETE FROM gophermart_login_attempts
+		WHERE last_failure_at < ? AND (locked_until IS NULL OR locked_until <= ?)
+	`
+	if _, err := tx.ExecContext(ctx, query, toSQLiteTime(now.Add(-loginAttemptsWindow)), toSQLiteTime(now)); err != nil {
+		return fmt.Errorf("ошибка при удалении устаревших неудачных попыток входа: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,541 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/paxren/go-musthave-diploma-tpl/internal/models"
+)
+
+// storageBackend реализации интерфейсов одного хранилища.
+// Общие тесты ниже проверяют, что все хранилища ведут себя одинаково
+type storageBackend struct {
+	name        string
+	users       UsersBase
+	orders      OrderBase
+	idempotency IdempotencyBase
+	sessions    SessionBase
+	// forgetUser удаляет пользователя после теста, если данные хранилища переживают тест
+	forgetUser func(t *testing.T, login string)
+}
+
+// forEachBackend запускает test на хранилище в памяти, на SQLite и на PostgreSQL, если задан TEST_DATABASE_URI.
+// Каждый вызов получает новое хранилище в памяти и новый файл SQLite
+func forEachBackend(t *testing.T, test func(t *testing.T, backend storageBackend)) {
+	sc, err := MakeSQLiteStorage(filepath.Join(t.TempDir(), "gophermart.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { sc.Close() })
+
+	memUsers := MakeUserMemStorage()
+	memSessions := MakeSessionMemStorage()
+	memUsers.SetSessions(memSessions)
+
+	backends := []storageBackend{{
+		name:        "memory",
+		users:       memUsers,
+		orders:      MakeOrderMemStorage(),
+		idempotency: MakeIdempotencyMemStorage(),
+		sessions:    memSessions,
+		forgetUser:  func(*testing.T, string) {},
+	}, {
+		name:        "sqlite",
+		users:       MakeUserSQLiteStorage(sc),
+		orders:      MakeOrderSQLiteStorage(sc),
+		idempotency: MakeIdempotencySQLiteStorage(sc),
+		sessions:    MakeSessionSQLiteStorage(sc),
+		forgetUser:  func(*testing.T, string) {},
+	}}
+
+	if os.Getenv("TEST_DATABASE_URI") != "" {
+		pc := newTestPostgres(t)
+		backends = append(backends, storageBackend{
+			name:        "postgres",
+			users:       MakeUserPostgresStorage(pc),
+			orders:      MakeOrderPostgresStorage(pc),
+			idempotency: MakeIdempotencyPostgresStorage(pc),
+			sessions:    MakeSessionPostgresStorage(pc),
+			forgetUser: func(t *testing.T, login string) {
+				t.Cleanup(func() {
+					pc.db.Exec("DELETE FROM gophermart_users WHERE login_normalized = $1", models.NormalizeLogin(login))
+				})
+			},
+		})
+	}
+
+	for _, backend := range backends {
+		t.Run(backend.name, func(t *testing.T) {
+			test(t, backend)
+		})
+	}
+}
+
+// uniqueLogin возвращает логин, не занятый другими тестами в общей базе
+func uniqueLogin(prefix string) string {
+	return fmt.Sprintf("%s-%d", prefix, time.Now().UnixNano())
+}
+
+// registerUser регистрирует пользователя с паролем "password" и возвращает его с идентификатором
+func registerUser(t *testing.T, backend storageBackend) models.User {
+	t.Helper()
+	ctx := context.Background()
+
+	login := uniqueLogin("conformance")
+	backend.forgetUser(t, login)
+	require.NoError(t, backend.users.RegisterUser(ctx, models.User{Login: login, Password: "password"}))
+
+	user := backend.users.GetUser(ctx, login)
+	require.NotNil(t, user)
+	require.NotNil(t, user.UserID)
+	return *user
+}
+
+// uniqueOrderNumber возвращает корректный по алгоритму Луна номер, не занятый другими тестами
+func uniqueOrderNumber(i int) string {
+	return luhnNumber(fmt.Sprintf("%d%03d", time.Now().UnixNano(), i))
+}
+
+func TestConformance_Users(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, backend storageBackend) {
+		ctx := context.Background()
+		login := uniqueLogin("Conformance")
+		backend.forgetUser(t, login)
+
+		require.NoError(t, backend.users.RegisterUser(ctx, models.User{Login: " " + login + " ", Password: "password"}))
+		assert.ErrorIs(t, backend.users.RegisterUser(ctx, models.User{Login: login, Password: "other"}), ErrUserExist)
+
+		// Логин ищется без учета регистра, пароль наружу не отдается
+		user := backend.users.GetUser(ctx, models.NormalizeLogin(login))
+		require.NotNil(t, user)
+		require.NotNil(t, user.UserID)
+		assert.Equal(t, login, user.Login)
+		assert.Empty(t, user.Password)
+		assert.Nil(t, backend.users.GetUser(ctx, login+"-missing"))
+
+		assert.NoError(t, backend.users.LoginUser(ctx, models.User{Login: login, Password: "password"}, "192.0.2.1"))
+		assert.ErrorIs(t, backend.users.LoginUser(ctx, models.User{Login: login, Password: "wrong"}, "192.0.2.1"), ErrBadLogin)
+		assert.ErrorIs(t, backend.users.LoginUser(ctx, models.User{Login: login + "-missing", Password: "password"}, "192.0.2.1"), ErrBadLogin)
+
+		assert.ErrorIs(t, backend.users.ChangePassword(ctx, *user.UserID, "wrong", "new-password", "192.0.2.1"), ErrWrongPassword)
+		require.NoError(t, backend.users.ChangePassword(ctx, *user.UserID, "password", "new-password", "192.0.2.1"))
+		assert.ErrorIs(t, backend.users.LoginUser(ctx, models.User{Login: login, Password: "password"}, "192.0.2.1"), ErrBadLogin)
+		assert.NoError(t, backend.users.LoginUser(ctx, models.User{Login: login, Password: "new-password"}, "192.0.2.1"))
+		assert.ErrorIs(t, backend.users.ChangePassword(ctx, *user.UserID+1000000, "password", "new-password", "192.0.2.1"), ErrBadLogin)
+	})
+}
+
+func TestConformance_ChangePassword(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, backend storageBackend) {
+		ctx := context.Background()
+		user := registerUser(t, backend)
+		// Адрес уникален, чтобы счетчики IP в общей базе не влияли на другие тесты
+		clientIP := uniqueLogin("ip")
+
+		session := models.Session{
+			ID:        uniqueLogin("session"),
+			UserID:    *user.UserID,
+			Login:     user.Login,
+			ExpiresAt: time.Now().Add(time.Hour),
+		}
+		require.NoError(t, backend.sessions.CreateSession(ctx, session, uniqueLogin("refresh")))
+
+		// Смена пароля отзывает все сессии пользователя
+		require.NoError(t, backend.users.ChangePassword(ctx, *user.UserID, "password", "new-password", clientIP))
+		_, err := backend.sessions.GetSessionUser(ctx, session.ID, "jti-1")
+		assert.ErrorIs(t, err, ErrSessionNotFound)
+
+		// Подбор старого пароля блокируется так же, как подбор пароля при входе
+		for i := 0; i < loginFailuresThreshold; i++ {
+			assert.ErrorIs(t, backend.users.ChangePassword(ctx, *user.UserID, "wrong", "other-password", clientIP), ErrWrongPassword)
+		}
+		assert.ErrorIs(t, backend.users.ChangePassword(ctx, *user.UserID, "new-password", "other-password", clientIP), ErrLoginLocked)
+		assert.ErrorIs(t, backend.users.LoginUser(ctx, models.User{Login: user.Login, Password: "new-password"}, clientIP), ErrLoginLocked)
+	})
+}
+
+func TestConformance_ConcurrentRegistration(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, backend storageBackend) {
+		ctx := context.Background()
+		login := uniqueLogin("concurrent")
+		backend.forgetUser(t, login)
+
+		const attempts = 8
+		var succeeded, rejected atomic.Int64
+		var wg sync.WaitGroup
+		for i := 0; i < attempts; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				err := backend.users.RegisterUser(ctx, models.User{Login: login, Password: "password"})
+				switch {
+				case err == nil:
+					succeeded.Add(1)
+				case errors.Is(err, ErrUserExist):
+					rejected.Add(1)
+				default:
+					t.Errorf("неожиданная ошибка регистрации: %v", err)
+				}
+			}()
+		}
+		wg.Wait()
+
+		assert.EqualValues(t, 1, succeeded.Load())
+		assert.EqualValues(t, attempts-1, rejected.Load())
+	})
+}
+
+func TestConformance_AddOrder(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, backend storageBackend) {
+		ctx := context.Background()
+		owner := registerUser(t, backend)
+		other := registerUser(t, backend)
+
+		number := uniqueOrderNumber(0)
+		require.NoError(t, backend.orders.AddOrder(ctx, *owner.UserID, *models.MakeNewOrder(owner, number)))
+
+		assert.ErrorIs(t, backend.orders.AddOrder(ctx, *owner.UserID, *models.MakeNewOrder(owner, number)), ErrOrderExistThisUser)
+		assert.ErrorIs(t, backend.orders.AddOrder(ctx, *other.UserID, *models.MakeNewOrder(other, number)), ErrOrderExistAnotherUser)
+		assert.ErrorIs(t, backend.orders.AddOrder(ctx, *owner.UserID, *models.MakeNewOrder(owner, "12345678901")), ErrBadOrderID)
+
+		unknown := *models.MakeNewOrder(owner, uniqueOrderNumber(1))
+		unknown.Type = "GIFT"
+		assert.ErrorIs(t, backend.orders.AddOrder(ctx, *owner.UserID, unknown), ErrOrderType)
+
+		order, err := backend.orders.GetOrder(ctx, number)
+		require.NoError(t, err)
+		assert.Equal(t, number, order.OrderID)
+		assert.Equal(t, owner.Login, order.User)
+		assert.Equal(t, models.OrderStatusNew, order.Status)
+		assert.Nil(t, order.ProcessedAt)
+
+		_, err = backend.orders.GetOrder(ctx, uniqueOrderNumber(2))
+		assert.ErrorIs(t, err, ErrOrderNotFound)
+	})
+}
+
+func TestConformance_StatusTransitionsAndBalance(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, backend storageBackend) {
+		ctx := context.Background()
+		user := registerUser(t, backend)
+
+		balance, err := backend.orders.GetBalance(ctx, *user.UserID)
+		require.NoError(t, err)
+		assert.Equal(t, models.Balance{}, *balance)
+
+		// Без начислений списывать нечего
+		withdraw := *models.MakeWithdraw(user, uniqueOrderNumber(0), 100)
+		assert.ErrorIs(t, backend.orders.AddOrder(ctx, *user.UserID, withdraw), ErrIncafitionFunds)
+
+		number := uniqueOrderNumber(1)
+		require.NoError(t, backend.orders.AddOrder(ctx, *user.UserID, *models.MakeNewOrder(user, number)))
+		require.NoError(t, backend.orders.UpdateOrderStatusAndValue(ctx, number, models.OrderStatusProcessing, 0))
+		require.NoError(t, backend.orders.UpdateOrderStatusAndValue(ctx, number, models.OrderStatusProcessed, 10000))
+
+		// Из конечного статуса заказ не выходит, повторное начисление невозможно
+		assert.ErrorIs(t, backend.orders.UpdateOrderStatusAndValue(ctx, number, models.OrderStatusProcessing, 0), models.ErrIllegalStatusTransition)
+		assert.ErrorIs(t, backend.orders.UpdateOrderStatusAndValue(ctx, number, models.OrderStatusProcessed, 10000), models.ErrIllegalStatusTransition)
+		assert.ErrorIs(t, backend.orders.UpdateOrderStatusAndValue(ctx, uniqueOrderNumber(2), models.OrderStatusProcessed, 1), ErrOrderNotFound)
+
+		order, err := backend.orders.GetOrder(ctx, number)
+		require.NoError(t, err)
+		assert.Equal(t, models.OrderStatusProcessed, order.Status)
+		assert.EqualValues(t, 10000, order.Value)
+		assert.NotNil(t, order.ProcessedAt)
+
+		withdraw = *models.MakeWithdraw(user, uniqueOrderNumber(3), 3000)
+		require.NoError(t, backend.orders.AddOrder(ctx, *user.UserID, withdraw))
+		assert.ErrorIs(t, backend.orders.AddOrder(ctx, *user.UserID, *models.MakeWithdraw(user, uniqueOrderNumber(4), 7001)), ErrIncafitionFunds)
+
+		balance, err = backend.orders.GetBalance(ctx, *user.UserID)
+		require.NoError(t, err)
+		assert.EqualValues(t, 7000, balance.Current)
+		assert.EqualValues(t, 3000, balance.Withdrawn)
+
+		// Списание не считается заказом на начисление
+		_, err = backend.orders.GetOrder(ctx, withdraw.OrderID)
+		assert.ErrorIs(t, err, ErrOrderNotFound)
+
+		withdrawals, err := backend.orders.GetOrders(ctx, *user.UserID, models.OrderQuery{Type: models.WithdrawType})
+		require.NoError(t, err)
+		require.Len(t, withdrawals.Orders, 1)
+		assert.Equal(t, withdraw.OrderID, withdrawals.Orders[0].OrderID)
+		assert.EqualValues(t, 3000, withdrawals.Orders[0].Value)
+		assert.NotNil(t, withdrawals.Orders[0].ProcessedAt)
+	})
+}
+
+func TestConformance_ConcurrentWithdrawals(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, backend storageBackend) {
+		ctx := context.Background()
+		user := registerUser(t, backend)
+
+		number := uniqueOrderNumber(0)
+		require.NoError(t, backend.orders.AddOrder(ctx, *user.UserID, *models.MakeNewOrder(user, number)))
+		require.NoError(t, backend.orders.UpdateOrderStatusAndValue(ctx, number, models.OrderStatusProcessed, 2000))
+
+		// Одновременно пытаемся списать по 1 баллу 50 раз при балансе 20 баллов
+		const withdrawals = 50
+		prefix := strconv.FormatInt(time.Now().UnixNano(), 10)
+		var succeeded, rejected atomic.Int64
+		var wg sync.WaitGroup
+		for i := 0; i < withdrawals; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				withdraw := *models.MakeWithdraw(user, luhnNumber(fmt.Sprintf("%s1%03d", prefix, i)), 100)
+				err := backend.orders.AddOrder(ctx, *user.UserID, withdraw)
+				switch {
+				case err == nil:
+					succeeded.Add(1)
+				case errors.Is(err, ErrIncafitionFunds):
+					rejected.Add(1)
+				default:
+					t.Errorf("неожиданная ошибка списания: %v", err)
+				}
+			}(i)
+		}
+		wg.Wait()
+
+		assert.EqualValues(t, 20, succeeded.Load())
+		assert.EqualValues(t, withdrawals-20, rejected.Load())
+
+		balance, err := backend.orders.GetBalance(ctx, *user.UserID)
+		require.NoError(t, err)
+		assert.EqualValues(t, 0, balance.Current)
+		assert.EqualValues(t, 2000, balance.Withdrawn)
+	})
+}
+
+func TestConformance_GetOrdersPagination(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, backend storageBackend) {
+		ctx := context.Background()
+		user := registerUser(t, backend)
+
+		// Пять заказов с разницей в час, последний обработан
+		base := time.Now().Add(-24 * time.Hour).Truncate(time.Second)
+		var numbers []string
+		for i := 0; i < 5; i++ {
+			order := *models.MakeNewOrder(user, uniqueOrderNumber(i))
+			order.UploadedAt = base.Add(time.Duration(i) * time.Hour)
+			require.NoError(t, backend.orders.AddOrder(ctx, *user.UserID, order))
+			numbers = append(numbers, order.OrderID)
+		}
+		require.NoError(t, backend.orders.UpdateOrderStatusAndValue(ctx, numbers[4], models.OrderStatusProcessed, 100))
+
+		collect := func(query models.OrderQuery) []string {
+			var got []string
+			for {
+				page, err := backend.orders.GetOrders(ctx, *user.UserID, query)
+				require.NoError(t, err)
+				for _, order := range page.Orders {
+					got = append(got, order.OrderID)
+				}
+				if page.Next == nil {
+					return got
+				}
+				query.After = page.Next
+			}
+		}
+
+		// Время обработки выставляется при переходе в конечный статус
+		page, err := backend.orders.GetOrders(ctx, *user.UserID, models.OrderQuery{Limit: 2})
+		require.NoError(t, err)
+		require.NotNil(t, page.Orders[0].ProcessedAt)
+		assert.Nil(t, page.Orders[1].ProcessedAt)
+		assert.True(t, base.Add(4*time.Hour).Equal(page.Orders[0].UploadedAt))
+
+		// Без параметров - все заказы от новых к старым
+		assert.Equal(t, []string{numbers[4], numbers[3], numbers[2], numbers[1], numbers[0]}, collect(models.OrderQuery{}))
+
+		// Постраничный обход дает те же заказы в том же порядке
+		assert.Equal(t, []string{numbers[4], numbers[3], numbers[2], numbers[1], numbers[0]}, collect(models.OrderQuery{Limit: 2}))
+		assert.Equal(t, numbers, collect(models.OrderQuery{Limit: 2, Ascending: true}))
+
+		// Фильтры по статусу и периоду
+		assert.Equal(t, []string{numbers[3], numbers[2], numbers[1], numbers[0]}, collect(models.OrderQuery{Statuses: []string{models.OrderStatusNew}}))
+		assert.Equal(t, []string{numbers[2], numbers[1]}, collect(models.OrderQuery{
+			From: base.Add(time.Hour),
+			To:   base.Add(3 * time.Hour),
+		}))
+		assert.Empty(t, collect(models.OrderQuery{Type: models.WithdrawType}))
+	})
+}
+
+func TestConformance_ClaimAndPostpone(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, backend storageBackend) {
+		ctx := context.Background()
+		user := registerUser(t, backend)
+		statuses := []string{models.OrderStatusNew, models.OrderStatusProcessing}
+
+		first, second := uniqueOrderNumber(0), uniqueOrderNumber(1)
+		require.NoError(t, backend.orders.AddOrder(ctx, *user.UserID, *models.MakeNewOrder(user, first)))
+		require.NoError(t, backend.orders.AddOrder(ctx, *user.UserID, *models.MakeNewOrder(user, second)))
+
+		// В общей базе могут быть заказы других тестов, поэтому смотрим только на свои
+		claimOwn := func() map[string]models.Order {
+			claimed, err := backend.orders.ClaimOrdersWithStatuses(ctx, statuses, 10000, time.Minute)
+			require.NoError(t, err)
+			own := make(map[string]models.Order)
+			for _, order := range claimed {
+				if order.OrderID == first || order.OrderID == second {
+					own[order.OrderID] = order
+				}
+			}
+			return own
+		}
+
+		claimed := claimOwn()
+		require.Len(t, claimed, 2)
+		assert.Equal(t, user.Login, claimed[first].User)
+
+		// Заказы в аренде повторно не захватываются
+		assert.Empty(t, claimOwn())
+
+		// Перенос снимает аренду, повторный перенос по той же аренде отклоняется
+		oldToken := claimed[first].LeaseToken
+		require.NoError(t, backend.orders.PostponeOrderPoll(ctx, first, oldToken, 0, true))
+		assert.ErrorIs(t, backend.orders.PostponeOrderPoll(ctx, first, oldToken, 0, true), ErrLeaseLost)
+		require.NoError(t, backend.orders.UpdateOrderStatusAndValue(ctx, second, models.OrderStatusProcessing, 0))
+
+		claimed = claimOwn()
+		require.Len(t, claimed, 2)
+		assert.Equal(t, models.OrderStatusProcessing, claimed[second].Status)
+		assert.Equal(t, 1, claimed[first].PollAttempts)
+		assert.Equal(t, 1, claimed[first].NotRegisteredPolls)
+		assert.Greater(t, claimed[first].LeaseToken, oldToken)
+
+		// Обработчик со старой арендой не может перенести перехваченный заказ
+		assert.ErrorIs(t, backend.orders.PostponeOrderPoll(ctx, first, oldToken, time.Hour, true), ErrLeaseLost)
+
+		// Другой исход опроса сбрасывает счетчик ответов "не зарегистрирован", но не счетчик попыток
+		require.NoError(t, backend.orders.PostponeOrderPoll(ctx, first, claimed[first].LeaseToken, time.Hour, false))
+		order, err := backend.orders.GetOrder(ctx, first)
+		require.NoError(t, err)
+		assert.Equal(t, 2, order.PollAttempts)
+		assert.Zero(t, order.NotRegisteredPolls)
+
+		// Отложенный заказ не захватывается до срока
+		assert.Empty(t, claimOwn())
+
+		assert.ErrorIs(t, backend.orders.PostponeOrderPoll(ctx, uniqueOrderNumber(2), 1, time.Second, false), ErrOrderNotFound)
+
+		withStatuses, err := backend.orders.GetOrdersWithStatuses(ctx, []string{models.OrderStatusProcessing})
+		require.NoError(t, err)
+		var found bool
+		for _, order := range withStatuses {
+			found = found || order.OrderID == second
+		}
+		assert.True(t, found)
+	})
+}
+
+func TestConformance_Idempotency(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, backend storageBackend) {
+		ctx := context.Background()
+		user := registerUser(t, backend)
+		key := uniqueLogin("key")
+
+		record, err := backend.idempotency.ReserveIdempotencyKey(ctx, *user.UserID, key, "hash")
+		require.NoError(t, err)
+		assert.Nil(t, record)
+
+		// Пока запрос выполняется, повтор видит резерв без ответа
+		record, err = backend.idempotency.ReserveIdempotencyKey(ctx, *user.UserID, key, "hash")
+		require.NoError(t, err)
+		require.NotNil(t, record)
+		assert.Equal(t, "hash", record.RequestHash)
+		assert.Zero(t, record.StatusCode)
+
+		// Освобожденный ключ можно зарезервировать заново
+		require.NoError(t, backend.idempotency.ReleaseIdempotencyKey(ctx, *user.UserID, key))
+		record, err = backend.idempotency.ReserveIdempotencyKey(ctx, *user.UserID, key, "other-hash")
+		require.NoError(t, err)
+		assert.Nil(t, record)
+
+		// Ключ с сохраненным ответом не освобождается, повтор получает ответ
+		require.NoError(t, backend.idempotency.CompleteIdempotencyKey(ctx, *user.UserID, key, 200, []byte(`{"ok":true}`)))
+		require.NoError(t, backend.idempotency.ReleaseIdempotencyKey(ctx, *user.UserID, key))
+		record, err = backend.idempotency.ReserveIdempotencyKey(ctx, *user.UserID, key, "other-hash")
+		require.NoError(t, err)
+		require.NotNil(t, record)
+		assert.Equal(t, "other-hash", record.RequestHash)
+		assert.Equal(t, 200, record.StatusCode)
+		assert.Equal(t, []byte(`{"ok":true}`), record.Body)
+
+		// Ключи разных пользователей независимы
+		other := registerUser(t, backend)
+		record, err = backend.idempotency.ReserveIdempotencyKey(ctx, *other.UserID, key, "hash")
+		require.NoError(t, err)
+		assert.Nil(t, record)
+	})
+}
+
+func TestConformance_Sessions(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, backend storageBackend) {
+		ctx := context.Background()
+		user := registerUser(t, backend)
+		newSession := func(refreshHash string) models.Session {
+			session := models.Session{
+				ID:        uniqueLogin("session"),
+				UserID:    *user.UserID,
+				Login:     user.Login,
+				ExpiresAt: time.Now().Add(time.Hour).Truncate(time.Microsecond),
+			}
+			require.NoError(t, backend.sessions.CreateSession(ctx, session, refreshHash))
+			return session
+		}
+
+		firstHash, secondHash := uniqueLogin("refresh"), uniqueLogin("refresh")
+		first := newSession(firstHash)
+		second := newSession(secondHash)
+
+		sessionUser, err := backend.sessions.GetSessionUser(ctx, first.ID, "jti-1")
+		require.NoError(t, err)
+		assert.Equal(t, *user.UserID, *sessionUser.UserID)
+		assert.Equal(t, user.Login, sessionUser.Login)
+
+		// Refresh токен одноразовый: после обмена действует только новый
+		rotatedHash := uniqueLogin("refresh")
+		expiresAt := time.Now().Add(2 * time.Hour).Truncate(time.Microsecond)
+		rotated, err := backend.sessions.RotateSession(ctx, firstHash, rotatedHash, expiresAt)
+		require.NoError(t, err)
+		assert.Equal(t, first.ID, rotated.ID)
+		assert.Equal(t, user.Login, rotated.Login)
+		assert.True(t, expiresAt.Equal(rotated.ExpiresAt))
+		_, err = backend.sessions.RotateSession(ctx, firstHash, uniqueLogin("refresh"), expiresAt)
+		assert.ErrorIs(t, err, ErrSessionNotFound)
+
+		// Отозванный access токен не принимается, остальные токены сессии принимаются
+		require.NoError(t, backend.sessions.RevokeToken(ctx, "jti-revoked-"+first.ID, time.Now().Add(time.Minute)))
+		_, err = backend.sessions.GetSessionUser(ctx, first.ID, "jti-revoked-"+first.ID)
+		assert.ErrorIs(t, err, ErrSessionNotFound)
+		_, err = backend.sessions.GetSessionUser(ctx, first.ID, "jti-2")
+		assert.NoError(t, err)
+
+		// Отзыв сессии запрещает и ее access токены, и обмен refresh токена
+		require.NoError(t, backend.sessions.RevokeSession(ctx, first.ID))
+		_, err = backend.sessions.GetSessionUser(ctx, first.ID, "jti-2")
+		assert.ErrorIs(t, err, ErrSessionNotFound)
+		_, err = backend.sessions.RotateSession(ctx, rotatedHash, uniqueLogin("refresh"), expiresAt)
+		assert.ErrorIs(t, err, ErrSessionNotFound)
+
+		_, err = backend.sessions.GetSessionUser(ctx, second.ID, "jti-3")
+		require.NoError(t, err)
+		require.NoError(t, backend.sessions.RevokeUserSessions(ctx, *user.UserID))
+		_, err = backend.sessions.GetSessionUser(ctx, second.ID, "jti-3")
+		assert.ErrorIs(t, err, ErrSessionNotFound)
+
+		_, err = backend.sessions.GetSessionUser(ctx, "missing-"+first.ID, "jti-4")
+		assert.ErrorIs(t, err, ErrSessionNotFound)
+	})
+}
@@ -0,0 +1,11 @@
+--
+-- Удаление схемы gophermart для SQLite
+-- Таблицы удаляются в порядке, обратном зависимостям
+DROP TABLE IF EXISTS gophermart_login_attempts;
+DROP TABLE IF EXISTS gophermart_revoked_tokens;
+DROP TABLE IF EXISTS gophermart_sessions;
+DROP TABLE IF EXISTS gophermart_idempotency_keys;
+DROP TABLE IF EXISTS gophermart_balances;
+DROP TABLE IF EXISTS gophermart_ledger;
+DROP TABLE IF EXISTS gophermart_orders;
+DROP TABLE IF EXISTS gophermart_users;
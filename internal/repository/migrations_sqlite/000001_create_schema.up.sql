@@ -0,0 +1,87 @@
+--
+-- Схема gophermart для SQLite
+-- Повторяет итоговую схему миграций PostgreSQL одним шагом.
+-- Даты хранятся целым числом микросекунд Unix (UTC), текущее время передает приложение,
+-- поэтому сравнения дат не зависят от формата и часового пояса
+CREATE TABLE gophermart_users (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    login TEXT NOT NULL UNIQUE,
+    login_normalized TEXT NOT NULL UNIQUE,
+    password_hash TEXT NOT NULL,
+    created_at INTEGER NOT NULL
+);
+
+CREATE TABLE gophermart_orders (
+    id TEXT PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES gophermart_users(id) ON DELETE CASCADE,
+    type TEXT NOT NULL CHECK (type IN ('ORDER', 'WITHDRAW')),
+    status TEXT NOT NULL CHECK (status IN ('NEW', 'PROCESSING', 'INVALID', 'PROCESSED')),
+    value INTEGER NOT NULL DEFAULT 0,
+    created_at INTEGER NOT NULL,
+    updated_at INTEGER NOT NULL,
+    processed_at INTEGER NULL,
+    poll_lease_until INTEGER NULL,
+    next_poll_at INTEGER NOT NULL,
+    poll_attempts INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX idx_gophermart_orders_user_type_created ON gophermart_orders(user_id, type, created_at, id);
+CREATE INDEX idx_gophermart_orders_status_next_poll ON gophermart_orders(status, next_poll_at);
+
+-- Леджер движения баллов (двойная запись) и текущие балансы, как в PostgreSQL
+CREATE TABLE gophermart_ledger (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES gophermart_users(id) ON DELETE CASCADE,
+    order_id TEXT NOT NULL REFERENCES gophermart_orders(id) ON DELETE CASCADE,
+    account TEXT NOT NULL CHECK (account IN ('ACCRUAL', 'USER', 'WITHDRAWAL')),
+    amount INTEGER NOT NULL,
+    created_at INTEGER NOT NULL,
+    UNIQUE (order_id, account)
+);
+
+CREATE INDEX idx_gophermart_ledger_user_id ON gophermart_ledger(user_id);
+
+CREATE TABLE gophermart_balances (
+    user_id INTEGER PRIMARY KEY REFERENCES gophermart_users(id) ON DELETE CASCADE,
+    current INTEGER NOT NULL DEFAULT 0 CHECK (current >= 0),
+    withdrawn INTEGER NOT NULL DEFAULT 0 CHECK (withdrawn >= 0),
+    updated_at INTEGER NOT NULL
+);
+
+-- status_code = NULL означает, что запрос с этим ключом еще выполняется
+CREATE TABLE gophermart_idempotency_keys (
+    user_id INTEGER NOT NULL REFERENCES gophermart_users(id) ON DELETE CASCADE,
+    key TEXT NOT NULL,
+    request_hash TEXT NOT NULL,
+    status_code INTEGER NULL,
+    response_body BLOB NULL,
+    created_at INTEGER NOT NULL,
+    PRIMARY KEY (user_id, key)
+);
+
+CREATE TABLE gophermart_sessions (
+    id TEXT PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES gophermart_users(id) ON DELETE CASCADE,
+    refresh_token_hash TEXT NOT NULL UNIQUE,
+    expires_at INTEGER NOT NULL,
+    revoked_at INTEGER NULL,
+    created_at INTEGER NOT NULL
+);
+
+CREATE INDEX idx_gophermart_sessions_user_id ON gophermart_sessions(user_id);
+
+CREATE TABLE gophermart_revoked_tokens (
+    jti TEXT PRIMARY KEY,
+    expires_at INTEGER NOT NULL
+);
+
+CREATE INDEX idx_gophermart_revoked_tokens_expires_at ON gophermart_revoked_tokens(expires_at);
+
+CREATE TABLE gophermart_login_attempts (
+    subject_type TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    failures INTEGER NOT NULL DEFAULT 0,
+    locked_until INTEGER NULL,
+    last_failure_at INTEGER NOT NULL,
+    PRIMARY KEY (subject_type, subject)
+);
@@ -0,0 +1,3 @@
+--
+-- Удаление счетчика ответов "заказ не зарегистрирован"
+ALTER TABLE gophermart_orders DROP COLUMN not_registered_polls;
@@ -0,0 +1,3 @@
+--
+-- Счетчик ответов accrual системы "заказ не зарегистрирован", как в миграции 000013 для PostgreSQL
+ALTER TABLE gophermart_orders ADD COLUMN not_registered_polls INTEGER NOT NULL DEFAULT 0;
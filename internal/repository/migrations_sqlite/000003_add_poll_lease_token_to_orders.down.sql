@@ -0,0 +1,3 @@
+--
+-- Удаление номера аренды заказа
+ALTER TABLE gophermart_orders DROP COLUMN poll_lease_token;
@@ -0,0 +1,3 @@
+--
+-- Номер аренды заказа для опроса, как в миграции 000014 для PostgreSQL
+ALTER TABLE gophermart_orders ADD COLUMN poll_lease_token INTEGER NOT NULL DEFAULT 0;
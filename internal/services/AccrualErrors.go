@@ -0,0 +1,50 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrOrderNotRegistered заказ не зарегистрирован в accrual системе (ответ 204)
+	ErrOrderNotRegistered = errors.New("заказ не зарегистрирован в accrual системе")
+
+	// ErrAccrualUnavailable accrual система недоступна: сетевая ошибка или ответ 5xx
+	ErrAccrualUnavailable = errors.New("accrual система недоступна")
+
+	// ErrStatusUnchanged статус заказа в accrual системе не изменился
+	ErrStatusUnchanged = errors.New("статус заказа не изменился")
+
+	// ErrOrderAlreadyUpdated статус заказа уже изменил другой обработчик
+	ErrOrderAlreadyUpdated = errors.New("статус заказа уже изменен")
+)
+
+// RateLimitError превышен лимит запросов к accrual системе (ответ 429)
+type RateLimitError struct {
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("превышен лимит запросов к accrual системе, повтор через %s", e.RetryAfter)
+}
+
+// UnexpectedStatusError accrual система вернула код ответа, не описанный в протоколе
+type UnexpectedStatusError struct {
+	StatusCode int
+}
+
+func (e *UnexpectedStatusError) Error() string {
+	return fmt.Sprintf("неожиданный статус код от accrual системы: %d", e.StatusCode)
+}
+
+// isRateLimitError проверяет, является ли ошибка ошибкой ограничения частоты запросов
+func isRateLimitError(err error) bool {
+	var rateLimitErr *RateLimitError
+	return errors.As(err, &rateLimitErr)
+}
+
+// isRetryableError проверяет, можно ли повторить запрос при данной ошибке
+func isRetryableError(err error) bool {
+	return errors.Is(err, ErrAccrualUnavailable) || isRateLimitError(err)
+}
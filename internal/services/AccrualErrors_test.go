@@ -0,0 +1,48 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccrualErrors_Matching(t *testing.T) {
+	wrappedRateLimit := fmt.Errorf("опрос заказа: %w", &RateLimitError{RetryAfter: 3 * time.Second})
+
+	var rateLimitErr *RateLimitError
+	require.True(t, errors.As(wrappedRateLimit, &rateLimitErr))
+	assert.Equal(t, 3*time.Second, rateLimitErr.RetryAfter)
+
+	wrappedStatus := fmt.Errorf("опрос заказа: %w", &UnexpectedStatusError{StatusCode: 418})
+
+	var statusErr *UnexpectedStatusError
+	require.True(t, errors.As(wrappedStatus, &statusErr))
+	assert.Equal(t, 418, statusErr.StatusCode)
+
+	assert.True(t, errors.Is(fmt.Errorf("%w: код ответа 503", ErrAccrualUnavailable), ErrAccrualUnavailable))
+}
+
+func TestIsRetryableError(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{"Нет ошибки", nil, false},
+		{"Заказ не зарегистрирован", ErrOrderNotRegistered, false},
+		{"Accrual недоступна", fmt.Errorf("%w: код ответа 500", ErrAccrualUnavailable), true},
+		{"Превышен лимит запросов", &RateLimitError{RetryAfter: time.Second}, true},
+		{"Неожиданный код ответа", &UnexpectedStatusError{StatusCode: 404}, false},
+		{"Произвольная ошибка", errors.New("ошибка при декодировании ответа"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, isRetryableError(tt.err))
+		})
+	}
+}
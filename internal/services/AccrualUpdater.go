@@ -0,0 +1,82 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+
+	"github.com/paxren/go-musthave-diploma-tpl/internal/models"
+	"github.com/paxren/go-musthave-diploma-tpl/internal/money"
+	"github.com/paxren/go-musthave-diploma-tpl/internal/repository"
+)
+
+// AccrualUpdater применяет к заказу информацию accrual системы: переводит ее статус в статус заказа,
+// проверяет допустимость перехода и сохраняет начисление. Общий для опроса и приема уведомлений,
+// поэтому заказ меняется по одним правилам, откуда бы ни пришла информация
+type AccrualUpdater struct {
+	orderRepo repository.OrderBase
+	logger    *slog.Logger
+}
+
+// NewAccrualUpdater создает новый экземпляр AccrualUpdater
+func NewAccrualUpdater(orderRepo repository.OrderBase) *AccrualUpdater {
+	return &AccrualUpdater{
+		orderRepo: orderRepo,
+		logger:    slog.New(slog.NewJSONHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelInfo})), // По умолчанию без логирования
+	}
+}
+
+// SetLogger устанавливает slog логгер
+func (u *AccrualUpdater) SetLogger(logger *slog.Logger) {
+	u.logger = logger
+}
+
+// Apply применяет ответ accrual системы к заказу order в его текущем статусе.
+// Возвращает ErrStatusUnchanged, если статус не изменился, models.ErrIllegalStatusTransition,
+// если переход недопустим, и ErrOrderAlreadyUpdated, если статус заказа успел изменить
+// другой обработчик. Начисление по обработанному заказу зачисляется на баланс хранилищем
+func (u *AccrualUpdater) Apply(ctx context.Context, order models.Order, response *AccrualOrderResponse) error {
+	// Переводим статус accrual системы в статус заказа
+	newStatus, err := models.OrderStatusFromAccrual(response.Status)
+	if err != nil {
+		return err
+	}
+
+	// Проверяем, изменился ли статус
+	if newStatus == order.Status {
+		return ErrStatusUnchanged
+	}
+
+	if !models.CanTransition(order.Status, newStatus) {
+		return fmt.Errorf("%w: %s -> %s", models.ErrIllegalStatusTransition, order.Status, newStatus)
+	}
+
+	u.logger.Info("Статус заказа изменился",
+		"order_id", order.OrderID,
+		"old_status", order.Status,
+		"new_status", newStatus)
+
+	// Сумма начисления уже разобрана из ответа, доли копейки отброшены (округление вниз)
+	var accrualValue money.Amount
+	if response.Accrual != nil {
+		accrualValue = *response.Accrual
+	}
+
+	// Обновляем статус и значение заказа в базе данных
+	err = u.orderRepo.UpdateOrderStatusAndValue(ctx, order.OrderID, newStatus, accrualValue)
+	if err != nil {
+		if errors.Is(err, models.ErrIllegalStatusTransition) {
+			return fmt.Errorf("%w: %v", ErrOrderAlreadyUpdated, err)
+		}
+		return fmt.Errorf("ошибка при обновлении статуса заказа: %w", err)
+	}
+
+	u.logger.Info("Заказ успешно обновлен",
+		"order_id", order.OrderID,
+		"status", newStatus,
+		"accrual_value", accrualValue)
+
+	return nil
+}
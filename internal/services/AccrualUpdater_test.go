@@ -0,0 +1,107 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/paxren/go-musthave-diploma-tpl/internal/models"
+	"github.com/paxren/go-musthave-diploma-tpl/internal/money"
+)
+
+// racingOrderRepo имитирует другой экземпляр, изменивший статус заказа между чтением и обновлением
+type racingOrderRepo struct {
+	*fakeOrderRepo
+}
+
+func (r racingOrderRepo) UpdateOrderStatusAndValue(ctx context.Context, orderID, status string, value money.Amount) error {
+	return models.ErrIllegalStatusTransition
+}
+
+func TestAccrualUpdater_Apply(t *testing.T) {
+	accrual := money.FromKopecks(50050)
+
+	tests := []struct {
+		name           string
+		status         string
+		response       AccrualOrderResponse
+		racing         bool
+		expectedErr    error
+		expectedStatus string
+		expectedValue  money.Amount
+	}{
+		{
+			name:           "Заказ обработан",
+			status:         models.OrderStatusProcessing,
+			response:       AccrualOrderResponse{Status: AccrualStatusProcessed, Accrual: &accrual},
+			expectedStatus: models.OrderStatusProcessed,
+			expectedValue:  50050,
+		},
+		{
+			name:           "Заказ зарегистрирован в accrual системе",
+			status:         models.OrderStatusNew,
+			response:       AccrualOrderResponse{Status: AccrualStatusRegistered},
+			expectedStatus: models.OrderStatusProcessing,
+		},
+		{
+			name:           "Заказ отклонен",
+			status:         models.OrderStatusNew,
+			response:       AccrualOrderResponse{Status: AccrualStatusInvalid},
+			expectedStatus: models.OrderStatusInvalid,
+		},
+		{
+			name:           "Статус не изменился",
+			status:         models.OrderStatusProcessing,
+			response:       AccrualOrderResponse{Status: AccrualStatusProcessing},
+			expectedErr:    ErrStatusUnchanged,
+			expectedStatus: models.OrderStatusProcessing,
+		},
+		{
+			name:           "Возврат из конечного статуса",
+			status:         models.OrderStatusProcessed,
+			response:       AccrualOrderResponse{Status: AccrualStatusProcessing},
+			expectedErr:    models.ErrIllegalStatusTransition,
+			expectedStatus: models.OrderStatusProcessed,
+		},
+		{
+			name:           "Неизвестный статус",
+			status:         models.OrderStatusNew,
+			response:       AccrualOrderResponse{Status: "UNKNOWN"},
+			expectedErr:    models.ErrUnknownAccrualStatus,
+			expectedStatus: models.OrderStatusNew,
+		},
+		{
+			name:           "Статус уже изменен другим обработчиком",
+			status:         models.OrderStatusNew,
+			response:       AccrualOrderResponse{Status: AccrualStatusProcessing},
+			racing:         true,
+			expectedErr:    ErrOrderAlreadyUpdated,
+			expectedStatus: models.OrderStatusNew,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newFakeOrderRepo(models.Order{OrderID: testOrderNumber, Type: models.OrderType, Status: tt.status})
+			updater := NewAccrualUpdater(repo)
+			if tt.racing {
+				updater = NewAccrualUpdater(racingOrderRepo{repo})
+			}
+
+			response := tt.response
+			response.Order = testOrderNumber
+			err := updater.Apply(context.Background(), repo.order(testOrderNumber), &response)
+
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			order := repo.order(testOrderNumber)
+			assert.Equal(t, tt.expectedStatus, order.Status)
+			assert.Equal(t, tt.expectedValue, order.Value)
+		})
+	}
+}
@@ -1,12 +1,15 @@
 package services
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/paxren/go-musthave-diploma-tpl/internal/models"
@@ -16,24 +19,61 @@ import (
 
 // AccrualOrderResponse представляет ответ от accrual системы
 type AccrualOrderResponse struct {
-	Order   string   `json:"order"`
-	Status  string   `json:"status"`
-	Accrual *float64 `json:"accrual,omitempty"`
+	Order   string        `json:"order"`
+	Status  string        `json:"status"`
+	Accrual *money.Amount `json:"accrual,omitempty"`
+}
+
+// UnmarshalJSON разбирает ответ accrual системы. Начисление может быть рассчитано точнее копейки
+// (6.1725) или записано с погрешностью float64 (729.9800000000001), поэтому доли копейки
+// отбрасываются так же, как в accrual.Calculate, а не считаются ошибкой
+func (r *AccrualOrderResponse) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Order   string          `json:"order"`
+		Status  string          `json:"status"`
+		Accrual json.RawMessage `json:"accrual"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	*r = AccrualOrderResponse{Order: raw.Order, Status: raw.Status}
+	if len(raw.Accrual) == 0 || string(raw.Accrual) == "null" {
+		return nil
+	}
+
+	accrual, err := money.UnmarshalAmountFloor(raw.Accrual)
+	if err != nil {
+		return fmt.Errorf("начисление заказа %s: %w", raw.Order, err)
+	}
+	r.Accrual = &accrual
+	return nil
 }
 
 // Константы для статусов accrual системы
 const (
-	AccrualStatusRegistered = "REGISTERED"
-	AccrualStatusInvalid    = "INVALID"
-	AccrualStatusProcessing = "PROCESSING"
-	AccrualStatusProcessed  = "PROCESSED"
+	AccrualStatusRegistered = models.AccrualStatusRegistered
+	AccrualStatusInvalid    = models.AccrualStatusInvalid
+	AccrualStatusProcessing = models.AccrualStatusProcessing
+	AccrualStatusProcessed  = models.AccrualStatusProcessed
+)
+
+// defaultRetryAfter пауза после ответа 429 без заголовка Retry-After
+const defaultRetryAfter = 60 * time.Second
+
+// Параметры повторных попыток запроса информации о заказе
+const (
+	maxRetries     = 3
+	baseRetryDelay = 1 * time.Second
 )
 
 // AccrualClient представляет клиент для взаимодействия с системой расчёта баллов
 type AccrualClient struct {
-	baseURL    string
-	httpClient *http.Client
-	logger     *slog.Logger
+	baseURL     string
+	httpClient  *http.Client
+	logger      *slog.Logger
+	rateLimiter *RateLimiter
+	retryDelay  time.Duration // задержка перед второй попыткой, далее удваивается
 }
 
 // NewAccrualClient создает новый экземпляр AccrualClient
@@ -43,7 +83,9 @@ func NewAccrualClient(baseURL string) *AccrualClient {
 		httpClient: &http.Client{
 			Timeout: 30 * time.Second,
 		},
-		logger: slog.New(slog.NewJSONHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelInfo})), // По умолчанию без логирования
+		logger:      slog.New(slog.NewJSONHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelInfo})), // По умолчанию без логирования
+		rateLimiter: NewRateLimiter(),
+		retryDelay:  baseRetryDelay,
 	}
 }
 
@@ -52,41 +94,50 @@ func (c *AccrualClient) SetLogger(logger *slog.Logger) {
 	c.logger = logger
 }
 
-// GetOrderInfo получает информацию о заказе из системы accrual с механизмом повторных попыток
-func (c *AccrualClient) GetOrderInfo(orderNumber string) (*AccrualOrderResponse, error) {
-	const maxRetries = 3
-	const baseRetryDelay = 1 * time.Second
+// RetryBudget возвращает суммарное ожидание между попытками GetOrderInfo.
+// Цикл опроса короче этого времени прерывал бы повторные попытки, не дав им завершиться
+func (c *AccrualClient) RetryBudget() time.Duration {
+	var budget time.Duration
+	for attempt := 1; attempt < maxRetries; attempt++ {
+		budget += c.retryDelay * time.Duration(1<<uint(attempt-1))
+	}
+	return budget
+}
 
+// GetOrderInfo получает информацию о заказе из системы accrual с механизмом повторных попыток.
+// Отмена контекста прерывает как текущий запрос, так и ожидание между попытками
+func (c *AccrualClient) GetOrderInfo(ctx context.Context, orderNumber string) (*AccrualOrderResponse, error) {
 	var lastErr error
 
 	for attempt := 0; attempt < maxRetries; attempt++ {
 		if attempt > 0 {
 			// Экспоненциальный backoff с jitter
-			delay := baseRetryDelay * time.Duration(1<<uint(attempt-1))
+			delay := c.retryDelay * time.Duration(1<<uint(attempt-1))
 			c.logger.Info("Повторная попытка запроса заказа",
 				"order_number", orderNumber,
 				"attempt", attempt+1,
 				"max_attempts", maxRetries,
 				"delay", delay)
-			time.Sleep(delay)
+			if err := sleepContext(ctx, delay); err != nil {
+				return nil, err
+			}
 		}
 
-		response, err := c.getOrderInfoOnce(orderNumber)
+		response, err := c.getOrderInfoOnce(ctx, orderNumber)
 		if err == nil {
 			return response, nil
 		}
 
 		lastErr = err
 
-		// Если это ошибка ограничения частоты запросов, пробуем повторить
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		// При ограничении частоты ограничитель уже приостановил все запросы клиента,
+		// следующая попытка дождется окончания паузы
 		if isRateLimitError(err) {
-			// Извлекаем время ожидания из ошибки, если возможно
-			if retryAfter := extractRetryAfter(err); retryAfter > 0 {
-				c.logger.Info("Ожидание перед повторной попыткой из-за ограничения частоты",
-					"retry_after_seconds", retryAfter)
-				time.Sleep(time.Duration(retryAfter) * time.Second)
-				continue
-			}
+			continue
 		}
 
 		// Для других ошибок не повторяем, кроме последней попытки
@@ -99,19 +150,29 @@ func (c *AccrualClient) GetOrderInfo(orderNumber string) (*AccrualOrderResponse,
 }
 
 // getOrderInfoOnce выполняет один запрос к accrual системе
-func (c *AccrualClient) getOrderInfoOnce(orderNumber string) (*AccrualOrderResponse, error) {
+func (c *AccrualClient) getOrderInfoOnce(ctx context.Context, orderNumber string) (*AccrualOrderResponse, error) {
 	url := fmt.Sprintf("%s/api/orders/%s", c.baseURL, orderNumber)
 
 	c.logger.Info("Запрос информации о заказе из accrual системы",
 		"order_number", orderNumber,
 		"url", url)
 
-	resp, err := c.httpClient.Get(url)
+	// Ждем разрешения общего для всех горутин ограничителя
+	if err := c.rateLimiter.Wait(ctx); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при создании запроса: %w", err)
+	}
+
+	resp, err := c.httpClient.Do(req)
 	if err != nil {
 		c.logger.Error("Ошибка при выполнении запроса к accrual системе",
 			"error", err,
 			"order_number", orderNumber)
-		return nil, fmt.Errorf("ошибка при выполнении запроса: %w", err)
+		return nil, fmt.Errorf("%w: ошибка при выполнении запроса: %v", ErrAccrualUnavailable, err)
 	}
 	defer resp.Body.Close()
 
@@ -134,103 +195,75 @@ func (c *AccrualClient) getOrderInfoOnce(orderNumber string) (*AccrualOrderRespo
 
 	case http.StatusNoContent:
 		c.logger.Info("Заказ не найден в accrual системе", "order_number", orderNumber)
-		return nil, fmt.Errorf("заказ не найден в accrual системе")
+		return nil, ErrOrderNotRegistered
 
 	case http.StatusTooManyRequests:
-		// Получаем заголовок Retry-After если он есть
-		retryAfter := resp.Header.Get("Retry-After")
-		if retryAfter != "" {
-			if seconds, err := strconv.Atoi(retryAfter); err == nil {
-				c.logger.Warn("Превышен лимит запросов к accrual системе",
-					"retry_after_seconds", seconds,
-					"order_number", orderNumber)
-				return nil, fmt.Errorf("превышен лимит запросов, повтор через %d секунд", seconds)
+		retryAfter := defaultRetryAfter
+		if header := resp.Header.Get("Retry-After"); header != "" {
+			if seconds, err := strconv.Atoi(header); err == nil && seconds >= 0 {
+				retryAfter = time.Duration(seconds) * time.Second
 			}
 		}
+
+		// Запоминаем допустимый темп запросов, если accrual система его сообщила
+		if body, err := io.ReadAll(resp.Body); err == nil {
+			if rpm, ok := parseRequestsPerMinute(string(body)); ok {
+				c.rateLimiter.SetRequestsPerMinute(rpm)
+				c.logger.Info("Установлен лимит запросов к accrual системе",
+					"requests_per_minute", rpm)
+			}
+		}
+
+		// Приостанавливаем все исходящие запросы клиента до истечения Retry-After
+		c.rateLimiter.PauseFor(retryAfter)
+
 		c.logger.Warn("Превышен лимит запросов к accrual системе",
+			"retry_after", retryAfter,
 			"order_number", orderNumber)
-		return nil, fmt.Errorf("превышен лимит запросов к accrual системе")
-
-	case http.StatusInternalServerError:
-		c.logger.Error("Внутренняя ошибка сервера accrual системы",
-			"order_number", orderNumber,
-			"status_code", resp.StatusCode)
-		return nil, fmt.Errorf("внутренняя ошибка сервера accrual системы")
+		return nil, &RateLimitError{RetryAfter: retryAfter}
 
 	default:
+		if resp.StatusCode >= http.StatusInternalServerError {
+			c.logger.Error("Внутренняя ошибка сервера accrual системы",
+				"order_number", orderNumber,
+				"status_code", resp.StatusCode)
+			return nil, fmt.Errorf("%w: код ответа %d", ErrAccrualUnavailable, resp.StatusCode)
+		}
+
 		c.logger.Error("Неожиданный статус код от accrual системы",
 			"order_number", orderNumber,
 			"status_code", resp.StatusCode)
-		return nil, fmt.Errorf("неожиданный статус код: %d", resp.StatusCode)
-	}
-}
-
-// isRateLimitError проверяет, является ли ошибка ошибкой ограничения частоты запросов
-func isRateLimitError(err error) bool {
-	return err != nil && (containsString(err.Error(), "превышен лимит запросов") ||
-		containsString(err.Error(), "too many requests"))
-}
-
-// isRetryableError проверяет, можно ли повторить запрос при данной ошибке
-func isRetryableError(err error) bool {
-	if err == nil {
-		return false
-	}
-
-	errStr := err.Error()
-	return containsString(errStr, "ошибка при выполнении запроса") ||
-		containsString(errStr, "внутренняя ошибка сервера") ||
-		isRateLimitError(err)
-}
-
-// extractRetryAfter извлекает время ожидания из ошибки ограничения частоты запросов
-func extractRetryAfter(err error) int {
-	if err == nil {
-		return 0
-	}
-
-	errStr := err.Error()
-	// Ищем паттерн "повтор через X секунд"
-	if idx := findSubstring(errStr, "повтор через "); idx != -1 {
-		remaining := errStr[idx+len("повтор через "):]
-		if spaceIdx := findSubstring(remaining, " "); spaceIdx != -1 {
-			secondsStr := remaining[:spaceIdx]
-			if seconds, parseErr := strconv.Atoi(secondsStr); parseErr == nil {
-				return seconds
-			}
-		}
+		return nil, &UnexpectedStatusError{StatusCode: resp.StatusCode}
 	}
-
-	return 0
-}
-
-// containsString проверяет, содержит ли строка подстроку (без учета регистра)
-func containsString(s, substr string) bool {
-	return len(s) >= len(substr) &&
-		(s == substr ||
-			len(s) > len(substr) &&
-				(s[:len(substr)] == substr ||
-					s[len(s)-len(substr):] == substr ||
-					findSubstring(s, substr) != -1))
 }
 
-// findSubstring находит индекс подстроки в строке
-func findSubstring(s, substr string) int {
-	for i := 0; i <= len(s)-len(substr); i++ {
-		if s[i:i+len(substr)] == substr {
-			return i
-		}
-	}
-	return -1
-}
+// Параметры опроса по умолчанию
+const (
+	DefaultPollInterval   = 1 * time.Second
+	DefaultPollWorkers    = 10
+	DefaultPollBatchSize  = 100
+	DefaultBackoffMax     = 5 * time.Minute
+	DefaultGiveUpAttempts = 20
+	// DefaultPollTickTimeout предельное время цикла опроса и срок аренды захваченных в нем заказов.
+	// Больше интервала опроса, чтобы в цикл укладывались повторные попытки запроса к accrual системе
+	DefaultPollTickTimeout = 15 * time.Second
+)
 
 // AccrualPollingService представляет сервис для периодического опроса статусов заказов
 type AccrualPollingService struct {
 	accrualClient *AccrualClient
 	orderRepo     repository.OrderBase
+	updater       *AccrualUpdater
 	logger        *slog.Logger
 	ticker        *time.Ticker
 	done          chan bool
+	interval      time.Duration
+	tickTimeout   time.Duration
+	workers       int
+	batchSize     int
+	backoffBase   time.Duration
+	backoffMax    time.Duration
+	giveUp        int
 }
 
 // NewAccrualPollingService создает новый экземпляр AccrualPollingService
@@ -238,29 +271,99 @@ func NewAccrualPollingService(accrualClient *AccrualClient, orderRepo repository
 	return &AccrualPollingService{
 		accrualClient: accrualClient,
 		orderRepo:     orderRepo,
+		updater:       NewAccrualUpdater(orderRepo),
 		logger:        slog.New(slog.NewJSONHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelInfo})), // По умолчанию без логирования
 		done:          make(chan bool),
+		interval:      DefaultPollInterval,
+		tickTimeout:   DefaultPollTickTimeout,
+		workers:       DefaultPollWorkers,
+		batchSize:     DefaultPollBatchSize,
+		backoffBase:   DefaultPollInterval,
+		backoffMax:    DefaultBackoffMax,
+		giveUp:        DefaultGiveUpAttempts,
+	}
+}
+
+// SetWorkers устанавливает количество параллельных обработчиков заказов
+func (s *AccrualPollingService) SetWorkers(workers int) {
+	if workers < 1 {
+		workers = 1
+	}
+	s.workers = workers
+}
+
+// SetBatchSize устанавливает максимальное количество заказов, захватываемых за один цикл
+func (s *AccrualPollingService) SetBatchSize(batchSize int) {
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	s.batchSize = batchSize
+}
+
+// SetBackoff устанавливает начальную и максимальную задержку повторного опроса заказа.
+// Задержка удваивается с каждым опросом, не изменившим статус заказа
+func (s *AccrualPollingService) SetBackoff(base, max time.Duration) {
+	if base <= 0 {
+		base = s.interval
+	}
+	if max < base {
+		max = base
+	}
+	s.backoffBase = base
+	s.backoffMax = max
+}
+
+// SetGiveUpAttempts устанавливает количество опросов, после которого заказ,
+// так и не зарегистрированный в accrual системе, помечается как INVALID.
+// Значение 0 отключает отказ от опроса
+func (s *AccrualPollingService) SetGiveUpAttempts(attempts int) {
+	if attempts < 0 {
+		attempts = 0
+	}
+	s.giveUp = attempts
+}
+
+// SetTickTimeout устанавливает предельное время одного цикла опроса, оно же срок аренды
+// захваченных в цикле заказов. По истечении этого времени новые заказы в обработку не берутся,
+// а незавершенные запросы цикла прерываются. Время, не превышающее RetryBudget клиента,
+// увеличивается до RetryBudget с запасом в один интервал опроса, иначе повторные попытки
+// не успевали бы завершиться
+func (s *AccrualPollingService) SetTickTimeout(timeout time.Duration) {
+	if timeout <= 0 {
+		timeout = DefaultPollTickTimeout
 	}
+	if budget := s.accrualClient.RetryBudget(); timeout <= budget {
+		s.logger.Warn("Время цикла опроса не превышает время повторных попыток, оно увеличено",
+			"tick_timeout", timeout,
+			"retry_budget", budget)
+		timeout = budget + s.interval
+	}
+	s.tickTimeout = timeout
 }
 
 // SetLogger устанавливает slog логгер для сервиса опроса
 func (s *AccrualPollingService) SetLogger(logger *slog.Logger) {
 	s.logger = logger
 	s.accrualClient.SetLogger(logger)
+	s.updater.SetLogger(logger)
 }
 
-// Start запускает сервис опроса статусов
-func (s *AccrualPollingService) Start() {
+// Start запускает сервис опроса статусов. Опрос прекращается при отмене ctx или вызове Stop,
+// отмена ctx также прерывает запросы к accrual системе и базе данных текущего цикла
+func (s *AccrualPollingService) Start(ctx context.Context) {
 	s.logger.Info("Запуск сервиса опроса статусов заказов")
 
-	// Создаем тикер с интервалом 1 секунды
-	s.ticker = time.NewTicker(1 * time.Second)
+	// Создаем тикер с интервалом опроса
+	s.ticker = time.NewTicker(s.interval)
 
 	go func() {
 		for {
 			select {
 			case <-s.ticker.C:
-				s.pollOrders()
+				s.pollOrders(ctx)
+			case <-ctx.Done():
+				s.logger.Info("Остановка сервиса опроса статусов заказов по отмене контекста")
+				return
 			case <-s.done:
 				s.logger.Info("Остановка сервиса опроса статусов заказов")
 				return
@@ -284,12 +387,18 @@ func (s *AccrualPollingService) Stop() {
 }
 
 // pollOrders выполняет опрос заказов со статусами NEW и PROCESSING
-func (s *AccrualPollingService) pollOrders() {
+func (s *AccrualPollingService) pollOrders(ctx context.Context) {
 	s.logger.Debug("Начало опроса статусов заказов")
 
-	// Получаем заказы со статусами NEW и PROCESSING
+	// Ограничиваем цикл опроса по времени. Циклы не накладываются: следующий начнется
+	// по тикеру после завершения этого, пропущенные за это время срабатывания тикера теряются
+	ctx, cancel := context.WithTimeout(ctx, s.tickTimeout)
+	defer cancel()
+
+	// Захватываем пачку заказов со статусами NEW и PROCESSING. Аренда длится столько же,
+	// сколько цикл: после его окончания незавершенные заказы снова доступны любому экземпляру
 	statuses := []string{models.OrderStatusNew, models.OrderStatusProcessing}
-	orders, err := s.orderRepo.GetOrdersWithStatuses(statuses)
+	orders, err := s.orderRepo.ClaimOrdersWithStatuses(ctx, statuses, s.batchSize, s.tickTimeout)
 	if err != nil {
 		s.logger.Error("Ошибка при получении заказов для опроса", "error", err)
 		return
@@ -300,73 +409,186 @@ func (s *AccrualPollingService) pollOrders() {
 		return
 	}
 
-	s.logger.Info("Найдено заказов для опроса", "count", len(orders))
+	s.logger.Info("Найдено заказов для опроса", "count", len(orders), "workers", s.workers)
+
+	workers := s.workers
+	if workers > len(orders) {
+		workers = len(orders)
+	}
+
+	// Раздаем заказы пулу обработчиков, чтобы медленный заказ не задерживал остальные
+	jobs := make(chan models.Order)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for order := range jobs {
+				s.processOrder(ctx, order)
+			}
+		}()
+	}
 
-	// Обрабатываем каждый заказ
+	dispatched := 0
+dispatch:
 	for _, order := range orders {
-		s.processOrder(order)
+		select {
+		case jobs <- order:
+			dispatched++
+		case <-ctx.Done():
+			s.logger.Warn("Истекло время цикла опроса, оставшиеся заказы перенесены на следующий цикл",
+				"dispatched", dispatched,
+				"skipped", len(orders)-dispatched)
+			break dispatch
+		}
 	}
+	close(jobs)
+	wg.Wait()
 
-	s.logger.Debug("Завершение опроса статусов заказов")
+	s.logger.Debug("Завершение опроса статусов заказов", "dispatched", dispatched)
 }
 
 // processOrder обрабатывает один заказ
-func (s *AccrualPollingService) processOrder(order models.Order) {
+func (s *AccrualPollingService) processOrder(ctx context.Context, order models.Order) {
 	s.logger.Info("Обработка заказа",
 		"order_id", order.OrderID,
 		"status", order.Status)
 
 	// Получаем информацию о заказе из accrual системы
-	accrualResponse, err := s.accrualClient.GetOrderInfo(order.OrderID)
+	accrualResponse, err := s.accrualClient.GetOrderInfo(ctx, order.OrderID)
 	if err != nil {
-		s.logger.Error("Ошибка при получении информации о заказе",
-			"error", err,
-			"order_id", order.OrderID)
+		var rateLimitErr *RateLimitError
+		var statusErr *UnexpectedStatusError
+		switch {
+		case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+			s.logger.Debug("Опрос заказа прерван",
+				"error", err,
+				"order_id", order.OrderID)
+		case errors.Is(err, ErrOrderNotRegistered):
+			// Отказываемся только после серии ответов 204 подряд: сбои accrual системы
+			// между ними счетчик сбрасывают и не приближают отказ
+			if s.giveUp > 0 && order.Status == models.OrderStatusNew && order.NotRegisteredPolls+1 >= s.giveUp {
+				s.giveUpOrder(ctx, order)
+				return
+			}
+			// Заказ еще не попал в accrual систему, опросим его позже
+			s.logger.Debug("Заказ еще не зарегистрирован в accrual системе",
+				"order_id", order.OrderID,
+				"not_registered", order.NotRegisteredPolls+1)
+			s.postponeNotRegisteredOrder(ctx, order)
+		case errors.As(err, &rateLimitErr):
+			// Паузу держит общий ограничитель клиента, расписание заказа не трогаем
+			s.logger.Warn("Опрос заказа отложен из-за ограничения частоты запросов",
+				"order_id", order.OrderID,
+				"retry_after", rateLimitErr.RetryAfter)
+		case errors.Is(err, ErrAccrualUnavailable):
+			s.logger.Warn("Accrual система недоступна",
+				"error", err,
+				"order_id", order.OrderID)
+			s.postponeOrder(ctx, order)
+		case errors.As(err, &statusErr):
+			s.logger.Error("Accrual система вернула неожиданный код ответа",
+				"status_code", statusErr.StatusCode,
+				"order_id", order.OrderID)
+			s.postponeOrder(ctx, order)
+		default:
+			s.logger.Error("Ошибка при получении информации о заказе",
+				"error", err,
+				"order_id", order.OrderID)
+			s.postponeOrder(ctx, order)
+		}
 		return
 	}
 
-	// Проверяем, изменился ли статус
-	if accrualResponse.Status == order.Status {
+	err = s.updater.Apply(ctx, order, accrualResponse)
+	switch {
+	case err == nil:
+	case errors.Is(err, ErrOrderAlreadyUpdated):
+		// Статус заказа уже изменил другой экземпляр, опрашивать его больше не нужно
+		s.logger.Warn("Статус заказа уже изменен",
+			"error", err,
+			"order_id", order.OrderID)
+	case errors.Is(err, ErrStatusUnchanged):
 		s.logger.Debug("Статус заказа не изменился",
 			"order_id", order.OrderID,
 			"status", order.Status)
-		return
+		s.postponeOrder(ctx, order)
+	case errors.Is(err, models.ErrUnknownAccrualStatus):
+		s.logger.Error("Неизвестный статус от accrual системы",
+			"error", err,
+			"order_id", order.OrderID)
+		s.postponeOrder(ctx, order)
+	case errors.Is(err, models.ErrIllegalStatusTransition):
+		s.logger.Warn("Недопустимый переход статуса заказа",
+			"error", err,
+			"order_id", order.OrderID)
+		s.postponeOrder(ctx, order)
+	default:
+		s.logger.Error("Ошибка при обновлении статуса заказа",
+			"error", err,
+			"order_id", order.OrderID,
+			"status", accrualResponse.Status)
+		s.postponeOrder(ctx, order)
 	}
+}
 
-	s.logger.Info("Статус заказа изменился",
-		"order_id", order.OrderID,
-		"old_status", order.Status,
-		"new_status", accrualResponse.Status)
-
-	// Определяем значение для начисления (конвертируем из рублей в копейки)
-	var accrualValue uint64 = 0
-	if accrualResponse.Accrual != nil {
-		// Accrual возвращает сумму в рублях, конвертируем в копейки для хранения в БД
-		// Используем безопасную конвертацию с проверкой на переполнение
-		var err error
-		accrualValue, err = money.AccrualToKopecks(*accrualResponse.Accrual)
-		if err != nil {
-			s.logger.Error("Ошибка при конвертации суммы начисления",
-				"error", err,
-				"order_id", order.OrderID,
-				"accrual", *accrualResponse.Accrual)
-			return
-		}
+// backoffDelay вычисляет задержку следующего опроса заказа по количеству предыдущих попыток
+func (s *AccrualPollingService) backoffDelay(attempts int) time.Duration {
+	delay := s.backoffBase
+	for i := 0; i < attempts && delay < s.backoffMax; i++ {
+		delay *= 2
+	}
+	if delay > s.backoffMax {
+		delay = s.backoffMax
 	}
+	return delay
+}
+
+// postponeOrder переносит следующий опрос заказа с экспоненциальной задержкой
+// и сбрасывает счетчик ответов "не зарегистрирован"
+func (s *AccrualPollingService) postponeOrder(ctx context.Context, order models.Order) {
+	s.postpone(ctx, order, false)
+}
+
+// postponeNotRegisteredOrder переносит опрос заказа, который accrual система не знает,
+// и увеличивает счетчик таких ответов подряд
+func (s *AccrualPollingService) postponeNotRegisteredOrder(ctx context.Context, order models.Order) {
+	s.postpone(ctx, order, true)
+}
 
-	// Обновляем статус и значение заказа в базе данных
-	err = s.orderRepo.UpdateOrderStatusAndValue(order.OrderID, accrualResponse.Status, accrualValue)
+// postpone переносит следующий опрос заказа с экспоненциальной задержкой
+func (s *AccrualPollingService) postpone(ctx context.Context, order models.Order, notRegistered bool) {
+	delay := s.backoffDelay(order.PollAttempts)
+	err := s.orderRepo.PostponeOrderPoll(ctx, order.OrderID, order.LeaseToken, delay, notRegistered)
+	if errors.Is(err, repository.ErrLeaseLost) {
+		// Цикл пережил аренду, заказом уже занимается другой обработчик
+		s.logger.Warn("Аренда заказа потеряна, опрос не перенесен",
+			"order_id", order.OrderID)
+		return
+	}
 	if err != nil {
-		s.logger.Error("Ошибка при обновлении статуса заказа",
+		s.logger.Error("Ошибка при переносе опроса заказа",
 			"error", err,
-			"order_id", order.OrderID,
-			"status", accrualResponse.Status,
-			"accrual_value", accrualValue)
+			"order_id", order.OrderID)
+		return
+	}
+
+	s.logger.Debug("Опрос заказа перенесен",
+		"order_id", order.OrderID,
+		"attempts", order.PollAttempts+1,
+		"delay", delay)
+}
+
+// giveUpOrder помечает заказ, так и не зарегистрированный в accrual системе, как INVALID
+func (s *AccrualPollingService) giveUpOrder(ctx context.Context, order models.Order) {
+	if err := s.orderRepo.UpdateOrderStatusAndValue(ctx, order.OrderID, models.OrderStatusInvalid, 0); err != nil {
+		s.logger.Error("Ошибка при отказе от опроса заказа",
+			"error", err,
+			"order_id", order.OrderID)
 		return
 	}
 
-	s.logger.Info("Заказ успешно обновлен",
+	s.logger.Warn("Заказ не зарегистрирован в accrual системе, опрос прекращен",
 		"order_id", order.OrderID,
-		"status", accrualResponse.Status,
-		"accrual_value", accrualValue)
+		"not_registered", order.NotRegisteredPolls+1)
 }
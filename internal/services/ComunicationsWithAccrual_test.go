@@ -0,0 +1,455 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/paxren/go-musthave-diploma-tpl/internal/accrualtest"
+	"github.com/paxren/go-musthave-diploma-tpl/internal/models"
+	"github.com/paxren/go-musthave-diploma-tpl/internal/money"
+	"github.com/paxren/go-musthave-diploma-tpl/internal/repository"
+)
+
+const testOrderNumber = "79927398713"
+
+// newTestAccrualClient создает клиент поддельной accrual системы с поддельными часами
+// ограничителя, чтобы паузы Retry-After не замедляли тесты
+func newTestAccrualClient(server *accrualtest.Server) (*AccrualClient, *fakeClock) {
+	limiter, clock := newTestRateLimiter()
+	client := NewAccrualClient(server.URL)
+	client.rateLimiter = limiter
+	client.retryDelay = time.Millisecond
+	return client, clock
+}
+
+func TestAccrualClient_GetOrderInfo(t *testing.T) {
+	accrual := money.FromKopecks(72998)
+
+	tests := []struct {
+		name     string
+		steps    []accrualtest.Step
+		expected *AccrualOrderResponse
+		checkErr func(t *testing.T, err error)
+		requests int
+		slept    []time.Duration
+	}{
+		{
+			name:     "Заказ обработан",
+			steps:    []accrualtest.Step{accrualtest.Processed("729.98")},
+			expected: &AccrualOrderResponse{Order: testOrderNumber, Status: AccrualStatusProcessed, Accrual: &accrual},
+			requests: 1,
+		},
+		{
+			name:     "Заказ в обработке",
+			steps:    []accrualtest.Step{accrualtest.Processing()},
+			expected: &AccrualOrderResponse{Order: testOrderNumber, Status: AccrualStatusProcessing},
+			requests: 1,
+		},
+		{
+			name:  "Заказ не зарегистрирован",
+			steps: []accrualtest.Step{accrualtest.NotRegistered()},
+			checkErr: func(t *testing.T, err error) {
+				assert.ErrorIs(t, err, ErrOrderNotRegistered)
+			},
+			requests: 1,
+		},
+		{
+			name:     "Повтор после ошибок сервера",
+			steps:    []accrualtest.Step{accrualtest.ServerError(), accrualtest.ServerError(), accrualtest.Invalid()},
+			expected: &AccrualOrderResponse{Order: testOrderNumber, Status: AccrualStatusInvalid},
+			requests: 3,
+		},
+		{
+			name:  "Сервер недоступен на всех попытках",
+			steps: []accrualtest.Step{accrualtest.ServerError()},
+			checkErr: func(t *testing.T, err error) {
+				assert.ErrorIs(t, err, ErrAccrualUnavailable)
+			},
+			requests: 3,
+		},
+		{
+			name:     "Повтор после разрыва соединения",
+			steps:    []accrualtest.Step{accrualtest.ConnectionReset(), accrualtest.Registered()},
+			expected: &AccrualOrderResponse{Order: testOrderNumber, Status: AccrualStatusRegistered},
+			requests: 2,
+		},
+		{
+			name:     "Повтор после паузы Retry-After",
+			steps:    []accrualtest.Step{accrualtest.TooManyRequests(5, 600), accrualtest.Processed("729.98")},
+			expected: &AccrualOrderResponse{Order: testOrderNumber, Status: AccrualStatusProcessed, Accrual: &accrual},
+			requests: 2,
+			slept:    []time.Duration{5 * time.Second},
+		},
+		{
+			name:  "Лимит запросов на всех попытках",
+			steps: []accrualtest.Step{accrualtest.TooManyRequests(2, 600)},
+			checkErr: func(t *testing.T, err error) {
+				var rateLimitErr *RateLimitError
+				require.ErrorAs(t, err, &rateLimitErr)
+				assert.Equal(t, 2*time.Second, rateLimitErr.RetryAfter)
+			},
+			requests: 3,
+			slept:    []time.Duration{2 * time.Second, 2 * time.Second},
+		},
+		{
+			name:  "Некорректный JSON не повторяется",
+			steps: []accrualtest.Step{accrualtest.Malformed(), accrualtest.Processing()},
+			checkErr: func(t *testing.T, err error) {
+				assert.Error(t, err)
+				assert.False(t, isRetryableError(err))
+			},
+			requests: 1,
+		},
+		{
+			name:  "Неожиданный код ответа не повторяется",
+			steps: []accrualtest.Step{{Code: 418}, accrualtest.Processing()},
+			checkErr: func(t *testing.T, err error) {
+				var statusErr *UnexpectedStatusError
+				require.ErrorAs(t, err, &statusErr)
+				assert.Equal(t, 418, statusErr.StatusCode)
+			},
+			requests: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := accrualtest.NewServer()
+			defer server.Close()
+			server.Script(testOrderNumber, tt.steps...)
+
+			client, clock := newTestAccrualClient(server)
+
+			response, err := client.GetOrderInfo(context.Background(), testOrderNumber)
+			if tt.checkErr != nil {
+				tt.checkErr(t, err)
+				assert.Nil(t, response)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tt.expected, response)
+			}
+
+			assert.Len(t, server.RequestsFor(testOrderNumber), tt.requests)
+			assert.Equal(t, tt.slept, clock.slept)
+		})
+	}
+}
+
+func TestAccrualClient_LearnsRateLimit(t *testing.T) {
+	server := accrualtest.NewServer()
+	defer server.Close()
+	server.Script(testOrderNumber, accrualtest.TooManyRequests(0, 600), accrualtest.Processing())
+
+	client, _ := newTestAccrualClient(server)
+
+	_, err := client.GetOrderInfo(context.Background(), testOrderNumber)
+	require.NoError(t, err)
+	assert.Equal(t, 100*time.Millisecond, client.rateLimiter.interval)
+}
+
+func TestAccrualClient_ContextTimeout(t *testing.T) {
+	server := accrualtest.NewServer()
+	defer server.Close()
+	server.Script(testOrderNumber, accrualtest.Processing().After(time.Minute))
+
+	client, _ := newTestAccrualClient(server)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := client.GetOrderInfo(ctx, testOrderNumber)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Len(t, server.RequestsFor(testOrderNumber), 1)
+}
+
+// fakeOrderRepo хранит заказы в памяти для тестов сервиса опроса.
+// В отличие от PostgreSQL не учитывает аренду и время следующего опроса:
+// каждый цикл захватывает все незавершенные заказы
+type fakeOrderRepo struct {
+	repository.OrderBase
+
+	mutex     sync.Mutex
+	orders    map[string]*models.Order
+	postponed map[string][]time.Duration
+}
+
+func newFakeOrderRepo(orders ...models.Order) *fakeOrderRepo {
+	repo := &fakeOrderRepo{
+		orders:    make(map[string]*models.Order),
+		postponed: make(map[string][]time.Duration),
+	}
+	for i := range orders {
+		repo.orders[orders[i].OrderID] = &orders[i]
+	}
+	return repo
+}
+
+func (r *fakeOrderRepo) ClaimOrdersWithStatuses(ctx context.Context, statuses []string, limit int, lease time.Duration) ([]models.Order, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	var claimed []models.Order
+	for _, order := range r.orders {
+		for _, status := range statuses {
+			if order.Status == status {
+				claimed = append(claimed, *order)
+				break
+			}
+		}
+	}
+	sort.Slice(claimed, func(i, j int) bool { return claimed[i].OrderID < claimed[j].OrderID })
+	if len(claimed) > limit {
+		claimed = claimed[:limit]
+	}
+	return claimed, nil
+}
+
+func (r *fakeOrderRepo) UpdateOrderStatusAndValue(ctx context.Context, orderID, status string, value money.Amount) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	order, ok := r.orders[orderID]
+	if !ok {
+		return errors.New("заказ не найден")
+	}
+	if !models.CanTransition(order.Status, status) {
+		return models.ErrIllegalStatusTransition
+	}
+	order.Status = status
+	order.Value = value
+	order.PollAttempts = 0
+	return nil
+}
+
+func (r *fakeOrderRepo) PostponeOrderPoll(ctx context.Context, orderID string, leaseToken int64, delay time.Duration, notRegistered bool) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	order, ok := r.orders[orderID]
+	if !ok {
+		return errors.New("заказ не найден")
+	}
+	order.PollAttempts++
+	if notRegistered {
+		order.NotRegisteredPolls++
+	} else {
+		order.NotRegisteredPolls = 0
+	}
+	r.postponed[orderID] = append(r.postponed[orderID], delay)
+	return nil
+}
+
+func (r *fakeOrderRepo) order(orderID string) models.Order {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return *r.orders[orderID]
+}
+
+func TestAccrualPollingService_StateMachine(t *testing.T) {
+	tests := []struct {
+		name        string
+		steps       []accrualtest.Step
+		ticks       int
+		giveUp      int
+		tickTimeout time.Duration
+		status      string
+		value       money.Amount
+		attempts    int
+		requests    int
+	}{
+		{
+			name:     "Полный цикл расчета",
+			steps:    []accrualtest.Step{accrualtest.Registered(), accrualtest.Processing(), accrualtest.Processed("729.98")},
+			ticks:    3,
+			status:   models.OrderStatusProcessed,
+			value:    72998,
+			requests: 3,
+		},
+		{
+			name:     "Начисление точнее копейки округляется вниз",
+			steps:    []accrualtest.Step{accrualtest.Processed("6.1725")},
+			ticks:    1,
+			status:   models.OrderStatusProcessed,
+			value:    617,
+			requests: 1,
+		},
+		{
+			name:     "Погрешность float64 в начислении",
+			steps:    []accrualtest.Step{accrualtest.Processed("729.9800000000001")},
+			ticks:    1,
+			status:   models.OrderStatusProcessed,
+			value:    72998,
+			requests: 1,
+		},
+		{
+			name:     "Повторный статус откладывает опрос",
+			steps:    []accrualtest.Step{accrualtest.Processing(), accrualtest.Processing()},
+			ticks:    3,
+			status:   models.OrderStatusProcessing,
+			attempts: 2,
+			requests: 3,
+		},
+		{
+			name:     "Заказ отклонен",
+			steps:    []accrualtest.Step{accrualtest.Invalid()},
+			ticks:    2,
+			status:   models.OrderStatusInvalid,
+			requests: 1,
+		},
+		{
+			name:     "Отказ от опроса незарегистрированного заказа",
+			steps:    []accrualtest.Step{accrualtest.NotRegistered()},
+			ticks:    5,
+			giveUp:   3,
+			status:   models.OrderStatusInvalid,
+			requests: 3,
+		},
+		{
+			name: "Сбои accrual системы не приближают отказ от опроса",
+			steps: []accrualtest.Step{
+				accrualtest.ServerError(), accrualtest.ServerError(), accrualtest.ServerError(),
+				accrualtest.ServerError(), accrualtest.ServerError(), accrualtest.ServerError(),
+				accrualtest.NotRegistered(),
+				accrualtest.Processed("729.98"),
+			},
+			ticks:    4,
+			giveUp:   3,
+			status:   models.OrderStatusProcessed,
+			value:    72998,
+			requests: 8,
+		},
+		{
+			name:     "Accrual система недоступна",
+			steps:    []accrualtest.Step{accrualtest.ServerError()},
+			ticks:    2,
+			status:   models.OrderStatusNew,
+			attempts: 2,
+			requests: 6,
+		},
+		{
+			name:     "Разрыв соединения не прерывает цикл",
+			steps:    []accrualtest.Step{accrualtest.ConnectionReset(), accrualtest.Processed("100")},
+			ticks:    1,
+			status:   models.OrderStatusProcessed,
+			value:    10000,
+			requests: 2,
+		},
+		{
+			name:     "Некорректный JSON",
+			steps:    []accrualtest.Step{accrualtest.Malformed()},
+			ticks:    1,
+			status:   models.OrderStatusNew,
+			attempts: 1,
+			requests: 1,
+		},
+		{
+			name:     "Неизвестный статус",
+			steps:    []accrualtest.Step{{Status: "UNKNOWN"}},
+			ticks:    1,
+			status:   models.OrderStatusNew,
+			attempts: 1,
+			requests: 1,
+		},
+		{
+			name:     "Ограничение частоты не сдвигает расписание заказа",
+			steps:    []accrualtest.Step{accrualtest.TooManyRequests(1, 60)},
+			ticks:    1,
+			status:   models.OrderStatusNew,
+			requests: 3,
+		},
+		{
+			name:        "Медленный ответ прерывается по окончании цикла",
+			steps:       []accrualtest.Step{accrualtest.Processed("1").After(time.Minute)},
+			ticks:       1,
+			tickTimeout: 50 * time.Millisecond,
+			status:      models.OrderStatusNew,
+			requests:    1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := accrualtest.NewServer()
+			defer server.Close()
+			server.Script(testOrderNumber, tt.steps...)
+
+			client, _ := newTestAccrualClient(server)
+			repo := newFakeOrderRepo(models.Order{
+				OrderID: testOrderNumber,
+				Type:    models.OrderType,
+				Status:  models.OrderStatusNew,
+			})
+
+			service := NewAccrualPollingService(client, repo)
+			service.SetGiveUpAttempts(tt.giveUp)
+			if tt.tickTimeout > 0 {
+				service.SetTickTimeout(tt.tickTimeout)
+			} else {
+				service.SetTickTimeout(10 * time.Second)
+			}
+
+			for i := 0; i < tt.ticks; i++ {
+				service.pollOrders(context.Background())
+			}
+
+			order := repo.order(testOrderNumber)
+			assert.Equal(t, tt.status, order.Status)
+			assert.Equal(t, tt.value, order.Value)
+			assert.Equal(t, tt.attempts, order.PollAttempts)
+			assert.Len(t, server.RequestsFor(testOrderNumber), tt.requests)
+		})
+	}
+}
+
+func TestAccrualPollingService_TickTimeout(t *testing.T) {
+	client := NewAccrualClient("http://localhost")
+	assert.Equal(t, 3*time.Second, client.RetryBudget())
+
+	service := NewAccrualPollingService(client, nil)
+	// Цикл и аренда по умолчанию вмещают все повторные попытки запроса
+	assert.Equal(t, DefaultPollTickTimeout, service.tickTimeout)
+	assert.Greater(t, service.tickTimeout, client.RetryBudget())
+
+	tests := []struct {
+		timeout  time.Duration
+		expected time.Duration
+	}{
+		{0, DefaultPollTickTimeout},
+		{time.Second, 4 * time.Second},
+		{3 * time.Second, 4 * time.Second},
+		{30 * time.Second, 30 * time.Second},
+	}
+
+	for _, tt := range tests {
+		service.SetTickTimeout(tt.timeout)
+		assert.Equal(t, tt.expected, service.tickTimeout, "timeout=%s", tt.timeout)
+	}
+}
+
+func TestAccrualPollingService_BackoffDelay(t *testing.T) {
+	service := NewAccrualPollingService(NewAccrualClient("http://localhost"), nil)
+	service.SetBackoff(time.Second, 10*time.Second)
+
+	tests := []struct {
+		attempts int
+		expected time.Duration
+	}{
+		{0, time.Second},
+		{1, 2 * time.Second},
+		{2, 4 * time.Second},
+		{3, 8 * time.Second},
+		{4, 10 * time.Second},
+		{100, 10 * time.Second},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, service.backoffDelay(tt.attempts), "attempts=%d", tt.attempts)
+	}
+}
@@ -0,0 +1,114 @@
+package services
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// rateLimitBodyPattern разбирает тело ответа 429 accrual системы:
+// "No more than N requests per minute allowed"
+var rateLimitBodyPattern = regexp.MustCompile(`No more than (\d+) requests per minute allowed`)
+
+// RateLimiter общий для всех горутин ограничитель запросов к accrual системе.
+// Хранит момент, до которого запросы приостановлены (Retry-After),
+// и выученный из ответа 429 допустимый темп запросов
+type RateLimiter struct {
+	mutex       sync.Mutex
+	pausedUntil time.Time
+	interval    time.Duration // минимальный интервал между запросами, 0 - без ограничения
+	next        time.Time     // момент, начиная с которого разрешен следующий запрос
+	now         func() time.Time
+	sleep       func(context.Context, time.Duration) error
+}
+
+// NewRateLimiter создает ограничитель без ограничений темпа
+func NewRateLimiter() *RateLimiter {
+	return &RateLimiter{
+		now:   time.Now,
+		sleep: sleepContext,
+	}
+}
+
+// Wait блокирует вызывающую горутину, пока ей не будет разрешено выполнить запрос,
+// или до отмены контекста. Слот занимается только в момент выхода из ожидания,
+// поэтому отмененные ожидания не сдвигают расписание остальных горутин
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	for {
+		l.mutex.Lock()
+		now := l.now()
+		slot := l.next
+		if l.pausedUntil.After(slot) {
+			slot = l.pausedUntil
+		}
+		if !slot.After(now) {
+			l.next = now.Add(l.interval)
+			l.mutex.Unlock()
+			return ctx.Err()
+		}
+		l.mutex.Unlock()
+
+		if err := l.sleep(ctx, slot.Sub(now)); err != nil {
+			return err
+		}
+	}
+}
+
+// PauseFor приостанавливает все запросы на время d
+func (l *RateLimiter) PauseFor(d time.Duration) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	until := l.now().Add(d)
+	if until.After(l.pausedUntil) {
+		l.pausedUntil = until
+	}
+}
+
+// PausedUntil возвращает момент, до которого запросы приостановлены
+func (l *RateLimiter) PausedUntil() time.Time {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.pausedUntil
+}
+
+// SetRequestsPerMinute устанавливает допустимое количество запросов в минуту.
+// Значение 0 снимает ограничение темпа
+func (l *RateLimiter) SetRequestsPerMinute(rpm int) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if rpm <= 0 {
+		l.interval = 0
+		return
+	}
+	l.interval = time.Minute / time.Duration(rpm)
+}
+
+// parseRequestsPerMinute извлекает допустимое количество запросов в минуту из тела ответа 429
+func parseRequestsPerMinute(body string) (int, bool) {
+	match := rateLimitBodyPattern.FindStringSubmatch(body)
+	if match == nil {
+		return 0, false
+	}
+	rpm, err := strconv.Atoi(match[1])
+	if err != nil || rpm <= 0 {
+		return 0, false
+	}
+	return rpm, true
+}
+
+// sleepContext ждет указанное время или отмены контекста
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,127 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeClock подменяет время и сон ограничителя: состоявшийся сон запоминается и сдвигает часы
+type fakeClock struct {
+	current time.Time
+	slept   []time.Duration
+}
+
+func (c *fakeClock) now() time.Time { return c.current }
+
+func (c *fakeClock) sleep(ctx context.Context, d time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c.slept = append(c.slept, d)
+	c.current = c.current.Add(d)
+	return nil
+}
+
+func newTestRateLimiter() (*RateLimiter, *fakeClock) {
+	clock := &fakeClock{current: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+	limiter := NewRateLimiter()
+	limiter.now = clock.now
+	limiter.sleep = clock.sleep
+	return limiter, clock
+}
+
+func TestRateLimiter_NoLimit(t *testing.T) {
+	limiter, clock := newTestRateLimiter()
+
+	assert.NoError(t, limiter.Wait(context.Background()))
+	assert.NoError(t, limiter.Wait(context.Background()))
+
+	assert.Empty(t, clock.slept)
+}
+
+func TestRateLimiter_PauseAppliesToAllCallers(t *testing.T) {
+	limiter, clock := newTestRateLimiter()
+	start := clock.current
+
+	limiter.PauseFor(5 * time.Second)
+	assert.Equal(t, start.Add(5*time.Second), limiter.PausedUntil())
+
+	assert.NoError(t, limiter.Wait(context.Background()))
+	assert.NoError(t, limiter.Wait(context.Background()))
+
+	// Ждет только первый вызов, второй приходит уже после окончания паузы
+	assert.Equal(t, []time.Duration{5 * time.Second}, clock.slept)
+}
+
+func TestRateLimiter_ShorterPauseDoesNotShortenLonger(t *testing.T) {
+	limiter, clock := newTestRateLimiter()
+
+	limiter.PauseFor(10 * time.Second)
+	limiter.PauseFor(2 * time.Second)
+
+	assert.Equal(t, clock.current.Add(10*time.Second), limiter.PausedUntil())
+}
+
+func TestRateLimiter_RequestsPerMinuteSpacesCallers(t *testing.T) {
+	limiter, clock := newTestRateLimiter()
+
+	limiter.SetRequestsPerMinute(60)
+	assert.NoError(t, limiter.Wait(context.Background()))
+	assert.NoError(t, limiter.Wait(context.Background()))
+	assert.NoError(t, limiter.Wait(context.Background()))
+
+	// Первый запрос проходит сразу, следующие ждут по секунде
+	assert.Equal(t, []time.Duration{time.Second, time.Second}, clock.slept)
+}
+
+func TestRateLimiter_WaitCanceled(t *testing.T) {
+	limiter := NewRateLimiter()
+	limiter.PauseFor(time.Hour)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	assert.ErrorIs(t, limiter.Wait(ctx), context.Canceled)
+}
+
+func TestRateLimiter_CanceledWaitKeepsSchedule(t *testing.T) {
+	limiter, clock := newTestRateLimiter()
+	limiter.SetRequestsPerMinute(60)
+	assert.NoError(t, limiter.Wait(context.Background()))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for i := 0; i < 5; i++ {
+		assert.ErrorIs(t, limiter.Wait(ctx), context.Canceled)
+	}
+
+	// Отмененные ожидания не заняли слоты: следующему вызову достаточно одного интервала
+	assert.NoError(t, limiter.Wait(context.Background()))
+	assert.Equal(t, []time.Duration{time.Second}, clock.slept)
+}
+
+func TestParseRequestsPerMinute(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		expected int
+		ok       bool
+	}{
+		{"Ответ accrual системы", "No more than 10 requests per minute allowed", 10, true},
+		{"Текст вокруг лимита", "error: No more than 250 requests per minute allowed\n", 250, true},
+		{"Пустое тело", "", 0, false},
+		{"Другой текст", "Too Many Requests", 0, false},
+		{"Нулевой лимит", "No more than 0 requests per minute allowed", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rpm, ok := parseRequestsPerMinute(tt.body)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.expected, rpm)
+		})
+	}
+}
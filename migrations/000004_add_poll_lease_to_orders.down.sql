@@ -0,0 +1,7 @@
+--
+-- Удаление аренды заказа для опроса accrual системы
+-- Откат миграции добавления колонки poll_lease_until
+DROP INDEX IF EXISTS idx_gophermart_orders_status_lease;
+
+ALTER TABLE gophermart_orders
+DROP COLUMN IF EXISTS poll_lease_until;
@@ -0,0 +1,9 @@
+--
+-- Добавление аренды заказа для опроса accrual системы
+-- Экземпляр gophermart захватывает пачку заказов до poll_lease_until,
+-- остальные экземпляры эти заказы пропускают до истечения аренды
+ALTER TABLE gophermart_orders
+ADD COLUMN poll_lease_until TIMESTAMP NULL;
+
+-- Индекс для выборки заказов, ожидающих опроса
+CREATE INDEX idx_gophermart_orders_status_lease ON gophermart_orders(status, poll_lease_until);
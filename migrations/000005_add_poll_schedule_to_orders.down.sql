@@ -0,0 +1,8 @@
+--
+-- Удаление расписания опроса заказа в accrual системе
+-- Откат миграции добавления колонок next_poll_at и poll_attempts
+DROP INDEX IF EXISTS idx_gophermart_orders_status_next_poll;
+
+ALTER TABLE gophermart_orders
+DROP COLUMN IF EXISTS poll_attempts,
+DROP COLUMN IF EXISTS next_poll_at;
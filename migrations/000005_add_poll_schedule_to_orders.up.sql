@@ -0,0 +1,10 @@
+--
+-- Добавление расписания опроса заказа в accrual системе
+-- next_poll_at - момент, не раньше которого заказ снова будет опрошен,
+-- poll_attempts - количество подряд идущих опросов без изменения статуса
+ALTER TABLE gophermart_orders
+ADD COLUMN next_poll_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+ADD COLUMN poll_attempts INTEGER NOT NULL DEFAULT 0;
+
+-- Индекс для выборки заказов, срок опроса которых наступил
+CREATE INDEX idx_gophermart_orders_status_next_poll ON gophermart_orders(status, next_poll_at);
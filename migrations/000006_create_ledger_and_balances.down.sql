@@ -0,0 +1,5 @@
+--
+-- Удаление леджера движения баллов и таблицы балансов
+-- Откат миграции создания gophermart_ledger и gophermart_balances
+DROP TABLE IF EXISTS gophermart_balances;
+DROP TABLE IF EXISTS gophermart_ledger;
@@ -0,0 +1,44 @@
+--
+-- Создание леджера движения баллов и таблицы балансов
+-- Каждая операция записывается в леджер двумя проводками с противоположными знаками
+-- (двойная запись), текущий баланс пользователя хранится отдельной строкой
+-- и обновляется в той же транзакции, что и проводки.
+-- Старый код мог списать больше, чем было начислено, поэтому перенесенный баланс
+-- бывает отрицательным. Ограничение current >= 0 здесь не создается: его добавляет сервис
+-- при запуске (ensureBalanceCheck), когда отрицательных балансов не осталось
+CREATE TABLE gophermart_ledger (
+    id BIGSERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES gophermart_users(id) ON DELETE CASCADE,
+    order_id VARCHAR(255) NOT NULL REFERENCES gophermart_orders(id) ON DELETE CASCADE,
+    account VARCHAR(20) NOT NULL CHECK (account IN ('ACCRUAL', 'USER', 'WITHDRAWAL')),
+    amount BIGINT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT uq_gophermart_ledger_order_account UNIQUE (order_id, account)
+);
+
+CREATE INDEX idx_gophermart_ledger_user_id ON gophermart_ledger(user_id);
+
+CREATE TABLE gophermart_balances (
+    user_id INTEGER PRIMARY KEY REFERENCES gophermart_users(id) ON DELETE CASCADE,
+    current BIGINT NOT NULL DEFAULT 0,
+    withdrawn BIGINT NOT NULL DEFAULT 0 CHECK (withdrawn >= 0),
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Перенос уже накопленной истории в леджер
+INSERT INTO gophermart_ledger (user_id, order_id, account, amount, created_at)
+SELECT user_id, id, 'ACCRUAL', -value, updated_at FROM gophermart_orders WHERE type = 'ORDER' AND value > 0
+UNION ALL
+SELECT user_id, id, 'USER', value, updated_at FROM gophermart_orders WHERE type = 'ORDER' AND value > 0
+UNION ALL
+SELECT user_id, id, 'USER', -value, created_at FROM gophermart_orders WHERE type = 'WITHDRAW' AND value > 0
+UNION ALL
+SELECT user_id, id, 'WITHDRAWAL', value, created_at FROM gophermart_orders WHERE type = 'WITHDRAW' AND value > 0;
+
+-- Расчет балансов по перенесенной истории
+INSERT INTO gophermart_balances (user_id, current, withdrawn)
+SELECT user_id,
+       COALESCE(SUM(CASE WHEN account = 'USER' THEN amount ELSE 0 END), 0),
+       COALESCE(SUM(CASE WHEN account = 'WITHDRAWAL' THEN amount ELSE 0 END), 0)
+FROM gophermart_ledger
+GROUP BY user_id;
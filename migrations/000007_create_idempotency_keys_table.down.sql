@@ -0,0 +1,4 @@
+--
+-- Удаление таблицы ключей идемпотентности
+-- Откат миграции создания таблицы gophermart_idempotency_keys
+DROP TABLE IF EXISTS gophermart_idempotency_keys;
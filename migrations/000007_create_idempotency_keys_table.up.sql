@@ -0,0 +1,14 @@
+--
+-- Создание таблицы ключей идемпотентности
+-- Хранит хеш запроса и сохраненный ответ, чтобы повтор запроса с тем же
+-- заголовком Idempotency-Key вернул исходный ответ, а не выполнился повторно.
+-- status_code = NULL означает, что запрос с этим ключом еще выполняется
+CREATE TABLE gophermart_idempotency_keys (
+    user_id INTEGER NOT NULL REFERENCES gophermart_users(id) ON DELETE CASCADE,
+    key VARCHAR(255) NOT NULL,
+    request_hash VARCHAR(64) NOT NULL,
+    status_code INTEGER NULL,
+    response_body BYTEA NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, key)
+);
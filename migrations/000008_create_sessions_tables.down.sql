@@ -0,0 +1,5 @@
+--
+-- Удаление таблиц сессий и отозванных токенов
+-- Откат миграции создания gophermart_sessions и gophermart_revoked_tokens
+DROP TABLE IF EXISTS gophermart_revoked_tokens;
+DROP TABLE IF EXISTS gophermart_sessions;
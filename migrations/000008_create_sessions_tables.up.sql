@@ -0,0 +1,22 @@
+--
+-- Создание таблиц сессий и отозванных токенов
+-- Сессия хранит хеш refresh токена, по которому выдаются новые access токены.
+-- Отзыв сессии делает недействительными все ее access токены,
+-- отзыв отдельного access токена выполняется по его идентификатору (jti)
+CREATE TABLE gophermart_sessions (
+    id VARCHAR(64) PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES gophermart_users(id) ON DELETE CASCADE,
+    refresh_token_hash VARCHAR(64) UNIQUE NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_gophermart_sessions_user_id ON gophermart_sessions(user_id);
+
+CREATE TABLE gophermart_revoked_tokens (
+    jti VARCHAR(64) PRIMARY KEY,
+    expires_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_gophermart_revoked_tokens_expires_at ON gophermart_revoked_tokens(expires_at);
@@ -0,0 +1,4 @@
+--
+-- Удаление таблицы неудачных попыток входа
+-- Откат миграции создания gophermart_login_attempts
+DROP TABLE IF EXISTS gophermart_login_attempts;
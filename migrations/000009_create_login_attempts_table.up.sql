@@ -0,0 +1,13 @@
+--
+-- Создание таблицы неудачных попыток входа
+-- Счетчики ведутся отдельно по логину и по IP адресу клиента (subject_type = 'login' | 'ip').
+-- После порога неудачных попыток субъект блокируется до locked_until,
+-- каждая следующая неудачная попытка удваивает время блокировки
+CREATE TABLE gophermart_login_attempts (
+    subject_type VARCHAR(8) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    failures INTEGER NOT NULL DEFAULT 0,
+    locked_until TIMESTAMP NULL,
+    last_failure_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (subject_type, subject)
+);
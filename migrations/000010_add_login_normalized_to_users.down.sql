@@ -0,0 +1,5 @@
+--
+-- Удаление нормализованного логина пользователя
+-- Откат миграции добавления login_normalized в gophermart_users
+DROP INDEX IF EXISTS idx_gophermart_users_login_normalized;
+ALTER TABLE gophermart_users DROP COLUMN IF EXISTS login_normalized;
@@ -0,0 +1,11 @@
+--
+-- Добавление нормализованного логина пользователя
+-- Приложение ищет пользователей по login_normalized: логин без пробелов по краям,
+-- в форме NFC и со сверткой регистра. Уникальный индекс не дает завести логины,
+-- отличающиеся только регистром или пробелами.
+-- Свертку регистра Unicode нельзя точно повторить в SQL, поэтому существующие логины
+-- заполняет сервис при запуске (backfillLoginNormalized) той же функцией models.NormalizeLogin,
+-- что и при регистрации, после чего колонка становится NOT NULL
+ALTER TABLE gophermart_users ADD COLUMN login_normalized VARCHAR(255);
+
+CREATE UNIQUE INDEX idx_gophermart_users_login_normalized ON gophermart_users(login_normalized);
@@ -0,0 +1,4 @@
+--
+-- Удаление индекса постраничной выдачи заказов
+-- Откат миграции 000011
+DROP INDEX IF EXISTS idx_gophermart_orders_user_type_created;
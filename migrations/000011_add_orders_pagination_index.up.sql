@@ -0,0 +1,5 @@
+--
+-- Индекс для постраничной выдачи заказов и списаний пользователя
+-- Страницы отсчитываются от курсора по паре (created_at, id) внутри типа заказа,
+-- индекс покрывает и фильтр, и сортировку в обоих направлениях
+CREATE INDEX idx_gophermart_orders_user_type_created ON gophermart_orders(user_id, type, created_at, id);
@@ -0,0 +1,7 @@
+--
+-- Удаление времени обработки заказа
+-- Откат миграции 000012: даты снова хранятся без часового пояса
+ALTER TABLE gophermart_orders
+    DROP COLUMN IF EXISTS processed_at,
+    ALTER COLUMN created_at TYPE TIMESTAMP,
+    ALTER COLUMN updated_at TYPE TIMESTAMP;
@@ -0,0 +1,15 @@
+--
+-- Время обработки заказа и даты с часовым поясом
+-- created_at и updated_at переводятся в TIMESTAMPTZ, существующие значения
+-- считаются заданными в часовом поясе сессии базы данных.
+-- processed_at - время перехода заказа в конечный статус (PROCESSED или INVALID),
+-- для уже обработанных заказов заполняется временем последнего обновления,
+-- для списаний - временем создания
+ALTER TABLE gophermart_orders
+    ALTER COLUMN created_at TYPE TIMESTAMPTZ,
+    ALTER COLUMN updated_at TYPE TIMESTAMPTZ,
+    ADD COLUMN processed_at TIMESTAMPTZ NULL;
+
+UPDATE gophermart_orders
+SET processed_at = CASE WHEN type = 'WITHDRAW' THEN created_at ELSE updated_at END
+WHERE status IN ('PROCESSED', 'INVALID');
@@ -0,0 +1,4 @@
+--
+-- Удаление счетчика ответов "заказ не зарегистрирован"
+-- Откат миграции 000013
+ALTER TABLE gophermart_orders DROP COLUMN IF EXISTS not_registered_polls;
@@ -0,0 +1,7 @@
+--
+-- Счетчик ответов accrual системы "заказ не зарегистрирован"
+-- not_registered_polls - количество подряд идущих ответов 204. В отличие от poll_attempts,
+-- ошибки accrual системы и другие ответы его сбрасывают, поэтому от опроса заказа
+-- отказываются только после серии ответов 204 подряд
+ALTER TABLE gophermart_orders
+ADD COLUMN not_registered_polls INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,4 @@
+--
+-- Удаление номера аренды заказа
+-- Откат миграции 000014
+ALTER TABLE gophermart_orders DROP COLUMN IF EXISTS poll_lease_token;
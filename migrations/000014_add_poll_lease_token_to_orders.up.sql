@@ -0,0 +1,7 @@
+--
+-- Номер аренды заказа для опроса
+-- poll_lease_token увеличивается при каждом захвате заказа. Опрос откладывается,
+-- только если номер совпадает с полученным при захвате и аренда не истекла:
+-- обработчик, переживший свою аренду, не меняет заказ, перехваченный другим экземпляром
+ALTER TABLE gophermart_orders
+ADD COLUMN poll_lease_token BIGINT NOT NULL DEFAULT 0;
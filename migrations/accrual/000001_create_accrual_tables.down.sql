@@ -0,0 +1,4 @@
+--
+-- Удаление таблиц системы расчета начислений (accrual)
+DROP TABLE IF EXISTS accrual_orders;
+DROP TABLE IF EXISTS accrual_mechanics;
@@ -0,0 +1,23 @@
+--
+-- Создание таблиц системы расчета начислений (accrual)
+-- Таблицы с префиксом accrual_, чтобы сервис мог работать в одной базе с gophermart.
+-- Цены и вознаграждения хранятся как NUMERIC без потери точности,
+-- начисление - в копейках
+CREATE TABLE accrual_mechanics (
+    match VARCHAR(255) PRIMARY KEY,
+    reward NUMERIC NOT NULL CHECK (reward >= 0),
+    reward_type VARCHAR(2) NOT NULL CHECK (reward_type IN ('%', 'pt')),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE accrual_orders (
+    number VARCHAR(255) PRIMARY KEY,
+    status VARCHAR(20) NOT NULL CHECK (status IN ('REGISTERED', 'INVALID', 'PROCESSING', 'PROCESSED')),
+    accrual BIGINT NULL CHECK (accrual >= 0),
+    goods JSONB NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Обработчик выбирает заказы по статусу в порядке регистрации
+CREATE INDEX idx_accrual_orders_status_created ON accrual_orders(status, created_at);